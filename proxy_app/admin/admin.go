@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+var adminLog = logger.For("admin")
+
+// ErrNotFound is matched (errors.Is) when requested object does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrInvalidRequest is matched (errors.Is) when operation is not allowed for requested object
+var ErrInvalidRequest = errors.New("invalid request")
+
+// IAdmin operates a proxy, Service works directly against the db and ApiClient against the api of running proxy
+type IAdmin interface {
+	GetOrganizations(ctx context.Context) ([]Organization, error)
+	CreateOrganization(ctx context.Context, organization Organization) (uuid.UUID, error)
+	DeleteOrganization(ctx context.Context, id uuid.UUID) error
+
+	GetWorkgroups(ctx context.Context) ([]Workgroup, error)
+	CreateWorkgroup(ctx context.Context, workgroup Workgroup) (uuid.UUID, error)
+	DeleteWorkgroup(ctx context.Context, id uuid.UUID) error
+
+	GetWorkgroupMembers(ctx context.Context, workgroupId uuid.UUID) ([]WorkgroupMember, error)
+	CreateWorkgroupMember(ctx context.Context, member WorkgroupMember) (uuid.UUID, error)
+	DeleteWorkgroupMember(ctx context.Context, workgroupId uuid.UUID, id uuid.UUID) error
+
+	GetWebhooks(ctx context.Context) ([]Webhook, error)
+	CreateWebhook(ctx context.Context, webhook Webhook) (uuid.UUID, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+
+	// trustmesh with entries and offchain messages, idOrBboid is trustmesh id or business object id of one of its entries
+	GetTrustmesh(ctx context.Context, idOrBboid string) (*types.Trustmesh, error)
+	// looks up transaction of entry on chain and runs business logic for it again, returns entry afterwards
+	RerunEntry(ctx context.Context, entryId uuid.UUID) (*types.TrustmeshEntry, error)
+	// sends offchain message of committed sent suggestion or feedback to its receiver again
+	ResendOffchainMessage(ctx context.Context, entryId uuid.UUID) error
+	// entries in given processing state, i.e. dead entries which need manual intervention
+	GetEntriesByProcessingState(ctx context.Context, processingState string) ([]types.TrustmeshEntry, error)
+	// makes failed or dead entry pending again with no failed attempts, it is processed on next poll
+	RetryEntry(ctx context.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error)
+	// marks entry dead without running business logic, it stays uncommitted
+	SkipEntry(ctx context.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error)
+	// marks entry committed and processed without running business logic
+	ResolveEntry(ctx context.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error)
+	// moves entry whose broadcast recovery found on chain without hash to uncommitted with transaction hash
+	// looked up by operator, commitment is then checked as for every broadcasted entry
+	FinishBroadcast(ctx context.Context, entryId uuid.UUID, transactionHash string, reason string) (*types.TrustmeshEntry, error)
+	// removes entry whose broadcast recovery found on chain without hash together with its offchain message,
+	// the same as when broadcast fails
+	AbandonBroadcast(ctx context.Context, entryId uuid.UUID, reason string) error
+	// checks sync trees of committed entries against proofs stored on chain
+	VerifyTrustmesh(ctx context.Context, idOrBboid string) (*TrustmeshVerification, error)
+	// audit bundle signed by the proxy, it is checked offline with VerifyAuditBundle
+	ExportTrustmesh(ctx context.Context, idOrBboid string) (*SignedAuditBundle, error)
+}
+
+type Organization struct {
+	Id   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+type Workgroup struct {
+	Id   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Key  string    `json:"key"`
+}
+
+type WorkgroupMember struct {
+	Id                   uuid.UUID `json:"id"`
+	WorkgroupId          string    `json:"workgroup_id"`
+	OrganizationId       string    `json:"organization_id"`
+	OrganizationEndpoint string    `json:"organization_endpoint"`
+	OrganizationToken    string    `json:"organization_token"`
+	// hex encoded ed25519 key envelopes of member received over https and amqp are verified with
+	OrganizationPublicKey string `json:"organization_public_key,omitempty"`
+}
+
+// Webhook has the same fields as create sor webhook request of the api
+type Webhook struct {
+	Id              uuid.UUID            `json:"id"`
+	Url             string               `json:"url"`
+	UrlParams       []types.RequestParam `json:"url_params"`
+	HttpMethod      string               `json:"http_method"`
+	WebhookType     types.WebhookType    `json:"webhook_type"`
+	AuthType        types.AuthType       `json:"auth_type"`
+	AuthUsername    string               `json:"auth_username"`
+	AuthPassword    string               `json:"auth_password"`
+	XcsrfUrl        string               `json:"xcsrf_url"`
+	BodyContentType string               `json:"body_content_type"`
+	Body            string               `json:"body"`
+	BodyParams      []types.RequestParam `json:"body_params"`
+}
+
+// InterventionRequest is body of retry, skip and resolve entry requests and of finishing or abandoning broadcasts
+type InterventionRequest struct {
+	Reason string `json:"reason"`
+	// only for finishing broadcast
+	TransactionHash string `json:"transaction_hash,omitempty"`
+}
+
+type EntryVerification struct {
+	EntryId                 uuid.UUID `json:"entry_id"`
+	EntryType               string    `json:"entry_type"`
+	BaseledgerTransactionId uuid.UUID `json:"baseledger_transaction_id"`
+	CommitmentState         string    `json:"commitment_state"`
+	// true if sync tree matches proof on chain
+	Verified bool `json:"verified"`
+	// true if sync tree matches proof of its offchain message in audit bundle, proof on chain was not compared
+	PartiallyVerified bool `json:"partially_verified,omitempty"`
+	// reason why entry is not verified, empty if verified or partially verified
+	Error string `json:"error,omitempty"`
+}
+
+type TrustmeshVerification struct {
+	TrustmeshId uuid.UUID `json:"trustmesh_id"`
+	// true if every committed entry matches proof on chain, uncommitted entries are reported but not checked
+	Verified bool                `json:"verified"`
+	Entries  []EntryVerification `json:"entries"`
+}
+
+// AuditBundle contains everything the proxy knows about a trustmesh, entries with offchain messages and
+// sync trees and their transactions on chain. Root proof is the one stored on ethereum when trustmesh is exited
+type AuditBundle struct {
+	Version        int                `json:"version"`
+	ExportedAt     time.Time          `json:"exported_at"`
+	OrganizationId string             `json:"organization_id"`
+	RootProof      string             `json:"root_proof"`
+	EthExitTxHash  string             `json:"eth_exit_tx_hash"`
+	Trustmesh      types.Trustmesh    `json:"trustmesh"`
+	Transactions   []AuditTransaction `json:"transactions"`
+}
@@ -0,0 +1,500 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	uuid "github.com/kthomas/go.uuid"
+	businesslogic "github.com/unibrightio/proxy-api/business_logic"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/messaging"
+	"github.com/unibrightio/proxy-api/proxyutil"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/synctree"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+const testPrivatizeKey = "6368616e676520746869732070617373776f726420746f206120736563726574"
+const testBusinessObjectJson = `{"orderId":"4711","amount":"10"}`
+const testSigningKey = "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"
+
+type fakeBlockchain struct {
+	transactions map[uuid.UUID]*types.BaseledgerTransactionDto
+}
+
+func (b *fakeBlockchain) SignAndBroadcast(ctx context.Context, payload restutil.SignAndBroadcastPayload) *string {
+	return nil
+}
+
+func (b *fakeBlockchain) GetCommittedBaseledgerTransaction(ctx context.Context, id uuid.UUID) *types.BaseledgerTransactionDto {
+	return b.transactions[id]
+}
+
+type sentMessage struct {
+	recipient string
+	subject   string
+	payload   []byte
+}
+
+type fakeMessaging struct {
+	sent []sentMessage
+}
+
+func (m *fakeMessaging) SendMessage(envelope messaging.Envelope, recipient string, token string) error {
+	m.sent = append(m.sent, sentMessage{recipient: recipient, subject: envelope.Subject, payload: envelope.Payload})
+	return nil
+}
+
+func (m *fakeMessaging) Subscribe(endpoint string, token string, subject string, onEnvelope func(messaging.Envelope)) error {
+	return nil
+}
+
+func (m *fakeMessaging) Drain(ctx context.Context) error {
+	return nil
+}
+
+type fixture struct {
+	service      *Service
+	repositories *repository.Repositories
+	blockchain   *fakeBlockchain
+	messaging    *fakeMessaging
+	rerun        []types.TrustmeshEntry
+	workgroup    *types.Workgroup
+	counterparty uuid.UUID
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{
+		repositories: repository.NewInMemory(),
+		blockchain:   &fakeBlockchain{transactions: map[uuid.UUID]*types.BaseledgerTransactionDto{}},
+		messaging:    &fakeMessaging{},
+		workgroup:    &types.Workgroup{WorkgroupName: "test", PrivatizeKey: testPrivatizeKey},
+		counterparty: uuid.NewV4(),
+	}
+
+	if err := f.repositories.Workgroups.CreateWorkgroup(f.workgroup); err != nil {
+		t.Fatalf("creating workgroup failed %v", err)
+	}
+	err := f.repositories.Workgroups.CreateWorkgroupMember(&types.WorkgroupMember{
+		WorkgroupId:          f.workgroup.Id.String(),
+		OrganizationId:       f.counterparty.String(),
+		OrganizationEndpoint: "counterparty:4222",
+	})
+	if err != nil {
+		t.Fatalf("creating workgroup member failed %v", err)
+	}
+
+	signingKey, _ := ParseSigningKey(testSigningKey)
+	f.service = &Service{
+		OrganizationId: uuid.NewV4().String(),
+		SigningKey:     signingKey,
+		Repositories:   f.repositories,
+		Processor: &businesslogic.Processor{
+			Repositories: f.repositories,
+			Blockchain:   f.blockchain,
+			Messaging:    f.messaging,
+		},
+		Rerun: func(ctx context.Context, entries []types.TrustmeshEntry) {
+			f.rerun = append(f.rerun, entries...)
+		},
+	}
+
+	return f
+}
+
+// createCommittedEntry stores offchain message with sync tree of test business object, committed entry
+// referencing it and transaction on chain holding chainProof or the proof of the business object if empty
+func (f *fixture) createCommittedEntry(t *testing.T, entryType string, bboid string, chainProof string) *types.TrustmeshEntry {
+	syncTree, err := synctree.CreateFromBusinessObjectJson(testBusinessObjectJson, []string{})
+	if err != nil {
+		t.Fatalf("creating sync tree failed %v", err)
+	}
+	syncTreeJson, _ := json.Marshal(syncTree)
+	transactionId := uuid.NewV4()
+
+	offchainMsg := &types.OffchainProcessMessage{
+		SenderId:                             f.counterparty,
+		ReceiverId:                           f.counterparty,
+		BaseledgerSyncTreeJson:               string(syncTreeJson),
+		BusinessObjectProof:                  syncTree.RootProof,
+		BaseledgerBusinessObjectId:           bboid,
+		EntryType:                            entryType,
+		BaseledgerTransactionIdOfStoredProof: transactionId,
+		TendermintTransactionIdOfStoredProof: transactionId,
+	}
+	if err := f.repositories.OffchainMessages.CreateOffchainMessage(offchainMsg); err != nil {
+		t.Fatalf("creating offchain message failed %v", err)
+	}
+
+	entry := &types.TrustmeshEntry{
+		EntryType:                  entryType,
+		SenderOrgId:                f.counterparty,
+		ReceiverOrgId:              f.counterparty,
+		WorkgroupId:                f.workgroup.Id,
+		WorkstepType:               common.WorkstepTypeInitial,
+		BaseledgerTransactionType:  common.BaseledgerTransactionTypeSuggest,
+		BaseledgerTransactionId:    transactionId,
+		TendermintTransactionId:    transactionId,
+		BaseledgerBusinessObjectId: bboid,
+		OffchainProcessMessageId:   offchainMsg.Id,
+		TransactionHash:            "tx-hash-" + transactionId.String(),
+	}
+	if err := f.repositories.TrustmeshEntries.CreateTrustmeshEntry(entry); err != nil {
+		t.Fatalf("creating trustmesh entry failed %v", err)
+	}
+	err = f.repositories.TrustmeshEntries.SetTrustmeshEntryCommitmentState(transactionId, common.CommittedCommitmentState, "42", "2022-06-01T10:00:00.000000000Z")
+	if err != nil {
+		t.Fatalf("committing trustmesh entry failed %v", err)
+	}
+
+	if chainProof == "" {
+		chainProof = syncTree.RootProof
+	}
+	payload := proxyutil.PrivatizeBaseledgerTransactionPayloadForWorkgroup(&types.BaseledgerTransactionPayload{
+		BaseledgerTransactionId: transactionId.String(),
+		Proof:                   chainProof,
+	}, f.workgroup)
+	f.blockchain.transactions[transactionId] = &types.BaseledgerTransactionDto{BaseledgerTransactionId: transactionId.String(), Payload: payload}
+
+	entry.CommitmentState = common.CommittedCommitmentState
+	return entry
+}
+
+func TestGivenBboidOfEntryWhenGetTrustmeshThenTrustmeshOfEntryReturned(t *testing.T) {
+	f := newFixture(t)
+	bboid := uuid.NewV4().String()
+	entry := f.createCommittedEntry(t, common.SuggestionSentTrustmeshEntryType, bboid, "")
+
+	byBboid, err := f.service.GetTrustmesh(context.Background(), bboid)
+	if err != nil {
+		t.Fatalf("getting trustmesh by bboid failed %v", err)
+	}
+	byId, err := f.service.GetTrustmesh(context.Background(), entry.TrustmeshId.String())
+	if err != nil {
+		t.Fatalf("getting trustmesh by id failed %v", err)
+	}
+
+	if byBboid.Id != entry.TrustmeshId || byId.Id != entry.TrustmeshId || len(byBboid.Entries) != 1 {
+		t.Fatalf("expected trustmesh %v with one entry, got %v and %v", entry.TrustmeshId, byBboid.Id, byId.Id)
+	}
+	if byBboid.Entries[0].Workgroup.Id != entry.WorkgroupId || byBboid.Entries[0].Workgroup.PrivatizeKey != "" || byId.Entries[0].Workgroup.PrivatizeKey != "" {
+		t.Fatalf("expected workgroup key to be blanked in trustmesh")
+	}
+}
+
+func TestGivenUnknownIdWhenGetTrustmeshThenNotFound(t *testing.T) {
+	f := newFixture(t)
+
+	_, err := f.service.GetTrustmesh(context.Background(), uuid.NewV4().String())
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestGivenEntriesMatchingProofsOnChainWhenVerifyTrustmeshThenVerified(t *testing.T) {
+	f := newFixture(t)
+	bboid := uuid.NewV4().String()
+	f.createCommittedEntry(t, common.SuggestionSentTrustmeshEntryType, bboid, "")
+
+	verification, err := f.service.VerifyTrustmesh(context.Background(), bboid)
+	if err != nil {
+		t.Fatalf("verifying trustmesh failed %v", err)
+	}
+
+	if !verification.Verified || len(verification.Entries) != 1 || !verification.Entries[0].Verified {
+		t.Fatalf("expected verified trustmesh, got %+v", verification)
+	}
+}
+
+func TestGivenEntryNotMatchingProofOnChainWhenVerifyTrustmeshThenNotVerified(t *testing.T) {
+	f := newFixture(t)
+	bboid := uuid.NewV4().String()
+	f.createCommittedEntry(t, common.SuggestionSentTrustmeshEntryType, bboid, "tampered-proof")
+
+	verification, err := f.service.VerifyTrustmesh(context.Background(), bboid)
+	if err != nil {
+		t.Fatalf("verifying trustmesh failed %v", err)
+	}
+
+	if verification.Verified || verification.Entries[0].Error == "" {
+		t.Fatalf("expected trustmesh not verified, got %+v", verification)
+	}
+}
+
+func TestGivenCommittedSuggestionSentWhenResendOffchainMessageThenMessageSentToReceiver(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createCommittedEntry(t, common.SuggestionSentTrustmeshEntryType, uuid.NewV4().String(), "")
+
+	if err := f.service.ResendOffchainMessage(context.Background(), entry.Id); err != nil {
+		t.Fatalf("resending offchain message failed %v", err)
+	}
+
+	if len(f.messaging.sent) != 1 || f.messaging.sent[0].recipient != "counterparty:4222" || f.messaging.sent[0].subject != common.BaseledgerNatsSubject {
+		t.Fatalf("expected offchain message sent to counterparty, got %+v", f.messaging.sent)
+	}
+	natsMessage := types.NatsMessage{}
+	if err := json.Unmarshal(f.messaging.sent[0].payload, &natsMessage); err != nil || natsMessage.TxHash != entry.TransactionHash {
+		t.Fatalf("expected offchain message of entry, got %v", string(f.messaging.sent[0].payload))
+	}
+}
+
+func TestGivenReceivedSuggestionWhenResendOffchainMessageThenInvalidRequest(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createCommittedEntry(t, common.SuggestionReceivedTrustmeshEntryType, uuid.NewV4().String(), "")
+
+	err := f.service.ResendOffchainMessage(context.Background(), entry.Id)
+
+	if !errors.Is(err, ErrInvalidRequest) || len(f.messaging.sent) != 0 {
+		t.Fatalf("expected invalid request and no message sent, got %v", err)
+	}
+}
+
+func TestGivenEntryWhenRerunEntryThenBusinessLogicRunForStoredEntry(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createCommittedEntry(t, common.SuggestionSentTrustmeshEntryType, uuid.NewV4().String(), "")
+
+	rerun, err := f.service.RerunEntry(context.Background(), entry.Id)
+	if err != nil {
+		t.Fatalf("rerunning entry failed %v", err)
+	}
+
+	if len(f.rerun) != 1 || f.rerun[0].Id != entry.Id || rerun.Id != entry.Id {
+		t.Fatalf("expected business logic rerun for entry %v, got %+v", entry.Id, f.rerun)
+	}
+}
+
+func TestGivenTrustmeshWhenExportTrustmeshThenBundleContainsEntriesAndRootProof(t *testing.T) {
+	f := newFixture(t)
+	bboid := uuid.NewV4().String()
+	f.createCommittedEntry(t, common.SuggestionSentTrustmeshEntryType, bboid, "")
+
+	signed, err := f.service.ExportTrustmesh(context.Background(), bboid)
+	if err != nil {
+		t.Fatalf("exporting trustmesh failed %v", err)
+	}
+	bundle, err := signed.Decode()
+	if err != nil {
+		t.Fatalf("decoding bundle failed %v", err)
+	}
+
+	if bundle.OrganizationId != f.service.OrganizationId || len(bundle.Trustmesh.Entries) != 1 ||
+		bundle.RootProof != synctree.CreateFromTrustmesh(bundle.Trustmesh).RootProof {
+		t.Fatalf("unexpected audit bundle %+v", bundle)
+	}
+	if len(bundle.Transactions) != 1 || bundle.Transactions[0].Payload == "" || bundle.Transactions[0].TendermintBlockHeight != "42" {
+		t.Fatalf("bundle should contain transaction of committed entry, got %+v", bundle.Transactions)
+	}
+}
+
+func TestGivenExportedBundleWhenVerifyAuditBundleThenSignatureRootProofAndChainProofsVerified(t *testing.T) {
+	f := newFixture(t)
+	bboid := uuid.NewV4().String()
+	f.createCommittedEntry(t, common.SuggestionSentTrustmeshEntryType, bboid, "")
+	signed, _ := f.service.ExportTrustmesh(context.Background(), bboid)
+
+	// written to file indented or zipped, bundle still has to match its signature
+	indented, _ := json.MarshalIndent(signed, "", "    ")
+	archive := &bytes.Buffer{}
+	signed.WriteZip(archive)
+	for _, data := range [][]byte{indented, archive.Bytes()} {
+		read, err := ReadSignedAuditBundle(data)
+		if err != nil {
+			t.Fatalf("reading bundle failed %v", err)
+		}
+
+		verification := VerifyAuditBundle(read, signed.PublicKey, testPrivatizeKey)
+		if !verification.Verified || !verification.SignatureVerified || !verification.ChainProofsChecked || len(verification.Entries) != 1 {
+			t.Fatalf("exported bundle should be verified, got %+v", verification)
+		}
+	}
+}
+
+func TestGivenNoExpectedKeyOrNoWorkgroupKeyWhenVerifyAuditBundleThenOnlyPartiallyVerified(t *testing.T) {
+	f := newFixture(t)
+	bboid := uuid.NewV4().String()
+	f.createCommittedEntry(t, common.SuggestionSentTrustmeshEntryType, bboid, "")
+	signed, _ := f.service.ExportTrustmesh(context.Background(), bboid)
+
+	// key embedded in the bundle signed it, anybody could have
+	verification := VerifyAuditBundle(signed, "", testPrivatizeKey)
+	if verification.Verified || !verification.PartiallyVerified || verification.SignerChecked || !verification.Entries[0].Verified {
+		t.Fatalf("bundle without expected key should be partially verified, got %+v", verification)
+	}
+
+	// entries only match proofs of offchain messages in the bundle
+	verification = VerifyAuditBundle(signed, signed.PublicKey, "")
+	if verification.Verified || !verification.PartiallyVerified || !verification.SignerChecked || verification.Entries[0].Verified || !verification.Entries[0].PartiallyVerified {
+		t.Fatalf("bundle without workgroup key should be partially verified, got %+v", verification)
+	}
+}
+
+func TestGivenTamperedBundleOrProofWhenVerifyAuditBundleThenNotVerified(t *testing.T) {
+	f := newFixture(t)
+	bboid := uuid.NewV4().String()
+	f.createCommittedEntry(t, common.SuggestionSentTrustmeshEntryType, bboid, "proof-not-matching-sync-tree")
+	signed, _ := f.service.ExportTrustmesh(context.Background(), bboid)
+
+	verification := VerifyAuditBundle(signed, "", testPrivatizeKey)
+	if verification.Verified || verification.PartiallyVerified || !verification.SignatureVerified || verification.Entries[0].Error != "sync tree does not match proof on chain" {
+		t.Fatalf("entry not matching proof on chain should not be verified, got %+v", verification)
+	}
+
+	tampered := *signed
+	tampered.Bundle = bytes.Replace(signed.Bundle, []byte(bboid), []byte(uuid.NewV4().String()), 1)
+	if verification = VerifyAuditBundle(&tampered, "", ""); verification.SignatureVerified || verification.Error == "" {
+		t.Fatalf("changed bundle should not match signature, got %+v", verification)
+	}
+
+	otherKey, _ := ParseSigningKey(strings.Repeat("ab", 32))
+	if verification = VerifyAuditBundle(signed, hex.EncodeToString(otherKey.Public().(ed25519.PublicKey)), ""); verification.SignatureVerified {
+		t.Fatalf("bundle signed with other than expected key should not be verified")
+	}
+}
+
+func TestGivenApiWhenApiClientCallsThenBasicAuthSentAndErrorStatusMapped(t *testing.T) {
+	organizationId := uuid.NewV4()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "user" || password != "pwd" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/organization":
+			json.NewEncoder(w).Encode([]Organization{{Id: organizationId, Name: "alice"}})
+		case "/admin/entries/" + organizationId.String() + "/resend":
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"message": "not committed"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "trustmesh not found"})
+		}
+	}))
+	defer server.Close()
+	client := NewApiClient(server.URL+"/", "user", "pwd")
+
+	organizations, err := client.GetOrganizations(context.Background())
+	if err != nil || len(organizations) != 1 || organizations[0].Id != organizationId {
+		t.Fatalf("expected organization %v, got %v %v", organizationId, organizations, err)
+	}
+
+	_, err = client.GetTrustmesh(context.Background(), "unknown")
+	if !errors.Is(err, ErrNotFound) || err.Error() != "trustmesh not found" {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	err = client.ResendOffchainMessage(context.Background(), organizationId)
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected invalid request, got %v", err)
+	}
+}
+
+func TestGivenDeadEntryWhenRetryEntryThenEntryPendingWithResolution(t *testing.T) {
+	f := newFixture(t)
+	entry := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), EntryType: common.SuggestionSentTrustmeshEntryType}
+	f.repositories.TrustmeshEntries.CreateTrustmeshEntry(entry)
+	entry.AbandonProcessing("offchain message not found")
+	f.repositories.TrustmeshEntries.UpdateTrustmeshEntryProcessing(entry)
+
+	retried, err := f.service.RetryEntry(context.Background(), entry.Id, "offchain message restored")
+	if err != nil {
+		t.Fatalf("retrying entry failed %v", err)
+	}
+
+	stored, _ := f.repositories.TrustmeshEntries.GetTrustmeshEntryById(entry.Id)
+	if retried.ProcessingState != common.PendingProcessingState || stored.ProcessingState != common.PendingProcessingState || stored.ProcessingAttempts != 0 {
+		t.Fatalf("processing state = %v, want %v", stored.ProcessingState, common.PendingProcessingState)
+	}
+	if stored.ProcessingResolution != "retried: offchain message restored" {
+		t.Fatalf("resolution = %q", stored.ProcessingResolution)
+	}
+}
+
+// createBroadcastingEntry stores entry in PENDING_BROADCAST with broadcasting pending broadcast, unconfirmed
+// if recovery left it to operator
+func (f *fixture) createBroadcastingEntry(t *testing.T, unconfirmed bool) *types.TrustmeshEntry {
+	entry := &types.TrustmeshEntry{
+		BaseledgerTransactionId: uuid.NewV4(),
+		WorkgroupId:             f.workgroup.Id,
+		CommitmentState:         common.PendingBroadcastCommitmentState,
+	}
+	pending := &types.PendingBroadcast{TransactionId: entry.BaseledgerTransactionId}
+	err := f.repositories.PendingBroadcasts.CreatePendingBroadcast(&types.OffchainProcessMessage{}, entry, pending, func(*types.OffchainProcessMessage) string { return "payload" })
+	if err != nil {
+		t.Fatalf("creating pending broadcast failed %v", err)
+	}
+	f.repositories.PendingBroadcasts.MarkBroadcasting(pending)
+	if unconfirmed {
+		f.repositories.PendingBroadcasts.MarkUnconfirmed(pending)
+	}
+	return entry
+}
+
+func TestGivenUnconfirmedBroadcastWhenFinishBroadcastThenEntryUncommittedWithTransactionHash(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createBroadcastingEntry(t, true)
+
+	if _, err := f.service.FinishBroadcast(context.Background(), entry.Id, " ", "found on chain"); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected invalid request without transaction hash, got %v", err)
+	}
+
+	finished, err := f.service.FinishBroadcast(context.Background(), entry.Id, "ABCDEF", "found on chain")
+	if err != nil || finished.CommitmentState != common.UncommittedCommitmentState || finished.TransactionHash != "ABCDEF" {
+		t.Fatalf("expected uncommitted entry with transaction hash, got %+v %v", finished, err)
+	}
+	if _, err := f.repositories.PendingBroadcasts.GetPendingBroadcastByTrustmeshEntryId(entry.Id); err == nil {
+		t.Fatalf("expected pending broadcast to be removed")
+	}
+	if _, err := f.service.FinishBroadcast(context.Background(), entry.Id, "ABCDEF", "again"); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected invalid request for broadcasted entry, got %v", err)
+	}
+}
+
+func TestGivenUnconfirmedOrRecoveredBroadcastWhenAbandonBroadcastThenOnlyUnconfirmedEntryRemoved(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createBroadcastingEntry(t, true)
+	recovered := f.createBroadcastingEntry(t, false)
+
+	if err := f.service.AbandonBroadcast(context.Background(), entry.Id, ""); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected invalid request without reason, got %v", err)
+	}
+	if err := f.service.AbandonBroadcast(context.Background(), recovered.Id, "not ours"); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected invalid request for broadcast still recovered, got %v", err)
+	}
+
+	if err := f.service.AbandonBroadcast(context.Background(), entry.Id, "not ours"); err != nil {
+		t.Fatalf("abandoning broadcast failed %v", err)
+	}
+	if _, err := f.service.getEntry(entry.Id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected abandoned entry to be removed, got %v", err)
+	}
+}
+
+func TestGivenMissingReasonOrCommittedEntryWhenInterveneThenInvalidRequest(t *testing.T) {
+	f := newFixture(t)
+	uncommitted := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4()}
+	f.repositories.TrustmeshEntries.CreateTrustmeshEntry(uncommitted)
+	committed := f.createCommittedEntry(t, common.SuggestionSentTrustmeshEntryType, uuid.NewV4().String(), "")
+
+	if _, err := f.service.SkipEntry(context.Background(), uncommitted.Id, " "); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected invalid request without reason, got %v", err)
+	}
+	if _, err := f.service.ResolveEntry(context.Background(), committed.Id, "done"); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected invalid request for committed entry, got %v", err)
+	}
+
+	resolved, err := f.service.ResolveEntry(context.Background(), uncommitted.Id, "committed on chain manually")
+	if err != nil || resolved.CommitmentState != common.CommittedCommitmentState || resolved.ProcessingState != common.CommittedProcessingState {
+		t.Fatalf("expected committed entry, got %+v %v", resolved, err)
+	}
+}
@@ -0,0 +1,318 @@
+package admin
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/proxyutil"
+	"github.com/unibrightio/proxy-api/synctree"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+// AuditBundleVersion is increased when the bundle format changes in a way verifiers have to know about
+const AuditBundleVersion = 1
+
+// files of zipped audit bundle
+const auditBundleFile = "bundle.json"
+const auditSignatureFile = "signature.json"
+
+// AuditTransaction is transaction of committed entry as stored on chain, payload is encrypted
+// with the workgroup key and holds the proof the sync tree of the entry is checked against
+type AuditTransaction struct {
+	EntryId                        uuid.UUID `json:"entry_id"`
+	BaseledgerTransactionId        uuid.UUID `json:"baseledger_transaction_id"`
+	TendermintTransactionId        uuid.UUID `json:"tendermint_transaction_id"`
+	TendermintBlockHeight          string    `json:"tendermint_block_height"`
+	TendermintTransactionTimestamp time.Time `json:"tendermint_transaction_timestamp"`
+	TransactionHash                string    `json:"transaction_hash"`
+	// empty if transaction could not be fetched from chain during export
+	Payload string `json:"payload"`
+}
+
+// SignedAuditBundle is audit bundle signed by the proxy that exported it. Signature covers compact json
+// of the bundle, which is kept raw so that it is verified without being decoded and encoded again
+type SignedAuditBundle struct {
+	Bundle    json.RawMessage `json:"bundle"`
+	PublicKey string          `json:"public_key"` // hex encoded ed25519 public key
+	Signature string          `json:"signature"`  // hex encoded ed25519 signature
+}
+
+type auditSignature struct {
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+// BundleVerification is result of offline verification of audit bundle
+type BundleVerification struct {
+	TrustmeshId uuid.UUID `json:"trustmesh_id"`
+	// true if signature of expected key, root proof and all committed entries against proofs on chain are verified
+	Verified bool `json:"verified"`
+	// true if bundle only matches itself: signature, root proof and entries match, but signer was not
+	// compared with expected key or sync trees were not compared with proofs on chain
+	PartiallyVerified bool `json:"partially_verified"`
+	SignatureVerified bool `json:"signature_verified"`
+	// signature is made with expected key, without it the key in the bundle signed it, whoever that is
+	SignerChecked     bool `json:"signer_checked"`
+	RootProofVerified bool `json:"root_proof_verified"`
+	// payloads on chain are encrypted with workgroup key, without it sync trees are only checked
+	// against proofs of offchain messages in the bundle
+	ChainProofsChecked bool                `json:"chain_proofs_checked"`
+	Entries            []EntryVerification `json:"entries"`
+	// reason why bundle could not be verified at all
+	Error string `json:"error,omitempty"`
+}
+
+// ParseSigningKey reads ed25519 key from hex encoded seed, see EXPORT_SIGNING_KEY
+func ParseSigningKey(seedHex string) (ed25519.PrivateKey, error) {
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key is not a hex encoded %v byte ed25519 seed", ed25519.SeedSize)
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// SignAuditBundle encodes bundle and signs it with key
+func SignAuditBundle(bundle *AuditBundle, key ed25519.PrivateKey) (*SignedAuditBundle, error) {
+	buf, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedAuditBundle{
+		Bundle:    buf,
+		PublicKey: hex.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: hex.EncodeToString(ed25519.Sign(key, buf)),
+	}, nil
+}
+
+// Decode returns signed bundle, signature is not checked (see VerifyAuditBundle)
+func (s *SignedAuditBundle) Decode() (*AuditBundle, error) {
+	bundle := &AuditBundle{}
+	if err := json.Unmarshal(s.Bundle, bundle); err != nil {
+		return nil, fmt.Errorf("audit bundle can not be read %w", err)
+	}
+
+	return bundle, nil
+}
+
+// WriteZip writes bundle and its signature as separate files of zip archive
+func (s *SignedAuditBundle) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	signature, err := json.MarshalIndent(auditSignature{PublicKey: s.PublicKey, Signature: s.Signature}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	files := []struct {
+		name    string
+		content []byte
+	}{{auditBundleFile, s.Bundle}, {auditSignatureFile, signature}}
+	for _, f := range files {
+		file, err := archive.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err = file.Write(f.content); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// ReadSignedAuditBundle reads bundle exported as json or zip archive
+func ReadSignedAuditBundle(data []byte) (*SignedAuditBundle, error) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		signed := &SignedAuditBundle{}
+		if err := json.Unmarshal(data, signed); err != nil {
+			return nil, fmt.Errorf("audit bundle is neither signed json nor zip archive %w", err)
+		}
+		return signed, nil
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		if file.Name != auditBundleFile && file.Name != auditSignatureFile {
+			continue
+		}
+		content, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+		files[file.Name] = content
+	}
+	if files[auditBundleFile] == nil || files[auditSignatureFile] == nil {
+		return nil, fmt.Errorf("audit bundle archive has to contain %v and %v", auditBundleFile, auditSignatureFile)
+	}
+
+	signature := auditSignature{}
+	if err = json.Unmarshal(files[auditSignatureFile], &signature); err != nil {
+		return nil, fmt.Errorf("%v can not be read %w", auditSignatureFile, err)
+	}
+
+	return &SignedAuditBundle{Bundle: files[auditBundleFile], PublicKey: signature.PublicKey, Signature: signature.Signature}, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+// VerifyAuditBundle checks signature of bundle, root proof of trustmesh and sync trees of committed entries
+// without db or chain access. Signature has to be made with expectedPublicKey if it is given, otherwise any key
+// is accepted and the caller has to compare returned public key with the one published by the exporting organization.
+// Sync trees are checked against proofs in on-chain payloads if workgroupKey is given. Without either key the
+// bundle is only checked against itself and at most partially verified
+func VerifyAuditBundle(signed *SignedAuditBundle, expectedPublicKey string, workgroupKey string) *BundleVerification {
+	verification := &BundleVerification{Entries: []EntryVerification{}}
+
+	if err := verifySignature(signed, expectedPublicKey); err != nil {
+		verification.Error = err.Error()
+		return verification
+	}
+	verification.SignatureVerified = true
+	verification.SignerChecked = expectedPublicKey != ""
+
+	bundle, err := signed.Decode()
+	if err != nil {
+		verification.Error = err.Error()
+		return verification
+	}
+	if bundle.Version > AuditBundleVersion {
+		verification.Error = fmt.Sprintf("audit bundle version %v is newer than supported version %v", bundle.Version, AuditBundleVersion)
+		return verification
+	}
+	verification.TrustmeshId = bundle.Trustmesh.Id
+
+	if workgroupKey != "" {
+		if key, err := hex.DecodeString(workgroupKey); err != nil || (len(key) != 16 && len(key) != 24 && len(key) != 32) {
+			verification.Error = "workgroup key is not a hex encoded aes key"
+			return verification
+		}
+		verification.ChainProofsChecked = true
+	}
+
+	verification.RootProofVerified = synctree.CreateFromTrustmesh(bundle.Trustmesh).RootProof == bundle.RootProof
+	matches := verification.RootProofVerified
+
+	transactions := map[uuid.UUID]AuditTransaction{}
+	for _, transaction := range bundle.Transactions {
+		transactions[transaction.EntryId] = transaction
+	}
+
+	for _, entry := range bundle.Trustmesh.Entries {
+		entryVerification := verifyBundleEntry(entry, transactions[entry.Id], workgroupKey)
+		if entry.CommitmentState == common.CommittedCommitmentState && !entryVerification.Verified && !entryVerification.PartiallyVerified {
+			matches = false
+		}
+		verification.Entries = append(verification.Entries, entryVerification)
+	}
+
+	verification.Verified = matches && verification.SignerChecked && verification.ChainProofsChecked
+	verification.PartiallyVerified = matches && !verification.Verified
+	return verification
+}
+
+func verifySignature(signed *SignedAuditBundle, expectedPublicKey string) error {
+	if expectedPublicKey != "" && expectedPublicKey != signed.PublicKey {
+		return fmt.Errorf("audit bundle is signed with key %v, not %v", signed.PublicKey, expectedPublicKey)
+	}
+
+	publicKey, err := hex.DecodeString(signed.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("public key of audit bundle is invalid")
+	}
+	// bundle is signed compact, indentation added when it is written to file is not part of its content
+	compact := &bytes.Buffer{}
+	if err = json.Compact(compact, signed.Bundle); err != nil {
+		return errors.New("audit bundle is not valid json")
+	}
+	signature, err := hex.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(publicKey, compact.Bytes(), signature) {
+		return errors.New("signature of audit bundle does not match its content")
+	}
+
+	return nil
+}
+
+func verifyBundleEntry(entry types.TrustmeshEntry, transaction AuditTransaction, workgroupKey string) EntryVerification {
+	verification := EntryVerification{
+		EntryId:                 entry.Id,
+		EntryType:               entry.EntryType,
+		BaseledgerTransactionId: entry.BaseledgerTransactionId,
+		CommitmentState:         entry.CommitmentState,
+	}
+	if entry.CommitmentState != common.CommittedCommitmentState {
+		verification.Error = "entry is not committed"
+		return verification
+	}
+
+	offchainMessage := entry.OffchainProcessMessage
+	proof := offchainMessage.BusinessObjectProof
+	if workgroupKey != "" {
+		if transaction.Payload == "" {
+			verification.Error = "transaction not found in bundle"
+			return verification
+		}
+
+		payload, err := readChainPayload(transaction.Payload, workgroupKey)
+		if err != nil {
+			verification.Error = "transaction payload can not be read with workgroup key"
+			return verification
+		}
+		proof = payload.Proof
+	}
+
+	if !synctree.VerifyHashMatch(proof, offchainMessage.BusinessObjectProof, offchainMessage.BaseledgerSyncTreeJson) {
+		verification.Error = "sync tree does not match proof on chain"
+		if workgroupKey == "" {
+			verification.Error = "sync tree does not match proof of offchain message"
+		}
+		return verification
+	}
+
+	// proof of offchain message is part of the bundle, matching it only shows the bundle is consistent
+	verification.Verified = workgroupKey != ""
+	verification.PartiallyVerified = workgroupKey == ""
+	return verification
+}
+
+// readChainPayload decrypts payload stored on chain, decryption panics on malformed payloads
+// which must not stop verification of the other entries
+func readChainPayload(encrypted string, workgroupKey string) (payload *types.BaseledgerTransactionPayload, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			payload, err = nil, fmt.Errorf("payload can not be decrypted %v", r)
+		}
+	}()
+
+	deprivatized := proxyutil.DeprivatizeBaseledgerTransactionPayloadForWorkgroup(encrypted, &types.Workgroup{PrivatizeKey: workgroupKey})
+	payload = &types.BaseledgerTransactionPayload{}
+	if err = json.Unmarshal([]byte(deprivatized), payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,269 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+// ApiClient operates a running proxy through its api using basic auth
+type ApiClient struct {
+	Url        string
+	User       string
+	Password   string
+	HttpClient *http.Client
+}
+
+// NewApiClient returns client of proxy api at url, i.e. http://localhost:8081
+func NewApiClient(url string, user string, password string) *ApiClient {
+	return &ApiClient{
+		Url:        strings.TrimSuffix(url, "/"),
+		User:       user,
+		Password:   password,
+		HttpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type createWorkgroupRequest struct {
+	Id           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	PrivatizeKey string    `json:"privatize_key"`
+}
+
+// create organization and workgroup respond with stored object
+type createdObject struct {
+	Id uuid.UUID
+}
+
+func (a *ApiClient) GetOrganizations(ctx context.Context) ([]Organization, error) {
+	organizations := []Organization{}
+	err := a.do(ctx, http.MethodGet, "/organization", nil, &organizations)
+	return organizations, err
+}
+
+func (a *ApiClient) CreateOrganization(ctx context.Context, organization Organization) (uuid.UUID, error) {
+	created := createdObject{}
+	err := a.do(ctx, http.MethodPost, "/organization", organization, &created)
+	return created.Id, err
+}
+
+func (a *ApiClient) DeleteOrganization(ctx context.Context, id uuid.UUID) error {
+	return a.do(ctx, http.MethodDelete, "/organization/"+id.String(), nil, nil)
+}
+
+func (a *ApiClient) GetWorkgroups(ctx context.Context) ([]Workgroup, error) {
+	workgroups := []Workgroup{}
+	err := a.do(ctx, http.MethodGet, "/workgroup", nil, &workgroups)
+	return workgroups, err
+}
+
+func (a *ApiClient) CreateWorkgroup(ctx context.Context, workgroup Workgroup) (uuid.UUID, error) {
+	created := createdObject{}
+	req := createWorkgroupRequest{Id: workgroup.Id, Name: workgroup.Name, PrivatizeKey: workgroup.Key}
+	err := a.do(ctx, http.MethodPost, "/workgroup", req, &created)
+	return created.Id, err
+}
+
+func (a *ApiClient) DeleteWorkgroup(ctx context.Context, id uuid.UUID) error {
+	return a.do(ctx, http.MethodDelete, "/workgroup/"+id.String(), nil, nil)
+}
+
+func (a *ApiClient) GetWorkgroupMembers(ctx context.Context, workgroupId uuid.UUID) ([]WorkgroupMember, error) {
+	members := []WorkgroupMember{}
+	err := a.do(ctx, http.MethodGet, "/workgroup/"+workgroupId.String()+"/participation", nil, &members)
+	return members, err
+}
+
+func (a *ApiClient) CreateWorkgroupMember(ctx context.Context, member WorkgroupMember) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := a.do(ctx, http.MethodPost, "/workgroup/"+url.PathEscape(member.WorkgroupId)+"/participation", member, &id)
+	return id, err
+}
+
+func (a *ApiClient) DeleteWorkgroupMember(ctx context.Context, workgroupId uuid.UUID, id uuid.UUID) error {
+	return a.do(ctx, http.MethodDelete, "/workgroup/"+workgroupId.String()+"/participation/"+id.String(), nil, nil)
+}
+
+func (a *ApiClient) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := a.do(ctx, http.MethodGet, "/sorwebhook", nil, &webhooks)
+	return webhooks, err
+}
+
+func (a *ApiClient) CreateWebhook(ctx context.Context, webhook Webhook) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := a.do(ctx, http.MethodPost, "/sorwebhook", webhook, &id)
+	return id, err
+}
+
+func (a *ApiClient) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	return a.do(ctx, http.MethodDelete, "/sorwebhook/"+id.String(), nil, nil)
+}
+
+func (a *ApiClient) GetTrustmesh(ctx context.Context, idOrBboid string) (*types.Trustmesh, error) {
+	trustmesh := &types.Trustmesh{}
+	err := a.do(ctx, http.MethodGet, "/admin/trustmeshes/"+url.PathEscape(idOrBboid), nil, trustmesh)
+	if err != nil {
+		return nil, err
+	}
+
+	return trustmesh, nil
+}
+
+func (a *ApiClient) RerunEntry(ctx context.Context, entryId uuid.UUID) (*types.TrustmeshEntry, error) {
+	entry := &types.TrustmeshEntry{}
+	err := a.do(ctx, http.MethodPost, "/admin/entries/"+entryId.String()+"/rerun", nil, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (a *ApiClient) ResendOffchainMessage(ctx context.Context, entryId uuid.UUID) error {
+	return a.do(ctx, http.MethodPost, "/admin/entries/"+entryId.String()+"/resend", nil, nil)
+}
+
+func (a *ApiClient) GetEntriesByProcessingState(ctx context.Context, processingState string) ([]types.TrustmeshEntry, error) {
+	entries := []types.TrustmeshEntry{}
+	err := a.do(ctx, http.MethodGet, "/admin/entries?processing_state="+url.QueryEscape(processingState), nil, &entries)
+	return entries, err
+}
+
+func (a *ApiClient) RetryEntry(ctx context.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error) {
+	return a.intervene(ctx, entryId, "retry", reason)
+}
+
+func (a *ApiClient) SkipEntry(ctx context.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error) {
+	return a.intervene(ctx, entryId, "skip", reason)
+}
+
+func (a *ApiClient) ResolveEntry(ctx context.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error) {
+	return a.intervene(ctx, entryId, "resolve", reason)
+}
+
+func (a *ApiClient) FinishBroadcast(ctx context.Context, entryId uuid.UUID, transactionHash string, reason string) (*types.TrustmeshEntry, error) {
+	entry := &types.TrustmeshEntry{}
+	req := InterventionRequest{Reason: reason, TransactionHash: transactionHash}
+	err := a.do(ctx, http.MethodPost, "/admin/entries/"+entryId.String()+"/finish-broadcast", req, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (a *ApiClient) AbandonBroadcast(ctx context.Context, entryId uuid.UUID, reason string) error {
+	return a.do(ctx, http.MethodPost, "/admin/entries/"+entryId.String()+"/abandon-broadcast", InterventionRequest{Reason: reason}, nil)
+}
+
+func (a *ApiClient) intervene(ctx context.Context, entryId uuid.UUID, action string, reason string) (*types.TrustmeshEntry, error) {
+	entry := &types.TrustmeshEntry{}
+	err := a.do(ctx, http.MethodPost, "/admin/entries/"+entryId.String()+"/"+action, InterventionRequest{Reason: reason}, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (a *ApiClient) VerifyTrustmesh(ctx context.Context, idOrBboid string) (*TrustmeshVerification, error) {
+	verification := &TrustmeshVerification{}
+	err := a.do(ctx, http.MethodGet, "/admin/trustmeshes/"+url.PathEscape(idOrBboid)+"/verify", nil, verification)
+	if err != nil {
+		return nil, err
+	}
+
+	return verification, nil
+}
+
+func (a *ApiClient) ExportTrustmesh(ctx context.Context, idOrBboid string) (*SignedAuditBundle, error) {
+	bundle := &SignedAuditBundle{}
+	err := a.do(ctx, http.MethodGet, "/admin/trustmeshes/"+url.PathEscape(idOrBboid)+"/export", nil, bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+// do sends request with body encoded as json and decodes response into out if it is not nil,
+// 404 responses are returned as ErrNotFound and 400 and 422 as ErrInvalidRequest
+func (a *ApiClient) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.Url+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(a.User, a.Password)
+
+	res, err := a.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		message := responseErrorMessage(res, resBody)
+		switch res.StatusCode {
+		case http.StatusNotFound:
+			return notFound("%v", message)
+		case http.StatusBadRequest, http.StatusUnprocessableEntity:
+			return invalidRequest("%v", message)
+		default:
+			return fmt.Errorf("%v %v failed: %v", method, path, message)
+		}
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.Unmarshal(resBody, out)
+}
+
+// error responses are {"message": "..."}, plain json strings or empty
+func responseErrorMessage(res *http.Response, body []byte) string {
+	var errorResponse struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if json.Unmarshal(body, &errorResponse) == nil {
+		if errorResponse.Message != "" {
+			return errorResponse.Message
+		}
+		if errorResponse.Error != "" {
+			return errorResponse.Error
+		}
+	}
+
+	var message string
+	if json.Unmarshal(body, &message) == nil && message != "" {
+		return message
+	}
+
+	return res.Status
+}
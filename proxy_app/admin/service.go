@@ -0,0 +1,597 @@
+package admin
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/kthomas/go.uuid"
+	businesslogic "github.com/unibrightio/proxy-api/business_logic"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/config"
+	"github.com/unibrightio/proxy-api/cron"
+	"github.com/unibrightio/proxy-api/dbutil"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/messaging"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/synctree"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+type adminError struct {
+	message string
+	kind    error
+}
+
+func (e *adminError) Error() string {
+	return e.message
+}
+
+func (e *adminError) Is(target error) bool {
+	return target == e.kind
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &adminError{message: fmt.Sprintf(format, args...), kind: ErrNotFound}
+}
+
+func invalidRequest(format string, args ...interface{}) error {
+	return &adminError{message: fmt.Sprintf(format, args...), kind: ErrInvalidRequest}
+}
+
+// Service operates proxy directly against the db, organizations, workgroups, members and webhooks
+// are managed the same way as by the api handlers, trustmeshes through repositories and business logic processor
+type Service struct {
+	OrganizationId string
+	// audit bundles are signed with it, nil if EXPORT_SIGNING_KEY is not configured
+	SigningKey   ed25519.PrivateKey
+	Repositories *repository.Repositories
+	Processor    *businesslogic.Processor
+	// looks up transactions of entries on chain and runs business logic for them
+	Rerun func(ctx context.Context, entries []types.TrustmeshEntry)
+}
+
+// NewService returns service of configured organization using postgres, blockchain app and nats
+func NewService() *Service {
+	processor := businesslogic.NewProcessor()
+	var signingKey ed25519.PrivateKey
+	if config.Get().Export.SigningKey != "" {
+		// validated when configuration is loaded
+		signingKey, _ = ParseSigningKey(config.Get().Export.SigningKey)
+	}
+
+	return &Service{
+		OrganizationId: config.Get().OrganizationId,
+		SigningKey:     signingKey,
+		Repositories:   processor.Repositories,
+		Processor:      processor,
+		Rerun: func(ctx context.Context, entries []types.TrustmeshEntry) {
+			cron.ProcessEntries(ctx, entries, processor.Execute)
+		},
+	}
+}
+
+func (s *Service) GetOrganizations(ctx context.Context) ([]Organization, error) {
+	var organizations []types.Organization
+	if err := dbutil.Db.GetConn().Find(&organizations).Error; err != nil {
+		return nil, err
+	}
+
+	result := []Organization{}
+	for _, organization := range organizations {
+		result = append(result, Organization{Id: organization.Id, Name: organization.OrganizationName})
+	}
+
+	return result, nil
+}
+
+func (s *Service) CreateOrganization(ctx context.Context, organization Organization) (uuid.UUID, error) {
+	newOrganization := &types.Organization{Id: organization.Id, OrganizationName: organization.Name}
+	if !newOrganization.Create() {
+		return uuid.Nil, fmt.Errorf("error when creating new organization")
+	}
+
+	return newOrganization.Id, nil
+}
+
+func (s *Service) DeleteOrganization(ctx context.Context, id uuid.UUID) error {
+	var existingOrganization types.Organization
+	if err := dbutil.Db.GetConn().First(&existingOrganization, "id = ?", id.String()).Error; err != nil {
+		return lookupError(err, "organization %v not found", id)
+	}
+
+	if !existingOrganization.Delete() {
+		return fmt.Errorf("error when deleting organization")
+	}
+
+	return nil
+}
+
+func (s *Service) GetWorkgroups(ctx context.Context) ([]Workgroup, error) {
+	var workgroups []types.Workgroup
+	if err := dbutil.Db.GetConn().Find(&workgroups).Error; err != nil {
+		return nil, err
+	}
+
+	result := []Workgroup{}
+	for _, workgroup := range workgroups {
+		result = append(result, Workgroup{Id: workgroup.Id, Name: workgroup.WorkgroupName, Key: workgroup.PrivatizeKey})
+	}
+
+	return result, nil
+}
+
+func (s *Service) CreateWorkgroup(ctx context.Context, workgroup Workgroup) (uuid.UUID, error) {
+	newWorkgroup := &types.Workgroup{Id: workgroup.Id, WorkgroupName: workgroup.Name, PrivatizeKey: workgroup.Key}
+	if !newWorkgroup.Create() {
+		return uuid.Nil, fmt.Errorf("error when creating new workgroup")
+	}
+
+	return newWorkgroup.Id, nil
+}
+
+func (s *Service) DeleteWorkgroup(ctx context.Context, id uuid.UUID) error {
+	var existingWorkgroup types.Workgroup
+	if err := dbutil.Db.GetConn().First(&existingWorkgroup, "id = ?", id.String()).Error; err != nil {
+		return lookupError(err, "workgroup %v not found", id)
+	}
+
+	if !existingWorkgroup.Delete() {
+		return fmt.Errorf("error when deleting workgroup")
+	}
+
+	return nil
+}
+
+func (s *Service) GetWorkgroupMembers(ctx context.Context, workgroupId uuid.UUID) ([]WorkgroupMember, error) {
+	var members []types.WorkgroupMember
+	if err := dbutil.Db.GetConn().Where("workgroup_id = ?", workgroupId.String()).Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	result := []WorkgroupMember{}
+	for _, member := range members {
+		result = append(result, WorkgroupMember{
+			Id:                    member.Id,
+			WorkgroupId:           member.WorkgroupId,
+			OrganizationId:        member.OrganizationId,
+			OrganizationEndpoint:  member.OrganizationEndpoint,
+			OrganizationToken:     member.OrganizationToken,
+			OrganizationPublicKey: member.OrganizationPublicKey,
+		})
+	}
+
+	return result, nil
+}
+
+func (s *Service) CreateWorkgroupMember(ctx context.Context, member WorkgroupMember) (uuid.UUID, error) {
+	if err := messaging.ValidateMemberEndpoint(member.OrganizationEndpoint, member.OrganizationPublicKey); err != nil {
+		return uuid.Nil, invalidRequest("%v", err)
+	}
+
+	newMember := &types.WorkgroupMember{
+		WorkgroupId:           member.WorkgroupId,
+		OrganizationId:        member.OrganizationId,
+		OrganizationEndpoint:  member.OrganizationEndpoint,
+		OrganizationToken:     member.OrganizationToken,
+		OrganizationPublicKey: member.OrganizationPublicKey,
+	}
+	if !newMember.Create() {
+		return uuid.Nil, fmt.Errorf("error when creating new workgroup member")
+	}
+
+	return newMember.Id, nil
+}
+
+func (s *Service) DeleteWorkgroupMember(ctx context.Context, workgroupId uuid.UUID, id uuid.UUID) error {
+	var existingMember types.WorkgroupMember
+	if err := dbutil.Db.GetConn().First(&existingMember, "workgroup_id = ? and id = ?", workgroupId.String(), id.String()).Error; err != nil {
+		return lookupError(err, "workgroup member %v not found", id)
+	}
+
+	if !existingMember.Delete() {
+		return fmt.Errorf("error when deleting workgroup member")
+	}
+
+	return nil
+}
+
+func (s *Service) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	var webhooks []types.SorWebhook
+	if err := dbutil.Db.GetConn().Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+
+	result := []Webhook{}
+	for _, webhook := range webhooks {
+		result = append(result, Webhook{
+			Id:              webhook.Id,
+			Url:             webhook.Url,
+			UrlParams:       types.ParseStringIntoRequestParams(webhook.UrlParams),
+			HttpMethod:      webhook.HttpMethod,
+			WebhookType:     webhook.WebhookType,
+			AuthType:        webhook.AuthType,
+			AuthUsername:    webhook.AuthUsername,
+			AuthPassword:    webhook.AuthPassword,
+			XcsrfUrl:        webhook.XCSRFUrl,
+			BodyContentType: webhook.BodyContentType,
+			Body:            webhook.Body,
+			BodyParams:      types.ParseStringIntoRequestParams(webhook.BodyParams),
+		})
+	}
+
+	return result, nil
+}
+
+func (s *Service) CreateWebhook(ctx context.Context, webhook Webhook) (uuid.UUID, error) {
+	newWebhook := &types.SorWebhook{
+		Url:             webhook.Url,
+		UrlParams:       types.ParseRequestParamsIntoString(webhook.UrlParams),
+		HttpMethod:      webhook.HttpMethod,
+		WebhookType:     webhook.WebhookType,
+		AuthType:        webhook.AuthType,
+		AuthUsername:    webhook.AuthUsername,
+		AuthPassword:    webhook.AuthPassword,
+		XCSRFUrl:        webhook.XcsrfUrl,
+		BodyContentType: webhook.BodyContentType,
+		Body:            webhook.Body,
+		BodyParams:      types.ParseRequestParamsIntoString(webhook.BodyParams),
+	}
+	if !newWebhook.Create() {
+		return uuid.Nil, fmt.Errorf("error when creating new sor webhook")
+	}
+
+	return newWebhook.Id, nil
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	var existingWebhook types.SorWebhook
+	if err := dbutil.Db.GetConn().First(&existingWebhook, "id = ?", id.String()).Error; err != nil {
+		return lookupError(err, "sor webhook %v not found", id)
+	}
+
+	if !existingWebhook.Delete() {
+		return fmt.Errorf("error when deleting sor webhook")
+	}
+
+	return nil
+}
+
+// GetTrustmesh returns the trustmesh by id or bboid of one of its entries, without workgroup keys
+func (s *Service) GetTrustmesh(ctx context.Context, idOrBboid string) (*types.Trustmesh, error) {
+	trustmesh, err := s.findTrustmesh(idOrBboid)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range trustmesh.Entries {
+		// workgroup key decrypts payloads on chain, it is handed to auditors separately if at all
+		trustmesh.Entries[i].Workgroup.PrivatizeKey = ""
+	}
+	return trustmesh, nil
+}
+
+func (s *Service) findTrustmesh(idOrBboid string) (*types.Trustmesh, error) {
+	if id, err := uuid.FromString(idOrBboid); err == nil {
+		trustmesh, err := s.Repositories.Trustmeshes.GetTrustmeshById(id)
+		if err == nil {
+			return trustmesh, nil
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+	}
+
+	entry, err := s.Repositories.TrustmeshEntries.GetLatestTrustmeshEntryBasedOnBboid(idOrBboid)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, notFound("trustmesh %v not found", idOrBboid)
+	}
+
+	trustmesh, err := s.Repositories.Trustmeshes.GetTrustmeshById(entry.TrustmeshId)
+	if err != nil {
+		return nil, lookupError(err, "trustmesh %v not found", entry.TrustmeshId)
+	}
+
+	return trustmesh, nil
+}
+
+func (s *Service) RerunEntry(ctx context.Context, entryId uuid.UUID) (*types.TrustmeshEntry, error) {
+	entry, err := s.getEntry(entryId)
+	if err != nil {
+		return nil, err
+	}
+	if entry.CommitmentState == common.PendingBroadcastCommitmentState {
+		return nil, invalidRequest("trustmesh entry %v is not yet broadcasted", entryId)
+	}
+
+	adminLog.Ctx(ctx).Info("rerunning business logic", logger.F("entry_id", entry.Id.String()), logger.F("entry_type", entry.EntryType))
+	s.Rerun(ctx, []types.TrustmeshEntry{*entry})
+
+	return s.getEntry(entryId)
+}
+
+func (s *Service) ResendOffchainMessage(ctx context.Context, entryId uuid.UUID) error {
+	entry, err := s.getEntry(entryId)
+	if err != nil {
+		return err
+	}
+	if entry.EntryType != common.SuggestionSentTrustmeshEntryType && entry.EntryType != common.FeedbackSentTrustmeshEntryType {
+		return invalidRequest("trustmesh entry %v of type %v did not send offchain message", entryId, entry.EntryType)
+	}
+	if entry.CommitmentState != common.CommittedCommitmentState {
+		return invalidRequest("trustmesh entry %v is not committed, offchain message is sent once it is", entryId)
+	}
+
+	offchainMessage, err := s.Repositories.OffchainMessages.GetOffchainMsgById(entry.OffchainProcessMessageId)
+	if err != nil {
+		return lookupError(err, "offchain message %v not found", entry.OffchainProcessMessageId)
+	}
+
+	adminLog.Ctx(ctx).Info("resending offchain message", logger.F("entry_id", entry.Id.String()), logger.F("receiver_org_id", entry.ReceiverOrgId.String()))
+	return s.Processor.SendEntryOffchainMessage(ctx, entry, offchainMessage)
+}
+
+func (s *Service) GetEntriesByProcessingState(ctx context.Context, processingState string) ([]types.TrustmeshEntry, error) {
+	switch processingState {
+	case common.PendingProcessingState, common.ProcessingProcessingState, common.CommittedProcessingState, common.FailedProcessingState, common.DeadProcessingState:
+		return s.Repositories.TrustmeshEntries.GetTrustmeshEntriesByProcessingState(processingState)
+	default:
+		return nil, invalidRequest("unknown processing state %v", processingState)
+	}
+}
+
+func (s *Service) RetryEntry(ctx context.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error) {
+	return s.intervene(ctx, entryId, "retried", reason, func(entry *types.TrustmeshEntry) error {
+		if entry.ProcessingState != common.FailedProcessingState && entry.ProcessingState != common.DeadProcessingState {
+			return invalidRequest("trustmesh entry %v is %v, only failed and dead entries can be retried", entryId, entry.ProcessingState)
+		}
+
+		entry.ResetProcessing()
+		return nil
+	})
+}
+
+func (s *Service) SkipEntry(ctx context.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error) {
+	return s.intervene(ctx, entryId, "skipped", reason, func(entry *types.TrustmeshEntry) error {
+		if entry.ProcessingState == common.DeadProcessingState {
+			return invalidRequest("trustmesh entry %v is already dead", entryId)
+		}
+
+		entry.AbandonProcessing("skipped")
+		return nil
+	})
+}
+
+func (s *Service) ResolveEntry(ctx context.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error) {
+	return s.intervene(ctx, entryId, "resolved", reason, func(entry *types.TrustmeshEntry) error {
+		entry.FinishProcessing(common.CommittedCommitmentState)
+		return nil
+	})
+}
+
+func (s *Service) FinishBroadcast(ctx context.Context, entryId uuid.UUID, transactionHash string, reason string) (*types.TrustmeshEntry, error) {
+	transactionHash = strings.TrimSpace(transactionHash)
+	if transactionHash == "" {
+		return nil, invalidRequest("transaction hash is required")
+	}
+	pending, err := s.unconfirmedBroadcast(entryId, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.Repositories.PendingBroadcasts.FinishPendingBroadcast(pending, transactionHash); err != nil {
+		return nil, err
+	}
+
+	adminLog.Ctx(ctx).Info("unconfirmed broadcast finished",
+		logger.F("entry_id", entryId.String()),
+		logger.F("transaction_hash", transactionHash),
+		logger.F("reason", reason))
+	return s.getEntry(entryId)
+}
+
+func (s *Service) AbandonBroadcast(ctx context.Context, entryId uuid.UUID, reason string) error {
+	pending, err := s.unconfirmedBroadcast(entryId, reason)
+	if err != nil {
+		return err
+	}
+
+	if err = s.Repositories.PendingBroadcasts.CompensatePendingBroadcast(pending); err != nil {
+		return err
+	}
+
+	adminLog.Ctx(ctx).Info("unconfirmed broadcast abandoned", logger.F("entry_id", entryId.String()), logger.F("reason", reason))
+	return nil
+}
+
+// unconfirmedBroadcast returns pending broadcast of entry that recovery left to operator, pending and
+// broadcasting ones are still recovered and must not be changed meanwhile
+func (s *Service) unconfirmedBroadcast(entryId uuid.UUID, reason string) (*types.PendingBroadcast, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, invalidRequest("reason is required")
+	}
+
+	entry, err := s.getEntry(entryId)
+	if err != nil {
+		return nil, err
+	}
+	if entry.CommitmentState != common.PendingBroadcastCommitmentState {
+		return nil, invalidRequest("trustmesh entry %v is %v and already broadcasted", entryId, entry.CommitmentState)
+	}
+
+	pending, err := s.Repositories.PendingBroadcasts.GetPendingBroadcastByTrustmeshEntryId(entryId)
+	if err != nil {
+		return nil, lookupError(err, "pending broadcast of trustmesh entry %v not found", entryId)
+	}
+	if pending.Status != types.PendingBroadcastStatusUnconfirmed {
+		return nil, invalidRequest("broadcast of trustmesh entry %v is %v and still recovered", entryId, pending.Status)
+	}
+
+	return pending, nil
+}
+
+// intervene changes processing of uncommitted entry which is not yet processed and records the reason
+func (s *Service) intervene(ctx context.Context, entryId uuid.UUID, action string, reason string, change func(entry *types.TrustmeshEntry) error) (*types.TrustmeshEntry, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, invalidRequest("reason is required")
+	}
+
+	entry, err := s.getEntry(entryId)
+	if err != nil {
+		return nil, err
+	}
+	if entry.CommitmentState != common.UncommittedCommitmentState || entry.ProcessingState == common.CommittedProcessingState {
+		return nil, invalidRequest("trustmesh entry %v is %v and already processed", entryId, entry.CommitmentState)
+	}
+
+	if err = change(entry); err != nil {
+		return nil, err
+	}
+	entry.ProcessingResolution = action + ": " + reason
+	if err = s.Repositories.TrustmeshEntries.UpdateTrustmeshEntryProcessing(entry); err != nil {
+		return nil, err
+	}
+
+	adminLog.Ctx(ctx).Info("trustmesh entry "+action,
+		logger.F("entry_id", entry.Id.String()),
+		logger.F("processing_state", entry.ProcessingState),
+		logger.F("reason", reason))
+	return entry, nil
+}
+
+func (s *Service) VerifyTrustmesh(ctx context.Context, idOrBboid string) (*TrustmeshVerification, error) {
+	trustmesh, err := s.GetTrustmesh(ctx, idOrBboid)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := &TrustmeshVerification{TrustmeshId: trustmesh.Id, Verified: true, Entries: []EntryVerification{}}
+	for _, entry := range trustmesh.Entries {
+		entryVerification := s.verifyEntry(ctx, entry)
+		if entry.CommitmentState == common.CommittedCommitmentState && !entryVerification.Verified {
+			verification.Verified = false
+		}
+		verification.Entries = append(verification.Entries, entryVerification)
+	}
+
+	return verification, nil
+}
+
+func (s *Service) ExportTrustmesh(ctx context.Context, idOrBboid string) (*SignedAuditBundle, error) {
+	if s.SigningKey == nil {
+		return nil, errors.New("audit bundles can not be signed, EXPORT_SIGNING_KEY is not configured")
+	}
+
+	trustmesh, err := s.GetTrustmesh(ctx, idOrBboid)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &AuditBundle{
+		Version:        AuditBundleVersion,
+		ExportedAt:     time.Now().UTC(),
+		OrganizationId: s.OrganizationId,
+		RootProof:      synctree.CreateFromTrustmesh(*trustmesh).RootProof,
+		EthExitTxHash:  trustmesh.EthExitTxHash,
+		Trustmesh:      *trustmesh,
+		Transactions:   []AuditTransaction{},
+	}
+	for i := range bundle.Trustmesh.Entries {
+		entry := &bundle.Trustmesh.Entries[i]
+		if entry.CommitmentState == common.CommittedCommitmentState {
+			bundle.Transactions = append(bundle.Transactions, s.auditTransaction(ctx, *entry))
+		}
+	}
+
+	return SignAuditBundle(bundle, s.SigningKey)
+}
+
+func (s *Service) auditTransaction(ctx context.Context, entry types.TrustmeshEntry) AuditTransaction {
+	transaction := AuditTransaction{
+		EntryId:                        entry.Id,
+		BaseledgerTransactionId:        entry.OffchainProcessMessage.BaseledgerTransactionIdOfStoredProof,
+		TendermintTransactionId:        entry.TendermintTransactionId,
+		TendermintBlockHeight:          entry.TendermintBlockId.String,
+		TendermintTransactionTimestamp: entry.TendermintTransactionTimestamp.Time,
+		TransactionHash:                entry.TransactionHash,
+	}
+
+	baseledgerTransaction := s.Processor.Blockchain.GetCommittedBaseledgerTransaction(ctx, transaction.BaseledgerTransactionId)
+	if baseledgerTransaction == nil {
+		adminLog.Ctx(ctx).Warn("transaction of exported entry not found on chain", logger.F("entry_id", entry.Id.String()))
+		return transaction
+	}
+
+	transaction.Payload = baseledgerTransaction.Payload
+	return transaction
+}
+
+func (s *Service) verifyEntry(ctx context.Context, entry types.TrustmeshEntry) EntryVerification {
+	verification := EntryVerification{
+		EntryId:                 entry.Id,
+		EntryType:               entry.EntryType,
+		BaseledgerTransactionId: entry.BaseledgerTransactionId,
+		CommitmentState:         entry.CommitmentState,
+	}
+	if entry.CommitmentState != common.CommittedCommitmentState {
+		verification.Error = "entry is not committed"
+		return verification
+	}
+
+	offchainMessage, err := s.Repositories.OffchainMessages.GetOffchainMsgById(entry.OffchainProcessMessageId)
+	if err != nil {
+		verification.Error = "offchain message not found"
+		return verification
+	}
+
+	baseledgerTransaction := s.Processor.Blockchain.GetCommittedBaseledgerTransaction(ctx, offchainMessage.BaseledgerTransactionIdOfStoredProof)
+	if baseledgerTransaction == nil {
+		verification.Error = "transaction not found on chain"
+		return verification
+	}
+
+	workgroup := s.Repositories.Workgroups.FindWorkgroup(entry.WorkgroupId.String())
+	if workgroup == nil {
+		verification.Error = "workgroup not found"
+		return verification
+	}
+
+	baseledgerTransactionPayload, err := readChainPayload(baseledgerTransaction.Payload, workgroup.PrivatizeKey)
+	if err != nil {
+		verification.Error = "transaction payload can not be read with workgroup key"
+		return verification
+	}
+
+	if !synctree.VerifyHashMatch(baseledgerTransactionPayload.Proof, offchainMessage.BusinessObjectProof, offchainMessage.BaseledgerSyncTreeJson) {
+		verification.Error = "sync tree does not match proof on chain"
+		return verification
+	}
+
+	verification.Verified = true
+	return verification
+}
+
+func (s *Service) getEntry(entryId uuid.UUID) (*types.TrustmeshEntry, error) {
+	entry, err := s.Repositories.TrustmeshEntries.GetTrustmeshEntryById(entryId)
+	if err != nil {
+		return nil, lookupError(err, "trustmesh entry %v not found", entryId)
+	}
+
+	return entry, nil
+}
+
+// not found errors of gorm become ErrNotFound, others are returned as they are
+func lookupError(err error, format string, args ...interface{}) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return notFound(format, args...)
+	}
+
+	return err
+}
@@ -1,38 +1,116 @@
 package businesslogic
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"io/ioutil"
-	"net/http"
-
-	"github.com/spf13/viper"
+	"sync"
+	"time"
 
 	uuid "github.com/kthomas/go.uuid"
 	common "github.com/unibrightio/proxy-api/common"
-	"github.com/unibrightio/proxy-api/dbutil"
+	"github.com/unibrightio/proxy-api/config"
 	"github.com/unibrightio/proxy-api/eth"
 	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/messaging"
+	"github.com/unibrightio/proxy-api/metrics"
 	"github.com/unibrightio/proxy-api/proxyutil"
+	"github.com/unibrightio/proxy-api/repository"
 	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/schema"
 	"github.com/unibrightio/proxy-api/synctree"
 	systemofrecord "github.com/unibrightio/proxy-api/systemofrecord"
+	"github.com/unibrightio/proxy-api/tracing"
 	"github.com/unibrightio/proxy-api/types"
 	proxytypes "github.com/unibrightio/proxy-api/types"
+	"github.com/unibrightio/proxy-api/workflow"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func ExecuteBusinessLogic(txResult proxytypes.Result) {
-	systemofrecord.InitClient()
+var businessLogicLog = logger.For("business_logic")
+
+// Processor moves committed trustmesh entries through suggestion, feedback and exit steps.
+// All persistence and external systems are injected so it can run without postgres and chain
+type Processor struct {
+	Repositories *repository.Repositories
+	Blockchain   restutil.IBlockchainClient
+	Messaging    messaging.IMessagingClient
+	Sor          systemofrecord.ISorClient
+	Eth          eth.IEthClient
+	// sends reject feedback when received suggestion does not match proof on chain or schema of its business object type
+	RejectFeedback func(ctx context.Context, offchainMessage *types.OffchainProcessMessage, workgroupId string, feedbackMessage string)
+	// failed business logic is retried until attempts are exhausted
+	Retry types.RetryPolicy
+}
+
+// NewProcessor returns processor using postgres and configured blockchain, nats, SOR and ethereum
+func NewProcessor() *Processor {
+	repositories := repository.Postgres()
+	return &Processor{
+		Repositories:   repositories,
+		Blockchain:     &restutil.RestBlockchainClient{},
+		Messaging:      messaging.NewClient(nil),
+		Sor:            &systemofrecord.WebhookSorClient{Webhooks: repositories.Webhooks},
+		Eth:            &eth.ContractEthClient{},
+		RejectFeedback: workflow.NewService().SendRejectFeedback,
+		Retry: types.RetryPolicy{
+			MaxAttempts:       config.Get().Cron.ProcessingMaxAttempts,
+			Backoff:           config.Get().Cron.ProcessingRetryBackoff,
+			MaxBackoff:        config.Get().Cron.ProcessingMaxRetryBackoff,
+			ProcessingTimeout: config.Get().Cron.ProcessingTimeout,
+		},
+	}
+}
+
+var defaultProcessor *Processor
+var defaultProcessorOnce sync.Once
+
+// ExecuteBusinessLogic runs default processor
+func ExecuteBusinessLogic(ctx context.Context, txResult proxytypes.Result) {
+	defaultProcessorOnce.Do(func() {
+		defaultProcessor = NewProcessor()
+	})
+
+	defaultProcessor.Execute(ctx, txResult)
+}
+
+// Execute processes result of entry commitment check,
+// ctx carries trace of request or message that created the trustmesh entry
+func (p *Processor) Execute(ctx context.Context, txResult proxytypes.Result) {
 	var trustmeshEntry = txResult.Job.TrustmeshEntry
+	ctx = logger.WithTrustmeshId(ctx, trustmeshEntry.TrustmeshId.String())
+
+	// every return path has to set outcome, it is recorded on exit
+	outcome := metrics.OutcomeError
+	defer func() {
+		metrics.BusinessLogicOutcomes.WithLabelValues(trustmeshEntry.EntryType, outcome).Inc()
+	}()
 
 	if txResult.TxInfo.TxHeight == "" || txResult.TxInfo.TxTimestamp == "" {
 		logger.Infof("Transaction %v not yet committed", trustmeshEntry.TransactionHash)
+		outcome = metrics.OutcomeNotCommitted
 		return
 	}
+
+	ctx, span := tracing.Start(ctx, "ExecuteBusinessLogic",
+		tracing.TrustmeshIdKey.String(trustmeshEntry.TrustmeshId.String()),
+		tracing.TrustmeshEntryIdKey.String(trustmeshEntry.Id.String()),
+		tracing.EntryTypeKey.String(trustmeshEntry.EntryType),
+		tracing.TransactionIdKey.String(trustmeshEntry.BaseledgerTransactionId.String()),
+		tracing.TransactionHashKey.String(trustmeshEntry.TransactionHash),
+	)
+	defer func() {
+		span.SetAttributes(attribute.String("baseledger.outcome", outcome))
+		if outcome == metrics.OutcomeError || outcome == metrics.OutcomeDead {
+			tracing.Fail(span, "business logic failed")
+		}
+		span.End()
+	}()
 	if !txResult.TxInfo.TxValid {
 		logger.Warnf("Transaction %v is invalid with code %v and log %v", trustmeshEntry.TransactionHash, txResult.TxInfo.TxCode, txResult.TxInfo.TxLog)
 
-		systemofrecord.TriggerSorWebhook(
+		p.Sor.TriggerSorWebhook(
+			ctx,
 			types.UpdateObject,
 			&trustmeshEntry,
 			"",
@@ -40,36 +118,33 @@ func ExecuteBusinessLogic(txResult proxytypes.Result) {
 			"Transaction is invalid",
 			"")
 
-		setTxStatus(txResult, common.InvalidCommitmentState)
+		p.setTxStatus(txResult, common.InvalidCommitmentState)
+		trustmeshEntry.CommitmentState = common.InvalidCommitmentState
+		trustmeshEntry.AbandonProcessing("transaction is invalid")
+		p.saveProcessing(&trustmeshEntry)
+		outcome = metrics.OutcomeInvalid
 		return
 	}
-	logger.Infof("Execute business logic for result %v\n", txResult)
-	offchainMessage, err := proxytypes.GetOffchainMsgById(trustmeshEntry.OffchainProcessMessageId)
+	trustmeshEntry.StartProcessing(time.Now(), p.Retry)
+	p.saveProcessing(&trustmeshEntry)
+	businessLogicLog.Ctx(ctx).Info("executing business logic",
+		logger.F("entry_type", trustmeshEntry.EntryType),
+		logger.F("transaction_hash", trustmeshEntry.TransactionHash),
+		logger.F("tx_height", txResult.TxInfo.TxHeight),
+	)
+	offchainMessage, err := p.Repositories.OffchainMessages.GetOffchainMsgById(trustmeshEntry.OffchainProcessMessageId)
 	if err != nil {
-		logger.Error("Offchain process msg not found")
-		systemofrecord.TriggerSorWebhook(
-			types.UpdateObject,
-			&trustmeshEntry,
-			"",
-			false,
-			"Offchain process msg not found",
-			"")
+		outcome = p.failProcessing(ctx, &trustmeshEntry, "Offchain process msg not found")
 		return
 	}
 	switch trustmeshEntry.EntryType {
 	case common.SuggestionSentTrustmeshEntryType:
 		logger.Info(common.SuggestionSentTrustmeshEntryType)
 
-		// TODO: bellow lines should be moved to send offchain message
-		var natsMessage proxytypes.NatsMessage
-		natsMessage.ProcessMessage = *offchainMessage
-		natsMessage.TxHash = trustmeshEntry.TransactionHash
+		p.sendEntryOffchainMessage(ctx, &trustmeshEntry, offchainMessage)
 
-		var payload, _ = json.Marshal(natsMessage)
-
-		proxyutil.SendOffchainMessage(payload, trustmeshEntry.WorkgroupId.String(), trustmeshEntry.ReceiverOrgId.String(), common.BaseledgerNatsSubject)
-
-		systemofrecord.TriggerSorWebhook(
+		p.Sor.TriggerSorWebhook(
+			ctx,
 			types.UpdateObject,
 			&trustmeshEntry,
 			"",
@@ -79,16 +154,21 @@ func ExecuteBusinessLogic(txResult proxytypes.Result) {
 
 	case common.SuggestionReceivedTrustmeshEntryType:
 		logger.Info(common.SuggestionReceivedTrustmeshEntryType)
-		baseledgerTransaction := getCommittedBaseledgerTransaction(offchainMessage.BaseledgerTransactionIdOfStoredProof)
+		baseledgerTransaction := p.Blockchain.GetCommittedBaseledgerTransaction(ctx, offchainMessage.BaseledgerTransactionIdOfStoredProof)
 		if baseledgerTransaction == nil {
-			logger.Error("Failed to get committed baseledger transaction")
+			outcome = p.failProcessing(ctx, &trustmeshEntry, "Failed to get committed baseledger transaction")
 			return
 		}
 		baseledgerTransactionPayload := proxytypes.BaseledgerTransactionPayload{}
-		deprivitizedPayload := proxyutil.DeprivatizeBaseledgerTransactionPayload(baseledgerTransaction.Payload, trustmeshEntry.WorkgroupId)
+		workgroup := p.Repositories.Workgroups.FindWorkgroup(trustmeshEntry.WorkgroupId.String())
+		if workgroup == nil {
+			outcome = p.failProcessing(ctx, &trustmeshEntry, "Workgroup of trustmesh entry not found")
+			return
+		}
+		deprivitizedPayload := proxyutil.DeprivatizeBaseledgerTransactionPayloadForWorkgroup(baseledgerTransaction.Payload, workgroup)
 		err = json.Unmarshal(([]byte)(deprivitizedPayload), &baseledgerTransactionPayload)
 		if err != nil {
-			logger.Error("Failed to unmarshal baseledger transaction payload")
+			outcome = p.failProcessing(ctx, &trustmeshEntry, "Failed to unmarshal baseledger transaction payload")
 			return
 		}
 
@@ -98,39 +178,61 @@ func ExecuteBusinessLogic(txResult proxytypes.Result) {
 			syncTree := &synctree.BaseledgerSyncTree{}
 			err = json.Unmarshal([]byte(offchainMessage.BaseledgerSyncTreeJson), &syncTree)
 			if err != nil {
-				logger.Errorf("Error unmarshalling sync tree", err.Error())
+				outcome = p.failProcessing(ctx, &trustmeshEntry, "Error unmarshalling sync tree "+err.Error())
 				return
 			}
-			logger.Infof("Sync tree unmarshalled", syncTree)
+			// sync tree that can not be read is rejected by validation below
+			if boJson, err := synctree.GetBusinessObjectFieldsJson(*syncTree); err == nil {
+				businessLogicLog.Ctx(ctx).Debug("business object extracted from sync tree", logger.Payload("business_object", boJson))
+			}
 
-			boJson := synctree.GetBusinessObjectJson(*syncTree)
-			logger.Infof("Business object sync tree json", boJson)
+			err = workflow.CheckSchemaAgreement(p.Repositories.Schemas, trustmeshEntry.WorkgroupId, offchainMessage.BusinessObjectType, offchainMessage.BusinessObjectSchemaHash)
+			if err == nil {
+				err = workflow.ValidateReceivedBusinessObject(p.Repositories.Schemas, trustmeshEntry.WorkgroupId, offchainMessage.BusinessObjectType, *syncTree)
+			}
+			if errors.Is(err, workflow.ErrSchemaNotAgreed) || errors.Is(err, schema.ErrInvalidBusinessObject) {
+				businessLogicLog.Ctx(ctx).Warn("business object does not match agreed schema, rejecting suggestion", logger.F("error", err.Error()))
+				p.RejectFeedback(ctx, offchainMessage, trustmeshEntry.WorkgroupId.String(), "Rejected because "+err.Error())
+				outcome = metrics.OutcomeRejected
+				break
+			}
+			if err != nil {
+				outcome = p.failProcessing(ctx, &trustmeshEntry, "Error validating business object "+err.Error())
+				return
+			}
+
+			// system of record gets business object in the format it was sent in
+			businessObject, _, err := synctree.GetBusinessObject(*syncTree)
+			if err != nil {
+				outcome = p.failProcessing(ctx, &trustmeshEntry, "Error reading business object from sync tree "+err.Error())
+				return
+			}
 
-			systemofrecord.TriggerSorWebhook(
+			p.Sor.TriggerSorWebhook(
+				ctx,
 				types.CreateObject,
 				&trustmeshEntry,
-				boJson,
+				businessObject,
 				false,
 				offchainMessage.StatusTextMessage,
 				offchainMessage.SenderId.String(),
 			)
 			break
 		}
-		logger.Warnf("Hashes don't match, rejecting feedback %v %v %v", baseledgerTransactionPayload.Proof, offchainMessage.BusinessObjectProof, offchainMessage.BaseledgerSyncTreeJson)
-		restutil.SendRejectFeedback(offchainMessage, trustmeshEntry.WorkgroupId.String())
+		businessLogicLog.Ctx(ctx).Warn("hashes don't match, rejecting feedback",
+			logger.F("blockchain_proof", baseledgerTransactionPayload.Proof),
+			logger.F("business_object_proof", offchainMessage.BusinessObjectProof),
+			logger.Payload("sync_tree", offchainMessage.BaseledgerSyncTreeJson),
+		)
+		p.RejectFeedback(ctx, offchainMessage, trustmeshEntry.WorkgroupId.String(), "Rejected because Hashes do not match")
+		outcome = metrics.OutcomeRejected
 	case common.FeedbackSentTrustmeshEntryType:
 		logger.Info(common.FeedbackSentTrustmeshEntryType)
 
-		// TODO: bellow lines should be moved to send offchain message
-		var natsMessage proxytypes.NatsMessage
-		natsMessage.ProcessMessage = *offchainMessage
-		natsMessage.TxHash = trustmeshEntry.TransactionHash
-
-		var payload, _ = json.Marshal(natsMessage)
+		p.sendEntryOffchainMessage(ctx, &trustmeshEntry, offchainMessage)
 
-		proxyutil.SendOffchainMessage(payload, trustmeshEntry.WorkgroupId.String(), trustmeshEntry.ReceiverOrgId.String(), common.BaseledgerNatsSubject)
-
-		systemofrecord.TriggerSorWebhook(
+		p.Sor.TriggerSorWebhook(
+			ctx,
 			types.UpdateObject,
 			&trustmeshEntry,
 			"",
@@ -140,30 +242,33 @@ func ExecuteBusinessLogic(txResult proxytypes.Result) {
 
 	case common.FeedbackReceivedTrustmeshEntryType:
 		logger.Info(common.FeedbackReceivedTrustmeshEntryType)
-		baseledgerTransaction := getCommittedBaseledgerTransaction(offchainMessage.BaseledgerTransactionIdOfStoredProof)
+		baseledgerTransaction := p.Blockchain.GetCommittedBaseledgerTransaction(ctx, offchainMessage.BaseledgerTransactionIdOfStoredProof)
 		if baseledgerTransaction == nil {
-			logger.Error("Failed to get committed baseledger transaction")
+			outcome = p.failProcessing(ctx, &trustmeshEntry, "Failed to get committed baseledger transaction")
 			return
 		}
 
 		syncTree := &synctree.BaseledgerSyncTree{}
 		err = json.Unmarshal([]byte(offchainMessage.BaseledgerSyncTreeJson), &syncTree)
 		if err != nil {
-			logger.Errorf("Error unmarshalling sync tree", err.Error())
+			outcome = p.failProcessing(ctx, &trustmeshEntry, "Error unmarshalling sync tree "+err.Error())
 			return
 		}
-		logger.Infof("Sync tree unmarshalled", syncTree)
 
 		// type? is it possible in go?
 		// do we need it if we just pass this to sor?
 		var bo map[string]interface{}
-		boJson := synctree.GetBusinessObjectJson(*syncTree)
+		boJson, err := synctree.GetBusinessObjectJson(*syncTree)
+		if err != nil {
+			outcome = p.failProcessing(ctx, &trustmeshEntry, "Error reading business object from sync tree "+err.Error())
+			return
+		}
 		err = json.Unmarshal([]byte(boJson), &bo)
 		if err != nil {
-			logger.Errorf("Error unmarshalling sync tree", err.Error())
+			outcome = p.failProcessing(ctx, &trustmeshEntry, "Error unmarshalling sync tree "+err.Error())
 			return
 		}
-		logger.Infof("Business object unmarshalled", bo)
+		businessLogicLog.Ctx(ctx).Debug("business object extracted from sync tree", logger.Payload("business_object", bo))
 		status := true
 		if trustmeshEntry.BaseledgerTransactionType == common.BaseledgerTransactionTypeReject {
 			status = false
@@ -171,7 +276,8 @@ func ExecuteBusinessLogic(txResult proxytypes.Result) {
 
 		logger.Infof("Sending feedback received status update %v\n", status)
 
-		systemofrecord.TriggerSorWebhook(
+		p.Sor.TriggerSorWebhook(
+			ctx,
 			types.UpdateObject,
 			&trustmeshEntry,
 			"",
@@ -180,7 +286,7 @@ func ExecuteBusinessLogic(txResult proxytypes.Result) {
 			offchainMessage.SenderId.String())
 
 		if status == true {
-			tryExitToEth(&trustmeshEntry)
+			p.tryExitToEth(ctx, &trustmeshEntry)
 		}
 
 	default:
@@ -188,11 +294,16 @@ func ExecuteBusinessLogic(txResult proxytypes.Result) {
 		panic(errors.New("uknown business process!"))
 	}
 
-	setTxStatus(txResult, common.CommittedCommitmentState)
+	p.setTxStatus(txResult, common.CommittedCommitmentState)
+	trustmeshEntry.FinishProcessing(common.CommittedCommitmentState)
+	p.saveProcessing(&trustmeshEntry)
+	if outcome != metrics.OutcomeRejected {
+		outcome = metrics.OutcomeProcessed
+	}
 }
 
-func tryExitToEth(trustmeshEntry *types.TrustmeshEntry) {
-	trustmesh, err := types.GetTrustmeshById(trustmeshEntry.TrustmeshId)
+func (p *Processor) tryExitToEth(ctx context.Context, trustmeshEntry *types.TrustmeshEntry) {
+	trustmesh, err := p.Repositories.Trustmeshes.GetTrustmeshById(trustmeshEntry.TrustmeshId)
 
 	if err != nil {
 		logger.Errorf("Could not find trustmesh for exiting %v", trustmeshEntry.TrustmeshId)
@@ -223,62 +334,128 @@ func tryExitToEth(trustmeshEntry *types.TrustmeshEntry) {
 
 	logger.Infof("Current trustmesh %v contains final workstep, exiting", trustmeshEntry.TrustmeshId)
 
+	workgroup := p.Repositories.Workgroups.FindWorkgroup(trustmeshEntry.WorkgroupId.String())
+	if workgroup == nil {
+		logger.Errorf("Workgroup %v not found, skipping exit", trustmeshEntry.WorkgroupId)
+		return
+	}
+
 	trustmeshSyncTree := synctree.CreateFromTrustmesh(*trustmesh)
 	transactionId := uuid.NewV4()
 
-	payload := proxyutil.CreateExitBaseledgerTransactionPayload(trustmeshEntry.WorkgroupId, transactionId, trustmeshSyncTree.RootProof)
+	payload := proxyutil.CreateExitBaseledgerTransactionPayloadForWorkgroup(workgroup, transactionId, trustmeshSyncTree.RootProof)
 	signAndBroadcastPayload := &restutil.SignAndBroadcastPayload{
 		OpCode:        0,
 		TransactionId: transactionId.String(),
 		Payload:       payload,
 	}
 
-	txHash := restutil.SignAndBroadcast(*signAndBroadcastPayload)
+	txHash := p.Blockchain.SignAndBroadcast(ctx, *signAndBroadcastPayload)
 	if txHash == nil {
 		logger.Error("Sign and broadcast exiting baseledger transaction failed")
 		return
 	}
 
-	eth.StoreExitProofInTrustmeshAndInformCounterparty(transactionId.String(), trustmeshSyncTree.RootProof, trustmeshEntry)
-}
+	ethTxHash, err := p.Eth.StoreExitProof(ctx, transactionId.String(), trustmeshSyncTree.RootProof)
+	if err != nil {
+		return
+	}
 
-func setTxStatus(txResult proxytypes.Result, commitmentState string) {
-	result := dbutil.Db.GetConn().Exec("UPDATE trustmesh_entries SET commitment_state = ?, tendermint_block_id = ?, tendermint_transaction_timestamp = ? WHERE tendermint_transaction_id = ?",
-		commitmentState,
-		txResult.TxInfo.TxHeight,
-		txResult.TxInfo.TxTimestamp,
-		txResult.Job.TrustmeshEntry.TendermintTransactionId)
-	if result.RowsAffected == 1 {
-		logger.Infof("Tx %v committed \n", txResult.Job.TrustmeshEntry.TendermintTransactionId)
-	} else {
-		logger.Errorf("Error setting tx status to committed %v\n", result.Error)
+	err = p.Repositories.Trustmeshes.UpdateTrustmeshEthTxHash(trustmeshEntry.TrustmeshId, ethTxHash)
+	if err != nil {
+		logger.Errorf("Error updating trustmesh eth hash %v", err.Error())
+		return
 	}
+	logger.Infof("successful setting of tx hash, broadcasting offchain message ")
+
+	var natsMessage types.NatsTrustmeshUpdateMessage
+	natsMessage.EthExitTxHash = ethTxHash
+	// it has to be referenced bboid because at this point entry has to be feedback (approval feedback of final workstep)
+	natsMessage.BaseledgerBusinessObjectId = trustmeshEntry.ReferencedBaseledgerBusinessObjectId
+	natsMessage.TraceContext = tracing.Inject(ctx)
+	var natsPayload, _ = json.Marshal(natsMessage)
+
+	p.sendOffchainMessage(ctx, natsPayload, trustmeshEntry.WorkgroupId.String(), trustmeshEntry.SenderOrgId.String(), common.EthTxHashNatsSubject)
 }
 
-func getCommittedBaseledgerTransaction(id uuid.UUID) *proxytypes.BaseledgerTransactionDto {
-	resp, err := http.Get("http://" + viper.Get("BLOCKCHAIN_APP_URL").(string) + "/unibrightio/baseledger/baseledger/BaseledgerTransaction/" + id.String())
+// SendEntryOffchainMessage sends offchain message of sent suggestion or feedback to its receiver
+func (p *Processor) SendEntryOffchainMessage(ctx context.Context, trustmeshEntry *types.TrustmeshEntry, offchainMessage *types.OffchainProcessMessage) error {
+	var natsMessage proxytypes.NatsMessage
+	natsMessage.ProcessMessage = *offchainMessage
+	natsMessage.ProcessMessage.BaseledgerSyncTreeJson = workflow.OffchainSyncTreeJson(p.Repositories.TrustmeshEntries, *offchainMessage)
+	natsMessage.TxHash = trustmeshEntry.TransactionHash
+	natsMessage.TraceContext = tracing.Inject(ctx)
 
+	payload, err := json.Marshal(natsMessage)
 	if err != nil {
-		logger.Errorf("error while fetching committed baseledger transaction %v\n", err.Error())
-		return nil
+		return err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	return proxyutil.SendOffchainMessageWith(ctx, p.Repositories.Workgroups, p.Messaging, payload, trustmeshEntry.WorkgroupId.String(), trustmeshEntry.ReceiverOrgId.String(), common.BaseledgerNatsSubject)
+}
+
+func (p *Processor) sendEntryOffchainMessage(ctx context.Context, trustmeshEntry *types.TrustmeshEntry, offchainMessage *types.OffchainProcessMessage) {
+	err := p.SendEntryOffchainMessage(ctx, trustmeshEntry, offchainMessage)
 	if err != nil {
-		logger.Errorf("error while reading committed baseledger transaction response %v\n", err.Error())
-		return nil
+		logger.Errorf("error sending offchain message %v", err.Error())
 	}
+}
 
-	logger.Infof("trying to unmarshal body: %v to CommittedBaseledgerTransactionResponse", string(body))
+func (p *Processor) sendOffchainMessage(ctx context.Context, payload []byte, workgroupId string, recipientId string, subject string) {
+	err := proxyutil.SendOffchainMessageWith(ctx, p.Repositories.Workgroups, p.Messaging, payload, workgroupId, recipientId, subject)
+	if err != nil {
+		logger.Errorf("error sending offchain message %v", err.Error())
+	}
+}
 
-	var transactionResponse proxytypes.CommittedBaseledgerTransactionResponse
-	err = json.Unmarshal(body, &transactionResponse)
+// failProcessing schedules retry of entry or marks it dead, SOR is notified about the failure only once entry is dead
+func (p *Processor) failProcessing(ctx context.Context, trustmeshEntry *types.TrustmeshEntry, reason string) string {
+	dead := trustmeshEntry.FailProcessing(reason, time.Now(), p.Retry)
+	p.saveProcessing(trustmeshEntry)
+	if !dead {
+		businessLogicLog.Ctx(ctx).Warn("business logic failed, retrying later",
+			logger.F("reason", reason),
+			logger.F("attempts", trustmeshEntry.ProcessingAttempts),
+			logger.F("next_retry_at", trustmeshEntry.ProcessingNextRetryAt.Time),
+		)
+		return metrics.OutcomeError
+	}
 
+	businessLogicLog.Ctx(ctx).Error("business logic failed, giving up",
+		logger.F("reason", reason),
+		logger.F("attempts", trustmeshEntry.ProcessingAttempts),
+	)
+	p.Sor.TriggerSorWebhook(
+		ctx,
+		types.UpdateObject,
+		trustmeshEntry,
+		"",
+		false,
+		reason,
+		"")
+	return metrics.OutcomeDead
+}
+
+func (p *Processor) saveProcessing(trustmeshEntry *types.TrustmeshEntry) {
+	err := p.Repositories.TrustmeshEntries.UpdateTrustmeshEntryProcessing(trustmeshEntry)
 	if err != nil {
-		logger.Errorf("error while unmarshalling fetched committed baseledger transaction %v\n", err.Error())
-		return nil
+		logger.Errorf("Error saving processing state %v of entry %v: %v", trustmeshEntry.ProcessingState, trustmeshEntry.Id, err)
 	}
+}
 
-	logger.Infof("commited baseledger transaction ", transactionResponse)
-	return &transactionResponse.BaseledgerTransaction
+func (p *Processor) setTxStatus(txResult proxytypes.Result, commitmentState string) {
+	err := p.Repositories.TrustmeshEntries.SetTrustmeshEntryCommitmentState(
+		txResult.Job.TrustmeshEntry.TendermintTransactionId,
+		commitmentState,
+		txResult.TxInfo.TxHeight,
+		txResult.TxInfo.TxTimestamp)
+	if err == nil {
+		logger.Infof("Tx %v committed \n", txResult.Job.TrustmeshEntry.TendermintTransactionId)
+		// observed once on the transition, entries that are rerun are committed already
+		if commitmentState == common.CommittedCommitmentState && txResult.Job.TrustmeshEntry.CommitmentState != common.CommittedCommitmentState {
+			metrics.BroadcastToCommitDuration.Observe(time.Since(txResult.Job.TrustmeshEntry.CreatedAt).Seconds())
+		}
+	} else {
+		logger.Errorf("Error setting tx status to committed %v\n", err)
+	}
 }
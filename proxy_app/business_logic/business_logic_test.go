@@ -0,0 +1,547 @@
+package businesslogic
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/messaging"
+	"github.com/unibrightio/proxy-api/proxyutil"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/synctree"
+	"github.com/unibrightio/proxy-api/types"
+	"github.com/unibrightio/proxy-api/workflow"
+)
+
+const testPrivatizeKey = "6368616e676520746869732070617373776f726420746f206120736563726574"
+const testBusinessObjectJson = `{"orderId":"4711","amount":10}`
+const testBusinessObjectType = "PurchaseOrder"
+
+type fakeBlockchain struct {
+	transactions map[uuid.UUID]*types.BaseledgerTransactionDto
+	broadcasted  []restutil.SignAndBroadcastPayload
+}
+
+func (b *fakeBlockchain) SignAndBroadcast(ctx context.Context, payload restutil.SignAndBroadcastPayload) *string {
+	b.broadcasted = append(b.broadcasted, payload)
+	txHash := "tx-hash-" + payload.TransactionId
+	return &txHash
+}
+
+func (b *fakeBlockchain) GetCommittedBaseledgerTransaction(ctx context.Context, id uuid.UUID) *types.BaseledgerTransactionDto {
+	return b.transactions[id]
+}
+
+type sentMessage struct {
+	recipient string
+	subject   string
+	payload   []byte
+}
+
+type fakeMessaging struct {
+	sent []sentMessage
+}
+
+func (m *fakeMessaging) SendMessage(envelope messaging.Envelope, recipient string, token string) error {
+	m.sent = append(m.sent, sentMessage{recipient: recipient, subject: envelope.Subject, payload: envelope.Payload})
+	return nil
+}
+
+func (m *fakeMessaging) Subscribe(endpoint string, token string, subject string, onEnvelope func(messaging.Envelope)) error {
+	return nil
+}
+
+func (m *fakeMessaging) Drain(ctx context.Context) error {
+	return nil
+}
+
+type sorCall struct {
+	webhookType types.WebhookType
+	payload     string
+	approved    bool
+}
+
+type fakeSor struct {
+	calls []sorCall
+}
+
+func (s *fakeSor) TriggerSorWebhook(ctx context.Context, webhookType types.WebhookType, trustmeshEntry *types.TrustmeshEntry, payload string, approved bool, message string, origin string) bool {
+	s.calls = append(s.calls, sorCall{webhookType: webhookType, payload: payload, approved: approved})
+	return true
+}
+
+type fakeEth struct {
+	stored []string
+}
+
+func (e *fakeEth) StoreExitProof(ctx context.Context, txId string, proof string) (string, error) {
+	e.stored = append(e.stored, txId)
+	return "0xexit", nil
+}
+
+type fixture struct {
+	processor    *Processor
+	repositories *repository.Repositories
+	blockchain   *fakeBlockchain
+	messaging    *fakeMessaging
+	sor          *fakeSor
+	eth          *fakeEth
+	rejected     []*types.OffchainProcessMessage
+	// feedback messages of rejected
+	rejectionMessages []string
+	workgroup         *types.Workgroup
+	counterparty      uuid.UUID
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{
+		repositories: repository.NewInMemory(),
+		blockchain:   &fakeBlockchain{transactions: map[uuid.UUID]*types.BaseledgerTransactionDto{}},
+		messaging:    &fakeMessaging{},
+		sor:          &fakeSor{},
+		eth:          &fakeEth{},
+		workgroup:    &types.Workgroup{WorkgroupName: "test", PrivatizeKey: testPrivatizeKey},
+		counterparty: uuid.NewV4(),
+	}
+
+	if err := f.repositories.Workgroups.CreateWorkgroup(f.workgroup); err != nil {
+		t.Fatalf("creating workgroup failed %v", err)
+	}
+	err := f.repositories.Workgroups.CreateWorkgroupMember(&types.WorkgroupMember{
+		WorkgroupId:          f.workgroup.Id.String(),
+		OrganizationId:       f.counterparty.String(),
+		OrganizationEndpoint: "nats://counterparty:4222",
+	})
+	if err != nil {
+		t.Fatalf("creating workgroup member failed %v", err)
+	}
+
+	f.processor = &Processor{
+		Repositories: f.repositories,
+		Blockchain:   f.blockchain,
+		Messaging:    f.messaging,
+		Sor:          f.sor,
+		Eth:          f.eth,
+		RejectFeedback: func(ctx context.Context, offchainMessage *types.OffchainProcessMessage, workgroupId string, feedbackMessage string) {
+			f.rejected = append(f.rejected, offchainMessage)
+			f.rejectionMessages = append(f.rejectionMessages, feedbackMessage)
+		},
+	}
+
+	return f
+}
+
+type entryParams struct {
+	entryType                            string
+	workstepType                         string
+	transactionType                      string
+	baseledgerBusinessObjectId           string
+	referencedBaseledgerBusinessObjectId string
+	referencedTransactionId              uuid.UUID
+	// proof stored on chain, defaults to proof of the business object
+	chainProof string
+	// schema hash sent by counterparty, defaults to hash of schema registered here
+	senderSchemaHash string
+}
+
+// createEntry stores offchain message with sync tree of test business object, entry referencing it
+// and transaction on chain holding the proof
+func (f *fixture) createEntry(t *testing.T, params entryParams) *types.TrustmeshEntry {
+	syncTree, err := synctree.CreateFromBusinessObjectJson(testBusinessObjectJson, []string{})
+	if err != nil {
+		t.Fatalf("creating sync tree failed %v", err)
+	}
+	syncTreeJson, _ := json.Marshal(syncTree)
+	transactionId := uuid.NewV4()
+	senderSchemaHash := params.senderSchemaHash
+	if senderSchemaHash == "" {
+		senderSchemaHash, _ = workflow.BusinessObjectSchemaHash(f.repositories.Schemas, f.workgroup.Id, testBusinessObjectType)
+	}
+
+	offchainMsg := &types.OffchainProcessMessage{
+		SenderId:                             f.counterparty,
+		Topic:                                f.workgroup.Id.String(),
+		WorkstepType:                         params.workstepType,
+		BaseledgerSyncTreeJson:               string(syncTreeJson),
+		BusinessObjectProof:                  syncTree.RootProof,
+		BusinessObjectType:                   testBusinessObjectType,
+		BusinessObjectSchemaHash:             senderSchemaHash,
+		BaseledgerBusinessObjectId:           params.baseledgerBusinessObjectId,
+		ReferencedBaseledgerBusinessObjectId: params.referencedBaseledgerBusinessObjectId,
+		BaseledgerTransactionType:            params.transactionType,
+		EntryType:                            params.entryType,
+		BaseledgerTransactionIdOfStoredProof: transactionId,
+		TendermintTransactionIdOfStoredProof: transactionId,
+	}
+	if err := f.repositories.OffchainMessages.CreateOffchainMessage(offchainMsg); err != nil {
+		t.Fatalf("creating offchain message failed %v", err)
+	}
+
+	entry := &types.TrustmeshEntry{
+		EntryType:                            params.entryType,
+		SenderOrgId:                          f.counterparty,
+		ReceiverOrgId:                        f.counterparty,
+		WorkgroupId:                          f.workgroup.Id,
+		WorkstepType:                         params.workstepType,
+		BaseledgerTransactionType:            params.transactionType,
+		BaseledgerTransactionId:              transactionId,
+		TendermintTransactionId:              transactionId,
+		ReferencedBaseledgerTransactionId:    params.referencedTransactionId,
+		BaseledgerBusinessObjectId:           params.baseledgerBusinessObjectId,
+		ReferencedBaseledgerBusinessObjectId: params.referencedBaseledgerBusinessObjectId,
+		OffchainProcessMessageId:             offchainMsg.Id,
+		TransactionHash:                      "tx-hash-" + transactionId.String(),
+	}
+	if err := f.repositories.TrustmeshEntries.CreateTrustmeshEntry(entry); err != nil {
+		t.Fatalf("creating trustmesh entry failed %v", err)
+	}
+
+	chainProof := params.chainProof
+	if chainProof == "" {
+		chainProof = syncTree.RootProof
+	}
+	payload := proxyutil.PrivatizeBaseledgerTransactionPayloadForWorkgroup(&types.BaseledgerTransactionPayload{
+		TransactionType:         params.transactionType,
+		BaseledgerTransactionId: transactionId.String(),
+		Proof:                   chainProof,
+	}, f.workgroup)
+	f.blockchain.transactions[transactionId] = &types.BaseledgerTransactionDto{BaseledgerTransactionId: transactionId.String(), Payload: payload}
+
+	return entry
+}
+
+func (f *fixture) registerSchema(t *testing.T, schemaJson string) {
+	service := &workflow.Service{Repositories: f.repositories}
+	if _, err := service.RegisterBusinessObjectSchema(f.workgroup.Id.String(), testBusinessObjectType, schemaJson); err != nil {
+		t.Fatalf("registering schema failed %v", err)
+	}
+}
+
+func (f *fixture) commitmentState(t *testing.T, entry *types.TrustmeshEntry) string {
+	stored, err := f.repositories.TrustmeshEntries.GetTrustmeshEntryById(entry.Id)
+	if err != nil {
+		t.Fatalf("getting trustmesh entry failed %v", err)
+	}
+
+	return stored.CommitmentState
+}
+
+// createFinalWorkstepApproval creates suggestion sent for final workstep and approval received for it
+func (f *fixture) createFinalWorkstepApproval(t *testing.T, workstepType string) *types.TrustmeshEntry {
+	bboid := uuid.NewV4().String()
+	suggestion := f.createEntry(t, entryParams{
+		entryType:                  common.SuggestionSentTrustmeshEntryType,
+		workstepType:               workstepType,
+		transactionType:            common.BaseledgerTransactionTypeSuggest,
+		baseledgerBusinessObjectId: bboid,
+	})
+
+	return f.createEntry(t, entryParams{
+		entryType:                            common.FeedbackReceivedTrustmeshEntryType,
+		workstepType:                         common.WorkstepTypeFeedback,
+		transactionType:                      common.BaseledgerTransactionTypeApprove,
+		referencedBaseledgerBusinessObjectId: bboid,
+		referencedTransactionId:              suggestion.BaseledgerTransactionId,
+	})
+}
+
+func committed(entry *types.TrustmeshEntry) types.Result {
+	return types.Result{
+		Job: types.Job{TrustmeshEntry: *entry},
+		TxInfo: types.TxInfo{
+			TxHeight:    "42",
+			TxTimestamp: "2022-06-01T10:00:00.000000000Z",
+			TxCommitted: true,
+			TxValid:     true,
+		},
+	}
+}
+
+func TestGivenNotYetCommittedTransactionWhenExecuteThenEntryStaysUncommitted(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createEntry(t, entryParams{entryType: common.SuggestionSentTrustmeshEntryType, workstepType: common.WorkstepTypeInitial})
+
+	f.processor.Execute(context.Background(), types.Result{Job: types.Job{TrustmeshEntry: *entry}})
+
+	if state := f.commitmentState(t, entry); state != common.UncommittedCommitmentState {
+		t.Fatalf("commitment state = %v, want %v", state, common.UncommittedCommitmentState)
+	}
+	if len(f.sor.calls) != 0 || len(f.messaging.sent) != 0 {
+		t.Fatalf("no side effects expected, got %v sor calls and %v messages", len(f.sor.calls), len(f.messaging.sent))
+	}
+}
+
+func TestGivenInvalidTransactionWhenExecuteThenEntryInvalidAndSorNotifiedAboutFailure(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createEntry(t, entryParams{entryType: common.SuggestionSentTrustmeshEntryType, workstepType: common.WorkstepTypeInitial})
+	result := committed(entry)
+	result.TxInfo.TxValid = false
+
+	f.processor.Execute(context.Background(), result)
+
+	if state := f.commitmentState(t, entry); state != common.InvalidCommitmentState {
+		t.Fatalf("commitment state = %v, want %v", state, common.InvalidCommitmentState)
+	}
+	if len(f.sor.calls) != 1 || f.sor.calls[0].approved {
+		t.Fatalf("expected single failed SOR update, got %+v", f.sor.calls)
+	}
+}
+
+func TestGivenCommittedSuggestionSentWhenExecuteThenOffchainMessageSentToRecipientAndEntryCommitted(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createEntry(t, entryParams{entryType: common.SuggestionSentTrustmeshEntryType, workstepType: common.WorkstepTypeInitial})
+
+	f.processor.Execute(context.Background(), committed(entry))
+
+	if state := f.commitmentState(t, entry); state != common.CommittedCommitmentState {
+		t.Fatalf("commitment state = %v, want %v", state, common.CommittedCommitmentState)
+	}
+	if len(f.messaging.sent) != 1 || f.messaging.sent[0].subject != common.BaseledgerNatsSubject || f.messaging.sent[0].recipient != "nats://counterparty:4222" {
+		t.Fatalf("expected offchain message to counterparty, got %+v", f.messaging.sent)
+	}
+
+	var natsMessage types.NatsMessage
+	if err := json.Unmarshal(f.messaging.sent[0].payload, &natsMessage); err != nil {
+		t.Fatalf("sent message is not nats message %v", err)
+	}
+	if natsMessage.TxHash != entry.TransactionHash || natsMessage.ProcessMessage.Id != entry.OffchainProcessMessageId {
+		t.Fatalf("sent message does not reference entry, got %+v", natsMessage)
+	}
+	if len(f.sor.calls) != 1 || f.sor.calls[0].webhookType != types.UpdateObject || !f.sor.calls[0].approved {
+		t.Fatalf("expected single successful SOR update, got %+v", f.sor.calls)
+	}
+}
+
+func TestGivenSuggestionReceivedMatchingProofOnChainWhenExecuteThenBusinessObjectCreatedInSor(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createEntry(t, entryParams{entryType: common.SuggestionReceivedTrustmeshEntryType, workstepType: common.WorkstepTypeInitial})
+
+	f.processor.Execute(context.Background(), committed(entry))
+
+	if state := f.commitmentState(t, entry); state != common.CommittedCommitmentState {
+		t.Fatalf("commitment state = %v, want %v", state, common.CommittedCommitmentState)
+	}
+	if len(f.sor.calls) != 1 || f.sor.calls[0].webhookType != types.CreateObject {
+		t.Fatalf("expected SOR create object, got %+v", f.sor.calls)
+	}
+
+	var created, want map[string]interface{}
+	json.Unmarshal([]byte(f.sor.calls[0].payload), &created)
+	json.Unmarshal([]byte(testBusinessObjectJson), &want)
+	if created["orderId"] != want["orderId"] || created["amount"] != want["amount"] {
+		t.Fatalf("SOR payload = %v, want %v", f.sor.calls[0].payload, testBusinessObjectJson)
+	}
+	if len(f.rejected) != 0 {
+		t.Fatalf("suggestion matching proof must not be rejected")
+	}
+}
+
+func TestGivenSuggestionReceivedNotMatchingProofOnChainWhenExecuteThenRejectFeedbackSent(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createEntry(t, entryParams{
+		entryType:    common.SuggestionReceivedTrustmeshEntryType,
+		workstepType: common.WorkstepTypeInitial,
+		chainProof:   "tampered",
+	})
+
+	f.processor.Execute(context.Background(), committed(entry))
+
+	if len(f.rejected) != 1 || f.rejected[0].Id != entry.OffchainProcessMessageId {
+		t.Fatalf("expected reject feedback for offchain message %v, got %v", entry.OffchainProcessMessageId, f.rejected)
+	}
+	if len(f.sor.calls) != 0 {
+		t.Fatalf("rejected suggestion must not reach SOR, got %+v", f.sor.calls)
+	}
+	if state := f.commitmentState(t, entry); state != common.CommittedCommitmentState {
+		t.Fatalf("commitment state = %v, want %v", state, common.CommittedCommitmentState)
+	}
+}
+
+func TestGivenSuggestionReceivedNotMatchingSchemaWhenExecuteThenRejectFeedbackWithValidationErrorsSent(t *testing.T) {
+	f := newFixture(t)
+	f.registerSchema(t, `{"type":"object","required":["orderId","currency"],"properties":{"amount":{"type":"number","maximum":5}}}`)
+	entry := f.createEntry(t, entryParams{
+		entryType:    common.SuggestionReceivedTrustmeshEntryType,
+		workstepType: common.WorkstepTypeInitial,
+	})
+
+	f.processor.Execute(context.Background(), committed(entry))
+
+	if len(f.rejected) != 1 || f.rejected[0].Id != entry.OffchainProcessMessageId {
+		t.Fatalf("expected reject feedback for offchain message %v, got %v", entry.OffchainProcessMessageId, f.rejected)
+	}
+	want := "Rejected because business object does not match schema: /amount: Must be less than or equal to 5; /currency: currency is required"
+	if f.rejectionMessages[0] != want {
+		t.Fatalf("feedback message = %v, want %v", f.rejectionMessages[0], want)
+	}
+	if len(f.sor.calls) != 0 {
+		t.Fatalf("rejected suggestion must not reach SOR, got %+v", f.sor.calls)
+	}
+	if state := f.commitmentState(t, entry); state != common.CommittedCommitmentState {
+		t.Fatalf("commitment state = %v, want %v", state, common.CommittedCommitmentState)
+	}
+}
+
+func TestGivenSuggestionReceivedMatchingSchemaWhenExecuteThenSorObjectCreated(t *testing.T) {
+	f := newFixture(t)
+	// sync tree leaves keep json types, amount is read back as number
+	f.registerSchema(t, `{"type":"object","required":["orderId","amount"],"properties":{"orderId":{"type":"string"},"amount":{"type":"number","minimum":1}}}`)
+	entry := f.createEntry(t, entryParams{
+		entryType:    common.SuggestionReceivedTrustmeshEntryType,
+		workstepType: common.WorkstepTypeInitial,
+	})
+
+	f.processor.Execute(context.Background(), committed(entry))
+
+	if len(f.rejected) != 0 {
+		t.Fatalf("suggestion matching schema must not be rejected, got %v", f.rejectionMessages)
+	}
+	if len(f.sor.calls) != 1 || f.sor.calls[0].webhookType != types.CreateObject {
+		t.Fatalf("expected SOR create object, got %+v", f.sor.calls)
+	}
+}
+
+func TestGivenSuggestionReceivedValidatedAgainstOtherSchemaWhenExecuteThenRejectFeedbackSent(t *testing.T) {
+	f := newFixture(t)
+	f.registerSchema(t, `{"type":"object","required":["orderId"]}`)
+	entry := f.createEntry(t, entryParams{
+		entryType:        common.SuggestionReceivedTrustmeshEntryType,
+		workstepType:     common.WorkstepTypeInitial,
+		senderSchemaHash: "hash-of-other-schema",
+	})
+
+	f.processor.Execute(context.Background(), committed(entry))
+
+	if len(f.rejected) != 1 || !strings.Contains(f.rejectionMessages[0], "schema not agreed") {
+		t.Fatalf("expected reject feedback for schema mismatch, got %v", f.rejectionMessages)
+	}
+	if len(f.sor.calls) != 0 {
+		t.Fatalf("rejected suggestion must not reach SOR, got %+v", f.sor.calls)
+	}
+}
+
+func TestGivenApprovalOfFinalWorkstepWhenExecuteThenTrustmeshExitedToEth(t *testing.T) {
+	f := newFixture(t)
+	approval := f.createFinalWorkstepApproval(t, common.WorkstepTypeFinal)
+
+	f.processor.Execute(context.Background(), committed(approval))
+
+	if len(f.blockchain.broadcasted) != 1 || f.blockchain.broadcasted[0].OpCode != 0 {
+		t.Fatalf("expected exit transaction broadcasted, got %+v", f.blockchain.broadcasted)
+	}
+	if len(f.eth.stored) != 1 || f.eth.stored[0] != f.blockchain.broadcasted[0].TransactionId {
+		t.Fatalf("expected exit proof stored for exit transaction, got %v", f.eth.stored)
+	}
+
+	trustmesh, _ := f.repositories.Trustmeshes.GetTrustmeshById(approval.TrustmeshId)
+	if trustmesh.EthExitTxHash != "0xexit" {
+		t.Fatalf("trustmesh eth exit hash = %v, want 0xexit", trustmesh.EthExitTxHash)
+	}
+	if len(f.messaging.sent) != 1 || f.messaging.sent[0].subject != common.EthTxHashNatsSubject {
+		t.Fatalf("expected eth exit hash sent to counterparty, got %+v", f.messaging.sent)
+	}
+	if state := f.commitmentState(t, approval); state != common.CommittedCommitmentState {
+		t.Fatalf("commitment state = %v, want %v", state, common.CommittedCommitmentState)
+	}
+}
+
+func TestGivenApprovalOfNonFinalWorkstepWhenExecuteThenTrustmeshNotExited(t *testing.T) {
+	f := newFixture(t)
+	approval := f.createFinalWorkstepApproval(t, common.WorkstepTypeNextWorkstep)
+
+	f.processor.Execute(context.Background(), committed(approval))
+
+	if len(f.blockchain.broadcasted) != 0 || len(f.eth.stored) != 0 {
+		t.Fatalf("non final workstep must not exit")
+	}
+	if len(f.sor.calls) != 1 || !f.sor.calls[0].approved {
+		t.Fatalf("expected approved SOR update, got %+v", f.sor.calls)
+	}
+}
+
+func TestGivenAlreadyExitedTrustmeshWhenApprovalOfFinalWorkstepThenNotExitedAgain(t *testing.T) {
+	f := newFixture(t)
+	approval := f.createFinalWorkstepApproval(t, common.WorkstepTypeFinal)
+	f.repositories.Trustmeshes.UpdateTrustmeshEthTxHash(approval.TrustmeshId, "0xearlier")
+
+	f.processor.Execute(context.Background(), committed(approval))
+
+	if len(f.blockchain.broadcasted) != 0 || len(f.eth.stored) != 0 {
+		t.Fatalf("exited trustmesh must not exit again")
+	}
+}
+
+func TestGivenRejectionReceivedWhenExecuteThenSorNotifiedAboutRejectionAndTrustmeshNotExited(t *testing.T) {
+	f := newFixture(t)
+	bboid := uuid.NewV4().String()
+	suggestion := f.createEntry(t, entryParams{
+		entryType:                  common.SuggestionSentTrustmeshEntryType,
+		workstepType:               common.WorkstepTypeFinal,
+		transactionType:            common.BaseledgerTransactionTypeSuggest,
+		baseledgerBusinessObjectId: bboid,
+	})
+	rejection := f.createEntry(t, entryParams{
+		entryType:                            common.FeedbackReceivedTrustmeshEntryType,
+		workstepType:                         common.WorkstepTypeFeedback,
+		transactionType:                      common.BaseledgerTransactionTypeReject,
+		referencedBaseledgerBusinessObjectId: bboid,
+		referencedTransactionId:              suggestion.BaseledgerTransactionId,
+	})
+
+	f.processor.Execute(context.Background(), committed(rejection))
+
+	if len(f.sor.calls) != 1 || f.sor.calls[0].approved {
+		t.Fatalf("expected rejected SOR update, got %+v", f.sor.calls)
+	}
+	if len(f.blockchain.broadcasted) != 0 || len(f.eth.stored) != 0 {
+		t.Fatalf("rejected final workstep must not exit")
+	}
+}
+
+func TestGivenMissingOffchainMessageWhenExecuteThenEntryNotCommitted(t *testing.T) {
+	f := newFixture(t)
+	entry := f.createEntry(t, entryParams{entryType: common.SuggestionSentTrustmeshEntryType, workstepType: common.WorkstepTypeInitial})
+	entry.OffchainProcessMessageId = uuid.NewV4()
+
+	f.processor.Execute(context.Background(), committed(entry))
+
+	if state := f.commitmentState(t, entry); state != common.UncommittedCommitmentState {
+		t.Fatalf("commitment state = %v, want %v", state, common.UncommittedCommitmentState)
+	}
+	if len(f.sor.calls) != 1 || f.sor.calls[0].approved {
+		t.Fatalf("expected failed SOR update, got %+v", f.sor.calls)
+	}
+}
+
+func TestGivenFailingEntryWhenExecuteUntilMaxAttemptsThenEntryDeadAndSorNotifiedOnce(t *testing.T) {
+	f := newFixture(t)
+	f.processor.Retry = types.RetryPolicy{MaxAttempts: 2, Backoff: time.Minute, MaxBackoff: time.Hour}
+	entry := f.createEntry(t, entryParams{entryType: common.SuggestionSentTrustmeshEntryType, workstepType: common.WorkstepTypeInitial})
+	entry.OffchainProcessMessageId = uuid.NewV4()
+
+	f.processor.Execute(context.Background(), committed(entry))
+
+	failed, _ := f.repositories.TrustmeshEntries.GetTrustmeshEntryById(entry.Id)
+	if failed.ProcessingState != common.FailedProcessingState || failed.ProcessingAttempts != 1 || !failed.ProcessingNextRetryAt.Valid {
+		t.Fatalf("expected failed entry scheduled for retry, got %v after %v attempts", failed.ProcessingState, failed.ProcessingAttempts)
+	}
+	if len(f.sor.calls) != 0 {
+		t.Fatalf("SOR must not be notified before entry is dead, got %+v", f.sor.calls)
+	}
+
+	failed.OffchainProcessMessageId = entry.OffchainProcessMessageId
+	f.processor.Execute(context.Background(), committed(failed))
+
+	dead, _ := f.repositories.TrustmeshEntries.GetTrustmeshEntryById(entry.Id)
+	if dead.ProcessingState != common.DeadProcessingState || dead.ProcessingLastError == "" {
+		t.Fatalf("processing state = %v, want %v", dead.ProcessingState, common.DeadProcessingState)
+	}
+	if len(f.sor.calls) != 1 || f.sor.calls[0].approved {
+		t.Fatalf("expected one failed SOR update, got %+v", f.sor.calls)
+	}
+}
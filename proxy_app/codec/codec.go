@@ -0,0 +1,115 @@
+// Package codec reads business objects in formats other than JSON into sync tree leaves and writes them back,
+// so that the receiver of a suggestion gets the business object in the format it was sent in
+package codec
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// formats of business objects, json is read by synctree itself
+const (
+	FormatJson    = "json"
+	FormatXml     = "xml"
+	FormatEdifact = "edifact"
+	FormatCsv     = "csv"
+)
+
+// ICodec converts business object to leaves and back. Leaves map field paths to values, path segments
+// are separated by dots and repeated fields are addressed by [index], the way synctree.Flatten names JSON fields.
+// Paths of the same business object have to be the same every time it is decoded. Leaves to encode come from
+// received sync trees, indexes and positions in their paths at or above leafCount, the number of leaves of
+// the tree, are refused, no business object of that many leaves has them
+type ICodec interface {
+	Decode(businessObject string) (map[string]string, error)
+	Encode(leaves map[string]string, leafCount int) (string, error)
+}
+
+var codecs = map[string]ICodec{
+	FormatXml:     &XmlCodec{},
+	FormatEdifact: &EdifactCodec{},
+	FormatCsv:     &CsvCodec{},
+}
+
+// Register adds codec of format or replaces it, codecs have to be registered before proxy starts
+func Register(format string, codec ICodec) {
+	codecs[format] = codec
+}
+
+// Get returns codec of format, json has no codec
+func Get(format string) (ICodec, error) {
+	codec, ok := codecs[format]
+	if !ok {
+		return nil, fmt.Errorf("business object format %v is not supported, supported formats are %v", format, strings.Join(Formats(), ", "))
+	}
+
+	return codec, nil
+}
+
+// Formats lists formats business objects can be sent in, json included
+func Formats() []string {
+	formats := []string{FormatJson}
+	for format := range codecs {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats[1:])
+	return formats
+}
+
+// characters of names that have a meaning in leaf paths or leaf values (path:value) are percent encoded,
+// # too so that names never collide with leaves codecs and sync tree add themselves (#format, #columns)
+var nameEscaper = strings.NewReplacer("%", "%25", ".", "%2E", ":", "%3A", "[", "%5B", "]", "%5D", "#", "%23")
+var nameUnescaper = strings.NewReplacer("%25", "%", "%2E", ".", "%3A", ":", "%5B", "[", "%5D", "]", "%23", "#")
+
+// emptyName is path segment of empty name, escaped names never have a bare %
+const emptyName = "%"
+
+// EscapeName makes element, attribute, column or json key name usable as path segment
+func EscapeName(name string) string {
+	if name == "" {
+		return emptyName
+	}
+	return nameEscaper.Replace(name)
+}
+
+func UnescapeName(segment string) string {
+	if segment == emptyName {
+		return ""
+	}
+	return nameUnescaper.Replace(segment)
+}
+
+type pathSegment struct {
+	name  string // escaped
+	index int    // -1 if segment is not addressed by index
+}
+
+// parsePath splits path into segments, indexes have to be below leafCount
+func parsePath(path string, leafCount int) ([]pathSegment, error) {
+	segments := []pathSegment{}
+	for _, part := range strings.Split(path, ".") {
+		segment := pathSegment{name: part, index: -1}
+		if open := strings.LastIndex(part, "["); open > 0 && strings.HasSuffix(part, "]") {
+			index, err := strconv.Atoi(part[open+1 : len(part)-1])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %v has invalid index", path)
+			}
+			if index >= leafCount {
+				return nil, fmt.Errorf("path %v has index above %v leaves", path, leafCount)
+			}
+			segment = pathSegment{name: part[:open], index: index}
+		}
+		if segment.name == "" {
+			return nil, fmt.Errorf("path %v has empty segment", path)
+		}
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+func indexed(path string, index int) string {
+	return path + "[" + strconv.Itoa(index) + "]"
+}
@@ -0,0 +1,158 @@
+package codec
+
+import (
+	"strings"
+	"testing"
+)
+
+const ublOrder = `<?xml version="1.0" encoding="UTF-8"?>
+<Order xmlns="urn:oasis:names:specification:ubl:schema:xsd:Order-2" xmlns:cbc="urn:cbc">
+  <cbc:ID>PO-1</cbc:ID>
+  <OrderLine><cbc:Quantity unitCode="EA">2</cbc:Quantity></OrderLine>
+  <OrderLine><cbc:Quantity unitCode="KG">1.5</cbc:Quantity><Note>a &amp; b</Note></OrderLine>
+</Order>`
+
+func TestGivenXmlWithAttributesAndRepeatedElementsWhenDecodeThenStablePaths(t *testing.T) {
+	leaves, err := (&XmlCodec{}).Decode(ublOrder)
+	if err != nil {
+		t.Fatalf("decode failed %v", err)
+	}
+
+	want := map[string]string{
+		"Order.@xmlns":       "urn:oasis:names:specification:ubl:schema:xsd:Order-2",
+		"Order.@xmlns%3Acbc": "urn:cbc",
+		"Order.#order":       "cbc:ID OrderLine",
+		"Order.cbc%3AID":     "PO-1",
+		"Order.OrderLine[0].cbc%3AQuantity.@unitCode": "EA",
+		"Order.OrderLine[0].cbc%3AQuantity.#text":     "2",
+		"Order.OrderLine[1].#order":                   "cbc:Quantity Note",
+		"Order.OrderLine[1].cbc%3AQuantity.@unitCode": "KG",
+		"Order.OrderLine[1].cbc%3AQuantity.#text":     "1.5",
+		"Order.OrderLine[1].Note":                     "a & b",
+	}
+	if len(leaves) != len(want) {
+		t.Fatalf("leaves = %v, want %v", leaves, want)
+	}
+	for path, value := range want {
+		if leaves[path] != value {
+			t.Fatalf("leaf %v = %q, want %q", path, leaves[path], value)
+		}
+	}
+}
+
+func TestGivenBusinessObjectsWhenEncodeDecodedLeavesThenSameLeaves(t *testing.T) {
+	businessObjects := map[string]string{
+		FormatXml:     ublOrder,
+		FormatEdifact: "UNA:+.? 'UNH+1+ORDERS:D:96A:UN'\nBGM+220+PO?+1+9'NAD+BY+++ACME?'s Shop'UNT+4+1'",
+		FormatCsv:     "sku,quantity,note\na-1,2,\"fragile, handle with care\"\nb.2,1,\n",
+	}
+
+	for format, businessObject := range businessObjects {
+		codec, err := Get(format)
+		if err != nil {
+			t.Fatalf("codec of %v missing %v", format, err)
+		}
+		leaves, err := codec.Decode(businessObject)
+		if err != nil {
+			t.Fatalf("decode of %v failed %v", format, err)
+		}
+		encoded, err := codec.Encode(leaves, len(leaves))
+		if err != nil {
+			t.Fatalf("encode of %v failed %v", format, err)
+		}
+		decoded, err := codec.Decode(encoded)
+		if err != nil {
+			t.Fatalf("decode of encoded %v failed %v, encoded %v", format, err, encoded)
+		}
+
+		if len(decoded) != len(leaves) {
+			t.Fatalf("%v leaves = %v, want %v", format, decoded, leaves)
+		}
+		for path, value := range leaves {
+			if decoded[path] != value {
+				t.Fatalf("%v leaf %v = %q, want %q", format, path, decoded[path], value)
+			}
+		}
+	}
+}
+
+func TestGivenEdifactWhenDecodeThenSegmentsElementsAndComponentsByPosition(t *testing.T) {
+	leaves, err := (&EdifactCodec{}).Decode("UNH+1+ORDERS:D:96A:UN'\r\nBGM+220+PO?+1'")
+	if err != nil {
+		t.Fatalf("decode failed %v", err)
+	}
+
+	want := map[string]string{
+		"segments[0].tag":   "UNH",
+		"segments[0].d1":    "1",
+		"segments[0].d2.c1": "ORDERS",
+		"segments[0].d2.c4": "UN",
+		"segments[1].tag":   "BGM",
+		"segments[1].d2":    "PO+1",
+	}
+	for path, value := range want {
+		if leaves[path] != value {
+			t.Fatalf("leaf %v = %q, want %q", path, leaves[path], value)
+		}
+	}
+	if _, ok := leaves[edifactServiceStringLeaf]; ok {
+		t.Fatalf("una leaf without UNA segment")
+	}
+
+	encoded, err := (&EdifactCodec{}).Encode(leaves, len(leaves))
+	if err != nil || encoded != "UNH+1+ORDERS:D:96A:UN'BGM+220+PO?+1'" {
+		t.Fatalf("encoded = %q, %v", encoded, err)
+	}
+}
+
+func TestGivenInvalidBusinessObjectsWhenDecodeThenError(t *testing.T) {
+	invalid := []struct {
+		format         string
+		businessObject string
+	}{
+		{FormatXml, "<Order><ID>1</Order>"},
+		{FormatXml, "<Order/><Order/>"},
+		{FormatEdifact, "UNH+1+ORDERS"},
+		{FormatEdifact, "+1'"},
+		{FormatCsv, "sku,sku\n1,2\n"},
+		{FormatCsv, ""},
+	}
+
+	for _, tc := range invalid {
+		codec, _ := Get(tc.format)
+		if _, err := codec.Decode(tc.businessObject); err == nil {
+			t.Fatalf("decode of %v %q succeeded, want error", tc.format, tc.businessObject)
+		}
+	}
+}
+
+func TestGivenLeavesWithIndexAboveLeafCountOrInvalidNameWhenEncodeThenError(t *testing.T) {
+	invalid := []struct {
+		format string
+		leaves map[string]string
+	}{
+		{FormatXml, map[string]string{"root.a[999999999]": "1"}},
+		{FormatXml, map[string]string{"root.a><x": "1"}},
+		{FormatXml, map[string]string{"root.@a=\"1\" b": "1"}},
+		{FormatXml, map[string]string{"1root.a": "1"}},
+		{FormatEdifact, map[string]string{"segments[0].tag": "UNH", "segments[0].d2000000000": "1"}},
+		{FormatEdifact, map[string]string{"segments[0].tag": "UNH", "segments[0].d1.c2000000000": "1"}},
+		{FormatEdifact, map[string]string{"segments[9223372036854775807].tag": "UNH"}},
+		{FormatCsv, map[string]string{"#columns": "sku", "rows[999999999].sku": "1"}},
+	}
+
+	for _, tc := range invalid {
+		codec, _ := Get(tc.format)
+		if encoded, err := codec.Encode(tc.leaves, 16); err == nil {
+			t.Fatalf("encode of %v %v = %q, want error", tc.format, tc.leaves, encoded)
+		}
+	}
+}
+
+func TestGivenUnknownFormatWhenGetThenErrorListsFormats(t *testing.T) {
+	_, err := Get("x12")
+
+	if err == nil || !strings.Contains(err.Error(), "json, csv, edifact, xml") {
+		t.Fatalf("error = %v, want supported formats listed", err)
+	}
+}
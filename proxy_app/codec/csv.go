@@ -0,0 +1,113 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const csvColumnsLeaf = "#columns" // header line, keeps order of columns
+
+// CsvCodec reads comma separated values with header line into leaves. Each record is rows[i] with
+// fields named by column, order of columns is kept in leaf #columns
+type CsvCodec struct {
+}
+
+func (c *CsvCodec) Decode(businessObject string) (map[string]string, error) {
+	reader := csv.NewReader(strings.NewReader(businessObject))
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("business object is not valid csv %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("business object csv has no header line")
+	}
+
+	columns := records[0]
+	seen := map[string]bool{}
+	for _, column := range columns {
+		if column == "" {
+			return nil, errors.New("business object csv has empty column name")
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("business object csv has column %v more than once", column)
+		}
+		seen[column] = true
+	}
+
+	header, err := csvLine(columns)
+	if err != nil {
+		return nil, err
+	}
+	leaves := map[string]string{csvColumnsLeaf: header}
+	for i, record := range records[1:] {
+		for j, value := range record {
+			leaves[indexed("rows", i)+"."+EscapeName(columns[j])] = value
+		}
+	}
+
+	return leaves, nil
+}
+
+func (c *CsvCodec) Encode(leaves map[string]string, leafCount int) (string, error) {
+	header, ok := leaves[csvColumnsLeaf]
+	if !ok {
+		return "", errors.New("leaf #columns is missing")
+	}
+	columns, err := csv.NewReader(strings.NewReader(header)).Read()
+	if err != nil {
+		return "", fmt.Errorf("leaf #columns is not a csv line %w", err)
+	}
+
+	rows := map[int]map[string]string{}
+	for path, value := range leaves {
+		if path == csvColumnsLeaf {
+			continue
+		}
+		segments, err := parsePath(path, leafCount)
+		if err != nil {
+			return "", err
+		}
+		if len(segments) != 2 || segments[0].name != "rows" || segments[0].index < 0 || segments[1].index >= 0 {
+			return "", fmt.Errorf("path %v is not a row field", path)
+		}
+		if _, ok := rows[segments[0].index]; !ok {
+			rows[segments[0].index] = map[string]string{}
+		}
+		rows[segments[0].index][UnescapeName(segments[1].name)] = value
+	}
+
+	indexes := []int{}
+	for index := range rows {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	records := [][]string{columns}
+	for _, index := range indexes {
+		record := make([]string, len(columns))
+		for j, column := range columns {
+			record[j] = rows[index][column]
+		}
+		records = append(records, record)
+	}
+
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	if err := writer.WriteAll(records); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func csvLine(record []string) (string, error) {
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	if err := writer.WriteAll([][]string{record}); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
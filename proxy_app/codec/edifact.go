@@ -0,0 +1,249 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// default service characters: component, data element, decimal mark, release, reserved and segment terminator
+const edifactDefaultServiceString = ":+.? '"
+
+const edifactServiceStringLeaf = "una"
+
+// EdifactCodec reads EDIFACT interchanges (i.e. ORDERS) into leaves. Segments keep their order in
+// segments[i], with tag and data elements d1, d2, .. numbered by position. Composite data elements have
+// components c1, c2, .. Service characters of an UNA segment are kept in leaf una. Line breaks between
+// segments are not kept
+type EdifactCodec struct {
+}
+
+type edifactSeparators struct {
+	component, element, release, terminator rune
+}
+
+func newEdifactSeparators(serviceString string) edifactSeparators {
+	chars := []rune(serviceString)
+	return edifactSeparators{component: chars[0], element: chars[1], release: chars[3], terminator: chars[5]}
+}
+
+func (c *EdifactCodec) Decode(businessObject string) (map[string]string, error) {
+	leaves := map[string]string{}
+	data := strings.TrimLeft(businessObject, " \r\n\t")
+
+	serviceString := edifactDefaultServiceString
+	if strings.HasPrefix(data, "UNA") {
+		chars := []rune(data[3:])
+		if len(chars) < 6 {
+			return nil, errors.New("business object edifact has incomplete UNA segment")
+		}
+		serviceString = string(chars[:6])
+		leaves[edifactServiceStringLeaf] = serviceString
+		data = string(chars[6:])
+	}
+	separators := newEdifactSeparators(serviceString)
+
+	segments, err := splitEdifact(data, separators)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return nil, errors.New("business object edifact has no segments")
+	}
+
+	for i, segment := range segments {
+		path := indexed("segments", i)
+		if len(segment[0]) != 1 || segment[0][0] == "" {
+			return nil, fmt.Errorf("segment %v of business object edifact has no tag", i+1)
+		}
+		leaves[path+".tag"] = segment[0][0]
+
+		for j, element := range segment[1:] {
+			elementPath := path + ".d" + strconv.Itoa(j+1)
+			if len(element) == 1 {
+				leaves[elementPath] = element[0]
+				continue
+			}
+			for k, component := range element {
+				leaves[elementPath+".c"+strconv.Itoa(k+1)] = component
+			}
+		}
+	}
+
+	return leaves, nil
+}
+
+// splitEdifact returns segments of data elements of components, service characters preceded by
+// release character are part of the value
+func splitEdifact(data string, separators edifactSeparators) ([][][]string, error) {
+	segments := [][][]string{}
+	segment := [][]string{}
+	element := []string{}
+	value := strings.Builder{}
+	empty := true
+
+	for chars, i := []rune(data), 0; i < len(chars); i++ {
+		char := chars[i]
+		switch {
+		case char == separators.release:
+			if i+1 == len(chars) {
+				return nil, errors.New("business object edifact ends with release character")
+			}
+			i++
+			value.WriteRune(chars[i])
+			empty = false
+		case char == separators.component:
+			element = append(element, value.String())
+			value.Reset()
+			empty = false
+		case char == separators.element:
+			segment = append(segment, append(element, value.String()))
+			element = []string{}
+			value.Reset()
+			empty = false
+		case char == separators.terminator:
+			segments = append(segments, append(segment, append(element, value.String())))
+			segment, element = [][]string{}, []string{}
+			value.Reset()
+			empty = true
+		case empty && (char == '\r' || char == '\n'):
+			// line breaks between segments
+		default:
+			value.WriteRune(char)
+			empty = false
+		}
+	}
+	if !empty {
+		return nil, errors.New("business object edifact has unterminated segment")
+	}
+
+	return segments, nil
+}
+
+func (c *EdifactCodec) Encode(leaves map[string]string, leafCount int) (string, error) {
+	serviceString, hasServiceString := leaves[edifactServiceStringLeaf]
+	if !hasServiceString {
+		serviceString = edifactDefaultServiceString
+	} else if len([]rune(serviceString)) != 6 {
+		return "", errors.New("leaf una has to hold 6 service characters")
+	}
+	separators := newEdifactSeparators(serviceString)
+
+	// segment index -> data element number -> component number -> value, component 0 is simple data element
+	segments := map[int]map[int]map[int]string{}
+	tags := map[int]string{}
+	for path, value := range leaves {
+		if path == edifactServiceStringLeaf {
+			continue
+		}
+		pathSegments, err := parsePath(path, leafCount)
+		if err != nil {
+			return "", err
+		}
+		if len(pathSegments) < 2 || len(pathSegments) > 3 || pathSegments[0].name != "segments" || pathSegments[0].index < 0 {
+			return "", fmt.Errorf("path %v is not a segment field", path)
+		}
+		index := pathSegments[0].index
+		if _, ok := segments[index]; !ok {
+			segments[index] = map[int]map[int]string{}
+		}
+		if pathSegments[1].name == "tag" && len(pathSegments) == 2 {
+			tags[index] = value
+			continue
+		}
+
+		element, ok := edifactPosition(pathSegments[1], "d", leafCount)
+		component := 0
+		if ok && len(pathSegments) == 3 {
+			component, ok = edifactPosition(pathSegments[2], "c", leafCount)
+		}
+		if !ok {
+			return "", fmt.Errorf("path %v is not a segment field", path)
+		}
+		if _, exists := segments[index][element]; !exists {
+			segments[index][element] = map[int]string{}
+		}
+		segments[index][element][component] = value
+	}
+	if len(segments) == 0 {
+		return "", errors.New("business object has no leaves")
+	}
+
+	indexes := []int{}
+	for index := range segments {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	escaper := strings.NewReplacer(
+		string(separators.release), string(separators.release)+string(separators.release),
+		string(separators.component), string(separators.release)+string(separators.component),
+		string(separators.element), string(separators.release)+string(separators.element),
+		string(separators.terminator), string(separators.release)+string(separators.terminator),
+	)
+
+	buf := strings.Builder{}
+	if hasServiceString {
+		buf.WriteString("UNA" + serviceString)
+	}
+	for _, index := range indexes {
+		tag, ok := tags[index]
+		if !ok || tag == "" {
+			return "", fmt.Errorf("segment %v has no tag", index)
+		}
+		buf.WriteString(escaper.Replace(tag))
+
+		elements := segments[index]
+		for element := 1; element <= maxKey(elements); element++ {
+			buf.WriteRune(separators.element)
+			components := elements[element]
+			if value, simple := components[0]; simple {
+				buf.WriteString(escaper.Replace(value))
+				continue
+			}
+			for component := 1; component <= maxKey(components); component++ {
+				if component > 1 {
+					buf.WriteRune(separators.component)
+				}
+				buf.WriteString(escaper.Replace(components[component]))
+			}
+		}
+		buf.WriteRune(separators.terminator)
+	}
+
+	return buf.String(), nil
+}
+
+// edifactPosition reads 1-based position of data element (d1) or component (c1) from path segment, every
+// position before it has a leaf, so it is not above leafCount
+func edifactPosition(segment pathSegment, prefix string, leafCount int) (int, bool) {
+	if segment.index >= 0 || !strings.HasPrefix(segment.name, prefix) {
+		return 0, false
+	}
+	position, err := strconv.Atoi(segment.name[len(prefix):])
+	if err != nil || position < 1 || position > leafCount {
+		return 0, false
+	}
+	return position, true
+}
+
+func maxKey(values interface{}) int {
+	max := 0
+	switch v := values.(type) {
+	case map[int]map[int]string:
+		for key := range v {
+			if key > max {
+				max = key
+			}
+		}
+	case map[int]string:
+		for key := range v {
+			if key > max {
+				max = key
+			}
+		}
+	}
+	return max
+}
@@ -0,0 +1,290 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// leaf names of xml elements, they can not clash with element names
+const (
+	xmlTextLeaf      = "#text"  // text of element that also has attributes or child elements
+	xmlOrderLeaf     = "#order" // names of child elements in document order, separated by spaces
+	xmlAttributeMark = "@"
+)
+
+// XmlCodec reads xml documents (i.e. UBL or IDoc) into leaves. Root element is the first path segment,
+// child elements and attributes (@name) follow, namespace prefixes are kept as written. An element that
+// occurs more than once in its parent is addressed by index. Comments, processing instructions and the
+// interleaving of different repeated elements are not kept, elements of the same name are written together
+type XmlCodec struct {
+}
+
+type xmlElement struct {
+	name     string
+	attrs    []xml.Attr
+	text     strings.Builder
+	children []*xmlElement
+}
+
+func (c *XmlCodec) Decode(businessObject string) (map[string]string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(businessObject))
+	var root *xmlElement
+	stack := []*xmlElement{}
+
+	for {
+		// raw tokens keep namespace prefixes as written instead of resolving them to urls
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("business object is not valid xml %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			element := &xmlElement{name: xmlName(t.Name), attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, element)
+			} else if root != nil {
+				return nil, errors.New("business object xml has more than one root element")
+			} else {
+				root = element
+			}
+			stack = append(stack, element)
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1].name != xmlName(t.Name) {
+				return nil, fmt.Errorf("business object xml has unexpected end element %v", xmlName(t.Name))
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errors.New("business object xml has text outside of root element")
+			}
+		}
+	}
+	if root == nil || len(stack) > 0 {
+		return nil, errors.New("business object xml has no complete root element")
+	}
+
+	leaves := map[string]string{}
+	addXmlLeaves(root, EscapeName(root.name), leaves)
+	return leaves, nil
+}
+
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+func addXmlLeaves(element *xmlElement, path string, leaves map[string]string) {
+	text := element.text.String()
+	if len(element.attrs) == 0 && len(element.children) == 0 {
+		leaves[path] = text
+		return
+	}
+
+	for _, attr := range element.attrs {
+		leaves[path+"."+xmlAttributeMark+EscapeName(xmlName(attr.Name))] = attr.Value
+	}
+	if len(element.children) > 0 {
+		text = strings.TrimSpace(text)
+	}
+	if text != "" {
+		leaves[path+"."+xmlTextLeaf] = text
+	}
+
+	names := []string{}
+	byName := map[string][]*xmlElement{}
+	for _, child := range element.children {
+		if _, ok := byName[child.name]; !ok {
+			names = append(names, child.name)
+		}
+		byName[child.name] = append(byName[child.name], child)
+	}
+	if len(names) > 1 {
+		leaves[path+"."+xmlOrderLeaf] = strings.Join(names, " ")
+	}
+
+	for _, name := range names {
+		children := byName[name]
+		childPath := path + "." + EscapeName(name)
+		if len(children) == 1 {
+			addXmlLeaves(children[0], childPath, leaves)
+			continue
+		}
+		for i, child := range children {
+			addXmlLeaves(child, indexed(childPath, i), leaves)
+		}
+	}
+}
+
+type xmlNode struct {
+	attrs    map[string]string
+	text     string
+	order    []string
+	children map[string][]*xmlNode
+}
+
+func newXmlNode() *xmlNode {
+	return &xmlNode{attrs: map[string]string{}, children: map[string][]*xmlNode{}}
+}
+
+func (c *XmlCodec) Encode(leaves map[string]string, leafCount int) (string, error) {
+	rootName := ""
+	root := newXmlNode()
+
+	for path, value := range leaves {
+		segments, err := parsePath(path, leafCount)
+		if err != nil {
+			return "", err
+		}
+		if rootName != "" && segments[0].name != rootName {
+			return "", fmt.Errorf("leaves have more than one root element, %v and %v", rootName, segments[0].name)
+		}
+		rootName = segments[0].name
+
+		node := root
+		for i, segment := range segments[1:] {
+			last := i == len(segments)-2
+			switch {
+			case last && strings.HasPrefix(segment.name, xmlAttributeMark):
+				attrName := UnescapeName(segment.name[len(xmlAttributeMark):])
+				if !isXmlName(attrName) {
+					return "", fmt.Errorf("path %v has invalid xml attribute name", path)
+				}
+				node.attrs[attrName] = value
+				continue
+			case last && segment.name == xmlTextLeaf:
+				node.text = value
+				continue
+			case last && segment.name == xmlOrderLeaf:
+				node.order = strings.Fields(value)
+				continue
+			}
+			childName := UnescapeName(segment.name)
+			if !isXmlName(childName) {
+				return "", fmt.Errorf("path %v has invalid xml element name", path)
+			}
+			node = node.child(childName, segment.index)
+		}
+		if !strings.HasPrefix(segments[len(segments)-1].name, "#") && !strings.HasPrefix(segments[len(segments)-1].name, xmlAttributeMark) {
+			node.text = value
+		}
+	}
+	if rootName == "" {
+		return "", errors.New("business object has no leaves")
+	}
+	if !isXmlName(UnescapeName(rootName)) {
+		return "", fmt.Errorf("root element %v has invalid xml name", rootName)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	if err := root.write(buf, UnescapeName(rootName)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (n *xmlNode) child(name string, index int) *xmlNode {
+	if index < 0 {
+		index = 0
+	}
+	for len(n.children[name]) <= index {
+		n.children[name] = append(n.children[name], newXmlNode())
+	}
+	return n.children[name][index]
+}
+
+func (n *xmlNode) write(buf *bytes.Buffer, name string) error {
+	buf.WriteString("<" + name)
+
+	attrNames := []string{}
+	for attrName := range n.attrs {
+		attrNames = append(attrNames, attrName)
+	}
+	// namespace declarations first, the way documents are usually written
+	sort.Slice(attrNames, func(i, j int) bool {
+		iNs, jNs := isNamespaceDeclaration(attrNames[i]), isNamespaceDeclaration(attrNames[j])
+		if iNs != jNs {
+			return iNs
+		}
+		return attrNames[i] < attrNames[j]
+	})
+	for _, attrName := range attrNames {
+		buf.WriteString(" " + attrName + `="`)
+		if err := xml.EscapeText(buf, []byte(n.attrs[attrName])); err != nil {
+			return err
+		}
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">")
+
+	if err := xml.EscapeText(buf, []byte(n.text)); err != nil {
+		return err
+	}
+	for _, childName := range n.childOrder() {
+		for _, child := range n.children[childName] {
+			if err := child.write(buf, childName); err != nil {
+				return err
+			}
+		}
+	}
+
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+// childOrder is the document order of child names, names missing in it are written last sorted by name
+func (n *xmlNode) childOrder() []string {
+	names := []string{}
+	written := map[string]bool{}
+	for _, name := range n.order {
+		if _, ok := n.children[name]; ok && !written[name] {
+			names = append(names, name)
+			written[name] = true
+		}
+	}
+
+	rest := []string{}
+	for name := range n.children {
+		if !written[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+// isXmlName reports whether name can be written as element or attribute name, names come from leaf
+// paths of received sync trees and are written into markup as they are
+func isXmlName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, char := range name {
+		switch {
+		case unicode.IsLetter(char) || char == '_' || char == ':':
+		case i > 0 && (unicode.IsDigit(char) || char == '-' || char == '.' || char == '\u00B7' || unicode.In(char, unicode.Mn, unicode.Mc)):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isNamespaceDeclaration(attrName string) bool {
+	return attrName == "xmlns" || strings.HasPrefix(attrName, "xmlns:")
+}
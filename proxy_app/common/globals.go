@@ -3,6 +3,13 @@ package common
 const UncommittedCommitmentState = "UNCOMMITTED"
 const CommittedCommitmentState = "COMMITTED"
 const InvalidCommitmentState = "INVALID"
+const PendingBroadcastCommitmentState = "PENDING_BROADCAST" // created, transaction not yet broadcasted
+
+const PendingProcessingState = "PENDING"       // waiting for commitment of transaction
+const ProcessingProcessingState = "PROCESSING" // business logic running, picked up again after processing timeout
+const CommittedProcessingState = "COMMITTED"   // business logic finished
+const FailedProcessingState = "FAILED"         // business logic failed, retried at next retry time
+const DeadProcessingState = "DEAD"             // not retried anymore, needs manual intervention
 
 const SuggestionSentTrustmeshEntryType = "SuggestionSent"
 const SuggestionReceivedTrustmeshEntryType = "SuggestionReceived"
@@ -7,12 +7,13 @@ import (
 	"log"
 	"net/http"
 	"net/http/cookiejar"
-	"net/http/httputil"
 
-	"github.com/spf13/viper"
+	"github.com/unibrightio/proxy-api/config"
 	"github.com/unibrightio/proxy-api/logger"
 )
 
+var concircleLog = logger.For("concircle")
+
 type PostBusinessObjectDto struct {
 	ID                 string          `json:"id"`
 	Type               string          `json:"type"`
@@ -89,8 +90,6 @@ func PostBusinessObject(
 
 	postBOUrl := formatReqUrl("ubc/ubc/business_objects")
 
-	logger.Infof("businessObjectPayload: %s\n", businessObjectPayload)
-
 	postBoDto := PostBusinessObjectDto{
 		ID:                 baseledgerObjectId,
 		Type:               businessObjectType,
@@ -104,8 +103,8 @@ func PostBusinessObject(
 	bodyBytes, _ := json.Marshal(postBoDto)
 	reader := bytes.NewReader(bodyBytes)
 
-	logger.Infof("POSTING NEW OBJECT URL: %s\n", postBOUrl)
-	logger.Infof("POSTING NEW OBJECT BODY: %s\n", postBoDto)
+	concircleLog.Info("posting new object", logger.F("url", postBOUrl), logger.F("baseledger_business_object_id", baseledgerObjectId))
+	concircleLog.Debug("new object body", logger.Payload("body", string(bodyBytes)))
 
 	req, err := http.NewRequest("POST", postBOUrl, reader)
 	if err != nil {
@@ -117,21 +116,14 @@ func PostBusinessObject(
 		req.AddCookie(c)
 	}
 
-	// Save a copy of this request for debugging.
-	requestDump, err := httputil.DumpRequest(req, true)
-	if err != nil {
-		logger.Errorf("DumpRequest error %s\n", err.Error())
-	}
-
-	logger.Infof(string(requestDump))
-
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Errorf("Concircle post bo req error %v\n", err.Error())
 	}
 
-	logger.Infof("BO RESP %v\n", resp)
-	logger.Infof("BO RESP BODY %v\n", resp.Body)
+	if resp != nil {
+		concircleLog.Info("new object posted", logger.F("status", resp.StatusCode))
+	}
 }
 
 func PutStatusUpdate(
@@ -160,8 +152,7 @@ func PutStatusUpdate(
 	bodyBytes, _ := json.Marshal(postStatusUpdateDto)
 	reader := bytes.NewReader(bodyBytes)
 
-	logger.Infof("POSTING STATUS UPDATE URL: %v\n", postStatusUpdateUrl)
-	logger.Infof("POSTING STATUS UPDATE BODY: %v\n", postStatusUpdateDto)
+	concircleLog.Info("posting status update", logger.F("url", postStatusUpdateUrl), logger.F("status", status), logger.F("baseledger_business_object_id", baseledgerObjectId))
 
 	req, err := http.NewRequest("PUT", postStatusUpdateUrl, reader)
 	if err != nil {
@@ -178,14 +169,15 @@ func PutStatusUpdate(
 		logger.Errorf("Concircle post status update error %v\n", err.Error())
 	}
 
-	logger.Infof("STATUS UPDATE RESP %v\n", resp)
-	logger.Infof("STATUS UPDATE RESP BODY %v\n", resp.Body)
+	if resp != nil {
+		concircleLog.Info("status update posted", logger.F("status", resp.StatusCode))
+	}
 }
 
 func formatReqUrl(endpoint string) string {
-	concircleUrl := viper.GetString("API_CONCIRCLE_URL") // s4h.rp.concircle.com
-	concircleUser := viper.GetString("API_CONCIRCLE_USER")
-	concirclePwd := viper.GetString("API_CONCIRCLE_PWD")
+	concircleUrl := config.Get().Concircle.Url // s4h.rp.concircle.com
+	concircleUser := config.Get().Concircle.User
+	concirclePwd := config.Get().Concircle.Password
 
 	return "https://" + concircleUser + ":" + concirclePwd + "@" + concircleUrl + "/" + endpoint
 }
@@ -1,51 +1,129 @@
 package cron
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"hash/fnv"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-co-op/gocron"
-	"github.com/spf13/viper"
+	uuid "github.com/kthomas/go.uuid"
 
 	proxytypes "github.com/unibrightio/proxy-api/types"
 
-	common "github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/config"
 	"github.com/unibrightio/proxy-api/dbutil"
 	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/ratelimit"
 
 	businesslogic "github.com/unibrightio/proxy-api/business_logic"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/saga"
+	"github.com/unibrightio/proxy-api/tracing"
 )
 
-func queryTrustmeshes() {
+func queryTrustmeshes(ctx context.Context) {
+	runningJobs.Add(1)
+	defer runningJobs.Done()
+
+	// only one replica polls, the others take over when its lock connection is gone
+	leading := leader.IsLeader(ctx)
+	isLeader.Store(leading)
+	if !leading {
+		logger.Debug("not cron leader, skipping query trustmesh")
+		return
+	}
+
 	logger.Info("query trustmesh start")
+	cronConfig := config.Get().Cron
+	trustmeshEntries, err := repository.Postgres().TrustmeshEntries.ClaimTrustmeshEntriesToProcess(time.Now(), cronConfig.BatchSize, cronConfig.ProcessingTimeout)
+	if err != nil {
+		return
+	}
+
+	logger.Infof("claimed %v trustmesh entries\n", len(trustmeshEntries))
+	ProcessEntries(ctx, trustmeshEntries, businesslogic.ExecuteBusinessLogic)
 
-	var trustmeshEntries []proxytypes.TrustmeshEntry
-	dbutil.Db.GetConn().Where("commitment_state=?", common.UncommittedCommitmentState).Find(&trustmeshEntries)
+	// entries not finished because of shutdown are claimed again by the next leader once released
+	claimedIds := make([]uuid.UUID, len(trustmeshEntries))
+	for i, trustmeshEntry := range trustmeshEntries {
+		claimedIds[i] = trustmeshEntry.Id
+	}
+	if err = repository.Postgres().TrustmeshEntries.ReleaseTrustmeshEntryClaims(claimedIds); err != nil {
+		logger.Errorf("error releasing claimed trustmesh entries %v, claims expire after %v", err, cronConfig.ProcessingTimeout)
+	}
 
-	logger.Infof("found %v trustmesh entries\n", len(trustmeshEntries))
-	var jobs = make(chan proxytypes.Job, len(trustmeshEntries))
-	var results = make(chan proxytypes.Result, len(trustmeshEntries))
-	createWorkerPool(1, jobs, results)
+	lastSuccessfulPoll.Store(time.Now())
+	logger.Info("query trustmesh end")
+}
 
-	for _, trustmeshEntry := range trustmeshEntries {
-		logger.Infof("creating job for %v\n", trustmeshEntry.TransactionHash)
-		job := proxytypes.Job{TrustmeshEntry: trustmeshEntry}
-		jobs <- job
+// ProcessEntries looks up transactions of entries on chain and runs execute with each result,
+// entries are partitioned by trustmesh over the configured workers and run in given order within a trustmesh
+func ProcessEntries(ctx context.Context, trustmeshEntries []proxytypes.TrustmeshEntry, execute func(ctx context.Context, txResult proxytypes.Result)) {
+	results := make(chan proxytypes.Result)
+	var workers sync.WaitGroup
+	for _, partition := range partitionByTrustmesh(trustmeshEntries, config.Get().Cron.Workers) {
+		workers.Add(1)
+		go func(jobs []proxytypes.Job) {
+			defer workers.Done()
+			worker(ctx, jobs, results, execute)
+		}(partition)
 	}
-	close(jobs)
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
 
 	for result := range results {
 		logger.Infof("Tx hash %v, height %v, timestamp %v\n", result.Job.TrustmeshEntry.TransactionHash, result.TxInfo.TxHeight, result.TxInfo.TxTimestamp)
 	}
+}
 
-	logger.Info("query trustmesh end")
+// IsLeader is true if this replica held the leader lock on last query trustmeshes run
+func IsLeader() bool {
+	leading, _ := isLeader.Load().(bool)
+	return leading
+}
+
+// partitionByTrustmesh splits entries into at most noOfWorkers non empty partitions,
+// all entries of a trustmesh are in the same partition in the same order
+func partitionByTrustmesh(trustmeshEntries []proxytypes.TrustmeshEntry, noOfWorkers int) [][]proxytypes.Job {
+	if noOfWorkers < 1 {
+		noOfWorkers = 1
+	}
+
+	partitions := make([][]proxytypes.Job, noOfWorkers)
+	for _, trustmeshEntry := range trustmeshEntries {
+		hash := fnv.New32a()
+		hash.Write(trustmeshEntry.TrustmeshId.Bytes())
+		i := hash.Sum32() % uint32(noOfWorkers)
+		logger.Infof("creating job for %v\n", trustmeshEntry.TransactionHash)
+		partitions[i] = append(partitions[i], proxytypes.Job{TrustmeshEntry: trustmeshEntry})
+	}
+
+	nonEmpty := [][]proxytypes.Job{}
+	for _, partition := range partitions {
+		if len(partition) > 0 {
+			nonEmpty = append(nonEmpty, partition)
+		}
+	}
+	return nonEmpty
+}
+
+// LastSuccessfulPoll returns time when query trustmeshes run last finished, zero if it did not yet
+func LastSuccessfulPoll() time.Time {
+	t, _ := lastSuccessfulPoll.Load().(time.Time)
+	return t
 }
 
 func getTxInfo(txHash string) (txInfo *proxytypes.TxInfo, err error) {
 	// fetching tx details
-	str := "http://" + viper.Get("TENDERMINT_API_URL").(string) + "/tx?hash=0x" + txHash
+	str := "http://" + config.Get().Blockchain.TendermintUrl + "/tx?hash=0x" + txHash
 	httpRes, err := http.Get(str)
 	if err != nil {
 		logger.Errorf("error during http tx req %v\n", err)
@@ -66,7 +144,7 @@ func getTxInfo(txHash string) (txInfo *proxytypes.TxInfo, err error) {
 		return &proxytypes.TxInfo{}, errors.New("error decoding tx")
 	}
 	// query for block at specific height to find timestamp
-	str = "http://" + viper.Get("TENDERMINT_API_URL").(string) + "/block?height" + committedTx.TxResult.Height
+	str = "http://" + config.Get().Blockchain.TendermintUrl + "/block?height=" + committedTx.TxResult.Height
 	httpRes, err = http.Get(str)
 	if err != nil {
 		logger.Errorf("error during http block req %v\n", err)
@@ -93,9 +171,14 @@ func getTxInfo(txHash string) (txInfo *proxytypes.TxInfo, err error) {
 	}, nil
 }
 
-func worker(jobs chan proxytypes.Job, results chan proxytypes.Result) {
-	defer close(results)
-	for job := range jobs {
+func worker(ctx context.Context, jobs []proxytypes.Job, results chan<- proxytypes.Result, execute func(ctx context.Context, txResult proxytypes.Result)) {
+	for _, job := range jobs {
+		// on shutdown job in progress is finished, remaining entries stay uncommitted and are picked up on next start
+		if ctx.Err() != nil {
+			logger.Infof("shutting down, skipping job for %v", job.TrustmeshEntry.TransactionHash)
+			continue
+		}
+
 		txInfo, err := getTxInfo(job.TrustmeshEntry.TransactionHash)
 		if err != nil {
 			// here it would be http error
@@ -104,20 +187,102 @@ func worker(jobs chan proxytypes.Job, results chan proxytypes.Result) {
 		}
 		logger.Infof("result tx %v transaction type %v\n", txInfo, job.TrustmeshEntry.BaseledgerTransactionType)
 		output := proxytypes.Result{Job: job, TxInfo: *txInfo}
-		businesslogic.ExecuteBusinessLogic(output)
+		// not derived from ctx, started business logic is finished even during shutdown
+		traceCtx := tracing.Deserialize(context.Background(), job.TrustmeshEntry.TraceContext)
+		execute(traceCtx, output)
 		results <- output
 	}
 }
 
-func createWorkerPool(noOfWorkers int, jobs chan proxytypes.Job, results chan proxytypes.Result) {
-	for i := 0; i < noOfWorkers; i++ {
-		go worker(jobs, results)
+var scheduler *gocron.Scheduler
+var queryTrustmeshesJob *gocron.Job
+var queryTrustmeshesInterval time.Duration
+var cronCtx context.Context
+var schedulerMutex sync.Mutex
+var runningJobs sync.WaitGroup
+var lastSuccessfulPoll atomic.Value
+var isLeader atomic.Value
+var leader *dbutil.Leader
+
+// StartCron schedules jobs, ctx is cancelled on shutdown and job runs stop taking new work
+func StartCron(ctx context.Context) {
+	cronCtx = ctx
+	leader = dbutil.NewLeader(int64(config.Get().Cron.LeaderLockKey))
+	scheduler = gocron.NewScheduler(time.UTC)
+	scheduleQueryTrustmeshes(config.Get().Cron.PollInterval)
+	scheduler.Every(1).Hour().SingletonMode().Do(ratelimit.DeleteExpired)
+	scheduler.Every(1).Minute().SingletonMode().Do(recoverPendingBroadcasts, cronCtx)
+
+	config.OnReload(func(c *config.Config) {
+		if c.Cron.PollInterval != queryTrustmeshesInterval {
+			scheduleQueryTrustmeshes(c.Cron.PollInterval)
+		}
+	})
+
+	scheduler.StartAsync()
+}
+
+// recoverPendingBroadcasts finishes or compensates suggestions and feedbacks interrupted between creation and broadcast
+func recoverPendingBroadcasts(ctx context.Context) {
+	runningJobs.Add(1)
+	defer runningJobs.Done()
+
+	// recovery of two replicas at once could broadcast the same suggestion twice
+	if ctx.Err() != nil || !leader.IsLeader(ctx) {
+		return
+	}
+
+	cronConfig := config.Get().Cron
+	saga.RecoverInterrupted(ctx, repository.Postgres().PendingBroadcasts, restutil.BroadcastTransaction, restutil.BaseledgerTransactionExists, saga.RecoveryPolicy{
+		After:                 cronConfig.SagaRecoveryAfter,
+		BroadcastGrace:        cronConfig.SagaBroadcastGrace,
+		CompensateAfterMisses: cronConfig.SagaCompensateAfterMisses,
+	})
+}
+
+// StopCron stops scheduling new runs and waits for query trustmeshes run in progress,
+// so that business logic is not interrupted between SOR update and commitment state update
+func StopCron(ctx context.Context) error {
+	schedulerMutex.Lock()
+	scheduler.Stop()
+	schedulerMutex.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		runningJobs.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		// running jobs are done, another replica can take over right away
+		return leader.Release(ctx)
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-func StartCron() {
-	s := gocron.NewScheduler(time.UTC)
-	s.Every(5).Seconds().SingletonMode().Do(queryTrustmeshes)
+// scheduleQueryTrustmeshes (re)schedules polling with the given interval,
+// job run that is already in progress is not interrupted
+func scheduleQueryTrustmeshes(pollInterval time.Duration) {
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+
+	if cronCtx.Err() != nil {
+		return
+	}
+
+	if queryTrustmeshesJob != nil {
+		scheduler.RemoveByReference(queryTrustmeshesJob)
+	}
+
+	job, err := scheduler.Every(pollInterval).SingletonMode().Do(queryTrustmeshes, cronCtx)
+	if err != nil {
+		logger.Errorf("error scheduling query trustmeshes job %v", err.Error())
+		return
+	}
 
-	s.StartAsync()
+	queryTrustmeshesJob = job
+	queryTrustmeshesInterval = pollInterval
+	logger.Infof("query trustmeshes scheduled every %v", pollInterval)
 }
@@ -0,0 +1,46 @@
+package cron
+
+import (
+	"testing"
+
+	uuid "github.com/kthomas/go.uuid"
+	proxytypes "github.com/unibrightio/proxy-api/types"
+)
+
+func TestGivenEntriesOfSeveralTrustmeshesWhenPartitionByTrustmeshThenTrustmeshInOnePartitionInOrder(t *testing.T) {
+	trustmeshIds := []uuid.UUID{uuid.NewV4(), uuid.NewV4(), uuid.NewV4(), uuid.NewV4(), uuid.NewV4()}
+	entries := []proxytypes.TrustmeshEntry{}
+	for i := 0; i < 20; i++ {
+		entries = append(entries, proxytypes.TrustmeshEntry{Id: uuid.NewV4(), TrustmeshId: trustmeshIds[i%len(trustmeshIds)]})
+	}
+
+	partitions := partitionByTrustmesh(entries, 3)
+
+	if len(partitions) == 0 || len(partitions) > 3 {
+		t.Fatalf("expected 1 to 3 partitions, got %v", len(partitions))
+	}
+	partitionOfTrustmesh := map[uuid.UUID]int{}
+	positions := map[uuid.UUID]int{}
+	for i, entry := range entries {
+		positions[entry.Id] = i
+	}
+	count := 0
+	for p, partition := range partitions {
+		last := -1
+		for _, job := range partition {
+			entry := job.TrustmeshEntry
+			if seen, ok := partitionOfTrustmesh[entry.TrustmeshId]; ok && seen != p {
+				t.Fatalf("trustmesh %v split over partitions %v and %v", entry.TrustmeshId, seen, p)
+			}
+			partitionOfTrustmesh[entry.TrustmeshId] = p
+			if positions[entry.Id] < last {
+				t.Fatalf("entries in partition %v out of order", p)
+			}
+			last = positions[entry.Id]
+			count++
+		}
+	}
+	if count != len(entries) {
+		t.Fatalf("partitions contain %v entries, want %v", count, len(entries))
+	}
+}
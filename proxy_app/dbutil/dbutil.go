@@ -1,23 +1,16 @@
 package dbutil
 
 import (
-	"database/sql"
 	"fmt"
-	"strconv"
+	"strings"
 	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
-	"github.com/spf13/viper"
-
-	"github.com/golang-migrate/migrate"
-	"github.com/golang-migrate/migrate/database/postgres"
-	_ "github.com/golang-migrate/migrate/source/file"
+	"github.com/lib/pq"
+	"github.com/unibrightio/proxy-api/config"
 	"github.com/unibrightio/proxy-api/logger"
 )
 
-const defaultResultsPerPage = 5
-
 type dbInstance struct {
 	db *gorm.DB
 }
@@ -27,11 +20,12 @@ var Db dbInstance
 func InitConnection() {
 	logger.Info("init app db connection")
 
-	dbHost, _ := viper.Get("DB_HOST").(string)
-	dbPwd, _ := viper.Get("DB_UB_PWD").(string)
-	sslMode, _ := viper.Get("DB_SSLMODE").(string)
-	dbUser, _ := viper.Get("DB_BASELEDGER_USER").(string)
-	dbName, _ := viper.Get("DB_BASELEDGER_NAME").(string)
+	dbConfig := config.Get().Db
+	dbHost := dbConfig.Host
+	dbPwd := dbConfig.Password
+	sslMode := dbConfig.SslMode
+	dbUser := dbConfig.BaseledgerUser
+	dbName := dbConfig.BaseledgerName
 
 	args := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s sslmode=%s",
@@ -58,14 +52,25 @@ func (instance *dbInstance) GetConn() *gorm.DB {
 	return instance.db
 }
 
+// CloseConnection closes app db pool, called last on shutdown
+func CloseConnection() error {
+	if Db.db == nil {
+		return nil
+	}
+
+	logger.Info("closing app db connection")
+	return Db.db.Close()
+}
+
 func InitDbIfNotExists() {
-	dbHost, _ := viper.Get("DB_HOST").(string)
-	dbSuperUser, _ := viper.Get("DB_UB_USER").(string)
-	dbPwd, _ := viper.Get("DB_UB_PWD").(string)
-	dbDefaultName, _ := viper.Get("DB_UB_NAME").(string)
-	sslMode, _ := viper.Get("DB_SSLMODE").(string)
-	dbUser, _ := viper.Get("DB_BASELEDGER_USER").(string)
-	dbName, _ := viper.Get("DB_BASELEDGER_NAME").(string)
+	dbConfig := config.Get().Db
+	dbHost := dbConfig.Host
+	dbSuperUser := dbConfig.SuperUser
+	dbPwd := dbConfig.Password
+	dbDefaultName := dbConfig.DefaultName
+	sslMode := dbConfig.SslMode
+	dbUser := dbConfig.BaseledgerUser
+	dbName := dbConfig.BaseledgerName
 
 	args := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s sslmode=%s",
@@ -104,21 +109,28 @@ func InitDbIfNotExists() {
 
 	logger.Info("admin db connection successful")
 
-	exists := db.Exec(fmt.Sprintf("select 1 from pg_roles where rolname='%s'", dbUser))
+	var roles int
+	err := db.Raw("select count(*) from pg_roles where rolname = ?", dbUser).Row().Scan(&roles)
+	if err != nil {
+		logger.Errorf("failed to check baseledger user %v\n", err)
+		panic(err)
+	}
 
-	if exists.RowsAffected == 1 {
-		logger.Errorf("row already exits")
+	if roles > 0 {
+		logger.Info("baseledger user already exists")
+		db.DB().Close()
 		return
 	}
 
-	result := db.Exec(fmt.Sprintf("create user %s with superuser password '%s'", dbUser, dbPwd))
+	// identifiers and literals can not be bound in utility statements, they are quoted instead
+	result := db.Exec(fmt.Sprintf("create user %s with superuser password %s", pq.QuoteIdentifier(dbUser), quoteLiteral(dbPwd)))
 
 	if result.Error != nil {
 		logger.Errorf("failed to create user %v\n", result.Error)
 		panic(result.Error)
 	}
 
-	result = db.Exec(fmt.Sprintf("create database %s owner %s", dbName, dbUser))
+	result = db.Exec(fmt.Sprintf("create database %s owner %s", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(dbUser)))
 
 	if result.Error != nil {
 		logger.Errorf("failed to create baseledger db %v\n", result.Error)
@@ -128,77 +140,12 @@ func InitDbIfNotExists() {
 	db.DB().Close() // Close admin connection
 }
 
-// TODO: check if we can reuse db connection from method above
-func PerformMigrations() {
-	dbHost, _ := viper.Get("DB_HOST").(string)
-	dbPwd, _ := viper.Get("DB_UB_PWD").(string)
-	sslMode, _ := viper.Get("DB_SSLMODE").(string)
-	dbUser, _ := viper.Get("DB_BASELEDGER_USER").(string)
-	dbName, _ := viper.Get("DB_BASELEDGER_NAME").(string)
-
-	dsn := fmt.Sprintf("postgres://%s/%s?user=%s&password=%s&sslmode=%s",
-		dbHost,
-		dbName,
-		dbUser,
-		dbPwd,
-		sslMode,
-	)
-	db, err := sql.Open("postgres", dsn)
-	if err != nil {
-		logger.Errorf("migrations failed 1: %s", err.Error())
-		panic(err)
-	}
-
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
-	if err != nil {
-		logger.Errorf("migrations failed 2: %s", err.Error())
-		panic(err)
-	}
-
-	// TODO: These have to be some kind of embeded resources
-	m, err := migrate.NewWithDatabaseInstance("file://./ops/migrations", dbName, driver)
-	if err != nil {
-		logger.Errorf("migrations failed 3: %s", err.Error())
-		panic(err)
-	}
-
-	err = m.Up()
-	if err != nil && err != migrate.ErrNoChange {
-		logger.Errorf("migrations failed 4: %s", err.Error())
-	}
-}
-
-// Paginate the current request given the page number and results per page;
-// returns the modified SQL query and adds x-total-results-count header to
-// the response
-func Paginate(c *gin.Context, db *gorm.DB, model interface{}) *gorm.DB {
-	page := int64(1)
-	rpp := int64(defaultResultsPerPage)
-
-	if c.Query("page") != "" {
-		if _page, err := strconv.ParseInt(c.Query("page"), 10, 64); err == nil {
-			page = _page
-		}
-	}
-
-	if c.Query("rpp") != "" {
-		if _rpp, err := strconv.ParseInt(c.Query("rpp"), 10, 64); err == nil {
-			rpp = _rpp
-		}
-	}
-
-	query, totalResults := paginate(db, model, page, rpp)
-	if totalResults != nil {
-		c.Header("x-total-results-count", fmt.Sprintf("%d", *totalResults))
+// quoteLiteral quotes string for use as SQL literal, backslashes are escaped so it does not depend on standard_conforming_strings
+func quoteLiteral(literal string) string {
+	literal = strings.Replace(literal, `'`, `''`, -1)
+	if strings.Contains(literal, `\`) {
+		return `E'` + strings.Replace(literal, `\`, `\\`, -1) + `'`
 	}
 
-	return query
-}
-
-// Paginate the given query given the page number and results per page;
-// returns the update query and total results
-func paginate(db *gorm.DB, model interface{}, page, rpp int64) (query *gorm.DB, totalResults *uint64) {
-	db.Model(model).Count(&totalResults)
-	query = db.Limit(rpp).Offset((page - 1) * rpp)
-	return query, totalResults
+	return `'` + literal + `'`
 }
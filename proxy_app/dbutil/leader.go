@@ -0,0 +1,74 @@
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/unibrightio/proxy-api/logger"
+)
+
+// Leader elects one of the replicas sharing the db with a postgres session advisory lock,
+// the lock is held by a dedicated connection and freed by postgres when that connection is lost
+type Leader struct {
+	key   int64
+	mutex sync.Mutex
+	conn  *sql.Conn
+}
+
+// NewLeader returns leader election on advisory lock key, replicas have to use the same key
+func NewLeader(key int64) *Leader {
+	return &Leader{key: key}
+}
+
+// IsLeader tries to take the lock if it is not held yet and checks that connection holding it is alive,
+// it is cheap enough to be called before every job run
+func (l *Leader) IsLeader(ctx context.Context) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conn != nil {
+		if _, err := l.conn.ExecContext(ctx, "SELECT 1"); err == nil {
+			return true
+		}
+
+		logger.Warnf("lost connection holding leader lock %v", l.key)
+		l.conn.Close()
+		l.conn = nil
+	}
+
+	conn, err := Db.GetConn().DB().Conn(ctx)
+	if err != nil {
+		logger.Errorf("error getting connection for leader lock %v", err)
+		return false
+	}
+
+	acquired := false
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired)
+	if err != nil || !acquired {
+		if err != nil {
+			logger.Errorf("error acquiring leader lock %v", err)
+		}
+		conn.Close()
+		return false
+	}
+
+	logger.Infof("acquired leader lock %v", l.key)
+	l.conn = conn
+	return true
+}
+
+// Release frees the lock so another replica takes over without waiting for the connection to drop
+func (l *Leader) Release(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key)
+	l.conn.Close()
+	l.conn = nil
+	return err
+}
@@ -0,0 +1,264 @@
+package dbutil
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate"
+	"github.com/golang-migrate/migrate/database/postgres"
+	"github.com/golang-migrate/migrate/source"
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/unibrightio/proxy-api/config"
+	"github.com/unibrightio/proxy-api/ops/migrations"
+)
+
+// ErrDirtySchema is returned when previous migration failed halfway, schema has to be fixed and forced to a version
+var ErrDirtySchema = errors.New("schema is dirty")
+
+// ErrNewerSchema is returned when schema was migrated by newer proxy than this one
+var ErrNewerSchema = errors.New("schema is newer than migrations of this proxy")
+
+// MigrationStatus describes schema of app db compared to embedded migrations
+type MigrationStatus struct {
+	Version uint
+	Dirty   bool
+	Latest  uint
+	// versions of embedded migrations, applied are the ones up to Version
+	Migrations []uint
+}
+
+// PerformMigrations migrates app db to the latest embedded version,
+// it refuses to touch dirty schema or schema newer than the proxy
+func PerformMigrations() error {
+	return withMigrate(func(m *migrate.Migrate) error {
+		if err := checkSchema(m); err != nil {
+			return err
+		}
+
+		err := m.Up()
+		if err != nil && err != migrate.ErrNoChange {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// MigrateUp applies given number of pending migrations, all of them if steps is 0
+func MigrateUp(steps int) error {
+	return withMigrate(func(m *migrate.Migrate) error {
+		if err := checkSchema(m); err != nil {
+			return err
+		}
+
+		var err error
+		if steps == 0 {
+			err = m.Up()
+		} else {
+			err = m.Steps(steps)
+		}
+
+		if err == migrate.ErrNoChange {
+			return nil
+		}
+
+		return err
+	})
+}
+
+// MigrateDown reverts given number of applied migrations
+func MigrateDown(steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("number of migrations to revert has to be positive, got %v", steps)
+	}
+
+	return withMigrate(func(m *migrate.Migrate) error {
+		if err := checkSchema(m); err != nil {
+			return err
+		}
+
+		return m.Steps(-steps)
+	})
+}
+
+// ForceMigrationVersion sets schema version and clears dirty flag without running migrations,
+// used after failed migration was fixed by hand
+func ForceMigrationVersion(version int) error {
+	return withMigrate(func(m *migrate.Migrate) error {
+		return m.Force(version)
+	})
+}
+
+// GetMigrationStatus returns schema version of app db and embedded migrations
+func GetMigrationStatus() (*MigrationStatus, error) {
+	status := &MigrationStatus{}
+
+	versions, err := embeddedMigrationVersions()
+	if err != nil {
+		return nil, err
+	}
+	status.Migrations = versions
+	if len(versions) > 0 {
+		status.Latest = versions[len(versions)-1]
+	}
+
+	err = withMigrate(func(m *migrate.Migrate) error {
+		status.Version, status.Dirty, err = schemaVersion(m)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// MigrationVersion returns schema version applied to app db and whether last migration failed halfway
+func MigrationVersion() (version uint, dirty bool, err error) {
+	row := Db.GetConn().Raw("select version, dirty from schema_migrations limit 1").Row()
+	err = row.Scan(&version, &dirty)
+	return version, dirty, err
+}
+
+// LatestMigrationVersion returns version of the newest migration shipped with the proxy
+func LatestMigrationVersion() (uint, error) {
+	versions, err := embeddedMigrationVersions()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(versions) == 0 {
+		return 0, nil
+	}
+
+	return versions[len(versions)-1], nil
+}
+
+func checkSchema(m *migrate.Migrate) error {
+	version, dirty, err := schemaVersion(m)
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("%w at version %v, fix it and force version with proxyctl migrate force", ErrDirtySchema, version)
+	}
+
+	latest, err := LatestMigrationVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > latest {
+		return fmt.Errorf("%w, schema version %v, latest migration %v", ErrNewerSchema, version, latest)
+	}
+
+	return nil
+}
+
+// schema version is 0 before first migration
+func schemaVersion(m *migrate.Migrate) (uint, bool, error) {
+	version, dirty, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		return 0, false, nil
+	}
+
+	return version, dirty, err
+}
+
+func withMigrate(fn func(m *migrate.Migrate) error) error {
+	m, err := newMigrate()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	return fn(m)
+}
+
+func newMigrate() (*migrate.Migrate, error) {
+	dbConfig := config.Get().Db
+
+	dsn := fmt.Sprintf("postgres://%s/%s?user=%s&password=%s&sslmode=%s",
+		dbConfig.Host,
+		dbConfig.BaseledgerName,
+		dbConfig.BaseledgerUser,
+		dbConfig.Password,
+		dbConfig.SslMode,
+	)
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	source, err := embeddedSource()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return migrate.NewWithInstance("go-bindata", source, dbConfig.BaseledgerName, driver)
+}
+
+func embeddedSource() (source.Driver, error) {
+	names, err := embeddedMigrationNames()
+	if err != nil {
+		return nil, err
+	}
+
+	return bindata.WithInstance(bindata.Resource(names, func(name string) ([]byte, error) {
+		return fs.ReadFile(migrations.Files, name)
+	}))
+}
+
+func embeddedMigrationNames() ([]string, error) {
+	files, err := fs.ReadDir(migrations.Files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".sql") {
+			names = append(names, file.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// sorted versions of embedded migrations
+func embeddedMigrationVersions() ([]uint, error) {
+	names, err := embeddedMigrationNames()
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[uint]bool{}
+	var versions []uint
+	for _, name := range names {
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if !found[uint(version)] {
+			found[uint(version)] = true
+			versions = append(versions, uint(version))
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, nil
+}
@@ -0,0 +1,74 @@
+package dbutil
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/golang-migrate/migrate/source"
+)
+
+func TestGivenEmbeddedMigrationsWhenListingVersionsThenEveryVersionHasUpAndDownMigration(t *testing.T) {
+	names, err := embeddedMigrationNames()
+	if err != nil {
+		t.Fatalf("listing embedded migrations failed %v", err)
+	}
+
+	directions := map[uint]map[source.Direction]bool{}
+	for _, name := range names {
+		migration, err := source.DefaultParse(name)
+		if err != nil {
+			t.Fatalf("embedded migration %v can not be parsed %v", name, err)
+		}
+		if directions[migration.Version] == nil {
+			directions[migration.Version] = map[source.Direction]bool{}
+		}
+		directions[migration.Version][migration.Direction] = true
+	}
+
+	versions, err := embeddedMigrationVersions()
+	if err != nil {
+		t.Fatalf("listing embedded versions failed %v", err)
+	}
+
+	if len(versions) == 0 {
+		t.Fatalf("expected embedded migrations")
+	}
+
+	for i, version := range versions {
+		if version != uint(i+1) {
+			t.Fatalf("expected versions without gaps, got %v", versions)
+		}
+		if !directions[version][source.Up] || !directions[version][source.Down] {
+			t.Fatalf("migration %v is missing up or down file", version)
+		}
+	}
+
+	embedded, err := embeddedSource()
+	if err != nil {
+		t.Fatalf("opening embedded source failed %v", err)
+	}
+	first, err := embedded.First()
+	if err != nil || first != versions[0] {
+		t.Fatalf("expected embedded source to start at %v, got %v %v", versions[0], first, err)
+	}
+
+	latest, _ := LatestMigrationVersion()
+	if latest != versions[len(versions)-1] {
+		t.Fatalf("expected latest version %v, got %v", versions[len(versions)-1], latest)
+	}
+}
+
+func TestGivenPasswordWithQuotesAndBackslashesWhenQuotingLiteralThenItCanNotEscapeLiteral(t *testing.T) {
+	cases := map[string]string{
+		"secret":          "'secret'",
+		"it's":            "'it''s'",
+		"x'; drop user--": "'x''; drop user--'",
+		`back\slash'`:     `E'back\\slash'''`,
+	}
+
+	for literal, expected := range cases {
+		if quoted := quoteLiteral(literal); quoted != expected {
+			t.Fatalf("expected %v to be quoted as %v, got %v", strconv.Quote(literal), expected, quoted)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package dbutil
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// UnitOfWork runs fn inside single db transaction, commits if fn succeeds and rolls back
+// if it returns error or panics
+func UnitOfWork(fn func(tx *gorm.DB) error) (err error) {
+	tx := Db.GetConn().Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			err = fmt.Errorf("unit of work panicked: %v", r)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
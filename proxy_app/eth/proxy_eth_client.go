@@ -3,7 +3,7 @@ package eth
 import (
 	"context"
 	"crypto/ecdsa"
-	"encoding/json"
+	"errors"
 	"log"
 	"math/big"
 
@@ -11,20 +11,22 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/spf13/viper"
+	"github.com/unibrightio/proxy-api/config"
 	"github.com/unibrightio/proxy-api/logger"
-	"github.com/unibrightio/proxy-api/proxyutil"
-	"github.com/unibrightio/proxy-api/types"
+	"github.com/unibrightio/proxy-api/metrics"
 
 	proxyCommon "github.com/unibrightio/proxy-api/common"
 	contracts "github.com/unibrightio/proxy-api/contracts"
+	"github.com/unibrightio/proxy-api/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var ethClient *ethclient.Client
 
 func GetClient() *ethclient.Client {
 	if ethClient == nil {
-		client, err := ethclient.Dial(viper.GetString("ETHEREUM_API_URL"))
+		client, err := ethclient.Dial(config.Get().Ethereum.ApiUrl)
 
 		if err != nil {
 			logger.Errorf("Error connecting to infure %v", err.Error())
@@ -38,32 +40,39 @@ func GetClient() *ethclient.Client {
 	return ethClient
 }
 
-func StoreExitProofInTrustmeshAndInformCounterparty(txId string, proof string, trustmeshEntry *types.TrustmeshEntry) {
+type IEthClient interface {
+	// stores exit proof of baseledger transaction in ethereum contract, returns ethereum transaction hash
+	StoreExitProof(ctx context.Context, txId string, proof string) (string, error)
+}
+
+// ContractEthClient stores proofs in the contract at configured ethereum node
+type ContractEthClient struct {
+}
+
+func (client *ContractEthClient) StoreExitProof(ctx context.Context, txId string, proof string) (string, error) {
+	_, span := tracing.StartWithKind(ctx, "StoreExitProof", trace.SpanKindClient, tracing.TransactionIdKey.String(txId))
+	defer span.End()
+
 	instance, auth := getContractInstance()
 	if instance == nil || auth == nil {
 		logger.Error("Error getting contract instance")
-		return
+		tracing.Fail(span, "contract instance not available")
+		return "", errors.New("contract instance not available")
 	}
 
 	tx, err := instance.Add(auth, txId, proof)
 	if err != nil {
 		logger.Error(err.Error())
+		metrics.EthExitTransactions.WithLabelValues(metrics.ResultFailure).Inc()
+		tracing.Fail(span, "exit transaction failed")
+		return "", err
 	}
+	span.SetAttributes(attribute.String("ethereum.tx_hash", tx.Hash().Hex()))
+
+	metrics.EthExitTransactions.WithLabelValues(metrics.ResultSuccess).Inc()
 
 	logger.Infof("eth tx sent: %s", tx.Hash().Hex())
-	err = types.UpdateTrustmeshEthTxHash(trustmeshEntry.TrustmeshId, tx.Hash().Hex())
-	if err != nil {
-		logger.Errorf("Error updating trustmesh eth hash %v", err.Error())
-		return
-	}
-	logger.Infof("successful setting of tx hash, broadcasting offchain message ")
-	var natsMessage types.NatsTrustmeshUpdateMessage
-	natsMessage.EthExitTxHash = tx.Hash().Hex()
-	// it has to be referenced bboid because at this point entry has to be feedback (approval feedback of final workstep)
-	natsMessage.BaseledgerBusinessObjectId = trustmeshEntry.ReferencedBaseledgerBusinessObjectId
-	var payload, _ = json.Marshal(natsMessage)
-
-	proxyutil.SendOffchainMessage(payload, trustmeshEntry.WorkgroupId.String(), trustmeshEntry.SenderOrgId.String(), proxyCommon.EthTxHashNatsSubject)
+	return tx.Hash().Hex(), nil
 }
 
 func GetProof(txId string) {
@@ -88,7 +97,7 @@ func getContractInstance() (*contracts.Contracts, *bind.TransactOpts) {
 		return nil, nil
 	}
 
-	privateKey, err := crypto.HexToECDSA(viper.GetString("ETHEREUM_PRIVATE_KEY"))
+	privateKey, err := crypto.HexToECDSA(config.Get().Ethereum.PrivateKey)
 	if err != nil {
 		log.Fatal(err)
 		return nil, nil
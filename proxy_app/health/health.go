@@ -0,0 +1,195 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/unibrightio/proxy-api/config"
+	"github.com/unibrightio/proxy-api/dbutil"
+)
+
+const (
+	StatusUp       = "UP"
+	StatusDown     = "DOWN"
+	StatusDisabled = "DISABLED" // dependency is not configured, it does not affect readiness
+)
+
+const checkTimeout = 3 * time.Second
+
+// ErrDisabled is returned by checks of dependencies that are not configured
+var ErrDisabled = fmt.Errorf("not configured")
+
+type Dependency struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type DependencyStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status       string             `json:"status"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+type Checker struct {
+	dependencies []Dependency
+}
+
+func NewChecker(dependencies ...Dependency) *Checker {
+	return &Checker{dependencies: dependencies}
+}
+
+// Check runs all dependency checks concurrently, each limited by check timeout.
+// Report is up only if no enabled dependency is down
+func (checker *Checker) Check(ctx context.Context) Report {
+	statuses := make([]DependencyStatus, len(checker.dependencies))
+
+	var wg sync.WaitGroup
+	for i, dependency := range checker.dependencies {
+		wg.Add(1)
+		go func(i int, dependency Dependency) {
+			defer wg.Done()
+			statuses[i] = check(ctx, dependency)
+		}(i, dependency)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Dependencies: statuses}
+	for _, status := range statuses {
+		if status.Status == StatusDown {
+			report.Status = StatusDown
+		}
+	}
+
+	return report
+}
+
+func check(ctx context.Context, dependency Dependency) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := dependency.Check(ctx)
+	status := DependencyStatus{Name: dependency.Name, Status: StatusUp, LatencyMs: time.Since(start).Milliseconds()}
+
+	if err == ErrDisabled {
+		status.Status = StatusDisabled
+		status.LatencyMs = 0
+	} else if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+// CheckPostgres pings app db and verifies that schema is migrated to the latest version
+func CheckPostgres(ctx context.Context) error {
+	conn := dbutil.Db.GetConn()
+	if conn == nil {
+		return fmt.Errorf("db connection not initialized")
+	}
+
+	err := conn.DB().PingContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := dbutil.MigrationVersion()
+	if err != nil {
+		return fmt.Errorf("error reading migration version %v", err.Error())
+	}
+
+	if dirty {
+		return fmt.Errorf("migration version %v is dirty", version)
+	}
+
+	latest, err := dbutil.LatestMigrationVersion()
+	if err != nil {
+		return fmt.Errorf("error reading migrations %v", err.Error())
+	}
+
+	if version != latest {
+		return fmt.Errorf("migration version %v, expected %v", version, latest)
+	}
+
+	return nil
+}
+
+// CheckNats builds check of local nats subscriptions
+func CheckNats(connected func() bool) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if !connected() {
+			return fmt.Errorf("nats subscriptions not connected")
+		}
+		return nil
+	}
+}
+
+// CheckBlockchainApp verifies that blockchain app is reachable and has enough balance to broadcast
+func CheckBlockchainApp(ctx context.Context) error {
+	return checkHttp(ctx, "http://"+config.Get().Blockchain.AppUrl+"/balanceCheck")
+}
+
+func CheckTendermint(ctx context.Context) error {
+	return checkHttp(ctx, "http://"+config.Get().Blockchain.TendermintUrl+"/health")
+}
+
+var ethereumProbe struct {
+	mutex  sync.Mutex
+	client *ethclient.Client
+}
+
+// CheckEthereum reuses one client across probes, client is dropped after failed probe and dialed again on next one
+func CheckEthereum(ctx context.Context) error {
+	apiUrl := config.Get().Ethereum.ApiUrl
+	if apiUrl == "" {
+		return ErrDisabled
+	}
+
+	ethereumProbe.mutex.Lock()
+	defer ethereumProbe.mutex.Unlock()
+
+	if ethereumProbe.client == nil {
+		client, err := ethclient.DialContext(ctx, apiUrl)
+		if err != nil {
+			return err
+		}
+		ethereumProbe.client = client
+	}
+
+	_, err := ethereumProbe.client.BlockNumber(ctx)
+	if err != nil {
+		ethereumProbe.client.Close()
+		ethereumProbe.client = nil
+	}
+	return err
+}
+
+func checkHttp(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %v", resp.StatusCode)
+	}
+
+	return nil
+}
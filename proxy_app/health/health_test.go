@@ -0,0 +1,42 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckReportsDownWhenAnyDependencyIsDown(t *testing.T) {
+	checker := NewChecker(
+		Dependency{Name: "up", Check: func(ctx context.Context) error { return nil }},
+		Dependency{Name: "down", Check: func(ctx context.Context) error { return errors.New("unreachable") }},
+	)
+
+	report := checker.Check(context.Background())
+
+	if report.Status != StatusDown {
+		t.Errorf("expected status %v, got %v", StatusDown, report.Status)
+	}
+	if report.Dependencies[0].Status != StatusUp || report.Dependencies[1].Status != StatusDown {
+		t.Errorf("unexpected dependency statuses %v", report.Dependencies)
+	}
+	if report.Dependencies[1].Error != "unreachable" {
+		t.Errorf("expected dependency error to be reported, got %v", report.Dependencies[1].Error)
+	}
+}
+
+func TestCheckIgnoresDisabledDependencies(t *testing.T) {
+	checker := NewChecker(
+		Dependency{Name: "up", Check: func(ctx context.Context) error { return nil }},
+		Dependency{Name: "disabled", Check: func(ctx context.Context) error { return ErrDisabled }},
+	)
+
+	report := checker.Check(context.Background())
+
+	if report.Status != StatusUp {
+		t.Errorf("expected status %v, got %v", StatusUp, report.Status)
+	}
+	if report.Dependencies[1].Status != StatusDisabled {
+		t.Errorf("expected disabled dependency, got %v", report.Dependencies[1].Status)
+	}
+}
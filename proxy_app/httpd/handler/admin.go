@@ -0,0 +1,347 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/admin"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+// @Security BasicAuth
+// GetAdminTrustmesh ... Get trustmesh with all stored details
+// @Summary Get trustmesh with all stored details
+// @Description get trustmesh with entries and offchain messages by trustmesh id or business object id of one of its entries
+// @Param id path string true "trustmesh id or baseledger business object id"
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} types.Trustmesh
+// @Failure 404 {string} errorMessage
+// @Router /admin/trustmeshes/{id} [get]
+func GetAdminTrustmeshHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		trustmesh, err := admin.NewService().GetTrustmesh(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			restutil.RenderError(err.Error(), adminErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(trustmesh, 200, c)
+	}
+}
+
+// @Security BasicAuth
+// VerifyTrustmesh ... Verify trustmesh against chain
+// @Summary Verify trustmesh against chain
+// @Description check sync trees of committed entries against proofs stored on chain
+// @Param id path string true "trustmesh id or baseledger business object id"
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} admin.TrustmeshVerification
+// @Failure 404 {string} errorMessage
+// @Router /admin/trustmeshes/{id}/verify [get]
+func VerifyTrustmeshHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		verification, err := admin.NewService().VerifyTrustmesh(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			restutil.RenderError(err.Error(), adminErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(verification, 200, c)
+	}
+}
+
+// @Security BasicAuth
+// ExportTrustmesh ... Export trustmesh as audit bundle
+// @Summary Export trustmesh as audit bundle
+// @Description export trustmesh with entries, offchain messages, sync trees, transactions on chain and root proof,
+// @Description signed by the proxy. Bundle is checked offline with proxyctl bundle verify
+// @Param id path string true "trustmesh id or baseledger business object id"
+// @Param format query string false "json (default) or zip"
+// @Tags Admin
+// @Produce json,application/zip
+// @Success 200 {object} admin.SignedAuditBundle
+// @Failure 400,404 {string} errorMessage
+// @Router /admin/trustmeshes/{id}/export [get]
+func ExportTrustmeshHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "zip" {
+			restutil.RenderError("format has to be json or zip", 400, c)
+			return
+		}
+
+		bundle, err := admin.NewService().ExportTrustmesh(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			restutil.RenderError(err.Error(), adminErrorStatus(err), c)
+			return
+		}
+
+		if format == "json" {
+			restutil.Render(bundle, 200, c)
+			return
+		}
+
+		// file is named after trustmesh id, id param may be a bboid
+		decoded, err := bundle.Decode()
+		archive := &bytes.Buffer{}
+		if err == nil {
+			err = bundle.WriteZip(archive)
+		}
+		if err != nil {
+			logger.Errorf("error when zipping audit bundle %v", err)
+			restutil.RenderError("error when zipping audit bundle", 500, c)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"trustmesh-%v.zip\"", decoded.Trustmesh.Id))
+		c.Data(200, "application/zip", archive.Bytes())
+	}
+}
+
+// @Security BasicAuth
+// RerunTrustmeshEntry ... Rerun business logic for trustmesh entry
+// @Summary Rerun business logic for trustmesh entry
+// @Description look up transaction of entry on chain and run business logic for it again, SOR webhooks and offchain messages are triggered again
+// @Param id path string format "uuid" "id"
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} types.TrustmeshEntry
+// @Failure 400,404 {string} errorMessage
+// @Router /admin/entries/{id}/rerun [post]
+func RerunTrustmeshEntryHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entryId, err := uuid.FromString(c.Param("id"))
+		if err != nil {
+			restutil.RenderError("trustmesh entry id in wrong format", 400, c)
+			return
+		}
+
+		entry, err := admin.NewService().RerunEntry(c.Request.Context(), entryId)
+		if err != nil {
+			restutil.RenderError(err.Error(), adminErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(entry, 200, c)
+	}
+}
+
+// @Security BasicAuth
+// ResendOffchainMessage ... Resend offchain message of trustmesh entry
+// @Summary Resend offchain message of trustmesh entry
+// @Description send offchain message of committed sent suggestion or feedback to its receiver again
+// @Param id path string format "uuid" "id"
+// @Tags Admin
+// @Success 204
+// @Failure 400,404 {string} errorMessage
+// @Router /admin/entries/{id}/resend [post]
+func ResendOffchainMessageHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entryId, err := uuid.FromString(c.Param("id"))
+		if err != nil {
+			restutil.RenderError("trustmesh entry id in wrong format", 400, c)
+			return
+		}
+
+		err = admin.NewService().ResendOffchainMessage(c.Request.Context(), entryId)
+		if err != nil {
+			restutil.RenderError(err.Error(), adminErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(nil, 204, c)
+	}
+}
+
+// @Security BasicAuth
+// GetTrustmeshEntriesByProcessingState ... Get trustmesh entries in processing state
+// @Summary Get trustmesh entries in processing state
+// @Description get trustmesh entries in processing state, i.e. DEAD entries which need manual intervention
+// @Param processing_state query string true "PENDING, PROCESSING, COMMITTED, FAILED or DEAD"
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} types.TrustmeshEntry
+// @Failure 400 {string} errorMessage
+// @Router /admin/entries [get]
+func GetTrustmeshEntriesByProcessingStateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entries, err := admin.NewService().GetEntriesByProcessingState(c.Request.Context(), c.Query("processing_state"))
+		if err != nil {
+			restutil.RenderError(err.Error(), adminErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(entries, 200, c)
+	}
+}
+
+// @Security BasicAuth
+// RetryTrustmeshEntry ... Retry failed or dead trustmesh entry
+// @Summary Retry failed or dead trustmesh entry
+// @Description make entry pending again with no failed attempts, it is processed on next poll
+// @Param id path string format "uuid" "id"
+// @Param body body admin.InterventionRequest true "reason of the intervention"
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} types.TrustmeshEntry
+// @Failure 400,404 {string} errorMessage
+// @Router /admin/entries/{id}/retry [post]
+func RetryTrustmeshEntryHandler() gin.HandlerFunc {
+	return interventionHandler(func(service *admin.Service, c *gin.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error) {
+		return service.RetryEntry(c.Request.Context(), entryId, reason)
+	})
+}
+
+// @Security BasicAuth
+// SkipTrustmeshEntry ... Skip trustmesh entry
+// @Summary Skip trustmesh entry
+// @Description mark entry dead without running business logic, it stays uncommitted
+// @Param id path string format "uuid" "id"
+// @Param body body admin.InterventionRequest true "reason of the intervention"
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} types.TrustmeshEntry
+// @Failure 400,404 {string} errorMessage
+// @Router /admin/entries/{id}/skip [post]
+func SkipTrustmeshEntryHandler() gin.HandlerFunc {
+	return interventionHandler(func(service *admin.Service, c *gin.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error) {
+		return service.SkipEntry(c.Request.Context(), entryId, reason)
+	})
+}
+
+// @Security BasicAuth
+// ResolveTrustmeshEntry ... Force resolve trustmesh entry
+// @Summary Force resolve trustmesh entry
+// @Description mark entry committed and processed without running business logic
+// @Param id path string format "uuid" "id"
+// @Param body body admin.InterventionRequest true "reason of the intervention"
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} types.TrustmeshEntry
+// @Failure 400,404 {string} errorMessage
+// @Router /admin/entries/{id}/resolve [post]
+func ResolveTrustmeshEntryHandler() gin.HandlerFunc {
+	return interventionHandler(func(service *admin.Service, c *gin.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error) {
+		return service.ResolveEntry(c.Request.Context(), entryId, reason)
+	})
+}
+
+// @Security BasicAuth
+// FinishTrustmeshEntryBroadcast ... Finish unconfirmed broadcast of trustmesh entry
+// @Summary Finish unconfirmed broadcast of trustmesh entry
+// @Description move entry whose transaction recovery found on chain without hash to uncommitted with the transaction hash looked up on chain, its commitment is checked afterwards
+// @Param id path string format "uuid" "id"
+// @Param body body admin.InterventionRequest true "transaction hash and reason of the intervention"
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} types.TrustmeshEntry
+// @Failure 400,404 {string} errorMessage
+// @Router /admin/entries/{id}/finish-broadcast [post]
+func FinishTrustmeshEntryBroadcastHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entryId, req, ok := bindInterventionRequest(c)
+		if !ok {
+			return
+		}
+
+		entry, err := admin.NewService().FinishBroadcast(c.Request.Context(), entryId, req.TransactionHash, req.Reason)
+		if err != nil {
+			restutil.RenderError(err.Error(), adminErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(entry, 200, c)
+	}
+}
+
+// @Security BasicAuth
+// AbandonTrustmeshEntryBroadcast ... Abandon unconfirmed broadcast of trustmesh entry
+// @Summary Abandon unconfirmed broadcast of trustmesh entry
+// @Description remove entry whose transaction recovery found on chain without hash together with its offchain message, as when broadcast fails
+// @Param id path string format "uuid" "id"
+// @Param body body admin.InterventionRequest true "reason of the intervention"
+// @Tags Admin
+// @Accept json
+// @Success 204
+// @Failure 400,404 {string} errorMessage
+// @Router /admin/entries/{id}/abandon-broadcast [post]
+func AbandonTrustmeshEntryBroadcastHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entryId, req, ok := bindInterventionRequest(c)
+		if !ok {
+			return
+		}
+
+		err := admin.NewService().AbandonBroadcast(c.Request.Context(), entryId, req.Reason)
+		if err != nil {
+			restutil.RenderError(err.Error(), adminErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(nil, 204, c)
+	}
+}
+
+func interventionHandler(intervene func(service *admin.Service, c *gin.Context, entryId uuid.UUID, reason string) (*types.TrustmeshEntry, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entryId, req, ok := bindInterventionRequest(c)
+		if !ok {
+			return
+		}
+
+		entry, err := intervene(admin.NewService(), c, entryId, req.Reason)
+		if err != nil {
+			restutil.RenderError(err.Error(), adminErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(entry, 200, c)
+	}
+}
+
+// bindInterventionRequest reads entry id and body of intervention, renders error if either is malformed
+func bindInterventionRequest(c *gin.Context) (uuid.UUID, *admin.InterventionRequest, bool) {
+	entryId, err := uuid.FromString(c.Param("id"))
+	if err != nil {
+		restutil.RenderError("trustmesh entry id in wrong format", 400, c)
+		return uuid.Nil, nil, false
+	}
+
+	buf, err := c.GetRawData()
+	if err != nil {
+		restutil.RenderError(err.Error(), 400, c)
+		return uuid.Nil, nil, false
+	}
+
+	req := &admin.InterventionRequest{}
+	err = json.Unmarshal(buf, &req)
+	if err != nil {
+		restutil.RenderError(err.Error(), 422, c)
+		return uuid.Nil, nil, false
+	}
+
+	return entryId, req, true
+}
+
+// adminErrorStatus maps errors of admin service to response status
+func adminErrorStatus(err error) int {
+	if errors.Is(err, admin.ErrNotFound) {
+		return 404
+	}
+	if errors.Is(err, admin.ErrInvalidRequest) {
+		return 400
+	}
+
+	return 500
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/types"
+	"github.com/unibrightio/proxy-api/workflow"
+)
+
+type businessObjectSchemaDto struct {
+	Id                 uuid.UUID       `json:"id"`
+	WorkgroupId        uuid.UUID       `json:"workgroup_id"`
+	BusinessObjectType string          `json:"business_object_type"`
+	Schema             json.RawMessage `json:"schema"`
+	Hash               string          `json:"hash"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+}
+
+// @Security BasicAuth
+// GetBusinessObjectSchemas ... Get business object schemas of workgroup
+// @Summary Get business object schemas of workgroup
+// @Description get JSON Schemas business objects are validated against, members agree on a schema by registering the same one with the same hash
+// @Param id path string true "workgroup id"
+// @Tags Workgroups
+// @Produce json
+// @Success 200 {array} businessObjectSchemaDto
+// @Failure 404 {string} errorMessage
+// @Router /workgroup/{id}/schemas [get]
+func GetBusinessObjectSchemasHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		schemas, err := workflow.NewService().GetBusinessObjectSchemas(c.Param("id"))
+		if err != nil {
+			restutil.RenderError(err.Error(), workflowErrorStatus(err), c)
+			return
+		}
+
+		dtos := []businessObjectSchemaDto{}
+		for i := range schemas {
+			dtos = append(dtos, processBusinessObjectSchema(&schemas[i]))
+		}
+
+		restutil.Render(dtos, 200, c)
+	}
+}
+
+// @Security BasicAuth
+// GetBusinessObjectSchema ... Get business object schema
+// @Summary Get business object schema of workgroup and business object type
+// @Param id path string true "workgroup id"
+// @Param type path string true "business object type"
+// @Tags Workgroups
+// @Produce json
+// @Success 200 {object} businessObjectSchemaDto
+// @Failure 404 {string} errorMessage
+// @Router /workgroup/{id}/schemas/{type} [get]
+func GetBusinessObjectSchemaHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		schema, err := workflow.NewService().GetBusinessObjectSchema(c.Param("id"), c.Param("type"))
+		if err != nil {
+			restutil.RenderError(err.Error(), workflowErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(processBusinessObjectSchema(schema), 200, c)
+	}
+}
+
+// @Security BasicAuth
+// PutBusinessObjectSchema ... Register business object schema
+// @Summary Register JSON Schema of business object type in workgroup
+// @Description suggestions of the type are validated before they are sent and when they are received,
+// @Description received suggestions not matching the schema are rejected with the validation errors. Schema registered before is replaced
+// @Param id path string true "workgroup id"
+// @Param type path string true "business object type"
+// @Param schema body object true "JSON Schema draft-07"
+// @Tags Workgroups
+// @Accept json
+// @Produce json
+// @Success 200 {object} businessObjectSchemaDto
+// @Failure 400,404,500 {string} errorMessage
+// @Router /workgroup/{id}/schemas/{type} [put]
+func PutBusinessObjectSchemaHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		buf, err := c.GetRawData()
+		if err != nil {
+			restutil.RenderError(err.Error(), 400, c)
+			return
+		}
+
+		schema, err := workflow.NewService().RegisterBusinessObjectSchema(c.Param("id"), c.Param("type"), string(buf))
+		if err != nil {
+			restutil.RenderError(err.Error(), workflowErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(processBusinessObjectSchema(schema), 200, c)
+	}
+}
+
+// @Security BasicAuth
+// DeleteBusinessObjectSchema ... Delete business object schema
+// @Summary Delete business object schema, business objects of the type are then only checked to be json objects
+// @Param id path string true "workgroup id"
+// @Param type path string true "business object type"
+// @Tags Workgroups
+// @Success 204
+// @Failure 404,500 {string} errorMessage
+// @Router /workgroup/{id}/schemas/{type} [delete]
+func DeleteBusinessObjectSchemaHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := workflow.NewService().DeleteBusinessObjectSchema(c.Param("id"), c.Param("type"))
+		if err != nil {
+			restutil.RenderError(err.Error(), workflowErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(nil, 204, c)
+	}
+}
+
+func processBusinessObjectSchema(schema *types.BusinessObjectSchema) businessObjectSchemaDto {
+	return businessObjectSchemaDto{
+		Id:                 schema.Id,
+		WorkgroupId:        schema.WorkgroupId,
+		BusinessObjectType: schema.BusinessObjectType,
+		Schema:             json.RawMessage(schema.Schema),
+		Hash:               schema.Hash,
+		CreatedAt:          schema.CreatedAt,
+		UpdatedAt:          schema.UpdatedAt,
+	}
+}
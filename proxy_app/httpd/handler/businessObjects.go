@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/synctree"
+	"github.com/unibrightio/proxy-api/workflow"
+)
+
+type businessObjectVersionDto struct {
+	Version                        int       `json:"version"`
+	WorkstepId                     string    `json:"workstep_id"`
+	EntryType                      string    `json:"entry_type"`
+	WorkstepType                   string    `json:"workstep_type"`
+	BaseledgerTransactionId        string    `json:"baseledger_transaction_id"`
+	Proof                          string    `json:"proof"`
+	CommitmentState                string    `json:"commitment_state"`
+	CreatedAt                      time.Time `json:"created_at"`
+	TendermintTransactionTimestamp time.Time `json:"tendermint_transaction_timestamp"`
+}
+
+type businessObjectDiffDto struct {
+	BaseledgerBusinessObjectId string                    `json:"baseledger_business_object_id"`
+	From                       int                       `json:"from"`
+	To                         int                       `json:"to"`
+	Diff                       []synctree.PatchOperation `json:"diff"`
+}
+
+// @Security BasicAuth
+// GetBusinessObjectVersions ... Get versions of business object
+// @Summary Get versions of business object
+// @Description get initial and new version suggestions of business object with their proofs, oldest first
+// @Param bboid path string true "baseledger business object id"
+// @Tags Business Objects
+// @Produce json
+// @Success 200 {array} businessObjectVersionDto
+// @Failure 404 {string} errorMessage
+// @Router /business-objects/{bboid}/versions [get]
+func GetBusinessObjectVersionsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		versions, err := workflow.NewService().GetBusinessObjectVersions(c.Param("bboid"))
+		if err != nil {
+			restutil.RenderError(err.Error(), workflowErrorStatus(err), c)
+			return
+		}
+
+		dtos := []businessObjectVersionDto{}
+		for _, version := range versions {
+			dtos = append(dtos, businessObjectVersionDto{
+				Version:                        version.Version,
+				WorkstepId:                     version.EntryId.String(),
+				EntryType:                      version.EntryType,
+				WorkstepType:                   version.WorkstepType,
+				BaseledgerTransactionId:        uuidToString(version.BaseledgerTransactionId),
+				Proof:                          version.Proof,
+				CommitmentState:                version.CommitmentState,
+				CreatedAt:                      version.CreatedAt,
+				TendermintTransactionTimestamp: version.TendermintTransactionTimestamp,
+			})
+		}
+
+		restutil.Render(dtos, 200, c)
+	}
+}
+
+// @Security BasicAuth
+// GetBusinessObjectDiff ... Get field level diff between versions of business object
+// @Summary Get field level diff between versions of business object
+// @Description compare flattened sync tree leaves of two versions as JSON patch operations with replaced values,
+// @Description covered (knowledge limited) fields are compared by hash only and reported with test op if unchanged
+// @Param bboid path string true "baseledger business object id"
+// @Param from query int false "version to compare, version before to by default"
+// @Param to query int false "version compared to, latest by default"
+// @Tags Business Objects
+// @Produce json
+// @Success 200 {object} businessObjectDiffDto
+// @Failure 400,404 {string} errorMessage
+// @Router /business-objects/{bboid}/diff [get]
+func GetBusinessObjectDiffHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		versions := map[string]int{}
+		for _, param := range []string{"from", "to"} {
+			if c.Query(param) == "" {
+				continue
+			}
+			version, err := strconv.Atoi(c.Query(param))
+			if err != nil || version < 1 {
+				restutil.RenderError(param+" has to be a version number", 400, c)
+				return
+			}
+			versions[param] = version
+		}
+
+		diff, err := workflow.NewService().DiffBusinessObjectVersions(c.Param("bboid"), versions["from"], versions["to"])
+		if err != nil {
+			restutil.RenderError(err.Error(), workflowErrorStatus(err), c)
+			return
+		}
+
+		restutil.Render(businessObjectDiffDto{
+			BaseledgerBusinessObjectId: diff.BaseledgerBusinessObjectId,
+			From:                       diff.From,
+			To:                         diff.To,
+			Diff:                       diff.Operations,
+		}, 200, c)
+	}
+}
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/unibrightio/proxy-api/config"
+	"github.com/unibrightio/proxy-api/restutil"
+)
+
+// @Security BasicAuth
+// GetConfig ... Get active configuration
+// @Summary Get active configuration
+// @Description get active configuration with secrets redacted
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/config [get]
+func GetConfigHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		restutil.Render(config.Get().View(), 200, c)
+	}
+}
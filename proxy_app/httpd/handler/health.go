@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unibrightio/proxy-api/cron"
+	"github.com/unibrightio/proxy-api/health"
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+type statusDto struct {
+	Status                       string                    `json:"status"`
+	Dependencies                 []health.DependencyStatus `json:"dependencies"`
+	UncommittedEntries           int                       `json:"uncommitted_entries"`
+	OldestPendingEntryAgeSeconds *int64                    `json:"oldest_pending_entry_age_seconds"`
+	LastSuccessfulPoll           *time.Time                `json:"last_successful_poll"`
+	CronLeader                   bool                      `json:"cron_leader"` // only leader replica polls, last poll stays empty on the others
+}
+
+// GetHealthz ... Liveness probe
+// @Summary Liveness probe
+// @Description returns 200 as long as proxy process is able to serve requests
+// @Tags Health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Router /healthz [get]
+func GetHealthzHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		restutil.Render(health.Report{Status: health.StatusUp, Dependencies: []health.DependencyStatus{}}, http.StatusOK, c)
+	}
+}
+
+// GetReadyz ... Readiness probe
+// @Summary Readiness probe
+// @Description checks all dependencies, returns 503 if any of them is down
+// @Tags Health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func GetReadyzHandler(checker *health.Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checker.Check(c.Request.Context())
+		restutil.Render(report, reportHttpStatus(report), c)
+	}
+}
+
+// @Security BasicAuth
+// GetStatus ... Detailed status
+// @Summary Detailed status
+// @Description dependency status together with backlog of uncommitted trustmesh entries
+// @Tags Health
+// @Produce json
+// @Success 200 {object} statusDto
+// @Failure 503 {object} statusDto
+// @Router /status [get]
+func GetStatusHandler(checker *health.Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checker.Check(c.Request.Context())
+		status := statusDto{Status: report.Status, Dependencies: report.Dependencies}
+
+		count, oldestCreatedAt, err := types.GetUncommittedBacklog()
+		if err != nil {
+			status.Status = health.StatusDown
+		}
+		status.UncommittedEntries = count
+
+		if oldestCreatedAt != nil {
+			age := int64(time.Since(*oldestCreatedAt).Seconds())
+			status.OldestPendingEntryAgeSeconds = &age
+		}
+
+		if lastPoll := cron.LastSuccessfulPoll(); !lastPoll.IsZero() {
+			status.LastSuccessfulPoll = &lastPoll
+		}
+
+		status.CronLeader = cron.IsLeader()
+
+		restutil.Render(status, reportHttpStatus(health.Report{Status: status.Status}), c)
+	}
+}
+
+func reportHttpStatus(report health.Report) int {
+	if report.Status != health.StatusUp {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusOK
+}
@@ -46,10 +46,9 @@ func GetSunburstHandler() gin.HandlerFunc {
 		syncTree := &synctree.BaseledgerSyncTree{}
 		err = json.Unmarshal([]byte(offchainMessage.BaseledgerSyncTreeJson), &syncTree)
 		if err != nil {
-			logger.Errorf("Error unmarshalling sync tree", err.Error())
+			logger.Errorf("Error unmarshalling sync tree %v", err.Error())
 			return
 		}
-		logger.Infof("Sync tree unmarshalled", syncTree)
 
 		sunburst := getSyncTreeSunburst(*syncTree)
 		restutil.Render(sunburst, 200, c)
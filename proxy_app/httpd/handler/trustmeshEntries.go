@@ -16,6 +16,8 @@ type newWorkflowDto struct {
 	WorkstepType               string `json:"workstep_type"`
 	BaseledgerBusinessObjectId string `json:"baseledger_business_object_id"`
 	BusinessObjectJsonPayload  string `json:"business_object_json_payload"`
+	BusinessObjectPayload      string `json:"business_object_payload"` // business object in the format it was sent in
+	BusinessObjectFormat       string `json:"business_object_format"`
 	BusinessObjectId           string `json:"business_object_id"`
 }
 
@@ -25,6 +27,8 @@ type latestTrustmeshEntryDto struct {
 	WorkstepType               string `json:"workstep_type"`
 	BaseledgerBusinessObjectId string `json:"baseledger_business_object_id"`
 	BusinessObjectJsonPayload  string `json:"business_object_json_payload"`
+	BusinessObjectPayload      string `json:"business_object_payload"` // business object in the format it was sent in
+	BusinessObjectFormat       string `json:"business_object_format"`
 	Approved                   bool   `json:"approved"`
 	EthExitTxHash              string `json:"eth_tx_hash"`
 }
@@ -53,13 +57,24 @@ func GetNewWorkflowHandler() gin.HandlerFunc {
 		for _, entry := range res {
 			syncTree := &synctree.BaseledgerSyncTree{}
 			json.Unmarshal([]byte(entry.OffchainProcessMessage.BaseledgerSyncTreeJson), &syncTree)
-			boJson := synctree.GetBusinessObjectJson(*syncTree)
+			boJson, err := synctree.GetBusinessObjectJson(*syncTree)
+			if err != nil {
+				restutil.RenderError("error when reading business object of pending entry "+entry.Id.String(), 500, c)
+				return
+			}
+			businessObject, format, err := synctree.GetBusinessObject(*syncTree)
+			if err != nil {
+				restutil.RenderError("error when reading business object of pending entry "+entry.Id.String(), 500, c)
+				return
+			}
 			dto := &newWorkflowDto{
 				WorkflowId:                 entry.TrustmeshId.String(),
 				WorkstepId:                 entry.Id.String(),
 				WorkstepType:               entry.WorkstepType,
 				BaseledgerBusinessObjectId: entry.BaseledgerBusinessObjectId,
 				BusinessObjectJsonPayload:  boJson,
+				BusinessObjectPayload:      businessObject,
+				BusinessObjectFormat:       format,
 				BusinessObjectId:           entry.SorBusinessObjectId,
 			}
 
@@ -105,13 +120,24 @@ func GetLatestWorkflowStateHandler() gin.HandlerFunc {
 		syncTree := &synctree.BaseledgerSyncTree{}
 		json.Unmarshal([]byte(entry.OffchainProcessMessage.BaseledgerSyncTreeJson), &syncTree)
 
-		boJson := synctree.GetBusinessObjectJson(*syncTree)
+		boJson, err := synctree.GetBusinessObjectJson(*syncTree)
+		if err != nil {
+			restutil.RenderError("error when reading business object of latest workflow entry", 500, c)
+			return
+		}
+		businessObject, format, err := synctree.GetBusinessObject(*syncTree)
+		if err != nil {
+			restutil.RenderError("error when reading business object of latest workflow entry", 500, c)
+			return
+		}
 		dto := &latestTrustmeshEntryDto{
 			WorkflowId:                 entry.TrustmeshId.String(),
 			WorkstepId:                 entry.Id.String(),
 			WorkstepType:               entry.WorkstepType,
 			BaseledgerBusinessObjectId: entry.BaseledgerBusinessObjectId,
 			BusinessObjectJsonPayload:  boJson,
+			BusinessObjectPayload:      businessObject,
+			BusinessObjectFormat:       format,
 			Approved:                   approved,
 			EthExitTxHash:              trustmesh.EthExitTxHash,
 		}
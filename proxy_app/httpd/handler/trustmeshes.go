@@ -1,12 +1,14 @@
 package handler
 
 import (
-	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	uuid "github.com/kthomas/go.uuid"
-	"github.com/unibrightio/proxy-api/common"
 	"github.com/unibrightio/proxy-api/dbutil"
 	"github.com/unibrightio/proxy-api/logger"
 	"github.com/unibrightio/proxy-api/restutil"
@@ -47,39 +49,135 @@ type trustmeshDto struct {
 	BusinessObjectTypes string
 	Finalized           bool
 	ContainsRejections  bool
+	EthExitTxHash       string
 	Entries             []trustmeshEntryDto
 }
 
 // @Security BasicAuth
-// GetTrustmeshes ... Get all trustmeshes
-// @Summary Get all trustmeshes
-// @Description get all trustmeshes
+// GetTrustmeshes ... Get trustmeshes
+// @Summary Get trustmeshes
+// @Description get trustmeshes matching filters, entry filters match if any entry of trustmesh matches.
+// @Description Next page is requested with cursor from x-next-cursor header, which is missing on last page.
+// @Description Page and rpp select offset pages instead and set x-total-results-count header
+// @Param workgroup_id query string false "workgroup id"
+// @Param participant query string false "id of sending or receiving organization"
+// @Param business_object_type query string false "business object type"
+// @Param sor_business_object_id query string false "business object id in SOR"
+// @Param bboid query string false "baseledger business object id"
+// @Param commitment_state query string false "commitment state"
+// @Param finalized query bool false "contains final workstep"
+// @Param contains_rejections query bool false "contains rejection"
+// @Param exited query bool false "exit proof stored on ethereum"
+// @Param created_after query string false "RFC3339 timestamp or date"
+// @Param created_before query string false "RFC3339 timestamp or date"
+// @Param transaction_after query string false "any entry committed at or after, RFC3339 timestamp or date"
+// @Param transaction_before query string false "any entry committed before, RFC3339 timestamp or date"
+// @Param sort query string false "created_at (default), start_time or end_time, prefixed with - for descending order"
+// @Param limit query int false "trustmeshes per page, 5 by default and 100 at most"
+// @Param cursor query string false "x-next-cursor of previous page"
+// @Param page query int false "offset page, can not be combined with cursor"
+// @Param rpp query int false "trustmeshes per offset page"
+// @Param fields query string false "comma separated fields to return, i.e. Id,Participants,Finalized"
 // @Tags Trustmeshes
 // @Produce json
 // @Success 200 {array} trustmeshDto
+// @Failure 400 {string} errorMessage
 // @Router /trustmeshes [get]
 func GetTrustmeshesHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var trustmeshes []types.Trustmesh
-		db := dbutil.Db.GetConn().Order("trustmeshes.created_at ASC")
-		// preload seems good enough for now, revisit if it turns out to be performance bottleneck
-		dbutil.Paginate(c, db, &types.Trustmesh{}).
-			Preload("Entries").
-			Preload("Entries.SenderOrg").
-			Preload("Entries.ReceiverOrg").
-			Preload("Entries.Workgroup").
-			Find(&trustmeshes)
-
-		var trustmeshesDtos []trustmeshDto
-
-		for i := 0; i < len(trustmeshes); i++ {
-			trustmeshesDtos = append(trustmeshesDtos, *processTrustmesh(&trustmeshes[i]))
+		query, err := types.ParseTrustmeshQuery(c.Request.URL.Query())
+		if err != nil {
+			restutil.RenderError(err.Error(), 400, c)
+			return
+		}
+
+		fields, err := normalizeTrustmeshFields(query.Fields)
+		if err != nil {
+			restutil.RenderError(err.Error(), 400, c)
+			return
+		}
+
+		// summary is persisted on trustmeshes, entries are loaded only if they are returned
+		preloadEntries := len(fields) == 0 || fields["entries"]
+
+		page, err := query.Find(dbutil.Db.GetConn(), preloadEntries)
+		if err != nil {
+			logger.Errorf("error when querying trustmeshes %v", err)
+			restutil.RenderError("error when querying trustmeshes", 500, c)
+			return
+		}
+
+		if page.NextCursor != "" {
+			c.Header("x-next-cursor", page.NextCursor)
+		}
+		if page.TotalResults != nil {
+			c.Header("x-total-results-count", fmt.Sprintf("%d", *page.TotalResults))
+		}
+
+		trustmeshesDtos := []interface{}{}
+		for i := range page.Trustmeshes {
+			dto := processTrustmesh(&page.Trustmeshes[i])
+			if len(fields) == 0 {
+				trustmeshesDtos = append(trustmeshesDtos, dto)
+				continue
+			}
+
+			sparse, err := selectFields(dto, fields)
+			if err != nil {
+				restutil.RenderError(err.Error(), 500, c)
+				return
+			}
+			trustmeshesDtos = append(trustmeshesDtos, sparse)
 		}
 
 		restutil.Render(trustmeshesDtos, 200, c)
 	}
 }
 
+// normalizeTrustmeshFields matches requested fields to json fields of trustmeshDto ignoring case
+// and underscores, so created_at selects CreatedAt
+func normalizeTrustmeshFields(requested []string) (map[string]bool, error) {
+	known := map[string]bool{}
+	dtoType := reflect.TypeOf(trustmeshDto{})
+	for i := 0; i < dtoType.NumField(); i++ {
+		known[normalizeField(dtoType.Field(i).Name)] = true
+	}
+
+	fields := map[string]bool{}
+	for _, field := range requested {
+		if !known[normalizeField(field)] {
+			return nil, fmt.Errorf("unknown field %v", field)
+		}
+		fields[normalizeField(field)] = true
+	}
+
+	return fields, nil
+}
+
+func normalizeField(field string) string {
+	return strings.ToLower(strings.ReplaceAll(field, "_", ""))
+}
+
+func selectFields(dto interface{}, fields map[string]bool) (map[string]interface{}, error) {
+	buf, err := json.Marshal(dto)
+	if err != nil {
+		return nil, err
+	}
+
+	all := map[string]interface{}{}
+	if err = json.Unmarshal(buf, &all); err != nil {
+		return nil, err
+	}
+
+	selected := map[string]interface{}{}
+	for field, value := range all {
+		if fields[normalizeField(field)] {
+			selected[field] = value
+		}
+	}
+	return selected, nil
+}
+
 // @Security BasicAuth
 // GetTrustmesh ... Get single trustmesh
 // @Summary Get single trustmesh
@@ -113,52 +211,24 @@ func GetTrustmeshHandler() gin.HandlerFunc {
 	}
 }
 
+// processTrustmesh maps trustmesh with its persisted summary, entries are mapped if they are loaded
 func processTrustmesh(trustmesh *types.Trustmesh) *trustmeshDto {
-	if len(trustmesh.Entries) == 0 {
-		return nil
+	trustmeshDto := &trustmeshDto{
+		Id:                  trustmesh.Id,
+		CreatedAt:           trustmesh.CreatedAt,
+		StartTime:           trustmesh.StartTime,
+		EndTime:             trustmesh.EndTime,
+		Participants:        trustmesh.Participants,
+		BusinessObjectTypes: trustmesh.BusinessObjectTypes,
+		Finalized:           trustmesh.Finalized,
+		ContainsRejections:  trustmesh.ContainsRejections,
+		EthExitTxHash:       trustmesh.EthExitTxHash,
 	}
-	trustmeshDto := &trustmeshDto{}
-	var entriesDto []trustmeshEntryDto
-
-	startTime := trustmesh.Entries[0].TendermintTransactionTimestamp
-	endTime := trustmesh.Entries[0].TendermintTransactionTimestamp
-	participants := ""
-	participantsMap := make(map[string]int)
-	businessObjectTypes := ""
-	businessObjectTypesMap := make(map[string]int)
-	finalized := false
-	containsRejection := false
 
 	for _, entry := range trustmesh.Entries {
-		startTime = getBeforeTime(startTime, entry.TendermintTransactionTimestamp)
-		endTime = getAfterTime(endTime, entry.TendermintTransactionTimestamp)
-
-		appendDistinct(participantsMap, entry.SenderOrg.OrganizationName, &participants)
-		appendDistinct(participantsMap, entry.ReceiverOrg.OrganizationName, &participants)
-		appendDistinct(businessObjectTypesMap, entry.BusinessObjectType, &businessObjectTypes)
-
-		if entry.WorkstepType == common.WorkstepTypeFinal && !finalized {
-			finalized = true
-		}
-
-		if entry.BaseledgerTransactionType == common.BaseledgerTransactionTypeReject && !containsRejection {
-			containsRejection = true
-		}
-
-		entryDto := processTrustmeshEntry(entry)
-		entriesDto = append(entriesDto, *entryDto)
+		trustmeshDto.Entries = append(trustmeshDto.Entries, *processTrustmeshEntry(entry))
 	}
 
-	trustmeshDto.Id = trustmesh.Id
-	trustmeshDto.CreatedAt = trustmesh.CreatedAt
-	trustmeshDto.StartTime = startTime.Time
-	trustmeshDto.EndTime = endTime.Time
-	trustmeshDto.Participants = participants
-	trustmeshDto.BusinessObjectTypes = businessObjectTypes
-	trustmeshDto.Finalized = finalized
-	trustmeshDto.ContainsRejections = containsRejection
-	trustmeshDto.Entries = entriesDto
-
 	return trustmeshDto
 }
 
@@ -195,50 +265,3 @@ func uuidToString(id uuid.UUID) string {
 	}
 	return id.String()
 }
-
-func getSeparator(str string) string {
-	if str == "" {
-		return ""
-	} else {
-		return ", "
-	}
-}
-
-func getBeforeTime(first sql.NullTime, second sql.NullTime) sql.NullTime {
-	if !first.Valid {
-		return second
-	}
-
-	if !second.Valid {
-		return first
-	}
-
-	if first.Time.Before(second.Time) {
-		return first
-	}
-
-	return second
-}
-
-func getAfterTime(first sql.NullTime, second sql.NullTime) sql.NullTime {
-	if !first.Valid {
-		return second
-	}
-
-	if !second.Valid {
-		return first
-	}
-
-	if first.Time.Before(second.Time) {
-		return second
-	}
-
-	return first
-}
-
-func appendDistinct(itemsMap map[string]int, newItem string, acc *string) {
-	if itemsMap[newItem] == 0 {
-		itemsMap[newItem] = 1
-		*acc = *acc + getSeparator(*acc) + newItem
-	}
-}
@@ -131,7 +131,7 @@ func CreateTransactionHandler() gin.HandlerFunc {
 			OpCode:        uint32(req.OpCode),
 		}
 
-		txHash := restutil.SignAndBroadcast(signAndBroadcastPayload)
+		txHash := restutil.SignAndBroadcast(c.Request.Context(), signAndBroadcastPayload)
 
 		logger.Infof("Transaction hash of custom payload %v\n", txHash)
 		restutil.Render(txHash, 200, c)
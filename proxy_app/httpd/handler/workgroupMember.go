@@ -7,22 +7,26 @@ import (
 	uuid "github.com/kthomas/go.uuid"
 	"github.com/unibrightio/proxy-api/dbutil"
 	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/messaging"
 	"github.com/unibrightio/proxy-api/restutil"
 	"github.com/unibrightio/proxy-api/types"
 )
 
 type workgroupMemberDetailsDto struct {
-	Id                   uuid.UUID `json:"id"`
-	WorkgroupId          string    `json:"workgroup_id"`
-	OrganizationId       string    `json:"organization_id"`
-	OrganizationEndpoint string    `json:"organization_endpoint"`
-	OrganizationToken    string    `json:"organization_token"`
+	Id                    uuid.UUID `json:"id"`
+	WorkgroupId           string    `json:"workgroup_id"`
+	OrganizationId        string    `json:"organization_id"`
+	OrganizationEndpoint  string    `json:"organization_endpoint"`
+	OrganizationToken     string    `json:"organization_token"`
+	OrganizationPublicKey string    `json:"organization_public_key"`
 }
 
 type createWorkgroupMemberRequest struct {
 	OrganizationId       string `json:"organization_id"`
 	OrganizationEndpoint string `json:"organization_endpoint"`
 	OrganizationToken    string `json:"organization_token"`
+	// hex encoded ed25519 key, required for https and amqp endpoints
+	OrganizationPublicKey string `json:"organization_public_key"`
 }
 
 // @Security BasicAuth
@@ -51,6 +55,7 @@ func GetWorkgroupMembersHandler() gin.HandlerFunc {
 			workgroupMemberDto.OrganizationId = workgroupMembers[i].OrganizationId
 			workgroupMemberDto.OrganizationEndpoint = workgroupMembers[i].OrganizationEndpoint
 			workgroupMemberDto.OrganizationToken = workgroupMembers[i].OrganizationToken
+			workgroupMemberDto.OrganizationPublicKey = workgroupMembers[i].OrganizationPublicKey
 			workgroupMembersDtos = append(workgroupMembersDtos, *workgroupMemberDto)
 		}
 
@@ -85,6 +90,11 @@ func CreateWorkgroupMemberHandler() gin.HandlerFunc {
 			return
 		}
 
+		if err := messaging.ValidateMemberEndpoint(req.OrganizationEndpoint, req.OrganizationPublicKey); err != nil {
+			restutil.RenderError(err.Error(), 422, c)
+			return
+		}
+
 		newWorkgroupMember := newWorkgroupMember(*req, workgroupId)
 
 		if !newWorkgroupMember.Create() {
@@ -133,9 +143,10 @@ func DeleteWorkgroupMemberHandler() gin.HandlerFunc {
 
 func newWorkgroupMember(req createWorkgroupMemberRequest, workgroupId string) *types.WorkgroupMember {
 	return &types.WorkgroupMember{
-		WorkgroupId:          workgroupId,
-		OrganizationId:       req.OrganizationId,
-		OrganizationEndpoint: req.OrganizationEndpoint,
-		OrganizationToken:    req.OrganizationToken,
+		WorkgroupId:           workgroupId,
+		OrganizationId:        req.OrganizationId,
+		OrganizationEndpoint:  req.OrganizationEndpoint,
+		OrganizationToken:     req.OrganizationToken,
+		OrganizationPublicKey: req.OrganizationPublicKey,
 	}
 }
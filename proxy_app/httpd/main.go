@@ -1,33 +1,40 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
-	"fmt"
-	"time"
+	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
-	uuid "github.com/kthomas/go.uuid"
-	"github.com/nats-io/nats.go"
-	"github.com/spf13/viper"
-	"github.com/ulule/limiter/v3"
-	"github.com/ulule/limiter/v3/drivers/store/memory"
 	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/config"
 	"github.com/unibrightio/proxy-api/cron"
 	"github.com/unibrightio/proxy-api/dbutil"
+	"github.com/unibrightio/proxy-api/health"
 	"github.com/unibrightio/proxy-api/httpd/handler"
 	proxyMiddleware "github.com/unibrightio/proxy-api/httpd/middleware"
+	"github.com/unibrightio/proxy-api/lifecycle"
 	"github.com/unibrightio/proxy-api/logger"
 	"github.com/unibrightio/proxy-api/messaging"
+	"github.com/unibrightio/proxy-api/ratelimit"
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/workflow"
+	"github.com/unibrightio/proxy-api/workgroups"
 
 	"github.com/unibrightio/proxy-api/types"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
 	docs "github.com/unibrightio/proxy-api/httpd/docs"
-
-	mgin "github.com/ulule/limiter/v3/drivers/middleware/gin"
+	"github.com/unibrightio/proxy-api/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var mainLog = logger.For("main")
+
 // @title Baseledger Proxy API documentation
 // @version 1.0.0
 // @host localhost:8081
@@ -36,141 +43,227 @@ import (
 // @in header
 // @name Authorization
 func main() {
-	setupViper()
-	docs.SwaggerInfo.Host = viper.GetString("SWAGGER_HOST")
+	setupConfig()
+	docs.SwaggerInfo.Host = config.Get().SwaggerHost
 	logger.SetupLogger()
-	setupDb()
-	cron.StartCron()
-	subscribeToWorkgroupMessages()
+	lifecycleManager := lifecycle.NewManager(config.Get().Shutdown.Timeout)
+	lifecycleManager.Register("tracing", tracing.Setup())
+	setupDb(lifecycleManager)
+	messagingClient := subscribeToWorkgroupMessages(lifecycleManager)
+	cron.StartCron(lifecycleManager.Context())
+	lifecycleManager.Register("cron", cron.StopCron)
 
-	rate := limiter.Rate{
-		Period: 1 * time.Hour * 24,
-		Limit:  10,
-	}
+	apiRateLimit := proxyMiddleware.RateLimit(ratelimit.LoadPolicy(ratelimit.ApiPolicy))
+	// separate budget for tokens consumed through sign and broadcast, enforced for cron driven broadcasts too
+	broadcastBudget := ratelimit.NewBroadcastBudget()
+	restutil.BroadcastBudget = broadcastBudget.Take
+	broadcastRateLimit := proxyMiddleware.BroadcastRateLimit(broadcastBudget)
+	devRateLimit := proxyMiddleware.RateLimit(ratelimit.LoadPolicy(ratelimit.DevPolicy))
 
-	store := memory.NewStore()
-	instance := limiter.New(store, rate)
-	rateMiddleware := mgin.NewMiddleware(instance)
+	dependencyChecker := health.NewChecker(
+		health.Dependency{Name: "postgres", Check: health.CheckPostgres},
+		health.Dependency{Name: "nats", Check: health.CheckNats(messagingClient.Connected)},
+		health.Dependency{Name: "blockchain_app", Check: health.CheckBlockchainApp},
+		health.Dependency{Name: "tendermint", Check: health.CheckTendermint},
+		health.Dependency{Name: "ethereum", Check: health.CheckEthereum},
+	)
 
 	r := gin.Default()
 	r.Use(proxyMiddleware.CORSMiddleware())
+	r.Use(proxyMiddleware.RequestId())
+	r.Use(proxyMiddleware.Tracing())
+	r.Use(proxyMiddleware.Metrics())
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-	r.GET("/trustmeshes", proxyMiddleware.BasicAuth(false), handler.GetTrustmeshesHandler())
-	r.GET("/trustmeshes/:id", proxyMiddleware.BasicAuth(false), handler.GetTrustmeshHandler())
-	r.POST("/suggestion", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), handler.CreateSuggestionRequestHandler())
-	r.POST("/feedback", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), handler.CreateSynchronizationFeedbackHandler())
-	r.GET("/sunburst/:txId", proxyMiddleware.BasicAuth(false), handler.GetSunburstHandler())
-	r.GET("/organization", proxyMiddleware.BasicAuth(false), handler.GetOrganizationsHandler())
-	r.POST("/organization", proxyMiddleware.BasicAuth(false), handler.CreateOrganizationHandler())
-	r.DELETE("/organization/:id", proxyMiddleware.BasicAuth(false), handler.DeleteOrganizationHandler())
-	r.GET("/workgroup", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), handler.GetWorkgroupsHandler())
-	r.POST("/workgroup", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), handler.CreateWorkgroupHandler())
-	r.DELETE("/workgroup/:id", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), handler.DeleteWorkgroupHandler())
-	r.GET("/workgroup/:id/participation", proxyMiddleware.BasicAuth(false), handler.GetWorkgroupMembersHandler())
-	r.POST("/workgroup/:id/participation", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), handler.CreateWorkgroupMemberHandler())
-	r.DELETE("/workgroup/:id/participation/:participationId", proxyMiddleware.BasicAuth(false), handler.DeleteWorkgroupMemberHandler())
-	r.GET("/sorwebhook", proxyMiddleware.BasicAuth(false), handler.GetSorWebhooksHandler())
-	r.POST("/sorwebhook", proxyMiddleware.BasicAuth(false), handler.CreateSorWebhookHandler())
-	r.DELETE("/sorwebhook/:id", proxyMiddleware.BasicAuth(false), handler.DeleteSorWebhookHandler())
+	// probes and metrics are not authenticated nor rate limited, kubernetes and prometheus call them directly
+	r.GET("/healthz", handler.GetHealthzHandler())
+	r.GET("/readyz", handler.GetReadyzHandler(dependencyChecker))
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/status", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetStatusHandler(dependencyChecker))
+	r.GET("/trustmeshes", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetTrustmeshesHandler())
+	r.GET("/trustmeshes/:id", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetTrustmeshHandler())
+	r.GET("/business-objects/:bboid/versions", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetBusinessObjectVersionsHandler())
+	r.GET("/business-objects/:bboid/diff", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetBusinessObjectDiffHandler())
+	r.POST("/suggestion", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), apiRateLimit, broadcastRateLimit, handler.CreateSuggestionRequestHandler())
+	r.POST("/feedback", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), apiRateLimit, broadcastRateLimit, handler.CreateSynchronizationFeedbackHandler())
+	r.GET("/sunburst/:txId", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetSunburstHandler())
+	r.GET("/organization", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetOrganizationsHandler())
+	r.POST("/organization", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.CreateOrganizationHandler())
+	r.DELETE("/organization/:id", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.DeleteOrganizationHandler())
+	r.GET("/workgroup", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), apiRateLimit, handler.GetWorkgroupsHandler())
+	r.POST("/workgroup", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), apiRateLimit, handler.CreateWorkgroupHandler())
+	r.DELETE("/workgroup/:id", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), apiRateLimit, handler.DeleteWorkgroupHandler())
+	r.GET("/workgroup/:id/participation", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetWorkgroupMembersHandler())
+	r.POST("/workgroup/:id/participation", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), apiRateLimit, handler.CreateWorkgroupMemberHandler())
+	r.GET("/workgroup/:id/schemas", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetBusinessObjectSchemasHandler())
+	r.GET("/workgroup/:id/schemas/:type", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetBusinessObjectSchemaHandler())
+	r.PUT("/workgroup/:id/schemas/:type", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), apiRateLimit, handler.PutBusinessObjectSchemaHandler())
+	r.DELETE("/workgroup/:id/schemas/:type", proxyMiddleware.BasicAuth(true), proxyMiddleware.AuthorizeJWTMiddleware(true), apiRateLimit, handler.DeleteBusinessObjectSchemaHandler())
+	r.DELETE("/workgroup/:id/participation/:participationId", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.DeleteWorkgroupMemberHandler())
+	r.GET("/sorwebhook", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetSorWebhooksHandler())
+	r.POST("/sorwebhook", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.CreateSorWebhookHandler())
+	r.DELETE("/sorwebhook/:id", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.DeleteSorWebhookHandler())
+	r.GET("/admin/config", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetConfigHandler())
+	r.GET("/admin/trustmeshes/:id", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetAdminTrustmeshHandler())
+	r.GET("/admin/trustmeshes/:id/verify", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.VerifyTrustmeshHandler())
+	r.GET("/admin/trustmeshes/:id/export", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.ExportTrustmeshHandler())
+	r.POST("/admin/entries/:id/rerun", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.RerunTrustmeshEntryHandler())
+	r.POST("/admin/entries/:id/resend", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.ResendOffchainMessageHandler())
+	r.GET("/admin/entries", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.GetTrustmeshEntriesByProcessingStateHandler())
+	r.POST("/admin/entries/:id/retry", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.RetryTrustmeshEntryHandler())
+	r.POST("/admin/entries/:id/skip", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.SkipTrustmeshEntryHandler())
+	r.POST("/admin/entries/:id/resolve", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.ResolveTrustmeshEntryHandler())
+	r.POST("/admin/entries/:id/finish-broadcast", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.FinishTrustmeshEntryBroadcastHandler())
+	r.POST("/admin/entries/:id/abandon-broadcast", proxyMiddleware.BasicAuth(false), apiRateLimit, handler.AbandonTrustmeshEntryBroadcastHandler())
 	// TODO: BAS-29 r.POST("/workgroup/invite", handler.InviteToWorkgroupHandler())
 	// full details of workgroup, including organization
-	r.GET("/workflow/new/:workgroup_id", proxyMiddleware.AuthorizeJWTMiddleware(false), handler.GetNewWorkflowHandler())
-	r.GET("/workflow/latestState/:bo_id", proxyMiddleware.AuthorizeJWTMiddleware(false), handler.GetLatestWorkflowStateHandler())
-	r.POST("/dev/users", handler.CreateUserHandler())
-	r.POST("/dev/auth", handler.LoginUserHandler())
-	r.POST("/dev/tx", proxyMiddleware.AuthorizeJWTMiddleware(false), rateMiddleware, handler.CreateTransactionHandler())
-	r.Run() // listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
+	r.GET("/workflow/new/:workgroup_id", proxyMiddleware.AuthorizeJWTMiddleware(false), apiRateLimit, handler.GetNewWorkflowHandler())
+	r.GET("/workflow/latestState/:bo_id", proxyMiddleware.AuthorizeJWTMiddleware(false), apiRateLimit, handler.GetLatestWorkflowStateHandler())
+	r.POST("/dev/users", devRateLimit, handler.CreateUserHandler())
+	r.POST("/dev/auth", devRateLimit, handler.LoginUserHandler())
+	r.POST("/dev/tx", proxyMiddleware.AuthorizeJWTMiddleware(false), devRateLimit, broadcastRateLimit, handler.CreateTransactionHandler())
+
+	serveHttp(r, lifecycleManager)
+
+	lifecycleManager.Wait()
+	if err := lifecycleManager.Shutdown(); err != nil {
+		logger.Errorf("%v", err.Error())
+		os.Exit(1)
+	}
+	logger.Info("shutdown complete")
+}
+
+// http server stops accepting new requests first and waits for in-flight ones on shutdown
+func serveHttp(r *gin.Engine, lifecycleManager *lifecycle.Manager) {
+	server := &http.Server{
+		Addr:    ":" + config.Get().Api.Port, // listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
+		Handler: r,
+	}
+
+	go func() {
+		logger.Infof("listening on %v", server.Addr)
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			logger.Errorf("http server error %v", err.Error())
+			lifecycleManager.Shutdown()
+		}
+	}()
+
+	lifecycleManager.Register("http server", server.Shutdown)
 }
 
-// discuss if we should use config struct or this is enough
-func setupViper() {
-	viper.AddConfigPath("../")
-	viper.SetConfigFile(".env")
-	viper.AutomaticEnv() // Overwrite config with env variables if exist, important for debugging session
-	err := viper.ReadInConfig()
+// all configuration problems are reported at once, proxy does not start with invalid configuration
+func setupConfig() {
+	_, err := config.Load(".env")
 	if err != nil {
-		fmt.Println(fmt.Printf("viper read config error %v\n", err))
+		logger.Errorf("invalid configuration %v", err.Error())
+		os.Exit(1)
 	}
+
+	config.WatchForChanges(logger.Warnf)
 }
 
-// migrate should be separate package, and we should have .sh script for running, see provide services
-// leaving this for first version but we should separate definetely
-func setupDb() {
+// db is bootstrapped and migrated on start, schema can also be managed separately with proxyctl migrate
+func setupDb(lifecycleManager *lifecycle.Manager) {
 	dbutil.InitDbIfNotExists()
-	dbutil.PerformMigrations()
+	// proxy does not run against schema it does not know, see proxyctl migrate
+	if err := dbutil.PerformMigrations(); err != nil {
+		logger.Errorf("migrations failed %v", err.Error())
+		os.Exit(1)
+	}
 	// TODO: BAS-29 Add own org id to database with some dummy name
 	dbutil.InitConnection()
+	lifecycleManager.Register("db", func(ctx context.Context) error {
+		return dbutil.CloseConnection()
+	})
 }
 
-func subscribeToWorkgroupMessages() {
-	natsServerUrl, _ := viper.Get("NATS_URL").(string)
-	natsToken := "testToken1" // TODO: Read from configuration
+// envelopes are received on local nats server and, when configured, on https endpoint and amqp queue
+func subscribeToWorkgroupMessages(lifecycleManager *lifecycle.Manager) *messaging.MessagingClient {
+	natsServerUrl := config.Get().Nats.Url
+	natsToken := config.Get().Nats.Token
 	logger.Infof("subscribeToWorkgroupMessages natsServerUrl %v", natsServerUrl)
-	messagingClient := &messaging.NatsMessagingClient{}
-	messagingClient.Subscribe(natsServerUrl, natsToken, common.BaseledgerNatsSubject, receiveOffchainProcessMessage)
-	messagingClient.Subscribe(natsServerUrl, natsToken, common.EthTxHashNatsSubject, receiveTxEthHashUpdateMessage)
+
+	workgroupClient := &workgroups.PostgresWorkgroupClient{}
+	messagingClient := messaging.NewClient(func(workgroupId string, organizationId string) ed25519.PublicKey {
+		member := workgroupClient.FindWorkgroupMember(workgroupId, organizationId)
+		if member == nil {
+			return nil
+		}
+		return member.PublicKey()
+	})
+
+	endpoints := []string{natsServerUrl}
+	if endpoint := config.Get().Messaging.HttpsEndpoint; endpoint != "" {
+		endpoints = append(endpoints, endpoint)
+	}
+	if endpoint := config.Get().Messaging.AmqpEndpoint; endpoint != "" {
+		endpoints = append(endpoints, endpoint)
+	}
+	for _, endpoint := range endpoints {
+		if err := messagingClient.Subscribe(endpoint, natsToken, common.BaseledgerNatsSubject, receiveOffchainProcessMessage); err != nil {
+			logger.Errorf("error subscribing to offchain messages %v", err)
+		}
+		if err := messagingClient.Subscribe(endpoint, natsToken, common.EthTxHashNatsSubject, receiveTxEthHashUpdateMessage); err != nil {
+			logger.Errorf("error subscribing to trustmesh updates %v", err)
+		}
+	}
+	lifecycleManager.Register("messaging subscriptions", messagingClient.Drain)
+	return messagingClient
 }
 
-func receiveOffchainProcessMessage(sender string, natsMsg *nats.Msg) {
+func receiveOffchainProcessMessage(envelope messaging.Envelope) {
 	// TODO: should we move this parsing to nats client and just get struct in this callback?
 	var natsMessage types.NatsMessage
-	err := json.Unmarshal(natsMsg.Data, &natsMessage)
+	err := json.Unmarshal(envelope.Payload, &natsMessage)
 	if err != nil {
 		logger.Errorf("Error parsing nats message %v\n", err)
 		return
 	}
 
-	logger.Infof("message received %v\n", natsMessage)
+	ctx := tracing.Extract(context.Background(), natsMessage.TraceContext)
+	ctx, span := tracing.StartWithKind(ctx, "receiveOffchainProcessMessage", trace.SpanKindConsumer,
+		tracing.NatsSubjectKey.String(envelope.Subject),
+		tracing.TransactionIdKey.String(natsMessage.ProcessMessage.BaseledgerTransactionIdOfStoredProof.String()),
+		tracing.TransactionHashKey.String(natsMessage.TxHash),
+		tracing.BaseledgerBusinessObjectIdKey.String(natsMessage.ProcessMessage.BaseledgerBusinessObjectId),
+	)
+	defer span.End()
 
-	natsMessage.ProcessMessage.Id = uuid.Nil // set to nil so that it can be created in the DB
-	if !natsMessage.ProcessMessage.Create() {
-		logger.Errorf("error when creating new offchain msg entry")
-		return
-	}
+	mainLog.Ctx(ctx).Info("offchain process message received",
+		logger.F("sender_id", natsMessage.ProcessMessage.SenderId.String()),
+		logger.F("entry_type", natsMessage.ProcessMessage.EntryType),
+		logger.F("transaction_hash", natsMessage.TxHash),
+		logger.F("baseledger_business_object_id", natsMessage.ProcessMessage.BaseledgerBusinessObjectId),
+	)
 
-	entryType := common.SuggestionReceivedTrustmeshEntryType
-	if natsMessage.ProcessMessage.EntryType == common.FeedbackSentTrustmeshEntryType {
-		entryType = common.FeedbackReceivedTrustmeshEntryType
+	if err := workflow.NewService().ReceiveOffchainProcessMessage(ctx, envelope, natsMessage); err != nil {
+		logger.Errorf(err.Error())
+		tracing.Fail(span, err.Error())
 	}
-
-	trustmeshEntry := &types.TrustmeshEntry{
-		TendermintTransactionId:              natsMessage.ProcessMessage.BaseledgerTransactionIdOfStoredProof,
-		OffchainProcessMessageId:             natsMessage.ProcessMessage.Id,
-		SenderOrgId:                          natsMessage.ProcessMessage.SenderId,
-		ReceiverOrgId:                        natsMessage.ProcessMessage.ReceiverId,
-		WorkgroupId:                          uuid.FromStringOrNil(natsMessage.ProcessMessage.Topic),
-		WorkstepType:                         natsMessage.ProcessMessage.WorkstepType,
-		BaseledgerTransactionType:            natsMessage.ProcessMessage.BaseledgerTransactionType,
-		BaseledgerTransactionId:              natsMessage.ProcessMessage.BaseledgerTransactionIdOfStoredProof,
-		ReferencedBaseledgerTransactionId:    natsMessage.ProcessMessage.ReferencedBaseledgerTransactionId,
-		BusinessObjectType:                   natsMessage.ProcessMessage.BusinessObjectType,
-		BaseledgerBusinessObjectId:           natsMessage.ProcessMessage.BaseledgerBusinessObjectId,
-		ReferencedBaseledgerBusinessObjectId: natsMessage.ProcessMessage.ReferencedBaseledgerBusinessObjectId,
-		SorBusinessObjectId:                  natsMessage.ProcessMessage.SorBusinessObjectId,
-		TransactionHash:                      natsMessage.TxHash,
-		EntryType:                            entryType,
-	}
-
-	if !trustmeshEntry.Create() {
-		logger.Errorf("error when creating new trustmesh entry")
-	}
-
 }
 
-func receiveTxEthHashUpdateMessage(sender string, natsMsg *nats.Msg) {
+func receiveTxEthHashUpdateMessage(envelope messaging.Envelope) {
 	var natsTrustmeshUpdateMessage types.NatsTrustmeshUpdateMessage
-	err := json.Unmarshal(natsMsg.Data, &natsTrustmeshUpdateMessage)
+	err := json.Unmarshal(envelope.Payload, &natsTrustmeshUpdateMessage)
 	if err != nil {
 		logger.Errorf("Error parsing nats message %v\n", err)
 		return
 	}
 
-	logger.Infof("message received %v", natsTrustmeshUpdateMessage)
+	ctx := tracing.Extract(context.Background(), natsTrustmeshUpdateMessage.TraceContext)
+	ctx, span := tracing.StartWithKind(ctx, "receiveTxEthHashUpdateMessage", trace.SpanKindConsumer,
+		tracing.NatsSubjectKey.String(envelope.Subject),
+		tracing.BaseledgerBusinessObjectIdKey.String(natsTrustmeshUpdateMessage.BaseledgerBusinessObjectId),
+	)
+	defer span.End()
 
-	trustmeshEntry, err := types.GetLatestTrustmeshEntryBasedOnBboid(natsTrustmeshUpdateMessage.BaseledgerBusinessObjectId)
-	if err != nil {
-		logger.Errorf("Error getting latest trustmesh entry by bbod %v", err.Error())
+	mainLog.Ctx(ctx).Info("eth exit tx hash update received",
+		logger.F("baseledger_business_object_id", natsTrustmeshUpdateMessage.BaseledgerBusinessObjectId),
+		logger.F("eth_exit_tx_hash", natsTrustmeshUpdateMessage.EthExitTxHash),
+	)
+
+	if err := workflow.NewService().ReceiveTrustmeshUpdate(ctx, envelope, natsTrustmeshUpdateMessage); err != nil {
+		logger.Errorf("Error updating trustmesh eth tx hash %v", err.Error())
+		tracing.Fail(span, err.Error())
 	}
-	types.UpdateTrustmeshEthTxHash(trustmeshEntry.TrustmeshId, natsTrustmeshUpdateMessage.EthExitTxHash)
-	return
 }
@@ -5,19 +5,24 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
-	"github.com/spf13/viper"
+	"github.com/unibrightio/proxy-api/config"
 	"github.com/unibrightio/proxy-api/logger"
 	"github.com/unibrightio/proxy-api/token"
 )
 
+// keys under which authenticated identities are stored in gin context
+const apiKeyContextKey = "apikey"
+const userContextKey = "user"
+
 func BasicAuth(fallbackToJwt bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		basicAuthUser, _ := viper.Get("API_UB_USER").(string)
-		basicAuthPwd, _ := viper.Get("API_UB_PWD").(string)
+		basicAuthUser := config.Get().Api.User
+		basicAuthPwd := config.Get().Api.Password
 		// Get the Basic Authentication credentials
 		user, password, hasAuth := c.Request.BasicAuth()
 		if hasAuth && user == basicAuthUser && password == basicAuthPwd {
 			logger.Info("Basic auth successful")
+			c.Set(apiKeyContextKey, user)
 			// Setting this flag inside this context so next middleware knows it is already auth
 			if fallbackToJwt {
 				c.Set("auth", true)
@@ -61,6 +66,9 @@ func AuthorizeJWTMiddleware(isFallback bool) gin.HandlerFunc {
 		if token.Valid {
 			claims := token.Claims.(jwt.MapClaims)
 			logger.Infof("Token valid, claims %v", claims)
+			if email, ok := claims["email"].(string); ok {
+				c.Set(userContextKey, email)
+			}
 		} else {
 			logger.Errorf("Auth error %v", err)
 			c.AbortWithStatus(http.StatusUnauthorized)
@@ -5,9 +5,9 @@ import "github.com/gin-gonic/gin"
 const authorizationHeader = "Authorization"
 const defaultCorsAccessControlAllowOrigin = "*"
 const defaultCorsAccessControlAllowCredentials = "true"
-const defaultCorsAccessControlAllowHeaders = "Accept, Accept-Encoding, Authorization, Cache-Control, Content-Length, Content-Type, Origin, User-Agent, X-CSRF-Token, X-Requested-With"
+const defaultCorsAccessControlAllowHeaders = "Accept, Accept-Encoding, Authorization, Cache-Control, Content-Length, Content-Type, Origin, User-Agent, X-CSRF-Token, X-Request-Id, X-Requested-With"
 const defaultCorsAccessControlAllowMethods = "GET, POST, PUT, DELETE, OPTIONS"
-const defaultCorsAccessControlExposeHeaders = "X-Total-Results-Count"
+const defaultCorsAccessControlExposeHeaders = "X-Total-Results-Count, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After, X-Request-Id"
 const defaultResponseContentType = "application/json; charset=UTF-8"
 const defaultResultsPerPage = 25
 
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ulule/limiter/v3"
+	"github.com/unibrightio/proxy-api/config"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/ratelimit"
+)
+
+// RateLimit enforces the given policy and sets RateLimit-* headers on the response.
+// It has to be placed after auth middlewares so the identity used as key is verified.
+// When multiple policies apply to the route, headers of the last one are returned
+func RateLimit(policy ratelimit.Policy) gin.HandlerFunc {
+	return rateLimitWith(policy, ratelimit.NewPostgresStore(policy.Name+":"))
+}
+
+func rateLimitWith(policy ratelimit.Policy, store limiter.Store) gin.HandlerFunc {
+	instance := limiter.New(store, policy.Rate)
+
+	return func(c *gin.Context) {
+		key := string(policy.KeyBy) + ":" + rateLimitIdentity(c, policy.KeyBy)
+
+		limitContext, err := instance.Get(c, key)
+		if err != nil {
+			// failing open, db issues should not make the whole api unavailable
+			logger.Errorf("rate limit check failed for policy %v %v", policy.Name, err.Error())
+			c.Next()
+			return
+		}
+
+		if !writeRateLimitHeaders(c, limitContext, limitContext.Reached) {
+			logger.Warnf("rate limit %v reached for %v", policy.Name, key)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// BroadcastRateLimit rejects requests early when broadcast budget of the caller is used up.
+// Budget itself is consumed in sign and broadcast, so requests that do not broadcast cost nothing
+// and broadcasts started by cron are limited too. Unlike RateLimit it fails closed, every broadcast costs tokens
+func BroadcastRateLimit(budget *ratelimit.Budget) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := ratelimit.WithIdentity(c.Request.Context(), rateLimitIdentity(c, budget.Policy.KeyBy))
+		c.Request = c.Request.WithContext(ctx)
+
+		limitContext, err := budget.Peek(ctx)
+		if err != nil {
+			logger.Errorf("rate limit check failed for policy %v %v", budget.Policy.Name, err.Error())
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, map[string]interface{}{"error": "rate limit unavailable"})
+			return
+		}
+
+		if !writeRateLimitHeaders(c, limitContext, limitContext.Remaining == 0) {
+			logger.Warnf("rate limit %v reached", budget.Policy.Name)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// writeRateLimitHeaders sets RateLimit-* headers and aborts with 429 when rejected, returns false if request was aborted
+func writeRateLimitHeaders(c *gin.Context, limitContext limiter.Context, rejected bool) bool {
+	resetSeconds := limitContext.Reset - time.Now().Unix()
+	if resetSeconds < 0 {
+		resetSeconds = 0
+	}
+
+	c.Header("RateLimit-Limit", strconv.FormatInt(limitContext.Limit, 10))
+	c.Header("RateLimit-Remaining", strconv.FormatInt(limitContext.Remaining, 10))
+	c.Header("RateLimit-Reset", strconv.FormatInt(resetSeconds, 10))
+
+	if rejected {
+		c.Header("Retry-After", strconv.FormatInt(resetSeconds, 10))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, map[string]interface{}{"error": "rate limit exceeded"})
+		return false
+	}
+
+	return true
+}
+
+func rateLimitIdentity(c *gin.Context, keyBy ratelimit.KeyType) string {
+	switch keyBy {
+	case ratelimit.KeyByOrg:
+		return config.Get().OrganizationId
+	case ratelimit.KeyByUser:
+		if user := c.GetString(userContextKey); user != "" {
+			return user
+		}
+		fallthrough
+	case ratelimit.KeyByApiKey:
+		if apiKey := c.GetString(apiKeyContextKey); apiKey != "" {
+			return apiKey
+		}
+	}
+
+	return c.ClientIP()
+}
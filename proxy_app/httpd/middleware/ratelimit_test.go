@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ulule/limiter/v3"
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+	"github.com/unibrightio/proxy-api/ratelimit"
+)
+
+type failingStore struct {
+	limiter.Store
+}
+
+func (s failingStore) Get(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return limiter.Context{}, errors.New("db unavailable")
+}
+
+func (s failingStore) Peek(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return limiter.Context{}, errors.New("db unavailable")
+}
+
+func rateLimitedRouter(limit gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/", func(c *gin.Context) { c.Set(apiKeyContextKey, "api") }, limit, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func post(r *gin.Engine) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+	return recorder
+}
+
+func TestGivenRateLimitWhenLimitIsReachedThenHeadersAreSetAnd429IsReturned(t *testing.T) {
+	policy := ratelimit.Policy{Name: ratelimit.ApiPolicy, Rate: limiter.Rate{Period: time.Minute, Limit: 1}, KeyBy: ratelimit.KeyByApiKey}
+	r := rateLimitedRouter(rateLimitWith(policy, memory.NewStore()))
+
+	first := post(r)
+	if first.Code != http.StatusOK || first.Header().Get("RateLimit-Limit") != "1" || first.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("expected first request to pass with headers, got %v %v", first.Code, first.Header())
+	}
+
+	second := post(r)
+	if second.Code != http.StatusTooManyRequests || second.Header().Get("Retry-After") == "" || second.Header().Get("RateLimit-Reset") == "" {
+		t.Fatalf("expected second request to be limited, got %v %v", second.Code, second.Header())
+	}
+}
+
+func TestGivenUnavailableStoreWhenRateLimitedThenApiFailsOpenAndBroadcastFailsClosed(t *testing.T) {
+	policy := ratelimit.Policy{Name: ratelimit.ApiPolicy, Rate: limiter.Rate{Period: time.Minute, Limit: 1}, KeyBy: ratelimit.KeyByApiKey}
+	if code := post(rateLimitedRouter(rateLimitWith(policy, failingStore{}))).Code; code != http.StatusOK {
+		t.Fatalf("expected api limit to fail open, got %v", code)
+	}
+
+	policy.Name = ratelimit.BroadcastPolicy
+	if code := post(rateLimitedRouter(BroadcastRateLimit(ratelimit.NewBudget(policy, failingStore{})))).Code; code != http.StatusServiceUnavailable {
+		t.Fatalf("expected broadcast limit to fail closed, got %v", code)
+	}
+}
+
+func TestGivenBroadcastBudgetWhenUsedUpThenRequestIsRejectedBeforeHandler(t *testing.T) {
+	policy := ratelimit.Policy{Name: ratelimit.BroadcastPolicy, Rate: limiter.Rate{Period: time.Minute, Limit: 1}, KeyBy: ratelimit.KeyByApiKey}
+	budget := ratelimit.NewBudget(policy, memory.NewStore())
+	r := rateLimitedRouter(BroadcastRateLimit(budget))
+
+	// requests only peek, budget is taken by the broadcast itself with identity set by middleware
+	if code := post(r).Code; code != http.StatusOK {
+		t.Fatalf("expected request to pass, got %v", code)
+	}
+	if err := budget.Take(ratelimit.WithIdentity(context.Background(), "api")); err != nil {
+		t.Fatalf("expected budget to be taken, got %v", err)
+	}
+
+	limited := post(r)
+	if limited.Code != http.StatusTooManyRequests || limited.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("expected request to be limited, got %v %v", limited.Code, limited.Header())
+	}
+}
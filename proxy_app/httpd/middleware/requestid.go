@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/logger"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+// RequestId reuses request id sent by caller or generates new one, it is added to request
+// context for logging and returned in response header
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(requestIdHeader)
+		if requestId == "" || len(requestId) > 64 {
+			requestId = uuid.NewV4().String()
+		}
+
+		c.Request = c.Request.WithContext(logger.WithRequestId(c.Request.Context(), requestId))
+		c.Header(requestIdHeader, requestId)
+		c.Next()
+	}
+}
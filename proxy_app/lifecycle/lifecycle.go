@@ -0,0 +1,133 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/unibrightio/proxy-api/logger"
+)
+
+// Manager owns root context of the proxy and stops registered components on shutdown.
+// Components are stopped in reverse order of registration, so component registered
+// first (i.e. db) is stopped last, after everything that depends on it
+type Manager struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	timeout    time.Duration
+	mutex      sync.Mutex
+	components []component
+	once       sync.Once
+	shutdown   chan struct{}
+	err        error
+}
+
+type component struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+func NewManager(timeout time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		ctx:      ctx,
+		cancel:   cancel,
+		timeout:  timeout,
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Context is cancelled when shutdown starts, subsystems should stop taking new work when it is done
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Register adds component stop function, called with context that expires at shutdown deadline
+func (m *Manager) Register(name string, stop func(ctx context.Context) error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.components = append(m.components, component{name: name, stop: stop})
+}
+
+// Wait blocks until SIGINT or SIGTERM is received or Shutdown is called from somewhere else
+func (m *Manager) Wait() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		logger.Infof("received signal %v, shutting down", sig)
+	case <-m.shutdown:
+	}
+}
+
+// Shutdown cancels root context and stops components one by one. All components together
+// have to stop within configured timeout, components still running after it are abandoned.
+// Concurrent and repeated calls wait for the first one and return its result
+func (m *Manager) Shutdown() error {
+	m.once.Do(func() {
+		close(m.shutdown)
+		m.err = m.stopComponents()
+	})
+
+	return m.err
+}
+
+func (m *Manager) stopComponents() error {
+	m.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	m.mutex.Lock()
+	components := append([]component{}, m.components...)
+	m.mutex.Unlock()
+
+	var problems []string
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		logger.Infof("stopping %v", c.name)
+
+		err := stopWithDeadline(ctx, c)
+		if err != nil {
+			logger.Errorf("error stopping %v %v", c.name, err.Error())
+			problems = append(problems, fmt.Sprintf("%v: %v", c.name, err.Error()))
+			continue
+		}
+
+		logger.Infof("%v stopped", c.name)
+	}
+
+	if len(problems) > 0 {
+		return errors.New("shutdown incomplete, " + strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+func stopWithDeadline(ctx context.Context, c component) error {
+	// deadline is checked before stop, so that remaining components are not even started
+	// to stop when time is up, they are going to be killed with the process anyway
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.stop(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
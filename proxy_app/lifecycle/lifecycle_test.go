@@ -0,0 +1,57 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShutdownStopsComponentsInReverseOrder(t *testing.T) {
+	manager := NewManager(time.Second)
+	var stopped []string
+	for _, name := range []string{"db", "nats", "http"} {
+		name := name
+		manager.Register(name, func(ctx context.Context) error {
+			stopped = append(stopped, name)
+			return nil
+		})
+	}
+
+	err := manager.Shutdown()
+
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if manager.Context().Err() == nil {
+		t.Errorf("expected context to be cancelled")
+	}
+	if len(stopped) != 3 || stopped[0] != "http" || stopped[1] != "nats" || stopped[2] != "db" {
+		t.Errorf("unexpected stop order %v", stopped)
+	}
+}
+
+func TestShutdownRespectsDeadline(t *testing.T) {
+	manager := NewManager(50 * time.Millisecond)
+	dbStopped := false
+	manager.Register("db", func(ctx context.Context) error {
+		dbStopped = true
+		return nil
+	})
+	manager.Register("cron", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	err := manager.Shutdown()
+
+	if err == nil {
+		t.Errorf("expected deadline error")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("shutdown did not respect deadline")
+	}
+	if dbStopped {
+		t.Errorf("expected db not to be stopped after deadline")
+	}
+}
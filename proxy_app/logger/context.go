@@ -0,0 +1,30 @@
+package logger
+
+import "context"
+
+type contextKey int
+
+const (
+	requestIdKey contextKey = iota
+	trustmeshIdKey
+)
+
+// WithRequestId returns context with id of incoming http request, logged as request_id
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+// WithTrustmeshId returns context with id of processed trustmesh, logged as trustmesh_id
+func WithTrustmeshId(ctx context.Context, trustmeshId string) context.Context {
+	return context.WithValue(ctx, trustmeshIdKey, trustmeshId)
+}
+
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
+
+func TrustmeshId(ctx context.Context) string {
+	trustmeshId, _ := ctx.Value(trustmeshIdKey).(string)
+	return trustmeshId
+}
@@ -1,50 +1,163 @@
 package logger
 
 import (
+	"fmt"
 	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"github.com/spf13/viper"
+	"github.com/unibrightio/proxy-api/config"
 )
 
-// ideally this should be in init of this package, but viper is not available yet
-// JSON_LOGS should be part of docker compose and we can move this to init and use os.GetEnv()
+const project = "PROXY-API"
+const modulePath = "github.com/unibrightio/proxy-api/"
+
+type levels struct {
+	defaultLevel  zerolog.Level
+	packageLevels map[string]zerolog.Level
+	payloads      bool
+}
+
+var activeLevels atomic.Value
+
+func init() {
+	activeLevels.Store(&levels{defaultLevel: zerolog.InfoLevel, packageLevels: map[string]zerolog.Level{}})
+}
+
+// ideally this should be in init of this package, but config is not loaded yet
 func SetupLogger() {
-	jsonLogs := viper.GetBool("JSON_LOGS")
-	if !jsonLogs {
+	logConfig := config.Get().Log
+	if !logConfig.JsonLogs {
 		log.Logger = log.Logger.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	}
+
+	setLevels(logConfig)
+	config.OnReload(func(c *config.Config) {
+		setLevels(c.Log)
+	})
+}
+
+func setLevels(logConfig config.LogConfig) {
+	defaultLevel, err := zerolog.ParseLevel(logConfig.Level)
+	if err != nil {
+		Errorf("invalid log level %v", logConfig.Level)
+		return
+	}
+
+	packageLevels, err := config.ParsePackageLevels(logConfig.PackageLevels)
+	if err != nil {
+		Errorf("invalid package log levels %v", err.Error())
+		return
+	}
+
+	// filtering is done here per package, zerolog only filters below the lowest configured level
+	lowest := defaultLevel
+	for _, level := range packageLevels {
+		if level < lowest {
+			lowest = level
+		}
+	}
+	zerolog.SetGlobalLevel(lowest)
+
+	activeLevels.Store(&levels{defaultLevel: defaultLevel, packageLevels: packageLevels, payloads: logConfig.Payloads})
+	Infof("log level set to %v, package levels %v", defaultLevel, packageLevels)
+}
+
+func enabled(pkg string, level zerolog.Level) bool {
+	active := activeLevels.Load().(*levels)
+	if packageLevel, ok := active.packageLevels[pkg]; ok {
+		return level >= packageLevel
+	}
+
+	return level >= active.defaultLevel
+}
+
+func payloadsEnabled() bool {
+	return activeLevels.Load().(*levels).payloads
+}
+
+// callerPackage returns package of the function that called logger, used for package levels
+// of calls through package level functions below
+func callerPackage(skip int) string {
+	if len(activeLevels.Load().(*levels).packageLevels) == 0 {
+		return ""
+	}
+
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+
+	return packageOfFunction(runtime.FuncForPC(pc).Name())
+}
+
+// packageOfFunction returns last package path element of fully qualified function name,
+// i.e. github.com/unibrightio/proxy-api/cron.queryTrustmeshes -> cron
+func packageOfFunction(function string) string {
+	function = strings.TrimPrefix(function, modulePath)
+	if slash := strings.LastIndex(function, "/"); slash >= 0 {
+		function = function[slash+1:]
+	}
+	if dot := strings.Index(function, "."); dot >= 0 {
+		function = function[:dot]
+	}
+
+	return function
 }
 
+func writef(pkg string, level zerolog.Level, format string, v ...interface{}) {
+	if !enabled(pkg, level) {
+		return
+	}
+
+	write(pkg, level, fmt.Sprintf(format, v...))
+}
+
+func write(pkg string, level zerolog.Level, msg string) {
+	if !enabled(pkg, level) {
+		return
+	}
+
+	event := log.Logger.WithLevel(level).Str("project", project)
+	if pkg != "" {
+		event = event.Str("package", pkg)
+	}
+	event.Msg(Redact(msg))
+}
+
+// package level functions are kept for unstructured logging, prefer For(package).Ctx(ctx) in new code
+
 func Info(msg string) {
-	log.Logger.Info().Str("project", "PROXY-API").Msg(msg)
+	write(callerPackage(1), zerolog.InfoLevel, msg)
 }
 
 func Infof(msg string, v ...interface{}) {
-	log.Logger.Info().Str("project", "PROXY-API").Msgf(msg, v...)
+	writef(callerPackage(1), zerolog.InfoLevel, msg, v...)
 }
 
 func Warn(msg string) {
-	log.Logger.Warn().Str("project", "PROXY-API").Msg(msg)
+	write(callerPackage(1), zerolog.WarnLevel, msg)
 }
 
 func Warnf(msg string, v ...interface{}) {
-	log.Logger.Warn().Str("project", "PROXY-API").Msgf(msg, v...)
+	writef(callerPackage(1), zerolog.WarnLevel, msg, v...)
 }
 
 func Error(msg string) {
-	log.Logger.Error().Str("project", "PROXY-API").Msg(msg)
+	write(callerPackage(1), zerolog.ErrorLevel, msg)
 }
 
 func Errorf(msg string, v ...interface{}) {
-	log.Logger.Error().Str("project", "PROXY-API").Msgf(msg, v...)
+	writef(callerPackage(1), zerolog.ErrorLevel, msg, v...)
 }
 
 func Debug(msg string) {
-	log.Logger.Debug().Str("project", "PROXY-API").Msg(msg)
+	write(callerPackage(1), zerolog.DebugLevel, msg)
 }
 
 func Debugf(msg string, v ...interface{}) {
-	log.Logger.Debug().Str("project", "PROXY-API").Msgf(msg, v...)
+	writef(callerPackage(1), zerolog.DebugLevel, msg, v...)
 }
@@ -0,0 +1,132 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const redactedValue = "******"
+
+type fieldKind int
+
+const (
+	plainField fieldKind = iota
+	secretField
+	payloadField
+)
+
+// Field is structured key value attached to log entry
+type Field struct {
+	Key   string
+	Value interface{}
+	kind  fieldKind
+}
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Secret is never logged, only whether it was set
+func Secret(key string, value interface{}) Field {
+	return Field{Key: key, Value: value, kind: secretField}
+}
+
+// Payload holds business object data (sync trees, decrypted payloads, webhook bodies),
+// logged only when LOG_PAYLOADS is enabled
+func Payload(key string, value interface{}) Field {
+	return Field{Key: key, Value: value, kind: payloadField}
+}
+
+// Logger writes structured entries for one package, with correlation ids taken from context
+type Logger struct {
+	pkg    string
+	ctx    context.Context
+	fields []Field
+}
+
+// For returns logger of package, package name is used for package log levels (LOG_PACKAGE_LEVELS)
+func For(pkg string) Logger {
+	return Logger{pkg: pkg}
+}
+
+// Ctx returns logger adding request id, trustmesh id and trace id from ctx to every entry
+func (l Logger) Ctx(ctx context.Context) Logger {
+	l.ctx = ctx
+	return l
+}
+
+// With returns logger adding fields to every entry
+func (l Logger) With(fields ...Field) Logger {
+	l.fields = append(append([]Field{}, l.fields...), fields...)
+	return l
+}
+
+func (l Logger) Debug(msg string, fields ...Field) {
+	l.write(zerolog.DebugLevel, msg, fields)
+}
+
+func (l Logger) Info(msg string, fields ...Field) {
+	l.write(zerolog.InfoLevel, msg, fields)
+}
+
+func (l Logger) Warn(msg string, fields ...Field) {
+	l.write(zerolog.WarnLevel, msg, fields)
+}
+
+func (l Logger) Error(msg string, fields ...Field) {
+	l.write(zerolog.ErrorLevel, msg, fields)
+}
+
+func (l Logger) write(level zerolog.Level, msg string, fields []Field) {
+	if !enabled(l.pkg, level) {
+		return
+	}
+
+	event := log.Logger.WithLevel(level).Str("project", project).Str("package", l.pkg)
+	if l.ctx != nil {
+		event = addCorrelation(event, l.ctx)
+	}
+
+	for _, field := range append(append([]Field{}, l.fields...), fields...) {
+		event = addField(event, field)
+	}
+
+	event.Msg(Redact(msg))
+}
+
+func addCorrelation(event *zerolog.Event, ctx context.Context) *zerolog.Event {
+	if requestId := RequestId(ctx); requestId != "" {
+		event = event.Str("request_id", requestId)
+	}
+	if trustmeshId := TrustmeshId(ctx); trustmeshId != "" {
+		event = event.Str("trustmesh_id", trustmeshId)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		event = event.Str("trace_id", spanContext.TraceID().String()).Str("span_id", spanContext.SpanID().String())
+	}
+
+	return event
+}
+
+func addField(event *zerolog.Event, field Field) *zerolog.Event {
+	switch {
+	case field.kind == secretField:
+		return event.Str(field.Key, redactedValue)
+	case field.kind == payloadField && !payloadsEnabled():
+		return event.Str(field.Key, redactedValue)
+	case isSecretKey(field.Key):
+		return event.Str(field.Key, redactedValue)
+	}
+
+	switch value := field.Value.(type) {
+	case string:
+		return event.Str(field.Key, Redact(value))
+	case error:
+		return event.Str(field.Key, Redact(value.Error()))
+	default:
+		return event.Interface(field.Key, value)
+	}
+}
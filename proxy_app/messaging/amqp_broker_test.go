@@ -0,0 +1,542 @@
+package messaging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// fakeBroker is AMQP 0-9-1 broker stand-in, it keeps messages of queues in memory and delivers
+// them to one consumer per queue up to its prefetch, unacknowledged messages are delivered again
+// to next consumer. Publishes on channels in confirm mode are confirmed with ack, or nack if rejected
+type fakeBroker struct {
+	listener net.Listener
+	password string
+
+	mutex     sync.Mutex
+	nack      bool
+	queues    map[string][][]byte
+	consumers map[string]*amqpConn
+	prefetch  map[*amqpConn]int
+	unacked   map[*amqpConn][]fakeDelivery
+	tags      map[*amqpConn]uint64
+	acked     int
+}
+
+type fakeDelivery struct {
+	queue string
+	body  []byte
+}
+
+func newFakeBroker(t *testing.T, password string) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("broker can not listen %v", err)
+	}
+	broker := &fakeBroker{
+		listener:  listener,
+		password:  password,
+		queues:    map[string][][]byte{},
+		consumers: map[string]*amqpConn{},
+		prefetch:  map[*amqpConn]int{},
+		unacked:   map[*amqpConn][]fakeDelivery{},
+		tags:      map[*amqpConn]uint64{},
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(newAmqpConn(conn))
+		}
+	}()
+	return broker
+}
+
+func (b *fakeBroker) serve(conn *amqpConn) {
+	defer conn.conn.Close()
+	defer b.disconnect(conn)
+
+	header := make([]byte, len(amqpProtocolHeader))
+	if _, err := io.ReadFull(conn.reader, header); err != nil || !bytes.Equal(header, amqpProtocolHeader) {
+		return
+	}
+	conn.writeMethod(0, amqpConnectionStart, (&amqpWriter{}).octet(0).octet(9).emptyTable().longstr([]byte("PLAIN")).longstr([]byte("en_US")))
+	startOk, err := conn.readMethod(amqpConnectionStartOk)
+	if err != nil {
+		return
+	}
+	startOk.next(int(startOk.long()))
+	startOk.shortstr()
+	if response := startOk.longstr(); !bytes.HasSuffix(response, []byte("\x00"+b.password)) {
+		conn.writeMethod(0, amqpConnectionClose, (&amqpWriter{}).short(403).shortstr("ACCESS_REFUSED").short(0).short(0))
+		return
+	}
+	conn.writeMethod(0, amqpConnectionTune, (&amqpWriter{}).short(0).long(amqpFrameMax).short(0))
+	if _, err := conn.readMethod(amqpConnectionTuneOk); err != nil {
+		return
+	}
+	if _, err := conn.readMethod(amqpConnectionOpen); err != nil {
+		return
+	}
+	conn.writeMethod(0, amqpConnectionOpenOk, (&amqpWriter{}).shortstr(""))
+
+	confirming := false
+	var published uint64
+	for {
+		method, args, err := conn.readMethodFrame()
+		if err != nil {
+			return
+		}
+
+		switch method {
+		case amqpChannelOpen:
+			conn.writeMethod(amqpChannel, amqpChannelOpenOk, (&amqpWriter{}).longstr(nil))
+		case amqpConfirmSelect:
+			confirming = true
+			conn.writeMethod(amqpChannel, amqpConfirmSelectOk, nil)
+		case amqpBasicQos:
+			args.long()
+			b.setPrefetch(conn, int(args.short()))
+			conn.writeMethod(amqpChannel, amqpBasicQosOk, nil)
+		case amqpQueueDeclare:
+			args.short()
+			queue := args.shortstr()
+			conn.writeMethod(amqpChannel, amqpQueueDeclareOk, (&amqpWriter{}).shortstr(queue).long(0).long(0))
+		case amqpBasicPublish:
+			args.short()
+			args.shortstr()
+			queue := args.shortstr()
+			body, err := conn.readContent()
+			if err != nil {
+				return
+			}
+			accepted := b.publish(queue, body)
+			if confirming {
+				published++
+				var confirm uint32 = amqpBasicAck
+				if !accepted {
+					confirm = amqpBasicNack
+				}
+				conn.writeMethod(amqpChannel, confirm, (&amqpWriter{}).longlong(published).octet(0))
+			}
+		case amqpBasicConsume:
+			args.short()
+			queue, tag := args.shortstr(), args.shortstr()
+			conn.writeMethod(amqpChannel, amqpBasicConsumeOk, (&amqpWriter{}).shortstr(tag))
+			b.consume(queue, conn)
+		case amqpBasicAck:
+			b.ack(conn)
+		case amqpChannelClose:
+			conn.writeMethod(amqpChannel, amqpChannelCloseOk, nil)
+		case amqpConnectionClose:
+			conn.writeMethod(0, amqpConnectionCloseOk, nil)
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) setPrefetch(conn *amqpConn, prefetch int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.prefetch[conn] = prefetch
+}
+
+// rejectPublishes makes broker drop published messages
+func (b *fakeBroker) rejectPublishes() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.nack = true
+}
+
+// publish queues message unless publishes are rejected
+func (b *fakeBroker) publish(queue string, body []byte) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.nack {
+		return false
+	}
+	b.queues[queue] = append(b.queues[queue], body)
+	b.deliver(queue)
+	return true
+}
+
+func (b *fakeBroker) consume(queue string, conn *amqpConn) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.consumers[queue] = conn
+	b.deliver(queue)
+}
+
+// deliver sends queued messages to consumer until its prefetch is reached, called with mutex held
+func (b *fakeBroker) deliver(queue string) {
+	conn, ok := b.consumers[queue]
+	if !ok {
+		return
+	}
+
+	for len(b.queues[queue]) > 0 && (b.prefetch[conn] == 0 || len(b.unacked[conn]) < b.prefetch[conn]) {
+		body := b.queues[queue][0]
+		b.queues[queue] = b.queues[queue][1:]
+		b.unacked[conn] = append(b.unacked[conn], fakeDelivery{queue: queue, body: body})
+		b.tags[conn]++
+
+		deliver := (&amqpWriter{}).shortstr("proxy").longlong(b.tags[conn]).octet(0).shortstr("").shortstr(queue)
+		conn.writeMutex.Lock()
+		conn.writeFrame(amqpFrameMethod, amqpChannel, append((&amqpWriter{}).long(amqpBasicDeliver).Bytes(), deliver.Bytes()...))
+		conn.writeContent(amqpChannel, body)
+		conn.writeMutex.Unlock()
+	}
+}
+
+// ack acknowledges oldest delivery, consumer handles deliveries in order
+func (b *fakeBroker) ack(conn *amqpConn) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.unacked[conn]) == 0 {
+		return
+	}
+	queue := b.unacked[conn][0].queue
+	b.unacked[conn] = b.unacked[conn][1:]
+	b.acked++
+	b.deliver(queue)
+}
+
+// disconnect requeues unacknowledged deliveries of closed connection
+func (b *fakeBroker) disconnect(conn *amqpConn) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for queue, consumer := range b.consumers {
+		if consumer == conn {
+			delete(b.consumers, queue)
+		}
+	}
+	for _, delivery := range b.unacked[conn] {
+		b.queues[delivery.queue] = append(b.queues[delivery.queue], delivery.body)
+	}
+	delete(b.unacked, conn)
+	delete(b.prefetch, conn)
+	delete(b.tags, conn)
+}
+
+func (b *fakeBroker) ackedCount() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.acked
+}
+
+func (b *fakeBroker) unackedCount() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	unacked := 0
+	for _, deliveries := range b.unacked {
+		unacked += len(deliveries)
+	}
+	return unacked
+}
+
+func (b *fakeBroker) endpoint(queue string) *url.URL {
+	endpoint, _ := url.Parse("amqp://proxy@" + b.listener.Addr().String() + "/?queue=" + queue)
+	return endpoint
+}
+
+const (
+	amqpFrameMethod    = 1
+	amqpFrameHeader    = 2
+	amqpFrameBody      = 3
+	amqpFrameHeartbeat = 8
+	amqpFrameEnd       = 0xCE
+
+	amqpFrameMax        = 4096
+	amqpChannel         = 1
+	amqpClassBasic      = 60
+	amqpDeliveryDurable = 2
+)
+
+var amqpProtocolHeader = []byte{'A', 'M', 'Q', 'P', 0, 0, 9, 1}
+
+// methods are class id << 16 | method id
+const (
+	amqpConnectionStart   = 10<<16 | 10
+	amqpConnectionStartOk = 10<<16 | 11
+	amqpConnectionTune    = 10<<16 | 30
+	amqpConnectionTuneOk  = 10<<16 | 31
+	amqpConnectionOpen    = 10<<16 | 40
+	amqpConnectionOpenOk  = 10<<16 | 41
+	amqpConnectionClose   = 10<<16 | 50
+	amqpConnectionCloseOk = 10<<16 | 51
+	amqpChannelOpen       = 20<<16 | 10
+	amqpChannelOpenOk     = 20<<16 | 11
+	amqpChannelClose      = 20<<16 | 40
+	amqpChannelCloseOk    = 20<<16 | 41
+	amqpQueueDeclare      = 50<<16 | 10
+	amqpQueueDeclareOk    = 50<<16 | 11
+	amqpBasicQos          = 60<<16 | 10
+	amqpBasicQosOk        = 60<<16 | 11
+	amqpBasicConsume      = 60<<16 | 20
+	amqpBasicConsumeOk    = 60<<16 | 21
+	amqpBasicPublish      = 60<<16 | 40
+	amqpBasicDeliver      = 60<<16 | 60
+	amqpBasicAck          = 60<<16 | 80
+	amqpBasicNack         = 60<<16 | 120
+	amqpConfirmSelect     = 85<<16 | 10
+	amqpConfirmSelectOk   = 85<<16 | 11
+)
+
+// amqpWriter writes method arguments and content headers
+type amqpWriter struct {
+	bytes.Buffer
+}
+
+func (w *amqpWriter) octet(v byte) *amqpWriter {
+	w.WriteByte(v)
+	return w
+}
+
+func (w *amqpWriter) short(v uint16) *amqpWriter {
+	binary.Write(w, binary.BigEndian, v)
+	return w
+}
+
+func (w *amqpWriter) long(v uint32) *amqpWriter {
+	binary.Write(w, binary.BigEndian, v)
+	return w
+}
+
+func (w *amqpWriter) longlong(v uint64) *amqpWriter {
+	binary.Write(w, binary.BigEndian, v)
+	return w
+}
+
+func (w *amqpWriter) shortstr(v string) *amqpWriter {
+	w.WriteByte(byte(len(v)))
+	w.WriteString(v)
+	return w
+}
+
+func (w *amqpWriter) longstr(v []byte) *amqpWriter {
+	w.long(uint32(len(v)))
+	w.Write(v)
+	return w
+}
+
+// emptyTable is field table without fields
+func (w *amqpWriter) emptyTable() *amqpWriter {
+	return w.long(0)
+}
+
+// amqpReader reads method arguments, first error sticks
+type amqpReader struct {
+	data []byte
+	err  error
+}
+
+func (r *amqpReader) next(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	if len(r.data) < n {
+		r.err = errors.New("amqp frame is too short")
+		return make([]byte, n)
+	}
+	next := r.data[:n]
+	r.data = r.data[n:]
+	return next
+}
+
+func (r *amqpReader) octet() byte {
+	return r.next(1)[0]
+}
+
+func (r *amqpReader) short() uint16 {
+	return binary.BigEndian.Uint16(r.next(2))
+}
+
+func (r *amqpReader) long() uint32 {
+	return binary.BigEndian.Uint32(r.next(4))
+}
+
+func (r *amqpReader) longlong() uint64 {
+	return binary.BigEndian.Uint64(r.next(8))
+}
+
+func (r *amqpReader) shortstr() string {
+	return string(r.next(int(r.octet())))
+}
+
+func (r *amqpReader) longstr() []byte {
+	return r.next(int(r.long()))
+}
+
+// amqpConn is broker side of client connection with one open channel
+type amqpConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+	frameMax   uint32
+}
+
+func newAmqpConn(conn net.Conn) *amqpConn {
+	return &amqpConn{conn: conn, reader: bufio.NewReader(conn), frameMax: amqpFrameMax}
+}
+
+func (c *amqpConn) writeFrame(kind byte, channel uint16, payload []byte) error {
+	frame := &amqpWriter{}
+	frame.octet(kind).short(channel).long(uint32(len(payload)))
+	frame.Write(payload)
+	frame.octet(amqpFrameEnd)
+
+	_, err := c.conn.Write(frame.Bytes())
+	return err
+}
+
+func (c *amqpConn) readFrame() (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[3:])
+	if size > c.frameMax {
+		return 0, 0, nil, fmt.Errorf("amqp frame of %v bytes exceeds frame max", size)
+	}
+
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	if payload[size] != amqpFrameEnd {
+		return 0, 0, nil, errors.New("amqp frame has no frame end")
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload[:size], nil
+}
+
+func (c *amqpConn) writeMethod(channel uint16, method uint32, args *amqpWriter) error {
+	payload := &amqpWriter{}
+	payload.long(method)
+	if args != nil {
+		payload.Write(args.Bytes())
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.writeFrame(amqpFrameMethod, channel, payload.Bytes())
+}
+
+// readMethodFrame reads next method, heartbeats are skipped
+func (c *amqpConn) readMethodFrame() (uint32, *amqpReader, error) {
+	for {
+		kind, _, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		if kind == amqpFrameHeartbeat {
+			continue
+		}
+		if kind != amqpFrameMethod {
+			return 0, nil, fmt.Errorf("unexpected amqp frame type %v", kind)
+		}
+
+		args := &amqpReader{data: payload}
+		method := args.long()
+		return method, args, args.err
+	}
+}
+
+// readMethod reads next method and fails unless it is the expected one
+func (c *amqpConn) readMethod(expected uint32) (*amqpReader, error) {
+	method, args, err := c.readMethodFrame()
+	if err != nil {
+		return nil, err
+	}
+	if method == amqpConnectionClose || method == amqpChannelClose {
+		code, text := args.short(), args.shortstr()
+		return nil, fmt.Errorf("amqp broker closed %v %v", code, text)
+	}
+	if method != expected {
+		return nil, fmt.Errorf("unexpected amqp method %x, expected %x", method, expected)
+	}
+	return args, nil
+}
+
+// writeContent writes content header and body frames of basic deliver
+func (c *amqpConn) writeContent(channel uint16, body []byte) error {
+	header := &amqpWriter{}
+	// content type and delivery mode properties
+	header.short(amqpClassBasic).short(0).longlong(uint64(len(body))).short(0x9000)
+	header.shortstr("application/json").octet(amqpDeliveryDurable)
+	if err := c.writeFrame(amqpFrameHeader, channel, header.Bytes()); err != nil {
+		return err
+	}
+
+	// frame max includes 8 bytes of frame header and end
+	chunkSize := int(c.frameMax) - 8
+	for start := 0; start < len(body); start += chunkSize {
+		end := start + chunkSize
+		if end > len(body) {
+			end = len(body)
+		}
+		if err := c.writeFrame(amqpFrameBody, channel, body[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readContentFrame reads next content frame, heartbeats are skipped
+func (c *amqpConn) readContentFrame() (byte, []byte, error) {
+	for {
+		kind, _, payload, err := c.readFrame()
+		if err != nil || kind != amqpFrameHeartbeat {
+			return kind, payload, err
+		}
+	}
+}
+
+// readContent reads content header and body frames following basic publish
+func (c *amqpConn) readContent() ([]byte, error) {
+	kind, payload, err := c.readContentFrame()
+	if err != nil {
+		return nil, err
+	}
+	if kind != amqpFrameHeader {
+		return nil, fmt.Errorf("unexpected amqp frame type %v, expected content header", kind)
+	}
+	header := &amqpReader{data: payload}
+	header.short()
+	header.short()
+	size := header.longlong()
+	if header.err != nil {
+		return nil, header.err
+	}
+
+	body := make([]byte, 0, size)
+	for uint64(len(body)) < size {
+		kind, payload, err := c.readContentFrame()
+		if err != nil {
+			return nil, err
+		}
+		if kind != amqpFrameBody {
+			return nil, fmt.Errorf("unexpected amqp frame type %v, expected content body", kind)
+		}
+		body = append(body, payload...)
+	}
+	return body, nil
+}
@@ -0,0 +1,161 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestGivenSignedEnvelopeWhenPublishedOverAmqpThenSubscriberReceivesItAndAcknowledgesIt(t *testing.T) {
+	broker := newFakeBroker(t, "secret")
+	signingKey, publicKeys := testKeys(t, "workgroup", "alice")
+
+	// larger than frame max of broker, so body is split into several frames
+	envelope := Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject", Payload: randomMessage(20000)}
+	sender := &AmqpTransport{SigningKey: signingKey}
+	if err := sender.Send(broker.endpoint("bob"), "secret", envelope); err != nil {
+		t.Fatalf("sending failed %v", err)
+	}
+
+	received := make(chan Envelope, 1)
+	receiver := &AmqpTransport{PublicKeys: publicKeys, OrganizationId: "bob", RetryInterval: 10 * time.Millisecond}
+	if err := receiver.Subscribe(broker.endpoint("bob"), "secret", "subject", func(envelope Envelope) { received <- envelope }); err != nil {
+		t.Fatalf("subscribing failed %v", err)
+	}
+	defer receiver.Drain(context.Background())
+
+	select {
+	case envelope := <-received:
+		if !bytes.Equal(envelope.Payload, randomMessage(20000)) || envelope.SenderId != "alice" {
+			t.Fatalf("expected envelope of alice, got %v", envelope.SenderId)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("envelope was not received")
+	}
+	waitFor(t, func() bool { return broker.ackedCount() == 1 && receiver.Connected() })
+}
+
+func TestGivenForgedEnvelopeWhenConsumedOverAmqpThenItIsDroppedAndNextOneIsReceived(t *testing.T) {
+	broker := newFakeBroker(t, "secret")
+	signingKey, publicKeys := testKeys(t, "workgroup", "alice")
+	otherKey, _ := testKeys(t, "workgroup", "alice")
+
+	envelope := Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject", Payload: []byte(`{"TxHash":"abc"}`)}
+	(&AmqpTransport{SigningKey: otherKey}).Send(broker.endpoint("bob"), "secret", envelope)
+	if err := (&AmqpTransport{SigningKey: signingKey}).Send(broker.endpoint("bob"), "secret", envelope); err != nil {
+		t.Fatalf("sending failed %v", err)
+	}
+
+	var mutex sync.Mutex
+	var received []Envelope
+	receiver := &AmqpTransport{PublicKeys: publicKeys, OrganizationId: "bob"}
+	receiver.Subscribe(broker.endpoint("bob"), "secret", "subject", func(envelope Envelope) {
+		mutex.Lock()
+		received = append(received, envelope)
+		mutex.Unlock()
+	})
+	defer receiver.Drain(context.Background())
+
+	// forged envelope is acknowledged too, redelivery would not make it valid
+	waitFor(t, func() bool { return broker.ackedCount() == 2 })
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("expected only signed envelope, got %v envelopes", len(received))
+	}
+}
+
+func TestGivenWrongPasswordWhenSendingOverAmqpThenItFails(t *testing.T) {
+	broker := newFakeBroker(t, "secret")
+	signingKey, _ := testKeys(t, "workgroup", "alice")
+
+	err := (&AmqpTransport{SigningKey: signingKey}).Send(broker.endpoint("bob"), "wrong", Envelope{SenderId: "alice", RecipientId: "bob", Subject: "subject"})
+	if err == nil {
+		t.Fatalf("expected wrong password to fail")
+	}
+}
+
+func TestGivenBrokerRejectingPublishWhenSendingOverAmqpThenItFails(t *testing.T) {
+	broker := newFakeBroker(t, "secret")
+	broker.rejectPublishes()
+	signingKey, _ := testKeys(t, "workgroup", "alice")
+
+	err := (&AmqpTransport{SigningKey: signingKey}).Send(broker.endpoint("bob"), "secret", Envelope{SenderId: "alice", RecipientId: "bob", Subject: "subject"})
+	if err == nil {
+		t.Fatalf("expected publish not confirmed by broker to fail")
+	}
+}
+
+func TestGivenPrefetchWhenConsumingOverAmqpThenNoMoreEnvelopesAreDeliveredUntilAcknowledged(t *testing.T) {
+	broker := newFakeBroker(t, "secret")
+	signingKey, publicKeys := testKeys(t, "workgroup", "alice")
+
+	sender := &AmqpTransport{SigningKey: signingKey}
+	for i := 0; i < 3; i++ {
+		if err := sender.Send(broker.endpoint("bob"), "secret", Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject"}); err != nil {
+			t.Fatalf("sending failed %v", err)
+		}
+	}
+
+	received := make(chan Envelope, 3)
+	release := make(chan struct{})
+	receiver := &AmqpTransport{PublicKeys: publicKeys, OrganizationId: "bob", Prefetch: 1}
+	receiver.Subscribe(broker.endpoint("bob"), "secret", "subject", func(envelope Envelope) {
+		received <- envelope
+		<-release
+	})
+	defer receiver.Drain(context.Background())
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("envelope was not received")
+	}
+	time.Sleep(50 * time.Millisecond)
+	unacked := broker.unackedCount()
+	close(release)
+	if unacked != 1 {
+		t.Fatalf("expected one envelope delivered with prefetch 1, got %v", unacked)
+	}
+	waitFor(t, func() bool { return broker.ackedCount() == 3 })
+}
+
+func TestGivenEndpointWithoutQueueWhenSendingOverAmqpThenItFails(t *testing.T) {
+	endpoint, _ := url.Parse("amqp://127.0.0.1:5672/")
+	if err := (&AmqpTransport{}).Send(endpoint, "token", Envelope{}); err == nil {
+		t.Fatalf("expected endpoint without queue to fail")
+	}
+}
+
+func TestGivenSubscribedAmqpConsumerWhenDrainedThenItStopsConsuming(t *testing.T) {
+	broker := newFakeBroker(t, "secret")
+	signingKey, publicKeys := testKeys(t, "workgroup", "alice")
+
+	receiver := &AmqpTransport{PublicKeys: publicKeys, OrganizationId: "bob"}
+	receiver.Subscribe(broker.endpoint("bob"), "secret", "subject", func(envelope Envelope) {
+		t.Errorf("envelope received after drain")
+	})
+	waitFor(t, receiver.Connected)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := receiver.Drain(ctx); err != nil {
+		t.Fatalf("drain failed %v", err)
+	}
+
+	(&AmqpTransport{SigningKey: signingKey}).Send(broker.endpoint("bob"), "secret", Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject"})
+	time.Sleep(50 * time.Millisecond)
+}
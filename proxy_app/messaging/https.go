@@ -0,0 +1,275 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/unibrightio/proxy-api/logger"
+)
+
+const SchemeHttps = "https"
+
+const defaultHttpsTimeout = 30 * time.Second
+
+// HttpsTransport pushes signed envelopes to https endpoints of workgroup members (i.e.
+// https://proxy.partner.example:8443/offchain). Both sides present certificates issued by
+// CertificateAuthorities and envelopes are verified with public key of sender registered in workgroup
+type HttpsTransport struct {
+	Certificate            *tls.Certificate
+	CertificateAuthorities *x509.CertPool
+	SigningKey             ed25519.PrivateKey
+	PublicKeys             PublicKeyLookup
+	// OrganizationId received envelopes have to be addressed to
+	OrganizationId string
+	// MaxEnvelopeAge after which received envelopes are rejected, 0 means 1 hour
+	MaxEnvelopeAge time.Duration
+	// MaxMessageSize is the largest payload accepted, 0 means 64 MB
+	MaxMessageSize int
+	// Timeout of sending one envelope, 0 means 30 seconds
+	Timeout time.Duration
+
+	mutex   sync.Mutex
+	servers map[string]*httpsServer
+	replays *replayGuard
+}
+
+// LoadTlsFiles reads pem files of certificate and key https transport presents and of CAs it trusts
+func LoadTlsFiles(certFile string, keyFile string, caFile string) (*tls.Certificate, *x509.CertPool, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("https certificate can not be loaded %w", err)
+	}
+
+	caPem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("https ca can not be loaded %w", err)
+	}
+	certificateAuthorities := x509.NewCertPool()
+	if !certificateAuthorities.AppendCertsFromPEM(caPem) {
+		return nil, nil, errors.New("https ca file has no certificates")
+	}
+
+	return &certificate, certificateAuthorities, nil
+}
+
+func (t *HttpsTransport) tlsConfig() (*tls.Config, error) {
+	if t.Certificate == nil || t.CertificateAuthorities == nil {
+		return nil, errors.New("https certificate and ca are not configured")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{*t.Certificate},
+		RootCAs:      t.CertificateAuthorities,
+		ClientCAs:    t.CertificateAuthorities,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func (t *HttpsTransport) replayGuard() *replayGuard {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.replays == nil {
+		t.replays = newReplayGuard(t.OrganizationId, t.MaxEnvelopeAge)
+	}
+	return t.replays
+}
+
+func (t *HttpsTransport) maxMessageSize() int64 {
+	if t.MaxMessageSize > 0 {
+		return int64(t.MaxMessageSize)
+	}
+	return defaultMaxMessageSize
+}
+
+func (t *HttpsTransport) Send(endpoint *url.URL, token string, envelope Envelope) error {
+	tlsConfig, err := t.tlsConfig()
+	if err != nil {
+		return err
+	}
+	body, err := signEnvelope(envelope, t.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = defaultHttpsTimeout
+	}
+	client := &http.Client{Timeout: timeout, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	defer client.CloseIdleConnections()
+
+	request, err := http.NewRequest(http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		message, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("https endpoint answered %v %s", response.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// Subscribe listens on host of endpoint, envelopes of all subjects are posted to path of endpoint
+func (t *HttpsTransport) Subscribe(endpoint *url.URL, token string, subject string, onEnvelope func(Envelope)) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if server, ok := t.servers[endpoint.Host]; ok {
+		return server.add(endpoint.Path, token, subject, onEnvelope)
+	}
+
+	tlsConfig, err := t.tlsConfig()
+	if err != nil {
+		return err
+	}
+	listener, err := tls.Listen("tcp", endpoint.Host, tlsConfig)
+	if err != nil {
+		return fmt.Errorf("https endpoint can not listen %w", err)
+	}
+
+	server := &httpsServer{transport: t, token: token, paths: map[string]map[string]func(Envelope){}}
+	server.http = &http.Server{Handler: server}
+	if err := server.add(endpoint.Path, token, subject, onEnvelope); err != nil {
+		listener.Close()
+		return err
+	}
+
+	if t.servers == nil {
+		t.servers = map[string]*httpsServer{}
+	}
+	t.servers[endpoint.Host] = server
+	go server.serve(listener)
+	return nil
+}
+
+func (t *HttpsTransport) Connected() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.servers) == 0 {
+		return false
+	}
+	for _, server := range t.servers {
+		if !server.listening() {
+			return false
+		}
+	}
+	return true
+}
+
+// Drain stops listening, envelopes being processed are finished before it returns
+func (t *HttpsTransport) Drain(ctx context.Context) error {
+	t.mutex.Lock()
+	servers := t.servers
+	t.servers = nil
+	t.mutex.Unlock()
+
+	for _, server := range servers {
+		if err := server.http.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type httpsServer struct {
+	transport *HttpsTransport
+	http      *http.Server
+	token     string
+
+	mutex     sync.Mutex
+	paths     map[string]map[string]func(Envelope)
+	serveDone bool
+}
+
+func (s *httpsServer) add(path string, token string, subject string, onEnvelope func(Envelope)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if path == "" {
+		path = "/"
+	}
+	if token != s.token {
+		return errors.New("https endpoint is already used with another token")
+	}
+	if s.paths[path] == nil {
+		s.paths[path] = map[string]func(Envelope){}
+	}
+	s.paths[path][subject] = onEnvelope
+	return nil
+}
+
+func (s *httpsServer) serve(listener net.Listener) {
+	err := s.http.Serve(listener)
+	if err != nil && err != http.ErrServerClosed {
+		logger.Errorf("https endpoint stopped %v", err)
+	}
+
+	s.mutex.Lock()
+	s.serveDone = true
+	s.mutex.Unlock()
+}
+
+func (s *httpsServer) listening() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return !s.serveDone
+}
+
+func (s *httpsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// payload is base64 in json
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.transport.maxMessageSize()/3*4+4096))
+	if err != nil {
+		http.Error(w, "envelope too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	envelope, err := openEnvelope(body, s.transport.PublicKeys, s.transport.replayGuard())
+	if err != nil {
+		messagingLog.Warn("rejecting https envelope", logger.F("error", err), logger.F("remote", r.RemoteAddr))
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	s.mutex.Lock()
+	onEnvelope, ok := s.paths[r.URL.Path][envelope.Subject]
+	s.mutex.Unlock()
+	if !ok {
+		http.Error(w, "unknown subject", http.StatusNotFound)
+		return
+	}
+
+	onEnvelope(envelope)
+	w.WriteHeader(http.StatusAccepted)
+}
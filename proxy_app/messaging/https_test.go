@@ -0,0 +1,161 @@
+package messaging
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testCa issues certificates for 127.0.0.1 usable by both server and client
+type testCa struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pool        *x509.CertPool
+}
+
+func newTestCa(t *testing.T) *testCa {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating ca failed %v", err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+	return &testCa{certificate: certificate, key: key, pool: pool}
+}
+
+func (ca *testCa) issue(t *testing.T) *tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "proxy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("issuing certificate failed %v", err)
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("no free port %v", err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+type httpsFixture struct {
+	endpoint *url.URL
+	sender   *HttpsTransport
+	received chan Envelope
+}
+
+func newHttpsFixture(t *testing.T) *httpsFixture {
+	ca := newTestCa(t)
+	signingKey, publicKeys := testKeys(t, "workgroup", "alice")
+
+	receiver := &HttpsTransport{Certificate: ca.issue(t), CertificateAuthorities: ca.pool, PublicKeys: publicKeys, OrganizationId: "bob"}
+	endpoint, _ := url.Parse("https://" + freeAddress(t) + "/offchain")
+	received := make(chan Envelope, 1)
+	if err := receiver.Subscribe(endpoint, "token", "subject", func(envelope Envelope) { received <- envelope }); err != nil {
+		t.Fatalf("subscribing failed %v", err)
+	}
+	t.Cleanup(func() { receiver.Drain(context.Background()) })
+	if !receiver.Connected() {
+		t.Fatalf("expected receiver to listen")
+	}
+
+	sender := &HttpsTransport{Certificate: ca.issue(t), CertificateAuthorities: ca.pool, SigningKey: signingKey}
+	return &httpsFixture{endpoint: endpoint, sender: sender, received: received}
+}
+
+func TestGivenSignedEnvelopeWhenPushedOverHttpsThenSubscriberReceivesIt(t *testing.T) {
+	f := newHttpsFixture(t)
+
+	envelope := Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject", Payload: []byte(`{"TxHash":"abc"}`)}
+	if err := f.sender.Send(f.endpoint, "token", envelope); err != nil {
+		t.Fatalf("sending failed %v", err)
+	}
+
+	select {
+	case received := <-f.received:
+		if string(received.Payload) != string(envelope.Payload) || received.SenderId != "alice" {
+			t.Fatalf("expected envelope of alice, got %+v", received)
+		}
+	default:
+		// envelope is handed over before endpoint answers
+		t.Fatalf("envelope was not received")
+	}
+}
+
+func TestGivenWrongTokenOrUnknownSenderSubjectOrRecipientWhenPushedOverHttpsThenEnvelopeIsRejected(t *testing.T) {
+	f := newHttpsFixture(t)
+	envelope := Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject"}
+
+	if err := f.sender.Send(f.endpoint, "wrong", envelope); err == nil {
+		t.Fatalf("expected wrong token to be rejected")
+	}
+
+	unknownSender := envelope
+	unknownSender.SenderId = "bob"
+	if err := f.sender.Send(f.endpoint, "token", unknownSender); err == nil {
+		t.Fatalf("expected sender without public key to be rejected")
+	}
+
+	unknownSubject := envelope
+	unknownSubject.Subject = "other"
+	if err := f.sender.Send(f.endpoint, "token", unknownSubject); err == nil {
+		t.Fatalf("expected unknown subject to be rejected")
+	}
+
+	otherRecipient := envelope
+	otherRecipient.RecipientId = "carol"
+	if err := f.sender.Send(f.endpoint, "token", otherRecipient); err == nil {
+		t.Fatalf("expected envelope addressed to other organization to be rejected")
+	}
+
+	if len(f.received) != 0 {
+		t.Fatalf("rejected envelope was received")
+	}
+}
+
+func TestGivenCertificateOfOtherCaWhenPushedOverHttpsThenConnectionIsRefused(t *testing.T) {
+	f := newHttpsFixture(t)
+
+	f.sender.Certificate = newTestCa(t).issue(t)
+	if err := f.sender.Send(f.endpoint, "token", Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject"}); err == nil {
+		t.Fatalf("expected client certificate of other ca to be refused")
+	}
+	if len(f.received) != 0 {
+		t.Fatalf("envelope of untrusted client was received")
+	}
+}
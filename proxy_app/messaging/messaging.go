@@ -0,0 +1,408 @@
+package messaging
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unibrightio/proxy-api/config"
+	"github.com/unibrightio/proxy-api/logger"
+)
+
+// Envelope is message exchanged between proxies, the same for every transport
+type Envelope struct {
+	WorkgroupId string
+	// organization id of sender, empty in nats messages of proxies before envelopes
+	SenderId string
+	// organization id of recipient, signed with https and amqp envelopes so they can not be passed on
+	RecipientId string
+	Subject     string
+	Payload     []byte
+	// Legacy is set for nats messages without sender accepted with NATS_ACCEPT_LEGACY_MESSAGES, never sent
+	Legacy bool `json:"-"`
+}
+
+// ErrUnexpectedSender means message in envelope claims another sender or workgroup than the envelope
+var ErrUnexpectedSender = errors.New("unexpected sender")
+
+// CheckSender fails unless envelope was sent by senderId in workgroupId. Sender of https and amqp envelopes
+// is verified by its signature, so a member can not send messages in the name of another member.
+// Legacy envelopes have no sender to check and pass
+func (e Envelope) CheckSender(senderId string, workgroupId string) error {
+	if e.Legacy {
+		return nil
+	}
+	if e.SenderId == "" || !strings.EqualFold(e.SenderId, senderId) {
+		return fmt.Errorf("%w: message of %v sent by %v", ErrUnexpectedSender, senderId, orNone(e.SenderId))
+	}
+	if !strings.EqualFold(e.WorkgroupId, workgroupId) {
+		return fmt.Errorf("%w: message of workgroup %v sent in workgroup %v", ErrUnexpectedSender, workgroupId, orNone(e.WorkgroupId))
+	}
+	return nil
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+type IMessagingClient interface {
+	// used to send an envelope (i.e. OffchainProcessMessage) to workgroup member
+	// envelope - recipient, subject and payload, sender is set by the client
+	// endpoint - endpoint of the member, its scheme chooses the transport (nats://, https://, amqp://, amqps://),
+	// endpoints without scheme are nats
+	// token - token used to authenticate at the endpoint taken from workgroup member
+	SendMessage(envelope Envelope, endpoint string, token string) error
+
+	// used to receive envelopes sent by other participants to our endpoint
+	// endpoint - local endpoint, i.e. nats server url or https address to listen on
+	// token - token other participants authenticate with
+	// subject - listening subject
+	// onEnvelope - callback function
+	Subscribe(endpoint string, token string, subject string, onEnvelope func(Envelope)) error
+
+	// used to stop receiving messages, messages already received are processed before it returns
+	// ctx - deadline for processing of received messages
+	Drain(ctx context.Context) error
+}
+
+// ITransport moves envelopes over endpoints of one scheme
+type ITransport interface {
+	Send(endpoint *url.URL, token string, envelope Envelope) error
+	Subscribe(endpoint *url.URL, token string, subject string, onEnvelope func(Envelope)) error
+	Connected() bool
+	Drain(ctx context.Context) error
+}
+
+// PublicKeyLookup finds public key of workgroup member envelopes are verified with, nil if member has none
+type PublicKeyLookup func(workgroupId string, organizationId string) ed25519.PublicKey
+
+const SchemeNats = "nats"
+
+// ParseEndpoint reads endpoint of workgroup member, host:port without scheme is a nats server
+func ParseEndpoint(endpoint string) (*url.URL, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = SchemeNats + "://" + endpoint
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %w", err)
+	}
+	if parsed.Host == "" {
+		return nil, errors.New("endpoint has no host")
+	}
+	return parsed, nil
+}
+
+// ValidateMemberEndpoint fails unless envelopes can be sent to endpoint of workgroup member, members with
+// https and amqp endpoints need a hex encoded ed25519 public key their envelopes are verified with
+func ValidateMemberEndpoint(endpoint string, publicKey string) error {
+	parsed, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+
+	switch parsed.Scheme {
+	case SchemeNats:
+		if publicKey == "" {
+			return nil
+		}
+	case SchemeHttps, SchemeAmqp, SchemeAmqps:
+	default:
+		return fmt.Errorf("no transport for endpoint scheme %v", parsed.Scheme)
+	}
+	if _, err := ParsePublicKey(publicKey); err != nil {
+		return fmt.Errorf("member with %v endpoint %w", parsed.Scheme, err)
+	}
+	return nil
+}
+
+// ParsePublicKey reads hex encoded ed25519 public key of workgroup member
+func ParsePublicKey(publicKey string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("has no hex encoded %v byte ed25519 public key", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// ParseSigningKey reads hex encoded ed25519 seed envelopes are signed with, nil if seed is empty
+func ParseSigningKey(seed string) (ed25519.PrivateKey, error) {
+	if seed == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(seed)
+	if err != nil || len(key) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key is not a hex encoded %v byte ed25519 seed", ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(key), nil
+}
+
+// MessagingClient sends and receives envelopes with the transport registered for scheme of endpoint
+type MessagingClient struct {
+	OrganizationId string
+	Transports     map[string]ITransport
+
+	mutex      sync.Mutex
+	subscribed []ITransport
+}
+
+// NewClient returns client of configured organization with nats, https and amqp transports, envelopes
+// received over https and amqp are verified with publicKeys, nil is enough for clients that only send
+func NewClient(publicKeys PublicKeyLookup) *MessagingClient {
+	cfg := config.Get()
+
+	signingKey, err := ParseSigningKey(cfg.Messaging.SigningKey)
+	if err != nil {
+		// config validation refuses malformed seeds, envelopes can not be sent over https and amqp without one
+		messagingLog.Error("messaging signing key is not configured", logger.F("error", err))
+	}
+
+	httpsTransport := &HttpsTransport{
+		SigningKey:     signingKey,
+		PublicKeys:     publicKeys,
+		OrganizationId: cfg.OrganizationId,
+		MaxEnvelopeAge: cfg.Messaging.MaxEnvelopeAge,
+		MaxMessageSize: cfg.Nats.MaxMessageSize,
+	}
+	if cfg.Messaging.HttpsCertFile != "" {
+		certificate, certificateAuthorities, err := LoadTlsFiles(cfg.Messaging.HttpsCertFile, cfg.Messaging.HttpsKeyFile, cfg.Messaging.HttpsCaFile)
+		if err != nil {
+			// envelopes can not be sent or received over https until files are fixed
+			messagingLog.Error("https transport is not configured", logger.F("error", err))
+		}
+		httpsTransport.Certificate, httpsTransport.CertificateAuthorities = certificate, certificateAuthorities
+	}
+	amqpTransport := &AmqpTransport{
+		SigningKey:     signingKey,
+		PublicKeys:     publicKeys,
+		OrganizationId: cfg.OrganizationId,
+		MaxEnvelopeAge: cfg.Messaging.MaxEnvelopeAge,
+	}
+
+	return &MessagingClient{
+		OrganizationId: cfg.OrganizationId,
+		Transports: map[string]ITransport{
+			SchemeNats: &NatsTransport{
+				TransferTimeout:      cfg.Nats.TransferTimeout,
+				MaxMessageSize:       cfg.Nats.MaxMessageSize,
+				MaxPendingTransfers:  cfg.Nats.MaxPendingTransfers,
+				MaxBufferedBytes:     cfg.Nats.MaxBufferedBytes,
+				AcceptLegacyMessages: cfg.Nats.AcceptLegacyMessages,
+			},
+			SchemeHttps: httpsTransport,
+			SchemeAmqp:  amqpTransport,
+			SchemeAmqps: amqpTransport,
+		},
+	}
+}
+
+func (client *MessagingClient) transport(endpoint string) (*url.URL, ITransport, error) {
+	parsed, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transport, ok := client.Transports[parsed.Scheme]
+	if !ok {
+		return nil, nil, fmt.Errorf("no transport for endpoint scheme %v", parsed.Scheme)
+	}
+	return parsed, transport, nil
+}
+
+func (client *MessagingClient) SendMessage(envelope Envelope, endpoint string, token string) error {
+	parsed, transport, err := client.transport(endpoint)
+	if err != nil {
+		return err
+	}
+
+	envelope.SenderId = client.OrganizationId
+	return transport.Send(parsed, token, envelope)
+}
+
+func (client *MessagingClient) Subscribe(endpoint string, token string, subject string, onEnvelope func(Envelope)) error {
+	parsed, transport, err := client.transport(endpoint)
+	if err != nil {
+		return err
+	}
+	if err := transport.Subscribe(parsed, token, subject, onEnvelope); err != nil {
+		return err
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	for _, subscribed := range client.subscribed {
+		if subscribed == transport {
+			return nil
+		}
+	}
+	client.subscribed = append(client.subscribed, transport)
+	return nil
+}
+
+// Connected reports whether transports of all subscriptions are up, false if there are none
+func (client *MessagingClient) Connected() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if len(client.subscribed) == 0 {
+		return false
+	}
+	for _, transport := range client.subscribed {
+		if !transport.Connected() {
+			return false
+		}
+	}
+	return true
+}
+
+func (client *MessagingClient) Drain(ctx context.Context) error {
+	client.mutex.Lock()
+	subscribed := client.subscribed
+	client.subscribed = nil
+	client.mutex.Unlock()
+
+	var drainErr error
+	for _, transport := range subscribed {
+		if err := transport.Drain(ctx); err != nil && drainErr == nil {
+			drainErr = err
+		}
+	}
+	return drainErr
+}
+
+// signedEnvelope is envelope sent over https and amqp, signature is ed25519 of json of the envelope
+// together with the time it was sent and a random nonce, receivers reject envelopes they have seen
+type signedEnvelope struct {
+	Envelope  Envelope
+	SentAt    time.Time
+	Nonce     string
+	Signature []byte
+}
+
+func (s signedEnvelope) signed() ([]byte, error) {
+	return json.Marshal(struct {
+		Envelope Envelope
+		SentAt   time.Time
+		Nonce    string
+	}{s.Envelope, s.SentAt, s.Nonce})
+}
+
+func signEnvelope(envelope Envelope, signingKey ed25519.PrivateKey) ([]byte, error) {
+	if len(signingKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("signing key for envelopes is not configured")
+	}
+	if envelope.SenderId == "" {
+		return nil, errors.New("envelope has no sender")
+	}
+	if envelope.RecipientId == "" {
+		return nil, errors.New("envelope has no recipient")
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := signedEnvelope{Envelope: envelope, SentAt: time.Now().UTC(), Nonce: hex.EncodeToString(nonce)}
+	signed, err := sealed.signed()
+	if err != nil {
+		return nil, err
+	}
+	sealed.Signature = ed25519.Sign(signingKey, signed)
+	return json.Marshal(sealed)
+}
+
+// openEnvelope reads signed envelope, verifies it with public key of its sender and rejects it
+// unless replays accepts it
+func openEnvelope(data []byte, publicKeys PublicKeyLookup, replays *replayGuard) (Envelope, error) {
+	var received signedEnvelope
+	if err := json.Unmarshal(data, &received); err != nil {
+		return Envelope{}, fmt.Errorf("invalid envelope %w", err)
+	}
+
+	var publicKey ed25519.PublicKey
+	if publicKeys != nil {
+		publicKey = publicKeys(received.Envelope.WorkgroupId, received.Envelope.SenderId)
+	}
+	if len(publicKey) != ed25519.PublicKeySize {
+		return Envelope{}, fmt.Errorf("sender %v has no public key in workgroup %v", received.Envelope.SenderId, received.Envelope.WorkgroupId)
+	}
+
+	signed, err := received.signed()
+	if err != nil {
+		return Envelope{}, err
+	}
+	if !ed25519.Verify(publicKey, signed, received.Signature) {
+		return Envelope{}, fmt.Errorf("signature of sender %v does not match", received.Envelope.SenderId)
+	}
+	// only signed envelopes are remembered, so others can not fill up nonces
+	if err := replays.check(received, time.Now()); err != nil {
+		return Envelope{}, err
+	}
+	return received.Envelope, nil
+}
+
+const (
+	defaultMaxEnvelopeAge = time.Hour
+	// clocks of members may be ahead of ours
+	maxEnvelopeClockSkew = time.Minute
+)
+
+// replayGuard rejects signed envelopes addressed to another organization, sent longer than maxAge ago
+// or already received. Nonces are remembered only in memory until their envelopes are stale
+type replayGuard struct {
+	recipientId string
+	maxAge      time.Duration
+
+	mutex  sync.Mutex
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+func newReplayGuard(recipientId string, maxAge time.Duration) *replayGuard {
+	if maxAge <= 0 {
+		maxAge = defaultMaxEnvelopeAge
+	}
+	return &replayGuard{recipientId: recipientId, maxAge: maxAge, seen: map[string]time.Time{}}
+}
+
+func (g *replayGuard) check(received signedEnvelope, now time.Time) error {
+	if g.recipientId == "" || !strings.EqualFold(received.Envelope.RecipientId, g.recipientId) {
+		return fmt.Errorf("envelope of sender %v is addressed to %v", received.Envelope.SenderId, orNone(received.Envelope.RecipientId))
+	}
+	if received.SentAt.Before(now.Add(-g.maxAge)) || received.SentAt.After(now.Add(maxEnvelopeClockSkew)) {
+		return fmt.Errorf("envelope of sender %v sent at %v is stale", received.Envelope.SenderId, received.SentAt)
+	}
+	if received.Nonce == "" {
+		return fmt.Errorf("envelope of sender %v has no nonce", received.Envelope.SenderId)
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if now.Sub(g.pruned) > time.Minute {
+		for nonce, expiresAt := range g.seen {
+			if expiresAt.Before(now) {
+				delete(g.seen, nonce)
+			}
+		}
+		g.pruned = now
+	}
+
+	key := received.Envelope.SenderId + "/" + received.Nonce
+	if _, ok := g.seen[key]; ok {
+		return fmt.Errorf("envelope of sender %v with nonce %v was already received", received.Envelope.SenderId, received.Nonce)
+	}
+	g.seen[key] = received.SentAt.Add(g.maxAge)
+	return nil
+}
@@ -0,0 +1,214 @@
+package messaging
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type fakeTransport struct {
+	sent      []Envelope
+	endpoints []string
+}
+
+func (t *fakeTransport) Send(endpoint *url.URL, token string, envelope Envelope) error {
+	t.sent = append(t.sent, envelope)
+	t.endpoints = append(t.endpoints, endpoint.String())
+	return nil
+}
+
+func (t *fakeTransport) Subscribe(endpoint *url.URL, token string, subject string, onEnvelope func(Envelope)) error {
+	t.endpoints = append(t.endpoints, endpoint.String())
+	return nil
+}
+
+func (t *fakeTransport) Connected() bool {
+	return true
+}
+
+func (t *fakeTransport) Drain(ctx context.Context) error {
+	return nil
+}
+
+// testKeys returns signing key of sender and lookup knowing only its public key
+func testKeys(t *testing.T, workgroupId string, senderId string) (ed25519.PrivateKey, PublicKeyLookup) {
+	publicKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key failed %v", err)
+	}
+
+	return signingKey, func(lookupWorkgroupId string, organizationId string) ed25519.PublicKey {
+		if lookupWorkgroupId == workgroupId && organizationId == senderId {
+			return publicKey
+		}
+		return nil
+	}
+}
+
+func TestGivenEndpointsOfDifferentSchemesWhenSendingThenTransportOfSchemeIsUsed(t *testing.T) {
+	nats, https := &fakeTransport{}, &fakeTransport{}
+	client := &MessagingClient{OrganizationId: "alice", Transports: map[string]ITransport{SchemeNats: nats, SchemeHttps: https}}
+
+	for _, endpoint := range []string{"counterparty:4222", "nats://counterparty:4222", "https://counterparty:8443/offchain"} {
+		if err := client.SendMessage(Envelope{WorkgroupId: "workgroup", Subject: "subject"}, endpoint, "token"); err != nil {
+			t.Fatalf("sending to %v failed %v", endpoint, err)
+		}
+	}
+
+	if len(nats.sent) != 2 || nats.endpoints[0] != "nats://counterparty:4222" || len(https.sent) != 1 {
+		t.Fatalf("expected two nats and one https envelope, got %v %v", nats.endpoints, https.endpoints)
+	}
+	if https.sent[0].SenderId != "alice" || https.sent[0].WorkgroupId != "workgroup" {
+		t.Fatalf("expected envelope from alice, got %+v", https.sent[0])
+	}
+	if err := client.SendMessage(Envelope{}, "amqp://broker:5672/?queue=proxy", "token"); err == nil {
+		t.Fatalf("expected endpoint without transport to fail")
+	}
+}
+
+func TestGivenInvalidEndpointWhenParsedThenItFails(t *testing.T) {
+	for _, endpoint := range []string{"", "https:///offchain", "nats://%zz"} {
+		if _, err := ParseEndpoint(endpoint); err == nil {
+			t.Fatalf("expected %q to fail", endpoint)
+		}
+	}
+}
+
+func TestGivenMemberEndpointWhenValidatedThenUnknownSchemesAndMissingPublicKeysFail(t *testing.T) {
+	publicKey := "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+	valid := map[string]string{
+		"counterparty:4222":                   "",
+		"nats://counterparty:4222":            publicKey,
+		"https://partner.example/offchain":    publicKey,
+		"amqps://broker.example/?queue=proxy": publicKey,
+	}
+	for endpoint, key := range valid {
+		if err := ValidateMemberEndpoint(endpoint, key); err != nil {
+			t.Fatalf("expected %q to be valid, got %v", endpoint, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"ftp://partner.example":              publicKey,
+		"https://partner.example/offchain":   "",
+		"amqp://broker.example/?queue=proxy": publicKey[:62],
+		"counterparty:4222":                  "not hex",
+	}
+	for endpoint, key := range invalid {
+		if err := ValidateMemberEndpoint(endpoint, key); err == nil {
+			t.Fatalf("expected %q with key %q to fail", endpoint, key)
+		}
+	}
+}
+
+func TestGivenSignedEnvelopeWhenOpenedThenOnlyUnchangedEnvelopeOfKnownSenderIsAccepted(t *testing.T) {
+	signingKey, publicKeys := testKeys(t, "workgroup", "alice")
+	envelope := Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject", Payload: []byte(`{"TxHash":"abc"}`)}
+
+	signed, err := signEnvelope(envelope, signingKey)
+	if err != nil {
+		t.Fatalf("signing failed %v", err)
+	}
+	opened, err := openEnvelope(signed, publicKeys, newReplayGuard("bob", time.Hour))
+	if err != nil || string(opened.Payload) != string(envelope.Payload) || opened.SenderId != "alice" {
+		t.Fatalf("expected envelope to be opened, got %+v %v", opened, err)
+	}
+
+	var tampered signedEnvelope
+	json.Unmarshal(signed, &tampered)
+	tampered.Envelope.Payload = []byte(`{"TxHash":"def"}`)
+	tamperedJson, _ := json.Marshal(tampered)
+	if _, err := openEnvelope(tamperedJson, publicKeys, newReplayGuard("bob", time.Hour)); err == nil {
+		t.Fatalf("expected tampered envelope to fail")
+	}
+	json.Unmarshal(signed, &tampered)
+	tampered.Envelope.RecipientId = "carol"
+	tamperedJson, _ = json.Marshal(tampered)
+	if _, err := openEnvelope(tamperedJson, publicKeys, newReplayGuard("carol", time.Hour)); err == nil {
+		t.Fatalf("expected envelope readdressed to other recipient to fail")
+	}
+
+	// envelopes signed with another key or sent by member without public key are rejected
+	bobsKey, _ := testKeys(t, "workgroup", "bob")
+	forged, _ := signEnvelope(envelope, bobsKey)
+	if _, err := openEnvelope(forged, publicKeys, newReplayGuard("bob", time.Hour)); err == nil {
+		t.Fatalf("expected envelope signed with other key to fail")
+	}
+	envelope.SenderId = "bob"
+	unknown, _ := signEnvelope(envelope, bobsKey)
+	if _, err := openEnvelope(unknown, publicKeys, newReplayGuard("bob", time.Hour)); err == nil {
+		t.Fatalf("expected envelope of sender without public key to fail")
+	}
+}
+
+func TestGivenSignedEnvelopeWhenOpenedAgainOrStaleOrByOtherRecipientThenItIsRejected(t *testing.T) {
+	signingKey, publicKeys := testKeys(t, "workgroup", "alice")
+	signed, _ := signEnvelope(Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject"}, signingKey)
+
+	replays := newReplayGuard("bob", time.Hour)
+	if _, err := openEnvelope(signed, publicKeys, replays); err != nil {
+		t.Fatalf("expected envelope to be opened, got %v", err)
+	}
+	if _, err := openEnvelope(signed, publicKeys, replays); err == nil {
+		t.Fatalf("expected replayed envelope to fail")
+	}
+	if _, err := openEnvelope(signed, publicKeys, newReplayGuard("carol", time.Hour)); err == nil {
+		t.Fatalf("expected envelope addressed to other recipient to fail")
+	}
+
+	var received signedEnvelope
+	json.Unmarshal(signed, &received)
+	if err := newReplayGuard("bob", time.Hour).check(received, received.SentAt.Add(2*time.Hour)); err == nil {
+		t.Fatalf("expected stale envelope to fail")
+	}
+	if err := newReplayGuard("bob", time.Hour).check(received, received.SentAt.Add(-time.Hour)); err == nil {
+		t.Fatalf("expected envelope sent in the future to fail")
+	}
+}
+
+func TestGivenSignedEnvelopeCarryingMessageOfOtherSenderWhenSenderIsCheckedThenItFails(t *testing.T) {
+	signingKey, publicKeys := testKeys(t, "workgroup", "alice")
+	signed, _ := signEnvelope(Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject"}, signingKey)
+	opened, err := openEnvelope(signed, publicKeys, newReplayGuard("bob", time.Hour))
+	if err != nil {
+		t.Fatalf("expected envelope to be opened, got %v", err)
+	}
+
+	if err := opened.CheckSender("alice", "workgroup"); err != nil {
+		t.Fatalf("expected message of alice to be accepted, got %v", err)
+	}
+	if err := opened.CheckSender("bob", "workgroup"); !errors.Is(err, ErrUnexpectedSender) {
+		t.Fatalf("expected message of bob sent by alice to fail, got %v", err)
+	}
+	if err := opened.CheckSender("alice", "other workgroup"); !errors.Is(err, ErrUnexpectedSender) {
+		t.Fatalf("expected message of other workgroup to fail, got %v", err)
+	}
+	if err := (Envelope{WorkgroupId: "workgroup"}).CheckSender("alice", "workgroup"); !errors.Is(err, ErrUnexpectedSender) {
+		t.Fatalf("expected envelope without sender to fail, got %v", err)
+	}
+	if err := (Envelope{Legacy: true}).CheckSender("alice", "workgroup"); err != nil {
+		t.Fatalf("expected accepted legacy nats message to pass, got %v", err)
+	}
+
+	// only nats transport marks envelopes legacy, signed envelopes can not claim it
+	legacy, _ := signEnvelope(Envelope{WorkgroupId: "workgroup", SenderId: "alice", RecipientId: "bob", Subject: "subject", Legacy: true}, signingKey)
+	opened, _ = openEnvelope(legacy, publicKeys, newReplayGuard("bob", time.Hour))
+	if err := opened.CheckSender("bob", "workgroup"); !errors.Is(err, ErrUnexpectedSender) {
+		t.Fatalf("expected signed envelope claiming legacy to be checked, got %v", err)
+	}
+}
+
+func TestGivenNoSigningKeyOrRecipientWhenSigningThenItFails(t *testing.T) {
+	if _, err := signEnvelope(Envelope{SenderId: "alice", RecipientId: "bob"}, nil); err == nil {
+		t.Fatalf("expected signing without key to fail")
+	}
+	signingKey, _ := testKeys(t, "workgroup", "alice")
+	if _, err := signEnvelope(Envelope{SenderId: "alice"}, signingKey); err == nil {
+		t.Fatalf("expected signing without recipient to fail")
+	}
+}
@@ -1,58 +1,179 @@
 package messaging
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
 	"github.com/nats-io/nats.go"
 	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/metrics"
 )
 
-type IMessagingClient interface {
-	// used to send an OffchainProcessMessage
-	// message - message payload
-	// recipient - address of the recipient (i.e. NATS server url) taken from workgroup
-	// token - token used to authenticate (i.e. NATS server token) taken from the workgroup
-	// subject - nats subject
-	SendMessage(message []byte, recipient string, token string, subject string)
-
-	// used to receive messages sent by other participants to our nats server
-	// serverUrl - local server url
-	// token - local server token
-	// topic - listening topic
-	// onMessageReceived - callback function
-	Subscribe(serverUrl string, token string, topic string, onMessageReceived func(string, *nats.Msg))
-}
+var messagingLog = logger.For("messaging")
 
-type NatsMessagingClient struct {
+// NatsTransport sends envelopes gzip compressed and split into chunks that fit max payload of
+// recipient's nats server, subscriptions reassemble and verify them before message is handed over
+type NatsTransport struct {
+	mutex         sync.Mutex
+	subscriptions []*nats.Conn
+
+	// MaxPayload caps size of published chunks below max payload of the server, 0 means server's
+	MaxPayload int
+	// TransferTimeout is how long chunks of incomplete message are kept, 0 means one minute
+	TransferTimeout time.Duration
+	// MaxMessageSize is the largest reassembled message accepted, 0 means 64 MB
+	MaxMessageSize int
+	// MaxPendingTransfers caps incomplete transfers per subscription, 0 means 64
+	MaxPendingTransfers int
+	// MaxBufferedBytes caps chunk data of incomplete transfers per subscription, 0 means 256 MB
+	MaxBufferedBytes int
+	// AcceptLegacyMessages passes on messages without sender of proxies before envelopes, their sender is not
+	// checked. Only meant for rolling upgrades, messages without sender are dropped otherwise
+	AcceptLegacyMessages bool
 }
 
-func (client *NatsMessagingClient) SendMessage(message []byte, recipient string, token string, subject string) {
+func (client *NatsTransport) Send(endpoint *url.URL, token string, envelope Envelope) error {
+	recipient, subject, message := endpoint.Host, envelope.Subject, envelope.Payload
 	// https://docs.nats.io/developing-with-nats/security/token
 	nc, err := nats.Connect("nats://" + token + "@" + recipient)
 
 	if err != nil {
-		logger.Errorf("Error while trying to connect to Nats: %v, message: %s, recipient: %s, token: %s", err, message, recipient, token)
-		return
+		messagingLog.Error("error connecting to nats", logger.F("error", err), logger.F("recipient", recipient), logger.F("subject", subject))
+		metrics.NatsMessagesSent.WithLabelValues(subject, metrics.ResultFailure).Inc()
+		return err
 	}
 
 	defer nc.Close()
 
-	// TODO: https://docs.nats.io/developing-with-nats/sending/replyto
-	err = nc.Publish(subject, message)
+	payloads, err := chunkMessage(envelope, client.maxPayload(nc))
+	if err == nil {
+		// TODO: https://docs.nats.io/developing-with-nats/sending/replyto
+		for _, payload := range payloads {
+			if err = nc.Publish(subject, payload); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = nc.Flush()
+	}
 
 	if err != nil {
-		logger.Errorf("Error while trying to send NATS message: %v, message: %s, recipient: %s, token: %s", err, message, recipient, token)
+		messagingLog.Error("error sending nats message", logger.F("error", err), logger.F("recipient", recipient), logger.F("subject", subject), logger.Payload("message", string(message)))
+		metrics.NatsMessagesSent.WithLabelValues(subject, metrics.ResultFailure).Inc()
+		return err
 	}
+
+	metrics.NatsMessagesSent.WithLabelValues(subject, metrics.ResultSuccess).Inc()
+	return nil
 }
 
-func (client *NatsMessagingClient) Subscribe(serverUrl string, token string, topic string, onMessageReceived func(string, *nats.Msg)) {
+func (client *NatsTransport) Subscribe(endpoint *url.URL, token string, topic string, onEnvelope func(Envelope)) error {
 	// https://docs.nats.io/developing-with-nats/security/token
-	nc, err := nats.Connect("nats://" + token + "@" + serverUrl)
+	nc, err := nats.Connect("nats://" + token + "@" + endpoint.Host)
 
 	if err != nil {
-		logger.Errorf("Error while trying to connect to local Nats: %v", err)
-		return
+		return fmt.Errorf("error while trying to connect to local nats %w", err)
 	}
 
+	assembler := newTransferAssembler(topic, client.TransferTimeout, client.MaxMessageSize, client.MaxPendingTransfers, client.MaxBufferedBytes)
 	nc.Subscribe(topic, func(m *nats.Msg) {
-		onMessageReceived(string("TODO: m.Sender"), m)
+		message, manifest, err := assembler.add(m.Data)
+		if err != nil {
+			messagingLog.Error("error receiving nats message", logger.F("error", err), logger.F("subject", m.Subject))
+			return
+		}
+		if message == nil {
+			// more chunks to come
+			return
+		}
+
+		envelope := Envelope{Subject: m.Subject, Payload: message}
+		if manifest != nil {
+			envelope.WorkgroupId, envelope.SenderId = manifest.WorkgroupId, manifest.SenderId
+		}
+		if envelope.SenderId == "" {
+			if !client.AcceptLegacyMessages {
+				messagingLog.Warn("dropping nats message without sender, sending proxy is not updated", logger.F("subject", m.Subject))
+				return
+			}
+			messagingLog.Warn("accepting nats message without sender of proxy before envelopes", logger.F("subject", m.Subject))
+			envelope.Legacy = true
+		}
+
+		metrics.NatsMessagesReceived.WithLabelValues(m.Subject).Inc()
+		onEnvelope(envelope)
 	})
+
+	// subscription is registered on server once flushed, messages published before would be missed
+	if err = nc.Flush(); err != nil {
+		logger.Errorf("Error while flushing Nats subscription: %v", err)
+	}
+
+	client.mutex.Lock()
+	client.subscriptions = append(client.subscriptions, nc)
+	client.mutex.Unlock()
+	return nil
+}
+
+func (client *NatsTransport) maxPayload(nc *nats.Conn) int {
+	maxPayload := int(nc.MaxPayload())
+	if maxPayload <= 0 {
+		maxPayload = defaultMaxPayload
+	}
+	if client.MaxPayload > 0 && client.MaxPayload < maxPayload {
+		maxPayload = client.MaxPayload
+	}
+
+	return maxPayload
+}
+
+// Connected reports whether all subscription connections are up, false if there are none
+func (client *NatsTransport) Connected() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if len(client.subscriptions) == 0 {
+		return false
+	}
+
+	for _, nc := range client.subscriptions {
+		if !nc.IsConnected() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (client *NatsTransport) Drain(ctx context.Context) error {
+	client.mutex.Lock()
+	subscriptions := client.subscriptions
+	client.subscriptions = nil
+	client.mutex.Unlock()
+
+	for _, nc := range subscriptions {
+		err := nc.Drain()
+		if err != nil {
+			logger.Errorf("Error while trying to drain Nats connection: %v", err)
+			nc.Close()
+		}
+	}
+
+	// drain is async, connection is closed when all pending messages are processed
+	for _, nc := range subscriptions {
+		for !nc.IsClosed() {
+			select {
+			case <-ctx.Done():
+				nc.Close()
+				return ctx.Err()
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,320 @@
+package messaging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/metrics"
+)
+
+const (
+	transferEncodingGzip = "gzip"
+
+	// room for transfer id, index and json of envelope around base64 chunk data
+	envelopeOverhead = 1024
+
+	defaultMaxPayload          = 1024 * 1024
+	defaultTransferTimeout     = time.Minute
+	defaultMaxMessageSize      = 64 * 1024 * 1024
+	defaultMaxPendingTransfers = 64
+	defaultMaxBufferedBytes    = 256 * 1024 * 1024
+)
+
+// transferEnvelope is what is published on nats: compressed message split into chunks, first envelope
+// carries the manifest. Messages of proxies before chunked transfers are not wrapped and have no transfer id
+type transferEnvelope struct {
+	Transfer string
+	Manifest *transferManifest `json:",omitempty"`
+	Chunk    *transferChunk    `json:",omitempty"`
+}
+
+type transferManifest struct {
+	WorkgroupId string `json:",omitempty"`
+	SenderId    string `json:",omitempty"`
+	Encoding    string
+	Size        int      // size of message before compression
+	Hash        string   // sha256 of message before compression
+	ChunkHashes []string // sha256 of every chunk of compressed message
+}
+
+type transferChunk struct {
+	Index int
+	Data  []byte
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// chunkMessage compresses payload of envelope and splits it into transfer envelopes of at most maxPayload bytes
+func chunkMessage(envelope Envelope, maxPayload int) ([][]byte, error) {
+	message := envelope.Payload
+	compressed := &bytes.Buffer{}
+	writer := gzip.NewWriter(compressed)
+	if _, err := writer.Write(message); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	// chunk data is base64 in json
+	chunkSize := (maxPayload - envelopeOverhead) / 4 * 3
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("max payload %v is too small for chunks", maxPayload)
+	}
+
+	var chunks [][]byte
+	data := compressed.Bytes()
+	for start := 0; start < len(data); start += chunkSize {
+		end := start + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, data[start:end])
+	}
+
+	manifest := &transferManifest{
+		WorkgroupId: envelope.WorkgroupId,
+		SenderId:    envelope.SenderId,
+		Encoding:    transferEncodingGzip,
+		Size:        len(message),
+		Hash:        sha256Hex(message),
+	}
+	for _, chunk := range chunks {
+		manifest.ChunkHashes = append(manifest.ChunkHashes, sha256Hex(chunk))
+	}
+	transferId := uuid.NewV4().String()
+
+	// single chunk goes together with manifest, manifest of many chunks would not fit next to a full one
+	envelopes := []transferEnvelope{{Transfer: transferId, Manifest: manifest}}
+	if len(chunks) == 1 {
+		envelopes[0].Chunk = &transferChunk{Data: chunks[0]}
+	} else {
+		for i, chunk := range chunks {
+			envelopes = append(envelopes, transferEnvelope{Transfer: transferId, Chunk: &transferChunk{Index: i, Data: chunk}})
+		}
+	}
+
+	var payloads [][]byte
+	for _, transferEnvelope := range envelopes {
+		payload, err := json.Marshal(transferEnvelope)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) > maxPayload {
+			return nil, fmt.Errorf("manifest of %v chunks exceeds max payload %v", len(chunks), maxPayload)
+		}
+		payloads = append(payloads, payload)
+	}
+
+	return payloads, nil
+}
+
+type transfer struct {
+	manifest *transferManifest
+	chunks   map[int][]byte
+	size     int // bytes of chunk data, see bufferedSize
+	timer    *time.Timer
+}
+
+// transferAssembler reassembles chunked messages of one subscription, transfers that are not complete
+// within timeout are dropped. Number of incomplete transfers and their chunk data are capped, so that
+// a sender can not make the proxy buffer chunks without end
+type transferAssembler struct {
+	mutex               sync.Mutex
+	transfers           map[string]*transfer
+	buffered            int
+	timeout             time.Duration
+	maxMessageSize      int
+	maxPendingTransfers int
+	maxBufferedBytes    int
+	subject             string
+}
+
+func newTransferAssembler(subject string, timeout time.Duration, maxMessageSize int, maxPendingTransfers int, maxBufferedBytes int) *transferAssembler {
+	if timeout <= 0 {
+		timeout = defaultTransferTimeout
+	}
+	if maxMessageSize <= 0 {
+		maxMessageSize = defaultMaxMessageSize
+	}
+	if maxPendingTransfers <= 0 {
+		maxPendingTransfers = defaultMaxPendingTransfers
+	}
+	if maxBufferedBytes <= 0 {
+		maxBufferedBytes = defaultMaxBufferedBytes
+	}
+
+	return &transferAssembler{
+		transfers:           map[string]*transfer{},
+		timeout:             timeout,
+		maxMessageSize:      maxMessageSize,
+		maxPendingTransfers: maxPendingTransfers,
+		maxBufferedBytes:    maxBufferedBytes,
+		subject:             subject,
+	}
+}
+
+// add takes received payload and returns message and its manifest once all its chunks are there, nil
+// while chunks are missing. Payloads that are no transfer envelope are returned as they are without manifest
+func (a *transferAssembler) add(payload []byte) ([]byte, *transferManifest, error) {
+	var envelope transferEnvelope
+	if json.Unmarshal(payload, &envelope) != nil || envelope.Transfer == "" {
+		return payload, nil, nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	current, ok := a.transfers[envelope.Transfer]
+	if !ok {
+		if len(a.transfers) >= a.maxPendingTransfers {
+			metrics.NatsTransfersFailed.WithLabelValues(a.subject, metrics.TransferFailureLimit).Inc()
+			return nil, nil, fmt.Errorf("transfer %v dropped, %v transfers are pending", envelope.Transfer, len(a.transfers))
+		}
+		current = &transfer{chunks: map[int][]byte{}}
+		transferId := envelope.Transfer
+		current.timer = time.AfterFunc(a.timeout, func() { a.expire(transferId) })
+		a.transfers[transferId] = current
+	}
+	if envelope.Manifest != nil {
+		current.manifest = envelope.Manifest
+	}
+	if envelope.Chunk != nil {
+		if old, ok := current.chunks[envelope.Chunk.Index]; ok {
+			current.size -= bufferedSize(old)
+			a.buffered -= bufferedSize(old)
+		}
+		current.chunks[envelope.Chunk.Index] = envelope.Chunk.Data
+		current.size += bufferedSize(envelope.Chunk.Data)
+		a.buffered += bufferedSize(envelope.Chunk.Data)
+	}
+	if err := a.checkLimits(current); err != nil {
+		a.remove(envelope.Transfer, current)
+		metrics.NatsTransfersFailed.WithLabelValues(a.subject, metrics.TransferFailureLimit).Inc()
+		return nil, nil, fmt.Errorf("transfer %v dropped %w", envelope.Transfer, err)
+	}
+
+	if current.manifest == nil || len(current.chunks) < len(current.manifest.ChunkHashes) {
+		return nil, nil, nil
+	}
+
+	a.remove(envelope.Transfer, current)
+
+	message, err := a.assemble(current)
+	if err != nil {
+		metrics.NatsTransfersFailed.WithLabelValues(a.subject, metrics.TransferFailureIntegrity).Inc()
+		return nil, nil, fmt.Errorf("transfer %v failed %w", envelope.Transfer, err)
+	}
+	return message, current.manifest, nil
+}
+
+// bufferedSize counts chunk with the overhead of its envelope, so that empty chunks are capped too
+func bufferedSize(chunk []byte) int {
+	return len(chunk) + envelopeOverhead
+}
+
+// checkLimits fails transfer that can never complete or makes buffered chunk data exceed its cap
+func (a *transferAssembler) checkLimits(current *transfer) error {
+	if current.manifest != nil {
+		if current.manifest.Size > a.maxMessageSize {
+			return fmt.Errorf("message of %v bytes exceeds max message size %v", current.manifest.Size, a.maxMessageSize)
+		}
+		for index := range current.chunks {
+			if index < 0 || index >= len(current.manifest.ChunkHashes) {
+				return fmt.Errorf("chunk %v is not in manifest of %v chunks", index, len(current.manifest.ChunkHashes))
+			}
+		}
+	}
+	if a.buffered > a.maxBufferedBytes {
+		return fmt.Errorf("buffered chunks exceed %v bytes", a.maxBufferedBytes)
+	}
+	return nil
+}
+
+// remove stops tracking transfer and releases its chunk data, mutex has to be held
+func (a *transferAssembler) remove(transferId string, current *transfer) {
+	current.timer.Stop()
+	delete(a.transfers, transferId)
+	a.buffered -= current.size
+}
+
+func (a *transferAssembler) assemble(current *transfer) ([]byte, error) {
+	manifest := current.manifest
+	if manifest.Encoding != transferEncodingGzip {
+		return nil, fmt.Errorf("unknown encoding %v", manifest.Encoding)
+	}
+	if manifest.Size > a.maxMessageSize {
+		return nil, fmt.Errorf("message of %v bytes exceeds max message size %v", manifest.Size, a.maxMessageSize)
+	}
+
+	compressed := &bytes.Buffer{}
+	for i, chunkHash := range manifest.ChunkHashes {
+		chunk, ok := current.chunks[i]
+		if !ok {
+			return nil, fmt.Errorf("chunk %v is missing", i)
+		}
+		if sha256Hex(chunk) != chunkHash {
+			return nil, fmt.Errorf("chunk %v does not match its hash", i)
+		}
+		compressed.Write(chunk)
+	}
+
+	reader, err := gzip.NewReader(compressed)
+	if err != nil {
+		return nil, err
+	}
+	// manifest size is not trusted until hash matches, larger message fails the size check
+	message, err := ioutil.ReadAll(io.LimitReader(reader, int64(manifest.Size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(message) != manifest.Size || sha256Hex(message) != manifest.Hash {
+		return nil, errors.New("message does not match its hash")
+	}
+
+	return message, nil
+}
+
+func (a *transferAssembler) expire(transferId string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	current, ok := a.transfers[transferId]
+	if !ok {
+		return
+	}
+	a.remove(transferId, current)
+
+	expected := "unknown"
+	if current.manifest != nil {
+		expected = fmt.Sprint(len(current.manifest.ChunkHashes))
+	}
+	messagingLog.Warn("dropping incomplete transfer",
+		logger.F("transfer", transferId),
+		logger.F("subject", a.subject),
+		logger.F("chunks", len(current.chunks)),
+		logger.F("expected_chunks", expected),
+	)
+	metrics.NatsTransfersFailed.WithLabelValues(a.subject, metrics.TransferFailureTimeout).Inc()
+}
+
+func (a *transferAssembler) pending() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return len(a.transfers)
+}
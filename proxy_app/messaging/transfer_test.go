@@ -0,0 +1,181 @@
+package messaging
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// random bytes do not compress, so message needs several chunks
+func randomMessage(size int) []byte {
+	message := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(message)
+	return message
+}
+
+func receive(t *testing.T, assembler *transferAssembler, payloads [][]byte) []byte {
+	var message []byte
+	for i, payload := range payloads {
+		received, _, err := assembler.add(payload)
+		if err != nil {
+			t.Fatalf("payload %v failed %v", i, err)
+		}
+		if received != nil && i < len(payloads)-1 {
+			t.Fatalf("message complete after %v of %v payloads", i+1, len(payloads))
+		}
+		message = received
+	}
+	return message
+}
+
+func TestGivenMessageLargerThanMaxPayloadWhenChunkedThenEveryPayloadFitsAndMessageIsReassembled(t *testing.T) {
+	message := randomMessage(20000)
+
+	payloads, err := chunkMessage(Envelope{Payload: message}, 4096)
+	if err != nil {
+		t.Fatalf("chunking failed %v", err)
+	}
+	if len(payloads) < 6 {
+		t.Fatalf("expected manifest and several chunks, got %v payloads", len(payloads))
+	}
+	for i, payload := range payloads {
+		if len(payload) > 4096 {
+			t.Fatalf("payload %v has %v bytes", i, len(payload))
+		}
+	}
+
+	// chunks may come before the manifest
+	payloads[0], payloads[len(payloads)-1] = payloads[len(payloads)-1], payloads[0]
+	if received := receive(t, newTransferAssembler("subject", time.Minute, 0, 0, 0), payloads); !bytes.Equal(received, message) {
+		t.Fatalf("reassembled message differs")
+	}
+}
+
+func TestGivenCompressibleMessageWhenChunkedThenOnePayloadIsSent(t *testing.T) {
+	message := bytes.Repeat([]byte(`{"sku":"sku-1","quantity":1},`), 10000)
+
+	payloads, err := chunkMessage(Envelope{Payload: message}, 64*1024)
+	if err != nil || len(payloads) != 1 || len(payloads[0]) >= len(message) {
+		t.Fatalf("expected one compressed payload, got %v payloads %v", len(payloads), err)
+	}
+	if received := receive(t, newTransferAssembler("subject", time.Minute, 0, 0, 0), payloads); !bytes.Equal(received, message) {
+		t.Fatalf("reassembled message differs")
+	}
+}
+
+func TestGivenTamperedChunkWhenReassembledThenMessageIsDropped(t *testing.T) {
+	payloads, _ := chunkMessage(Envelope{Payload: randomMessage(10000)}, 4096)
+
+	var envelope transferEnvelope
+	json.Unmarshal(payloads[1], &envelope)
+	envelope.Chunk.Data[0]++
+	payloads[1], _ = json.Marshal(envelope)
+
+	assembler := newTransferAssembler("subject", time.Minute, 0, 0, 0)
+	var err error
+	for _, payload := range payloads {
+		if _, _, err = assembler.add(payload); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Fatalf("expected tampered chunk to fail")
+	}
+	if assembler.pending() != 0 {
+		t.Fatalf("failed transfer is still pending")
+	}
+}
+
+func TestGivenMessageLargerThanMaxMessageSizeWhenReassembledThenItIsDropped(t *testing.T) {
+	payloads, _ := chunkMessage(Envelope{Payload: bytes.Repeat([]byte("a"), 100000)}, 4096)
+
+	assembler := newTransferAssembler("subject", time.Minute, 1000, 0, 0)
+	if _, _, err := assembler.add(payloads[0]); err == nil {
+		t.Fatalf("expected message above max message size to fail")
+	}
+}
+
+func TestGivenMissingChunkWhenTimeoutPassesThenTransferIsDropped(t *testing.T) {
+	payloads, _ := chunkMessage(Envelope{Payload: randomMessage(10000)}, 4096)
+
+	assembler := newTransferAssembler("subject", 20*time.Millisecond, 0, 0, 0)
+	for _, payload := range payloads[:len(payloads)-1] {
+		if message, _, err := assembler.add(payload); message != nil || err != nil {
+			t.Fatalf("expected incomplete transfer, got %v %v", message, err)
+		}
+	}
+	if assembler.pending() != 1 {
+		t.Fatalf("expected one pending transfer, got %v", assembler.pending())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for assembler.pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if assembler.pending() != 0 {
+		t.Fatalf("incomplete transfer was not dropped")
+	}
+}
+
+func TestGivenMessageOfProxyBeforeChunkingWhenReceivedThenItIsPassedOn(t *testing.T) {
+	message := []byte(`{"ProcessMessage":{"Id":"00000000-0000-0000-0000-000000000000"},"TxHash":"abc"}`)
+
+	received, _, err := newTransferAssembler("subject", time.Minute, 0, 0, 0).add(message)
+	if err != nil || !bytes.Equal(received, message) {
+		t.Fatalf("expected message as it is, got %s %v", received, err)
+	}
+}
+
+func TestGivenChunkIndexOutsideManifestWhenReceivedThenTransferIsDropped(t *testing.T) {
+	payloads, _ := chunkMessage(Envelope{Payload: randomMessage(10000)}, 4096)
+
+	var envelope transferEnvelope
+	json.Unmarshal(payloads[1], &envelope)
+	envelope.Chunk.Index = 1000
+	outside, _ := json.Marshal(envelope)
+
+	assembler := newTransferAssembler("subject", time.Minute, 0, 0, 0)
+	if _, _, err := assembler.add(payloads[0]); err != nil {
+		t.Fatalf("manifest failed %v", err)
+	}
+	if _, _, err := assembler.add(outside); err == nil {
+		t.Fatalf("expected chunk outside manifest to fail")
+	}
+	if assembler.pending() != 0 || assembler.buffered != 0 {
+		t.Fatalf("dropped transfer is still pending, %v transfers, %v bytes", assembler.pending(), assembler.buffered)
+	}
+}
+
+func TestGivenTransfersAboveCapsWhenReceivedThenTheyAreDropped(t *testing.T) {
+	assembler := newTransferAssembler("subject", time.Minute, 0, 2, 0)
+	for i := 0; i < 3; i++ {
+		payloads, _ := chunkMessage(Envelope{Payload: randomMessage(10000)}, 4096)
+		_, _, err := assembler.add(payloads[1])
+		if i < 2 && err != nil {
+			t.Fatalf("transfer %v failed %v", i, err)
+		}
+		if i == 2 && err == nil {
+			t.Fatalf("expected transfer above max pending transfers to fail")
+		}
+	}
+	if assembler.pending() != 2 {
+		t.Fatalf("expected two pending transfers, got %v", assembler.pending())
+	}
+
+	payloads, _ := chunkMessage(Envelope{Payload: randomMessage(10000)}, 4096)
+	assembler = newTransferAssembler("subject", time.Minute, 0, 0, 6000)
+	var err error
+	for _, payload := range payloads[1:] {
+		if _, _, err = assembler.add(payload); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Fatalf("expected chunks above max buffered bytes to fail")
+	}
+	if assembler.pending() != 0 || assembler.buffered != 0 {
+		t.Fatalf("dropped transfer is still buffered, %v transfers, %v bytes", assembler.pending(), assembler.buffered)
+	}
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// all metrics are registered in default prometheus registry and exposed on /metrics
+
+const namespace = "baseledger_proxy"
+
+// result label values
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// reasons chunked nats messages are dropped
+const (
+	TransferFailureTimeout   = "timeout"
+	TransferFailureIntegrity = "integrity"
+	TransferFailureLimit     = "limit"
+)
+
+// business logic outcome label values
+const (
+	OutcomeNotCommitted = "not_committed"
+	OutcomeInvalid      = "invalid"
+	OutcomeRejected     = "rejected"
+	OutcomeProcessed    = "processed"
+	OutcomeError        = "error"
+	OutcomeDead         = "dead"
+)
+
+var HttpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "http_requests_total",
+	Help:      "Number of handled http requests by route, method and status",
+}, []string{"route", "method", "status"})
+
+var HttpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "http_request_duration_seconds",
+	Help:      "Duration of handled http requests by route and method",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"route", "method"})
+
+var SuggestionsCreated = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "suggestions_created_total",
+	Help:      "Number of suggestions created and broadcasted",
+})
+
+var FeedbacksCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "feedbacks_created_total",
+	Help:      "Number of feedbacks created and broadcasted, by approval",
+}, []string{"approved"})
+
+var SignAndBroadcastDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "sign_and_broadcast_duration_seconds",
+	Help:      "Duration of sign and broadcast calls to blockchain app",
+	Buckets:   prometheus.DefBuckets,
+})
+
+var SignAndBroadcastFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "sign_and_broadcast_failures_total",
+	Help:      "Number of failed sign and broadcast calls by reason",
+}, []string{"reason"})
+
+var BroadcastToCommitDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "broadcast_to_commit_seconds",
+	Help:      "Time from creating trustmesh entry until its transaction is found committed",
+	Buckets:   []float64{1, 2, 5, 10, 30, 60, 120, 300, 600, 1800},
+})
+
+var BusinessLogicOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "business_logic_executions_total",
+	Help:      "Number of business logic executions by trustmesh entry type and outcome",
+}, []string{"entry_type", "outcome"})
+
+var SorWebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "sor_webhook_deliveries_total",
+	Help:      "Number of system of record webhook deliveries by result",
+}, []string{"result"})
+
+var NatsMessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "nats_messages_sent_total",
+	Help:      "Number of nats messages sent by subject and result",
+}, []string{"subject", "result"})
+
+var NatsMessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "nats_messages_received_total",
+	Help:      "Number of nats messages received by subject",
+}, []string{"subject"})
+
+var NatsTransfersFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "nats_transfers_failed_total",
+	Help:      "Number of chunked nats messages dropped by subject and reason",
+}, []string{"subject", "reason"})
+
+var HashVerificationFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "hash_verification_failures_total",
+	Help:      "Number of sync trees that failed hash verification",
+})
+
+var EthExitTransactions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "eth_exit_transactions_total",
+	Help:      "Number of ethereum exit transactions by result",
+}, []string{"result"})
@@ -0,0 +1,3 @@
+DROP INDEX idx_rate_limits_expires_at;
+
+DROP TABLE public.rate_limits;
@@ -0,0 +1,11 @@
+CREATE TABLE public.rate_limits (
+  key text NOT NULL,
+  count bigint NOT NULL,
+  expires_at timestamp with time zone NOT NULL
+);
+
+ALTER TABLE public.rate_limits OWNER TO baseledger;
+
+ALTER TABLE ONLY public.rate_limits ADD CONSTRAINT rate_limits_pkey PRIMARY KEY (key);
+
+CREATE INDEX idx_rate_limits_expires_at ON public.rate_limits USING btree (expires_at);
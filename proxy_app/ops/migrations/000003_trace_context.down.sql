@@ -0,0 +1 @@
+ALTER TABLE public.trustmesh_entries DROP COLUMN trace_context;
@@ -0,0 +1 @@
+ALTER TABLE public.trustmesh_entries ADD COLUMN trace_context text;
@@ -0,0 +1,3 @@
+DROP INDEX idx_pending_broadcasts_created_at;
+
+DROP TABLE public.pending_broadcasts;
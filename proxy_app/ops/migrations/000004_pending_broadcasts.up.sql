@@ -0,0 +1,20 @@
+CREATE TABLE public.pending_broadcasts (
+  id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+  created_at timestamp with time zone DEFAULT now() NOT NULL,
+  transaction_id uuid NOT NULL,
+  trustmesh_entry_id uuid NOT NULL,
+  offchain_process_message_id uuid NOT NULL,
+  payload text NOT NULL,
+  op_code bigint NOT NULL,
+  status text NOT NULL,
+  broadcast_attempted_at timestamp with time zone
+);
+
+ALTER TABLE public.pending_broadcasts OWNER TO baseledger;
+
+ALTER TABLE ONLY public.pending_broadcasts ADD CONSTRAINT pending_broadcasts_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.pending_broadcasts
+  ADD CONSTRAINT pending_broadcasts_trustmesh_entry_id_trustmesh_entries_id_foreign FOREIGN KEY (trustmesh_entry_id) REFERENCES public.trustmesh_entries(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+CREATE INDEX idx_pending_broadcasts_created_at ON public.pending_broadcasts USING btree (created_at);
@@ -0,0 +1,7 @@
+DROP INDEX public.idx_trustmesh_entries_processing_state;
+
+ALTER TABLE public.trustmesh_entries DROP COLUMN processing_resolution;
+ALTER TABLE public.trustmesh_entries DROP COLUMN processing_next_retry_at;
+ALTER TABLE public.trustmesh_entries DROP COLUMN processing_last_error;
+ALTER TABLE public.trustmesh_entries DROP COLUMN processing_attempts;
+ALTER TABLE public.trustmesh_entries DROP COLUMN processing_state;
@@ -0,0 +1,10 @@
+ALTER TABLE public.trustmesh_entries ADD COLUMN processing_state text DEFAULT 'PENDING' NOT NULL;
+ALTER TABLE public.trustmesh_entries ADD COLUMN processing_attempts integer DEFAULT 0 NOT NULL;
+ALTER TABLE public.trustmesh_entries ADD COLUMN processing_last_error text;
+ALTER TABLE public.trustmesh_entries ADD COLUMN processing_next_retry_at timestamp with time zone;
+ALTER TABLE public.trustmesh_entries ADD COLUMN processing_resolution text;
+
+UPDATE public.trustmesh_entries SET processing_state = 'COMMITTED' WHERE commitment_state = 'COMMITTED';
+UPDATE public.trustmesh_entries SET processing_state = 'DEAD', processing_last_error = 'transaction is invalid' WHERE commitment_state = 'INVALID';
+
+CREATE INDEX idx_trustmesh_entries_processing_state ON public.trustmesh_entries USING btree (processing_state);
@@ -0,0 +1,3 @@
+DROP INDEX public.idx_trustmesh_entries_uncommitted_created_at;
+
+ALTER TABLE public.trustmesh_entries DROP COLUMN processing_claimed_until;
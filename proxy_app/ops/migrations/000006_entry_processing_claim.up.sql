@@ -0,0 +1,3 @@
+ALTER TABLE public.trustmesh_entries ADD COLUMN processing_claimed_until timestamp with time zone;
+
+CREATE INDEX idx_trustmesh_entries_uncommitted_created_at ON public.trustmesh_entries USING btree (created_at) WHERE commitment_state = 'UNCOMMITTED';
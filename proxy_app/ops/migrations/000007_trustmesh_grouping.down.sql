@@ -0,0 +1,26 @@
+DROP INDEX public.idx_trustmesh_entries_baseledger_transaction_id;
+DROP INDEX public.idx_trustmesh_entries_parent_trustmesh_entry_id;
+
+ALTER TABLE public.trustmesh_entries DROP COLUMN parent_trustmesh_entry_id;
+
+CREATE OR REPLACE FUNCTION set_trustmesh_entry_group()
+  RETURNS trigger AS
+  $$
+    DECLARE new_trustmesh_id uuid;
+    BEGIN
+      IF NEW.referenced_baseledger_transaction_id = uuid_nil() THEN
+        INSERT INTO trustmeshes VALUES (DEFAULT, DEFAULT) RETURNING id INTO new_trustmesh_id;
+      ELSE 
+        SELECT trustmesh_id INTO new_trustmesh_id FROM trustmesh_entries WHERE baseledger_transaction_id = NEW.referenced_baseledger_transaction_id LIMIT 1;
+      END IF;
+      NEW.trustmesh_id := new_trustmesh_id;
+      RETURN NEW;
+    END;
+  $$
+LANGUAGE plpgsql;
+
+CREATE TRIGGER trustmesh_entry_insert_trigger
+  BEFORE INSERT
+  ON trustmesh_entries
+  FOR EACH ROW
+  EXECUTE PROCEDURE set_trustmesh_entry_group();
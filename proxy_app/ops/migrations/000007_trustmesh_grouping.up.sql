@@ -0,0 +1,41 @@
+-- trustmesh of new entries is assigned by the proxy (TrustmeshEntry.AssignTrustmesh)
+DROP TRIGGER IF EXISTS trustmesh_entry_insert_trigger ON public.trustmesh_entries;
+DROP FUNCTION IF EXISTS set_trustmesh_entry_group();
+
+ALTER TABLE public.trustmesh_entries ADD COLUMN parent_trustmesh_entry_id uuid DEFAULT public.uuid_nil() NOT NULL;
+
+-- parent is the first entry of referenced transaction
+UPDATE public.trustmesh_entries e SET parent_trustmesh_entry_id = (
+  SELECT p.id FROM public.trustmesh_entries p
+  WHERE p.baseledger_transaction_id = e.referenced_baseledger_transaction_id
+  ORDER BY p.created_at ASC
+  LIMIT 1
+)
+WHERE e.referenced_baseledger_transaction_id <> public.uuid_nil()
+AND EXISTS (SELECT 1 FROM public.trustmesh_entries p WHERE p.baseledger_transaction_id = e.referenced_baseledger_transaction_id);
+
+-- trigger left entries without trustmesh when their referenced entry arrived later or never,
+-- entries without parent get their own trustmesh and the others join trustmesh of their parent
+DO $$
+  DECLARE
+    linked integer;
+    orphan record;
+    new_trustmesh_id uuid;
+  BEGIN
+    FOR orphan IN SELECT id, created_at FROM public.trustmesh_entries WHERE trustmesh_id IS NULL AND parent_trustmesh_entry_id = public.uuid_nil() ORDER BY created_at LOOP
+      INSERT INTO public.trustmeshes (id, created_at) VALUES (public.uuid_generate_v4(), orphan.created_at) RETURNING id INTO new_trustmesh_id;
+      UPDATE public.trustmesh_entries SET trustmesh_id = new_trustmesh_id WHERE id = orphan.id;
+    END LOOP;
+
+    LOOP
+      UPDATE public.trustmesh_entries e SET trustmesh_id = p.trustmesh_id
+      FROM public.trustmesh_entries p
+      WHERE e.trustmesh_id IS NULL AND p.id = e.parent_trustmesh_entry_id AND p.trustmesh_id IS NOT NULL;
+      GET DIAGNOSTICS linked = ROW_COUNT;
+      EXIT WHEN linked = 0;
+    END LOOP;
+  END;
+$$;
+
+CREATE INDEX idx_trustmesh_entries_parent_trustmesh_entry_id ON public.trustmesh_entries USING btree (parent_trustmesh_entry_id);
+CREATE INDEX idx_trustmesh_entries_baseledger_transaction_id ON public.trustmesh_entries USING btree (baseledger_transaction_id);
@@ -0,0 +1,12 @@
+DROP INDEX public.idx_trustmeshes_contains_rejections;
+DROP INDEX public.idx_trustmeshes_finalized;
+DROP INDEX public.idx_trustmeshes_created_at;
+DROP INDEX public.idx_trustmeshes_end_time;
+DROP INDEX public.idx_trustmeshes_start_time;
+
+ALTER TABLE public.trustmeshes DROP COLUMN contains_rejections;
+ALTER TABLE public.trustmeshes DROP COLUMN finalized;
+ALTER TABLE public.trustmeshes DROP COLUMN business_object_types;
+ALTER TABLE public.trustmeshes DROP COLUMN participants;
+ALTER TABLE public.trustmeshes DROP COLUMN end_time;
+ALTER TABLE public.trustmeshes DROP COLUMN start_time;
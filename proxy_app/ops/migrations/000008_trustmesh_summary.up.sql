@@ -0,0 +1,59 @@
+-- summary of entries is maintained by the proxy when entries are created and committed (see Trustmesh.AddEntry)
+ALTER TABLE public.trustmeshes ADD COLUMN start_time timestamp with time zone;
+ALTER TABLE public.trustmeshes ADD COLUMN end_time timestamp with time zone;
+ALTER TABLE public.trustmeshes ADD COLUMN participants text DEFAULT '' NOT NULL;
+ALTER TABLE public.trustmeshes ADD COLUMN business_object_types text DEFAULT '' NOT NULL;
+ALTER TABLE public.trustmeshes ADD COLUMN finalized boolean DEFAULT false NOT NULL;
+ALTER TABLE public.trustmeshes ADD COLUMN contains_rejections boolean DEFAULT false NOT NULL;
+
+UPDATE public.trustmeshes t SET
+  start_time = s.start_time,
+  end_time = s.end_time,
+  finalized = s.finalized,
+  contains_rejections = s.contains_rejections
+FROM (
+  SELECT
+    trustmesh_id,
+    MIN(tendermint_transaction_timestamp) AS start_time,
+    MAX(tendermint_transaction_timestamp) AS end_time,
+    bool_or(workstep_type = 'FINALWORKSTEP') AS finalized,
+    bool_or(baseledger_transaction_type = 'REJECT') AS contains_rejections
+  FROM public.trustmesh_entries
+  GROUP BY trustmesh_id
+) s
+WHERE s.trustmesh_id = t.id;
+
+-- distinct names in order of appearance, sender before receiver of each entry
+UPDATE public.trustmeshes t SET participants = p.participants
+FROM (
+  SELECT trustmesh_id, string_agg(organization_name, ', ' ORDER BY first_seen) AS participants
+  FROM (
+    SELECT e.trustmesh_id, o.organization_name, MIN(ARRAY[EXTRACT(EPOCH FROM e.created_at), s.side]) AS first_seen
+    FROM public.trustmesh_entries e
+    CROSS JOIN (VALUES (0), (1)) s(side)
+    JOIN public.organizations o ON o.id = CASE WHEN s.side = 0 THEN e.sender_org_id ELSE e.receiver_org_id END
+    WHERE o.organization_name <> ''
+    GROUP BY e.trustmesh_id, o.organization_name
+  ) names
+  GROUP BY trustmesh_id
+) p
+WHERE p.trustmesh_id = t.id;
+
+UPDATE public.trustmeshes t SET business_object_types = b.business_object_types
+FROM (
+  SELECT trustmesh_id, string_agg(business_object_type, ', ' ORDER BY first_seen) AS business_object_types
+  FROM (
+    SELECT trustmesh_id, business_object_type, MIN(created_at) AS first_seen
+    FROM public.trustmesh_entries
+    WHERE business_object_type <> ''
+    GROUP BY trustmesh_id, business_object_type
+  ) types
+  GROUP BY trustmesh_id
+) b
+WHERE b.trustmesh_id = t.id;
+
+CREATE INDEX idx_trustmeshes_start_time ON public.trustmeshes USING btree (COALESCE(start_time, created_at), id);
+CREATE INDEX idx_trustmeshes_end_time ON public.trustmeshes USING btree (COALESCE(end_time, created_at), id);
+CREATE INDEX idx_trustmeshes_created_at ON public.trustmeshes USING btree (created_at, id);
+CREATE INDEX idx_trustmeshes_finalized ON public.trustmeshes USING btree (finalized);
+CREATE INDEX idx_trustmeshes_contains_rejections ON public.trustmeshes USING btree (contains_rejections);
@@ -0,0 +1 @@
+DROP INDEX public.idx_trustmesh_entries_baseledger_business_object_id;
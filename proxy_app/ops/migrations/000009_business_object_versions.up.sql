@@ -0,0 +1,2 @@
+-- versions of business object are looked up by its id (see GET /business-objects/:bboid/versions)
+CREATE INDEX idx_trustmesh_entries_baseledger_business_object_id ON public.trustmesh_entries USING btree (baseledger_business_object_id);
@@ -0,0 +1,3 @@
+DROP INDEX idx_business_object_schemas_workgroup_id_business_object_type;
+
+DROP TABLE public.business_object_schemas;
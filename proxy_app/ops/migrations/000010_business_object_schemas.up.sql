@@ -0,0 +1,19 @@
+-- JSON Schemas business objects are validated against, per workgroup and business object type
+CREATE TABLE public.business_object_schemas (
+  id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+  created_at timestamp with time zone DEFAULT now() NOT NULL,
+  updated_at timestamp with time zone DEFAULT now() NOT NULL,
+  workgroup_id uuid NOT NULL,
+  business_object_type text NOT NULL,
+  schema text NOT NULL,
+  hash text NOT NULL
+);
+
+ALTER TABLE public.business_object_schemas OWNER TO baseledger;
+
+ALTER TABLE ONLY public.business_object_schemas ADD CONSTRAINT business_object_schemas_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.business_object_schemas
+  ADD CONSTRAINT business_object_schemas_workgroup_id_workgroups_id_foreign FOREIGN KEY (workgroup_id) REFERENCES public.workgroups(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX idx_business_object_schemas_workgroup_id_business_object_type ON public.business_object_schemas USING btree (workgroup_id, business_object_type);
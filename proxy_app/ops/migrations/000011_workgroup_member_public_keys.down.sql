@@ -0,0 +1 @@
+ALTER TABLE public.workgroup_members DROP COLUMN organization_public_key;
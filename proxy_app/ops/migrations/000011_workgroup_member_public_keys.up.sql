@@ -0,0 +1,2 @@
+-- ed25519 public keys envelopes of members received over https and amqp are verified with
+ALTER TABLE public.workgroup_members ADD COLUMN organization_public_key text;
@@ -0,0 +1,3 @@
+ALTER TABLE public.pending_broadcasts DROP COLUMN transaction_hash;
+ALTER TABLE public.pending_broadcasts DROP COLUMN lookup_misses;
+ALTER TABLE public.pending_broadcasts DROP COLUMN recovery_claimed_until;
@@ -0,0 +1,5 @@
+-- recovery claims rows with a lease, counts chain lookups that missed the transaction
+-- and keeps transaction hash when entry could not be updated after broadcast
+ALTER TABLE public.pending_broadcasts ADD COLUMN recovery_claimed_until timestamp with time zone;
+ALTER TABLE public.pending_broadcasts ADD COLUMN lookup_misses integer DEFAULT 0 NOT NULL;
+ALTER TABLE public.pending_broadcasts ADD COLUMN transaction_hash text;
@@ -0,0 +1 @@
+ALTER TABLE public.offchain_process_messages DROP COLUMN business_object_schema_hash;
@@ -0,0 +1,2 @@
+-- hash of schema the sender validated business object of suggestion against, receiver rejects suggestion if it differs
+ALTER TABLE public.offchain_process_messages ADD COLUMN business_object_schema_hash text;
@@ -0,0 +1,7 @@
+// Package migrations embeds schema migrations so that proxy and proxyctl do not depend on working directory
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
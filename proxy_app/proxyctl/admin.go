@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/admin"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+func runAdmin(client admin.IAdmin, command string, args []string) {
+	if len(args) == 0 {
+		exitWithUsage()
+	}
+
+	ctx := context.Background()
+	var err error
+	switch command + " " + args[0] {
+	case "org list":
+		expectArgs(args, 1)
+		err = listOrganizations(ctx, client)
+	case "org create":
+		expectArgs(args, 2)
+		err = printCreated(client.CreateOrganization(ctx, admin.Organization{Name: args[1]}))
+	case "org delete":
+		expectArgs(args, 2)
+		err = client.DeleteOrganization(ctx, parseId(args[1]))
+	case "workgroup list":
+		expectArgs(args, 1)
+		err = listWorkgroups(ctx, client)
+	case "workgroup create":
+		expectArgs(args, 4)
+		err = printCreated(client.CreateWorkgroup(ctx, admin.Workgroup{Id: parseId(args[1]), Name: args[2], Key: args[3]}))
+	case "workgroup delete":
+		expectArgs(args, 2)
+		err = client.DeleteWorkgroup(ctx, parseId(args[1]))
+	case "member list":
+		expectArgs(args, 2)
+		err = listWorkgroupMembers(ctx, client, parseId(args[1]))
+	case "member add":
+		if len(args) != 5 && len(args) != 6 {
+			exitWithUsage()
+		}
+		member := admin.WorkgroupMember{
+			WorkgroupId:          parseId(args[1]).String(),
+			OrganizationId:       parseId(args[2]).String(),
+			OrganizationEndpoint: args[3],
+			OrganizationToken:    args[4],
+		}
+		if len(args) == 6 {
+			member.OrganizationPublicKey = args[5]
+		}
+		err = printCreated(client.CreateWorkgroupMember(ctx, member))
+	case "member remove":
+		expectArgs(args, 3)
+		err = client.DeleteWorkgroupMember(ctx, parseId(args[1]), parseId(args[2]))
+	case "webhook list":
+		expectArgs(args, 1)
+		err = listWebhooks(ctx, client)
+	case "webhook create":
+		expectArgs(args, 2)
+		err = createWebhook(ctx, client, args[1])
+	case "webhook delete":
+		expectArgs(args, 2)
+		err = client.DeleteWebhook(ctx, parseId(args[1]))
+	case "trustmesh show":
+		expectArgs(args, 2)
+		err = showTrustmesh(ctx, client, args[1])
+	case "trustmesh verify":
+		expectArgs(args, 2)
+		err = verifyTrustmesh(ctx, client, args[1])
+	case "trustmesh export":
+		if len(args) != 2 && len(args) != 3 {
+			exitWithUsage()
+		}
+		err = exportTrustmesh(ctx, client, args[1], args[2:])
+	case "entry rerun":
+		expectArgs(args, 2)
+		err = rerunEntry(ctx, client, parseId(args[1]))
+	case "entry resend":
+		expectArgs(args, 2)
+		err = client.ResendOffchainMessage(ctx, parseId(args[1]))
+	case "entry list":
+		expectArgs(args, 2)
+		err = listEntries(ctx, client, args[1])
+	case "entry retry":
+		expectArgs(args, 3)
+		err = printProcessing(client.RetryEntry(ctx, parseId(args[1]), args[2]))
+	case "entry skip":
+		expectArgs(args, 3)
+		err = printProcessing(client.SkipEntry(ctx, parseId(args[1]), args[2]))
+	case "entry resolve":
+		expectArgs(args, 3)
+		err = printProcessing(client.ResolveEntry(ctx, parseId(args[1]), args[2]))
+	case "entry finish-broadcast":
+		expectArgs(args, 4)
+		err = printProcessing(client.FinishBroadcast(ctx, parseId(args[1]), args[2], args[3]))
+	case "entry abandon-broadcast":
+		expectArgs(args, 3)
+		err = client.AbandonBroadcast(ctx, parseId(args[1]), args[2])
+	default:
+		exitWithUsage()
+	}
+
+	if err != nil {
+		exitWithError(err)
+	}
+}
+
+func listOrganizations(ctx context.Context, client admin.IAdmin) error {
+	organizations, err := client.GetOrganizations(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := newTable("ID", "NAME")
+	for _, organization := range organizations {
+		fmt.Fprintf(w, "%v\t%v\n", organization.Id, organization.Name)
+	}
+	return w.Flush()
+}
+
+func listWorkgroups(ctx context.Context, client admin.IAdmin) error {
+	workgroups, err := client.GetWorkgroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	// privatize key is secret and not printed, it is part of workgroup list response of the api
+	w := newTable("ID", "NAME")
+	for _, workgroup := range workgroups {
+		fmt.Fprintf(w, "%v\t%v\n", workgroup.Id, workgroup.Name)
+	}
+	return w.Flush()
+}
+
+func listWorkgroupMembers(ctx context.Context, client admin.IAdmin, workgroupId uuid.UUID) error {
+	members, err := client.GetWorkgroupMembers(ctx, workgroupId)
+	if err != nil {
+		return err
+	}
+
+	w := newTable("ID", "ORGANIZATION ID", "ENDPOINT")
+	for _, member := range members {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", member.Id, member.OrganizationId, member.OrganizationEndpoint)
+	}
+	return w.Flush()
+}
+
+func listWebhooks(ctx context.Context, client admin.IAdmin) error {
+	webhooks, err := client.GetWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := newTable("ID", "TYPE", "METHOD", "URL")
+	for _, webhook := range webhooks {
+		webhookType := "create"
+		if webhook.WebhookType == types.UpdateObject {
+			webhookType = "update"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", webhook.Id, webhookType, webhook.HttpMethod, webhook.Url)
+	}
+	return w.Flush()
+}
+
+func createWebhook(ctx context.Context, client admin.IAdmin, file string) error {
+	var in io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	buf, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	webhook := admin.Webhook{}
+	if err = json.Unmarshal(buf, &webhook); err != nil {
+		return fmt.Errorf("invalid webhook json %v", err.Error())
+	}
+
+	return printCreated(client.CreateWebhook(ctx, webhook))
+}
+
+func showTrustmesh(ctx context.Context, client admin.IAdmin, idOrBboid string) error {
+	trustmesh, err := client.GetTrustmesh(ctx, idOrBboid)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("trustmesh %v created %v\n", trustmesh.Id, trustmesh.CreatedAt.Format("2006-01-02 15:04:05"))
+	if trustmesh.EthExitTxHash != "" {
+		fmt.Printf("exited to ethereum in %v\n", trustmesh.EthExitTxHash)
+	}
+
+	w := newTable("CREATED", "ENTRY ID", "TYPE", "WORKSTEP", "TRANSACTION", "STATE", "PROCESSING", "BBOID", "TX HASH")
+	for _, entry := range trustmesh.Entries {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			entry.CreatedAt.Format("2006-01-02 15:04:05"),
+			entry.Id,
+			entry.EntryType,
+			entry.WorkstepType,
+			entry.BaseledgerTransactionType,
+			entry.CommitmentState,
+			entry.ProcessingState,
+			entry.BaseledgerBusinessObjectId,
+			entry.TransactionHash)
+	}
+	return w.Flush()
+}
+
+func verifyTrustmesh(ctx context.Context, client admin.IAdmin, idOrBboid string) error {
+	verification, err := client.VerifyTrustmesh(ctx, idOrBboid)
+	if err != nil {
+		return err
+	}
+
+	w := newTable("ENTRY ID", "TYPE", "STATE", "RESULT")
+	for _, entry := range verification.Entries {
+		result := "verified"
+		if !entry.Verified {
+			result = entry.Error
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", entry.EntryId, entry.EntryType, entry.CommitmentState, result)
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	if !verification.Verified {
+		return fmt.Errorf("trustmesh %v does not match proofs on chain", verification.TrustmeshId)
+	}
+	fmt.Printf("trustmesh %v matches proofs on chain\n", verification.TrustmeshId)
+	return nil
+}
+
+func exportTrustmesh(ctx context.Context, client admin.IAdmin, idOrBboid string, file []string) error {
+	bundle, err := client.ExportTrustmesh(ctx, idOrBboid)
+	if err != nil {
+		return err
+	}
+
+	if len(file) == 1 && strings.HasSuffix(file[0], ".zip") {
+		archive := &bytes.Buffer{}
+		if err = bundle.WriteZip(archive); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file[0], archive.Bytes(), 0600)
+	}
+
+	out, err := json.MarshalIndent(bundle, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if len(file) == 0 {
+		fmt.Println(string(out))
+		return nil
+	}
+
+	return ioutil.WriteFile(file[0], out, 0600)
+}
+
+func rerunEntry(ctx context.Context, client admin.IAdmin, entryId uuid.UUID) error {
+	entry, err := client.RerunEntry(ctx, entryId)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("trustmesh entry %v is %v\n", entry.Id, entry.CommitmentState)
+	return nil
+}
+
+func listEntries(ctx context.Context, client admin.IAdmin, processingState string) error {
+	entries, err := client.GetEntriesByProcessingState(ctx, processingState)
+	if err != nil {
+		return err
+	}
+
+	w := newTable("CREATED", "ENTRY ID", "TRUSTMESH ID", "TYPE", "ATTEMPTS", "NEXT RETRY", "LAST ERROR")
+	for _, entry := range entries {
+		nextRetry := ""
+		if entry.ProcessingNextRetryAt.Valid {
+			nextRetry = entry.ProcessingNextRetryAt.Time.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			entry.CreatedAt.Format("2006-01-02 15:04:05"),
+			entry.Id,
+			entry.TrustmeshId,
+			entry.EntryType,
+			entry.ProcessingAttempts,
+			nextRetry,
+			entry.ProcessingLastError)
+	}
+	return w.Flush()
+}
+
+func printProcessing(entry *types.TrustmeshEntry, err error) error {
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("trustmesh entry %v is %v, processing %v\n", entry.Id, entry.CommitmentState, entry.ProcessingState)
+	return nil
+}
+
+func printCreated(id uuid.UUID, err error) error {
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(id.String())
+	return nil
+}
+
+func newTable(columns ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, column := range columns {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, column)
+	}
+	fmt.Fprintln(w)
+	return w
+}
+
+func parseId(arg string) uuid.UUID {
+	id, err := uuid.FromString(arg)
+	if err != nil {
+		exitWithError(fmt.Errorf("invalid id %v", arg))
+	}
+
+	return id
+}
+
+func expectArgs(args []string, count int) {
+	if len(args) != count {
+		exitWithUsage()
+	}
+}
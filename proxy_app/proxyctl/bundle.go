@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/unibrightio/proxy-api/admin"
+)
+
+// runBundle works only with the bundle file, neither db nor api of the proxy are needed
+func runBundle(args []string) {
+	if len(args) == 0 || args[0] != "verify" {
+		exitWithUsage()
+	}
+
+	flags := flag.NewFlagSet("bundle verify", flag.ExitOnError)
+	flags.Usage = exitWithUsage
+	publicKey := flags.String("public-key", "", "hex encoded public key the bundle has to be signed with")
+	workgroupKey := flags.String("workgroup-key", "", "privatize key of workgroup, decrypts proofs stored on chain")
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		exitWithUsage()
+	}
+
+	if err := verifyBundle(flags.Arg(0), *publicKey, *workgroupKey); err != nil {
+		exitWithError(err)
+	}
+}
+
+func verifyBundle(file string, publicKey string, workgroupKey string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	signed, err := admin.ReadSignedAuditBundle(data)
+	if err != nil {
+		return err
+	}
+
+	verification := admin.VerifyAuditBundle(signed, publicKey, workgroupKey)
+	if verification.Error != "" {
+		return fmt.Errorf("audit bundle is not verified: %v", verification.Error)
+	}
+
+	w := newTable("ENTRY ID", "TYPE", "STATE", "RESULT")
+	for _, entry := range verification.Entries {
+		result := "verified"
+		if entry.PartiallyVerified {
+			result = "matches proof in bundle, not compared with chain"
+		} else if !entry.Verified {
+			result = entry.Error
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", entry.EntryId, entry.EntryType, entry.CommitmentState, result)
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("signed with key %v\n", signed.PublicKey)
+	if !verification.RootProofVerified {
+		return fmt.Errorf("root proof of trustmesh %v does not match its entries", verification.TrustmeshId)
+	}
+	if !verification.Verified && !verification.PartiallyVerified {
+		return fmt.Errorf("trustmesh %v does not match proofs in bundle", verification.TrustmeshId)
+	}
+	if !verification.SignerChecked {
+		fmt.Println("signer was not checked, compare the key with the one published by the exporting organization or pass --public-key")
+	}
+	if !verification.ChainProofsChecked {
+		fmt.Println("proofs on chain were not compared, they can be decrypted with --workgroup-key")
+	}
+	if !verification.Verified {
+		return fmt.Errorf("trustmesh %v is only partially verified, bundle matches itself", verification.TrustmeshId)
+	}
+	fmt.Printf("trustmesh %v is verified\n", verification.TrustmeshId)
+	return nil
+}
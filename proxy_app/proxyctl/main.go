@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/unibrightio/proxy-api/admin"
+	"github.com/unibrightio/proxy-api/config"
+	"github.com/unibrightio/proxy-api/dbutil"
+	"github.com/unibrightio/proxy-api/logger"
+)
+
+const usage = `usage: proxyctl [--api URL] [--user USER] [--password PASSWORD] <command> [arguments]
+
+commands:
+  migrate up [N]         apply N pending migrations, all if N is omitted
+  migrate down [N]       revert N applied migrations, 1 if N is omitted
+  migrate status         print schema version and embedded migrations
+  migrate force VERSION  set schema version and clear dirty flag without running migrations
+
+  org list
+  org create NAME
+  org delete ID
+
+  workgroup list
+  workgroup create ID NAME PRIVATIZE_KEY
+  workgroup delete ID
+
+  member list WORKGROUP_ID
+  member add WORKGROUP_ID ORGANIZATION_ID ENDPOINT TOKEN [PUBLIC_KEY]
+                                    ENDPOINT is nats host:port or nats://, https:// or amqp(s):// url,
+                                    PUBLIC_KEY is hex ed25519 key envelopes of https and amqp are verified with
+  member remove WORKGROUP_ID MEMBER_ID
+
+  webhook list
+  webhook create FILE    create sor webhook from json file in format of POST /sorwebhook, - reads stdin
+  webhook delete ID
+
+  trustmesh show ID|BBOID           print trustmesh by id or business object id of one of its entries
+  trustmesh verify ID|BBOID         check committed entries against proofs on chain, exits with 1 if any does not match
+  trustmesh export ID|BBOID [FILE]  write signed trustmesh audit bundle as json, or zip if FILE ends with .zip,
+                                    to stdout if FILE is omitted
+
+  bundle verify [--public-key KEY] [--workgroup-key KEY] FILE
+                         check signature, root proof and sync trees of exported audit bundle without db or api,
+                         sync trees are compared with proofs on chain if workgroup key is given,
+                         without both keys bundle is only partially verified and it exits with 1
+
+  entry rerun ENTRY_ID   look up transaction of entry on chain and run business logic for it again
+  entry resend ENTRY_ID  send offchain message of committed sent suggestion or feedback again
+  entry list STATE       list entries in processing state PENDING, PROCESSING, COMMITTED, FAILED or DEAD
+  entry retry ENTRY_ID REASON    make failed or dead entry pending again, it is processed on next poll
+  entry skip ENTRY_ID REASON     mark entry dead without running business logic
+  entry resolve ENTRY_ID REASON  mark entry committed without running business logic
+  entry finish-broadcast ENTRY_ID TX_HASH REASON
+                         move entry whose transaction recovery found on chain without hash (UNCONFIRMED
+                         pending broadcast) to uncommitted with the hash looked up on chain
+  entry abandon-broadcast ENTRY_ID REASON
+                         remove such entry with its offchain message, as when broadcast fails
+
+by default proxyctl works directly against the db and configuration is read the same way as by proxy
+(.env, PROXY_CONFIG_FILE and environment). with --api (or PROXYCTL_API_URL) all commands except migrate
+are sent to the api of running proxy, basic auth credentials default to API_UB_USER and API_UB_PWD.
+bundle verify needs neither.
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	apiUrl := flag.String("api", os.Getenv("PROXYCTL_API_URL"), "url of proxy api")
+	user := flag.String("user", os.Getenv("API_UB_USER"), "api basic auth user")
+	password := flag.String("password", os.Getenv("API_UB_PWD"), "api basic auth password")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 {
+		exitWithUsage()
+	}
+
+	switch args[0] {
+	case "migrate":
+		if *apiUrl != "" {
+			exitWithError(fmt.Errorf("migrate works only directly against the db"))
+		}
+		setupConfig()
+		runMigrate(args[1:])
+	case "org", "workgroup", "member", "webhook", "trustmesh", "entry":
+		var client admin.IAdmin
+		if *apiUrl != "" {
+			client = admin.NewApiClient(*apiUrl, *user, *password)
+		} else {
+			setupConfig()
+			dbutil.InitConnection()
+			client = admin.NewService()
+		}
+		runAdmin(client, args[0], args[1:])
+	case "bundle":
+		runBundle(args[1:])
+	case "help":
+		fmt.Print(usage)
+	default:
+		exitWithUsage()
+	}
+}
+
+func setupConfig() {
+	_, err := config.Load(".env")
+	if err != nil {
+		exitWithError(err)
+	}
+
+	logger.SetupLogger()
+}
+
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+func exitWithUsage() {
+	fmt.Fprint(os.Stderr, usage)
+	os.Exit(2)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/unibrightio/proxy-api/dbutil"
+)
+
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		exitWithUsage()
+	}
+
+	var err error
+	switch args[0] {
+	case "up":
+		err = dbutil.MigrateUp(optionalCount(args[1:], 0))
+	case "down":
+		err = dbutil.MigrateDown(optionalCount(args[1:], 1))
+	case "status":
+		err = printMigrationStatus()
+	case "force":
+		if len(args) != 2 {
+			exitWithUsage()
+		}
+		version, parseErr := strconv.Atoi(args[1])
+		if parseErr != nil {
+			exitWithError(fmt.Errorf("invalid version %v", args[1]))
+		}
+		err = dbutil.ForceMigrationVersion(version)
+	default:
+		exitWithUsage()
+	}
+
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if args[0] != "status" {
+		if err = printMigrationStatus(); err != nil {
+			exitWithError(err)
+		}
+	}
+}
+
+func printMigrationStatus() error {
+	status, err := dbutil.GetMigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	dirty := ""
+	if status.Dirty {
+		dirty = " (dirty)"
+	}
+	fmt.Printf("schema version %v%v, latest migration %v\n", status.Version, dirty, status.Latest)
+
+	for _, version := range status.Migrations {
+		state := "pending"
+		if version <= status.Version {
+			state = "applied"
+		}
+		fmt.Printf("  %06d %v\n", version, state)
+	}
+
+	return nil
+}
+
+func optionalCount(args []string, defaultCount int) int {
+	if len(args) == 0 {
+		return defaultCount
+	}
+
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count <= 0 || len(args) > 1 {
+		exitWithUsage()
+	}
+
+	return count
+}
@@ -1,6 +1,7 @@
 package proxyutil
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/md5"
@@ -10,18 +11,23 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	uuid "github.com/kthomas/go.uuid"
-	"github.com/spf13/viper"
 
 	// "github.com/cosmos/cosmos-sdk/client/tx"
 
+	"github.com/unibrightio/proxy-api/config"
 	"github.com/unibrightio/proxy-api/logger"
 	"github.com/unibrightio/proxy-api/messaging"
+	"github.com/unibrightio/proxy-api/tracing"
 	"github.com/unibrightio/proxy-api/types"
 	"github.com/unibrightio/proxy-api/workgroups"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var proxyutilLog = logger.For("proxyutil")
+
 type workgroupMock struct {
 	BaselineWorkgroupID uuid.UUID
 	Description         string
@@ -47,7 +53,7 @@ func NewBaseledgerProxy() BaseledgerProxy {
 	proxy := BaseledgerProxy{}
 	proxy.config = BaseledgerProxyConfig{"das connection string"}
 
-	proxy.messagingClient = &messaging.NatsMessagingClient{}
+	proxy.messagingClient = messaging.NewClient(nil)
 	// proxy.messagingClient.Subscribe("local server conn string", "token", "baseledger", receiveOffchainProcessMessage)
 
 	proxy.workgroupClient = &workgroups.PostgresWorkgroupClient{}
@@ -63,7 +69,14 @@ func CreateNewSuggestionBaseledgerTransactionPayload(
 	// should we load workgroup at start and keep it in memory, we are querying it all the time and it won't change
 	workgroupClient := &workgroups.PostgresWorkgroupClient{}
 	workgroup := workgroupClient.FindWorkgroup(newSuggestionRequest.WorkgroupId.String())
+	return CreateNewSuggestionBaseledgerTransactionPayloadForWorkgroup(workgroup, newSuggestionRequest, offchainProcessMessage)
+}
 
+func CreateNewSuggestionBaseledgerTransactionPayloadForWorkgroup(
+	workgroup *types.Workgroup,
+	newSuggestionRequest *types.NewSuggestionRequest,
+	offchainProcessMessage *types.OffchainProcessMessage,
+) string {
 	payload := &types.BaseledgerTransactionPayload{
 		SenderId:                   offchainProcessMessage.SenderId.String(),
 		TransactionType:            offchainProcessMessage.BaseledgerTransactionType,
@@ -73,11 +86,11 @@ func CreateNewSuggestionBaseledgerTransactionPayload(
 		BaseledgerBusinessObjectId: newSuggestionRequest.BaseledgerBusinessObjectId,
 	}
 
-	logger.Infof("\n payload %v \n", *payload)
 	enc := privatizePayload(payload, workgroup.PrivatizeKey)
-	logger.Infof("enc %s\n\n", enc)
-	dec := deprivatizePayload(enc, workgroup.PrivatizeKey)
-	logger.Infof("dec %s\n", dec)
+	proxyutilLog.Debug("baseledger transaction payload privatized",
+		logger.F("baseledger_transaction_id", payload.BaseledgerTransactionId),
+		logger.Payload("payload", *payload),
+	)
 
 	return enc
 }
@@ -89,6 +102,14 @@ func CreateExitBaseledgerTransactionPayload(
 ) string {
 	workgroupClient := &workgroups.PostgresWorkgroupClient{}
 	workgroup := workgroupClient.FindWorkgroup(workgroupId.String())
+	return CreateExitBaseledgerTransactionPayloadForWorkgroup(workgroup, baseledgerTransactionId, rootProof)
+}
+
+func CreateExitBaseledgerTransactionPayloadForWorkgroup(
+	workgroup *types.Workgroup,
+	baseledgerTransactionId uuid.UUID,
+	rootProof string,
+) string {
 	payload := &types.BaseledgerTransactionExitPayload{
 		RootProof:               rootProof,
 		BaseledgerTransactionId: baseledgerTransactionId.String(),
@@ -103,9 +124,17 @@ func CreateNewFeedbackBaseledgerTransactionPayload(
 ) string {
 	workgroupClient := &workgroups.PostgresWorkgroupClient{}
 	workgroup := workgroupClient.FindWorkgroup(newFeedbackRequest.WorkgroupId.String())
+	return CreateNewFeedbackBaseledgerTransactionPayloadForWorkgroup(workgroup, config.Get().OrganizationId, newFeedbackRequest, offchainProcessMessage)
+}
 
+func CreateNewFeedbackBaseledgerTransactionPayloadForWorkgroup(
+	workgroup *types.Workgroup,
+	senderId string,
+	newFeedbackRequest *types.NewFeedbackRequest,
+	offchainProcessMessage *types.OffchainProcessMessage,
+) string {
 	payload := &types.BaseledgerTransactionPayload{
-		SenderId:                             viper.Get("ORGANIZATION_ID").(string),
+		SenderId:                             senderId,
 		TransactionType:                      offchainProcessMessage.BaseledgerTransactionType,
 		OffchainMessageId:                    offchainProcessMessage.Id.String(),
 		ReferencedBaseledgerTransactionId:    newFeedbackRequest.OriginalBaseledgerTransactionId,
@@ -115,33 +144,61 @@ func CreateNewFeedbackBaseledgerTransactionPayload(
 		ReferencedBaseledgerBusinessObjectId: offchainProcessMessage.ReferencedBaseledgerBusinessObjectId,
 	}
 
-	logger.Infof("\n payload %v \n", *payload)
 	enc := privatizePayload(payload, workgroup.PrivatizeKey)
-	logger.Infof("enc %s\n\n", enc)
-	dec := deprivatizePayload(enc, workgroup.PrivatizeKey)
-	logger.Infof("dec %s\n", dec)
+	proxyutilLog.Debug("baseledger transaction payload privatized",
+		logger.F("baseledger_transaction_id", payload.BaseledgerTransactionId),
+		logger.Payload("payload", *payload),
+	)
 
 	return enc
 }
 
-func SendOffchainMessage(payload []byte, workgroupId string, recipientId string, subject string) (err error) {
-	workgroupClient := &workgroups.PostgresWorkgroupClient{}
+var defaultMessagingClient messaging.IMessagingClient
+var defaultMessagingClientOnce sync.Once
+
+// SendOffchainMessage sends message to workgroup member with messaging client of configured organization,
+// the client is built with the first message and shared by all of them
+func SendOffchainMessage(ctx context.Context, payload []byte, workgroupId string, recipientId string, subject string) (err error) {
+	defaultMessagingClientOnce.Do(func() {
+		defaultMessagingClient = messaging.NewClient(nil)
+	})
+	return SendOffchainMessageWith(ctx, &workgroups.PostgresWorkgroupClient{}, defaultMessagingClient, payload, workgroupId, recipientId, subject)
+}
+
+// SendOffchainMessageWith sends message to workgroup member using given clients
+func SendOffchainMessageWith(
+	ctx context.Context,
+	workgroupClient workgroups.IWorkgroupClient,
+	messagingClient messaging.IMessagingClient,
+	payload []byte,
+	workgroupId string,
+	recipientId string,
+	subject string,
+) (err error) {
+	_, span := tracing.StartWithKind(ctx, "SendOffchainMessage", trace.SpanKindProducer,
+		tracing.WorkgroupIdKey.String(workgroupId),
+		tracing.NatsSubjectKey.String(subject),
+	)
+	defer span.End()
 
 	logger.Infof("trying to find workgroup member - workgroup id: %s recipient id: %s \n", workgroupId, recipientId)
 	workgroupMembership := workgroupClient.FindWorkgroupMember(workgroupId, recipientId)
 
 	if workgroupMembership == nil {
+		tracing.Fail(span, "workgroup member not found")
 		return errors.New("failed to find a workgroup member")
 	}
 
-	logger.Infof("trying to message on url: %s with token: %s\n", workgroupMembership.OrganizationEndpoint, workgroupMembership.OrganizationToken)
+	proxyutilLog.Ctx(ctx).Info("sending offchain message", logger.F("recipient", workgroupMembership.OrganizationEndpoint), logger.F("subject", subject))
 
-	messagingClient := &messaging.NatsMessagingClient{}
-	messagingClient.SendMessage(
-		payload,
+	err = messagingClient.SendMessage(
+		messaging.Envelope{WorkgroupId: workgroupId, RecipientId: recipientId, Subject: subject, Payload: payload},
 		workgroupMembership.OrganizationEndpoint,
-		workgroupMembership.OrganizationToken,
-		subject)
+		workgroupMembership.OrganizationToken)
+	if err != nil {
+		tracing.Fail(span, err.Error())
+		return fmt.Errorf("failed to send offchain message %w", err)
+	}
 
 	return nil
 }
@@ -154,9 +211,18 @@ func CreateHashFromBusinessObject(bo string) string {
 func DeprivatizeBaseledgerTransactionPayload(payload string, workgroupId uuid.UUID) string {
 	workgroupClient := &workgroups.PostgresWorkgroupClient{}
 	workgroup := workgroupClient.FindWorkgroup(workgroupId.String())
+	return DeprivatizeBaseledgerTransactionPayloadForWorkgroup(payload, workgroup)
+}
+
+func DeprivatizeBaseledgerTransactionPayloadForWorkgroup(payload string, workgroup *types.Workgroup) string {
 	return deprivatizePayload(payload, workgroup.PrivatizeKey)
 }
 
+// PrivatizeBaseledgerTransactionPayloadForWorkgroup encrypts payload the way it is stored on chain
+func PrivatizeBaseledgerTransactionPayloadForWorkgroup(payload *types.BaseledgerTransactionPayload, workgroup *types.Workgroup) string {
+	return privatizePayload(payload, workgroup.PrivatizeKey)
+}
+
 func privatizePayload(payload *types.BaseledgerTransactionPayload, key string) string {
 	payloadJson, _ := json.Marshal(payload)
 	return encrypt(string(payloadJson), key)
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ulule/limiter/v3"
+	"github.com/unibrightio/proxy-api/config"
+)
+
+// ErrBudgetExceeded is returned when no budget is left in the current window
+var ErrBudgetExceeded = errors.New("rate limit exceeded")
+
+type identityContextKey struct{}
+
+// WithIdentity stores the verified caller identity, so budgets consumed deeper in the call chain
+// are tracked for the same key as the route middleware
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// Budget enforces a policy outside of http middleware, i.e. right where tokens are spent.
+// Unlike the api middleware it fails closed, an unavailable store consumes no budget but blocks the call
+type Budget struct {
+	Policy   Policy
+	instance *limiter.Limiter
+}
+
+func NewBudget(policy Policy, store limiter.Store) *Budget {
+	return &Budget{Policy: policy, instance: limiter.New(store, policy.Rate)}
+}
+
+// NewBroadcastBudget returns budget of broadcast policy shared with BroadcastRateLimit middleware
+func NewBroadcastBudget() *Budget {
+	policy := LoadPolicy(BroadcastPolicy)
+	return NewBudget(policy, NewPostgresStore(policy.Name+":"))
+}
+
+// Take consumes one unit of budget, returns ErrBudgetExceeded when nothing is left
+func (b *Budget) Take(ctx context.Context) error {
+	limitContext, err := b.instance.Get(ctx, b.key(ctx))
+	if err != nil {
+		return err
+	}
+	if limitContext.Reached {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+// Peek returns the state of budget without consuming it
+func (b *Budget) Peek(ctx context.Context) (limiter.Context, error) {
+	return b.instance.Peek(ctx, b.key(ctx))
+}
+
+// key falls back to organization when no identity is known, i.e. for calls started by cron
+func (b *Budget) key(ctx context.Context) string {
+	if identity, ok := ctx.Value(identityContextKey{}).(string); ok && identity != "" {
+		return string(b.Policy.KeyBy) + ":" + identity
+	}
+	return string(KeyByOrg) + ":" + config.Get().OrganizationId
+}
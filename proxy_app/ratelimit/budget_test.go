@@ -0,0 +1,32 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ulule/limiter/v3"
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+)
+
+func TestGivenBudgetWhenTakenOverLimitThenItFailsPerIdentity(t *testing.T) {
+	budget := NewBudget(Policy{Name: BroadcastPolicy, Rate: limiter.Rate{Period: time.Minute, Limit: 2}, KeyBy: KeyByUser}, memory.NewStore())
+	alice := WithIdentity(context.Background(), "alice")
+
+	for i := 0; i < 2; i++ {
+		if err := budget.Take(alice); err != nil {
+			t.Fatalf("expected budget to be available, got %v", err)
+		}
+	}
+	if err := budget.Take(alice); err != ErrBudgetExceeded {
+		t.Fatalf("expected budget to be exceeded, got %v", err)
+	}
+	if limitContext, _ := budget.Peek(alice); limitContext.Remaining != 0 {
+		t.Fatalf("expected no remaining budget, got %v", limitContext.Remaining)
+	}
+
+	// calls without identity, i.e. from cron, share the budget of organization
+	if err := budget.Take(context.Background()); err != nil {
+		t.Fatalf("expected organization budget to be available, got %v", err)
+	}
+}
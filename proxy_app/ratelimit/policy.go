@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"github.com/ulule/limiter/v3"
+	"github.com/unibrightio/proxy-api/config"
+)
+
+// KeyType defines which identity a rate limit budget is tracked for
+type KeyType string
+
+const (
+	KeyByIp     KeyType = "ip"     // client ip address
+	KeyByApiKey KeyType = "apikey" // basic auth api user
+	KeyByUser   KeyType = "user"   // jwt user email, falls back to api key
+	KeyByOrg    KeyType = "org"    // one budget for the whole organization running this proxy
+)
+
+const ApiPolicy = "api"
+const BroadcastPolicy = "broadcast"
+const DevPolicy = "dev"
+
+type Policy struct {
+	Name  string
+	Rate  limiter.Rate
+	KeyBy KeyType
+}
+
+// LoadPolicy reads rate (in limiter format, i.e. 10-M, 1000-H, 10-D) and key type for the given policy,
+// see RATE_LIMIT_<POLICY> and RATE_LIMIT_<POLICY>_KEY settings
+func LoadPolicy(name string) Policy {
+	rateLimitConfig := config.Get().RateLimit
+
+	formattedRate, keyBy := rateLimitConfig.Api, rateLimitConfig.ApiKey
+	switch name {
+	case BroadcastPolicy:
+		formattedRate, keyBy = rateLimitConfig.Broadcast, rateLimitConfig.BroadcastKey
+	case DevPolicy:
+		formattedRate, keyBy = rateLimitConfig.Dev, rateLimitConfig.DevKey
+	}
+
+	// format is validated when configuration is loaded
+	rate, _ := limiter.NewRateFromFormatted(formattedRate)
+
+	return Policy{
+		Name:  name,
+		Rate:  rate,
+		KeyBy: KeyType(keyBy),
+	}
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/ulule/limiter/v3"
+	"github.com/ulule/limiter/v3/drivers/store/common"
+	"github.com/unibrightio/proxy-api/dbutil"
+	"github.com/unibrightio/proxy-api/logger"
+)
+
+// PostgresStore keeps limiter counters in the rate_limits table so limits
+// survive restarts and are shared between all proxy replicas using the same db
+type PostgresStore struct {
+	prefix string
+	conn   func() *gorm.DB
+}
+
+func NewPostgresStore(prefix string) *PostgresStore {
+	return &PostgresStore{prefix: prefix, conn: func() *gorm.DB { return dbutil.Db.GetConn() }}
+}
+
+// Get increments the counter for the given key and returns the resulting limit context.
+// Counter increment and window reset happen in a single upsert, so concurrent requests
+// from multiple instances can not lose updates
+func (s *PostgresStore) Get(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	now := time.Now()
+	expiration := now.Add(rate.Period)
+
+	row := s.conn().Raw(`
+		INSERT INTO rate_limits (key, count, expires_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limits.expires_at <= ? THEN 1 ELSE rate_limits.count + 1 END,
+			expires_at = CASE WHEN rate_limits.expires_at <= ? THEN EXCLUDED.expires_at ELSE rate_limits.expires_at END
+		RETURNING count, expires_at`,
+		s.prefix+key, expiration, now, now).Row()
+
+	var count int64
+	if err := row.Scan(&count, &expiration); err != nil {
+		logger.Errorf("error incrementing rate limit for key %v %v", key, err.Error())
+		return limiter.Context{}, err
+	}
+
+	return common.GetContextFromState(now, rate, expiration, count), nil
+}
+
+// Peek returns the limit context for the given key without incrementing the counter
+func (s *PostgresStore) Peek(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	now := time.Now()
+	expiration := now.Add(rate.Period)
+
+	var count int64
+	row := s.conn().Raw("SELECT count, expires_at FROM rate_limits WHERE key = ? AND expires_at > ?", s.prefix+key, now).Row()
+	if err := row.Scan(&count, &expiration); err == sql.ErrNoRows {
+		// no active window yet, nothing consumed
+		return common.GetContextFromState(now, rate, now.Add(rate.Period), 0), nil
+	} else if err != nil {
+		logger.Errorf("error reading rate limit for key %v %v", key, err.Error())
+		return limiter.Context{}, err
+	}
+
+	return common.GetContextFromState(now, rate, expiration, count), nil
+}
+
+// Reset removes the counter for the given key
+func (s *PostgresStore) Reset(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	now := time.Now()
+
+	res := s.conn().Exec("DELETE FROM rate_limits WHERE key = ?", s.prefix+key)
+	if res.Error != nil {
+		logger.Errorf("error resetting rate limit for key %v %v", key, res.Error.Error())
+		return limiter.Context{}, res.Error
+	}
+
+	return common.GetContextFromState(now, rate, now.Add(rate.Period), 0), nil
+}
+
+// DeleteExpired removes counters whose window is over, called periodically from cron
+func DeleteExpired() {
+	res := dbutil.Db.GetConn().Exec("DELETE FROM rate_limits WHERE expires_at <= ?", time.Now())
+	if res.Error != nil {
+		logger.Errorf("error deleting expired rate limits %v", res.Error.Error())
+		return
+	}
+
+	logger.Infof("deleted %v expired rate limits", res.RowsAffected)
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/ulule/limiter/v3"
+)
+
+func mockedStore(t *testing.T) (*PostgresStore, sqlmock.Sqlmock) {
+	sqlDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating sql mock failed %v", err)
+	}
+	db, err := gorm.Open("postgres", sqlDb)
+	if err != nil {
+		t.Fatalf("opening gorm failed %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &PostgresStore{prefix: "broadcast:", conn: func() *gorm.DB { return db }}, mock
+}
+
+func TestGivenKeyWhenGetThenCounterIsUpsertedWithWindowResetAndReturnedStateIsUsed(t *testing.T) {
+	store, mock := mockedStore(t)
+	rate := limiter.Rate{Period: time.Minute, Limit: 3}
+	expiresAt := time.Now().Add(30 * time.Second)
+
+	mock.ExpectQuery(`INSERT INTO rate_limits \(key, count, expires_at\) VALUES \(\$1, 1, \$2\)\s+ON CONFLICT \(key\) DO UPDATE SET\s+`+
+		`count = CASE WHEN rate_limits.expires_at <= \$3 THEN 1 ELSE rate_limits.count \+ 1 END,\s+`+
+		`expires_at = CASE WHEN rate_limits.expires_at <= \$4 THEN EXCLUDED.expires_at ELSE rate_limits.expires_at END\s+`+
+		`RETURNING count, expires_at`).
+		WithArgs("broadcast:org:alice", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "expires_at"}).AddRow(3, expiresAt))
+
+	limitContext, err := store.Get(context.Background(), "org:alice", rate)
+	if err != nil {
+		t.Fatalf("get failed %v", err)
+	}
+	if limitContext.Limit != 3 || limitContext.Remaining != 0 || limitContext.Reached || limitContext.Reset != expiresAt.Unix() {
+		t.Fatalf("expected last request of window, got %+v", limitContext)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations %v", err)
+	}
+}
+
+func TestGivenCounterOverLimitWhenGetThenLimitIsReached(t *testing.T) {
+	store, mock := mockedStore(t)
+	mock.ExpectQuery("INSERT INTO rate_limits").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "expires_at"}).AddRow(4, time.Now().Add(time.Minute)))
+
+	limitContext, err := store.Get(context.Background(), "org:alice", limiter.Rate{Period: time.Minute, Limit: 3})
+	if err != nil || !limitContext.Reached {
+		t.Fatalf("expected limit to be reached, got %+v %v", limitContext, err)
+	}
+}
+
+func TestGivenNoActiveWindowWhenPeekThenNothingIsConsumed(t *testing.T) {
+	store, mock := mockedStore(t)
+	mock.ExpectQuery(`SELECT count, expires_at FROM rate_limits WHERE key = \$1 AND expires_at > \$2`).
+		WithArgs("broadcast:org:alice", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "expires_at"}))
+
+	limitContext, err := store.Peek(context.Background(), "org:alice", limiter.Rate{Period: time.Minute, Limit: 3})
+	if err != nil || limitContext.Remaining != 3 {
+		t.Fatalf("expected full budget, got %+v %v", limitContext, err)
+	}
+}
+
+func TestGivenDbErrorWhenPeekOrGetThenErrorIsReturned(t *testing.T) {
+	store, mock := mockedStore(t)
+	mock.ExpectQuery("SELECT count").WillReturnError(context.DeadlineExceeded)
+	mock.ExpectQuery("INSERT INTO rate_limits").WillReturnError(context.DeadlineExceeded)
+	rate := limiter.Rate{Period: time.Minute, Limit: 3}
+
+	if _, err := store.Peek(context.Background(), "org:alice", rate); err == nil {
+		t.Fatalf("expected peek to fail")
+	}
+	if _, err := store.Get(context.Background(), "org:alice", rate); err == nil {
+		t.Fatalf("expected get to fail")
+	}
+}
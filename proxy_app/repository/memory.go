@@ -0,0 +1,781 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+// memoryStore keeps all entities of in-memory repositories, entries are kept in creation order
+// which is what latest entry queries rely on
+type memoryStore struct {
+	mutex            sync.Mutex
+	trustmeshes      map[uuid.UUID]*types.Trustmesh
+	entries          []*types.TrustmeshEntry
+	offchainMessages map[uuid.UUID]*types.OffchainProcessMessage
+	workgroups       map[uuid.UUID]*types.Workgroup
+	members          []*types.WorkgroupMember
+	organizations    map[uuid.UUID]*types.Organization
+	webhooks         []*types.SorWebhook
+	pending          []*types.PendingBroadcast
+	schemas          []*types.BusinessObjectSchema
+}
+
+// NewInMemory returns empty repositories that keep data in memory, used in tests
+func NewInMemory() *Repositories {
+	store := &memoryStore{
+		trustmeshes:      map[uuid.UUID]*types.Trustmesh{},
+		offchainMessages: map[uuid.UUID]*types.OffchainProcessMessage{},
+		workgroups:       map[uuid.UUID]*types.Workgroup{},
+		organizations:    map[uuid.UUID]*types.Organization{},
+	}
+
+	return &Repositories{
+		Trustmeshes:       &InMemoryTrustmeshRepository{store},
+		TrustmeshEntries:  &InMemoryTrustmeshEntryRepository{store},
+		OffchainMessages:  &InMemoryOffchainMessageRepository{store},
+		Workgroups:        &InMemoryWorkgroupRepository{store},
+		Organizations:     &InMemoryOrganizationRepository{store},
+		Webhooks:          &InMemoryWebhookRepository{store},
+		PendingBroadcasts: &InMemoryPendingBroadcastRepository{store},
+		Schemas:           &InMemoryBusinessObjectSchemaRepository{store},
+	}
+}
+
+// entry copy with offchain message loaded, the way postgres repository preloads it
+func (s *memoryStore) loadEntry(entry *types.TrustmeshEntry) *types.TrustmeshEntry {
+	loaded := *entry
+	if msg, ok := s.offchainMessages[entry.OffchainProcessMessageId]; ok {
+		loaded.OffchainProcessMessage = *msg
+	}
+
+	return &loaded
+}
+
+func (s *memoryStore) latestEntryInTrustmesh(trustmeshId uuid.UUID) *types.TrustmeshEntry {
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if s.entries[i].TrustmeshId == trustmeshId {
+			return s.loadEntry(s.entries[i])
+		}
+	}
+
+	return nil
+}
+
+type InMemoryTrustmeshRepository struct {
+	store *memoryStore
+}
+
+func (r *InMemoryTrustmeshRepository) GetTrustmeshById(id uuid.UUID) (*types.Trustmesh, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	trustmesh, ok := r.store.trustmeshes[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	loaded := *trustmesh
+	loaded.Entries = []types.TrustmeshEntry{}
+	for _, entry := range r.store.entries {
+		if entry.TrustmeshId == id {
+			loadedEntry := r.store.loadEntry(entry)
+			// like Preload("Entries.Workgroup") in postgres
+			if workgroup, ok := r.store.workgroups[entry.WorkgroupId]; ok {
+				loadedEntry.Workgroup = *workgroup
+			}
+			loaded.Entries = append(loaded.Entries, *loadedEntry)
+		}
+	}
+
+	return &loaded, nil
+}
+
+func (r *InMemoryTrustmeshRepository) UpdateTrustmeshEthTxHash(id uuid.UUID, ethTxHash string) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	if trustmesh, ok := r.store.trustmeshes[id]; ok {
+		trustmesh.EthExitTxHash = ethTxHash
+	}
+
+	return nil
+}
+
+type InMemoryTrustmeshEntryRepository struct {
+	store *memoryStore
+}
+
+func (r *InMemoryTrustmeshEntryRepository) CreateTrustmeshEntry(entry *types.TrustmeshEntry) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	if err := r.store.assignTrustmesh(entry); err != nil {
+		return err
+	}
+
+	r.store.createEntry(entry)
+	return nil
+}
+
+// assignTrustmesh puts entry into trustmesh of its parent or a new one, the same way postgres repository does
+func (s *memoryStore) assignTrustmesh(entry *types.TrustmeshEntry) error {
+	var parent *types.TrustmeshEntry
+	for _, existing := range s.entries {
+		if entry.ReferencedBaseledgerTransactionId != uuid.Nil && existing.BaseledgerTransactionId == entry.ReferencedBaseledgerTransactionId {
+			parent = existing
+			break
+		}
+	}
+
+	trustmesh, err := entry.AssignTrustmesh(parent, time.Now())
+	if err != nil {
+		return err
+	}
+	if trustmesh != nil {
+		s.trustmeshes[trustmesh.Id] = trustmesh
+	}
+
+	return nil
+}
+
+func (s *memoryStore) createEntry(entry *types.TrustmeshEntry) {
+	if entry.Id == uuid.Nil {
+		entry.Id = uuid.NewV4()
+	}
+	if entry.CommitmentState == "" {
+		entry.CommitmentState = common.UncommittedCommitmentState
+	}
+	if entry.ProcessingState == "" {
+		entry.ProcessingState = common.PendingProcessingState
+	}
+	entry.CreatedAt = time.Now()
+	entry.TendermintBlockId = sql.NullString{Valid: false}
+	entry.TendermintTransactionTimestamp = sql.NullTime{Valid: false}
+
+	stored := *entry
+	s.entries = append(s.entries, &stored)
+
+	if trustmesh, ok := s.trustmeshes[entry.TrustmeshId]; ok {
+		trustmesh.AddEntry(entry, s.organizationName(entry.SenderOrgId), s.organizationName(entry.ReceiverOrgId))
+	}
+}
+
+func (s *memoryStore) organizationName(id uuid.UUID) string {
+	if organization, ok := s.organizations[id]; ok {
+		return organization.OrganizationName
+	}
+	return ""
+}
+
+// refreshTrustmeshSummary recomputes summary of trustmesh from its remaining entries
+func (s *memoryStore) refreshTrustmeshSummary(trustmeshId uuid.UUID) {
+	trustmesh, ok := s.trustmeshes[trustmeshId]
+	if !ok {
+		return
+	}
+
+	entries := []types.TrustmeshEntry{}
+	for _, entry := range s.entries {
+		if entry.TrustmeshId == trustmeshId {
+			loaded := *entry
+			loaded.SenderOrg.OrganizationName = s.organizationName(entry.SenderOrgId)
+			loaded.ReceiverOrg.OrganizationName = s.organizationName(entry.ReceiverOrgId)
+			entries = append(entries, loaded)
+		}
+	}
+	trustmesh.ResetSummary(entries)
+}
+
+func (r *InMemoryTrustmeshEntryRepository) GetTrustmeshEntryById(id uuid.UUID) (*types.TrustmeshEntry, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	for _, entry := range r.store.entries {
+		if entry.Id == id {
+			return r.store.loadEntry(entry), nil
+		}
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *InMemoryTrustmeshEntryRepository) GetLatestTrustmeshEntryBasedOnTrustmeshId(trustmeshId string) (*types.TrustmeshEntry, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	return r.store.latestEntryInTrustmesh(uuid.FromStringOrNil(trustmeshId)), nil
+}
+
+func (r *InMemoryTrustmeshEntryRepository) GetLatestTrustmeshEntryBasedOnBboid(bboid string) (*types.TrustmeshEntry, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	for _, entry := range r.store.entries {
+		if entry.BaseledgerBusinessObjectId == bboid || entry.ReferencedBaseledgerBusinessObjectId == bboid {
+			return r.store.latestEntryInTrustmesh(entry.TrustmeshId), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *InMemoryTrustmeshEntryRepository) GetBusinessObjectVersions(bboid string) ([]types.TrustmeshEntry, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	entries := []types.TrustmeshEntry{}
+	for _, entry := range r.store.entries {
+		if entry.BaseledgerBusinessObjectId == bboid && entry.BaseledgerTransactionType == common.BaseledgerTransactionTypeSuggest {
+			entries = append(entries, *r.store.loadEntry(entry))
+		}
+	}
+
+	return entries, nil
+}
+
+func (r *InMemoryTrustmeshEntryRepository) GetTrustmeshEntriesByCommitmentState(commitmentState string) ([]types.TrustmeshEntry, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	entries := []types.TrustmeshEntry{}
+	for _, entry := range r.store.entries {
+		if entry.CommitmentState == commitmentState {
+			entries = append(entries, *entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (r *InMemoryTrustmeshEntryRepository) ClaimTrustmeshEntriesToProcess(now time.Time, limit int, lease time.Duration) ([]types.TrustmeshEntry, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	// entries are stored in creation order, entries not final yet block later entries of their trustmesh
+	blockedTrustmeshes := map[uuid.UUID]bool{}
+	entries := []types.TrustmeshEntry{}
+	for _, entry := range r.store.entries {
+		blocked := blockedTrustmeshes[entry.TrustmeshId]
+		if entry.ProcessingState != common.CommittedProcessingState && entry.ProcessingState != common.DeadProcessingState {
+			blockedTrustmeshes[entry.TrustmeshId] = true
+		}
+
+		claimed := entry.ProcessingClaimedUntil.Valid && entry.ProcessingClaimedUntil.Time.After(now)
+		if len(entries) == limit || blocked || claimed || !toProcess(entry, now) {
+			continue
+		}
+
+		entry.ProcessingClaimedUntil = sql.NullTime{Time: now.Add(lease), Valid: true}
+		entries = append(entries, *entry)
+	}
+
+	return entries, nil
+}
+
+func (r *InMemoryTrustmeshEntryRepository) ReleaseTrustmeshEntryClaims(ids []uuid.UUID) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	for _, id := range ids {
+		for _, entry := range r.store.entries {
+			if entry.Id == id {
+				entry.ProcessingClaimedUntil = sql.NullTime{Valid: false}
+			}
+		}
+	}
+
+	return nil
+}
+
+// toProcess is true for uncommitted entries which are pending or whose retry is due
+func toProcess(entry *types.TrustmeshEntry, now time.Time) bool {
+	if entry.CommitmentState != common.UncommittedCommitmentState {
+		return false
+	}
+
+	retryDue := entry.ProcessingNextRetryAt.Valid && !entry.ProcessingNextRetryAt.Time.After(now)
+	switch entry.ProcessingState {
+	case common.PendingProcessingState:
+		return true
+	case common.FailedProcessingState, common.ProcessingProcessingState:
+		return retryDue
+	}
+
+	return false
+}
+
+func (r *InMemoryTrustmeshEntryRepository) GetTrustmeshEntriesByProcessingState(processingState string) ([]types.TrustmeshEntry, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	entries := []types.TrustmeshEntry{}
+	for _, entry := range r.store.entries {
+		if entry.ProcessingState == processingState {
+			entries = append(entries, *entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (r *InMemoryTrustmeshEntryRepository) UpdateTrustmeshEntryProcessing(entry *types.TrustmeshEntry) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	for _, stored := range r.store.entries {
+		if stored.Id == entry.Id {
+			stored.CommitmentState = entry.CommitmentState
+			stored.ProcessingState = entry.ProcessingState
+			stored.ProcessingAttempts = entry.ProcessingAttempts
+			stored.ProcessingLastError = entry.ProcessingLastError
+			stored.ProcessingNextRetryAt = entry.ProcessingNextRetryAt
+			stored.ProcessingResolution = entry.ProcessingResolution
+			return nil
+		}
+	}
+
+	return errors.New("trustmesh entry not found")
+}
+
+func (r *InMemoryTrustmeshEntryRepository) SetTrustmeshEntryCommitmentState(tendermintTransactionId uuid.UUID, commitmentState string, blockId string, timestamp string) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	updated := false
+	for _, entry := range r.store.entries {
+		if entry.TendermintTransactionId != tendermintTransactionId {
+			continue
+		}
+
+		entry.CommitmentState = commitmentState
+		entry.TendermintBlockId = sql.NullString{String: blockId, Valid: true}
+		if parsed, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+			entry.TendermintTransactionTimestamp = sql.NullTime{Time: parsed, Valid: true}
+			if trustmesh, ok := r.store.trustmeshes[entry.TrustmeshId]; ok {
+				trustmesh.AddTransactionTimestamp(parsed)
+			}
+		}
+		updated = true
+	}
+
+	if !updated {
+		return errors.New("trustmesh entry not found")
+	}
+
+	return nil
+}
+
+type InMemoryOffchainMessageRepository struct {
+	store *memoryStore
+}
+
+func (r *InMemoryOffchainMessageRepository) CreateOffchainMessage(msg *types.OffchainProcessMessage) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	r.store.createOffchainMessage(msg)
+	return nil
+}
+
+func (s *memoryStore) createOffchainMessage(msg *types.OffchainProcessMessage) {
+	if msg.Id == uuid.Nil {
+		msg.Id = uuid.NewV4()
+	}
+
+	stored := *msg
+	s.offchainMessages[msg.Id] = &stored
+}
+
+func (r *InMemoryOffchainMessageRepository) GetOffchainMsgById(id uuid.UUID) (*types.OffchainProcessMessage, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	msg, ok := r.store.offchainMessages[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	found := *msg
+	return &found, nil
+}
+
+type InMemoryWorkgroupRepository struct {
+	store *memoryStore
+}
+
+func (r *InMemoryWorkgroupRepository) FindWorkgroup(workgroupId string) *types.Workgroup {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	workgroup, ok := r.store.workgroups[uuid.FromStringOrNil(workgroupId)]
+	if !ok {
+		return nil
+	}
+
+	found := *workgroup
+	return &found
+}
+
+func (r *InMemoryWorkgroupRepository) FindWorkgroupMember(workgroupId string, recipientId string) *types.WorkgroupMember {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	for _, member := range r.store.members {
+		if member.WorkgroupId == workgroupId && member.OrganizationId == recipientId {
+			found := *member
+			return &found
+		}
+	}
+
+	return nil
+}
+
+func (r *InMemoryWorkgroupRepository) CreateWorkgroup(workgroup *types.Workgroup) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	if workgroup.Id == uuid.Nil {
+		workgroup.Id = uuid.NewV4()
+	}
+
+	stored := *workgroup
+	r.store.workgroups[workgroup.Id] = &stored
+	return nil
+}
+
+func (r *InMemoryWorkgroupRepository) CreateWorkgroupMember(member *types.WorkgroupMember) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	if member.Id == uuid.Nil {
+		member.Id = uuid.NewV4()
+	}
+
+	stored := *member
+	r.store.members = append(r.store.members, &stored)
+	return nil
+}
+
+type InMemoryOrganizationRepository struct {
+	store *memoryStore
+}
+
+func (r *InMemoryOrganizationRepository) CreateOrganization(organization *types.Organization) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	if organization.Id == uuid.Nil {
+		organization.Id = uuid.NewV4()
+	}
+
+	stored := *organization
+	r.store.organizations[organization.Id] = &stored
+	return nil
+}
+
+func (r *InMemoryOrganizationRepository) GetOrganizationById(id uuid.UUID) (*types.Organization, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	organization, ok := r.store.organizations[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	found := *organization
+	return &found, nil
+}
+
+type InMemoryWebhookRepository struct {
+	store *memoryStore
+}
+
+func (r *InMemoryWebhookRepository) CreateWebhook(webhook *types.SorWebhook) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	if webhook.Id == uuid.Nil {
+		webhook.Id = uuid.NewV4()
+	}
+
+	stored := *webhook
+	r.store.webhooks = append(r.store.webhooks, &stored)
+	return nil
+}
+
+func (r *InMemoryWebhookRepository) FetchWebhookByType(webhookType types.WebhookType) *types.SorWebhook {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	for _, webhook := range r.store.webhooks {
+		if webhook.WebhookType == webhookType {
+			found := *webhook
+			return &found
+		}
+	}
+
+	return nil
+}
+
+type InMemoryBusinessObjectSchemaRepository struct {
+	store *memoryStore
+}
+
+func (r *InMemoryBusinessObjectSchemaRepository) SaveBusinessObjectSchema(schema *types.BusinessObjectSchema) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	now := time.Now()
+	for _, existing := range r.store.schemas {
+		if existing.WorkgroupId == schema.WorkgroupId && existing.BusinessObjectType == schema.BusinessObjectType {
+			existing.Schema = schema.Schema
+			existing.Hash = schema.Hash
+			existing.UpdatedAt = now
+			*schema = *existing
+			return nil
+		}
+	}
+
+	schema.Id = uuid.NewV4()
+	schema.CreatedAt = now
+	schema.UpdatedAt = now
+	stored := *schema
+	r.store.schemas = append(r.store.schemas, &stored)
+	return nil
+}
+
+func (r *InMemoryBusinessObjectSchemaRepository) GetBusinessObjectSchema(workgroupId uuid.UUID, businessObjectType string) (*types.BusinessObjectSchema, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	for _, schema := range r.store.schemas {
+		if schema.WorkgroupId == workgroupId && schema.BusinessObjectType == businessObjectType {
+			found := *schema
+			return &found, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *InMemoryBusinessObjectSchemaRepository) GetBusinessObjectSchemas(workgroupId uuid.UUID) ([]types.BusinessObjectSchema, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	schemas := []types.BusinessObjectSchema{}
+	for _, schema := range r.store.schemas {
+		if schema.WorkgroupId == workgroupId {
+			schemas = append(schemas, *schema)
+		}
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].BusinessObjectType < schemas[j].BusinessObjectType })
+
+	return schemas, nil
+}
+
+func (r *InMemoryBusinessObjectSchemaRepository) DeleteBusinessObjectSchema(workgroupId uuid.UUID, businessObjectType string) (bool, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	for i, schema := range r.store.schemas {
+		if schema.WorkgroupId == workgroupId && schema.BusinessObjectType == businessObjectType {
+			r.store.schemas = append(r.store.schemas[:i], r.store.schemas[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+type InMemoryPendingBroadcastRepository struct {
+	store *memoryStore
+}
+
+func (r *InMemoryPendingBroadcastRepository) CreatePendingBroadcast(offchainMsg *types.OffchainProcessMessage, entry *types.TrustmeshEntry, pending *types.PendingBroadcast, createPayload func(*types.OffchainProcessMessage) string) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	if err := r.store.assignTrustmesh(entry); err != nil {
+		return err
+	}
+
+	r.store.createOffchainMessage(offchainMsg)
+	entry.OffchainProcessMessageId = offchainMsg.Id
+	r.store.createEntry(entry)
+
+	pending.Id = uuid.NewV4()
+	pending.CreatedAt = time.Now()
+	pending.TrustmeshEntryId = entry.Id
+	pending.OffchainProcessMessageId = offchainMsg.Id
+	pending.Payload = createPayload(offchainMsg)
+	pending.Status = types.PendingBroadcastStatusPending
+
+	stored := *pending
+	r.store.pending = append(r.store.pending, &stored)
+	return nil
+}
+
+func (r *InMemoryPendingBroadcastRepository) MarkBroadcasting(pending *types.PendingBroadcast) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	stored := r.store.findPending(pending.Id)
+	if stored == nil {
+		return errors.New("pending broadcast not found")
+	}
+	if stored.Status != types.PendingBroadcastStatusPending {
+		return types.ErrPendingBroadcastTaken
+	}
+
+	stored.Status = types.PendingBroadcastStatusBroadcasting
+	stored.BroadcastAttemptedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	pending.Status = stored.Status
+	pending.BroadcastAttemptedAt = stored.BroadcastAttemptedAt
+	return nil
+}
+
+func (r *InMemoryPendingBroadcastRepository) MarkUnconfirmed(pending *types.PendingBroadcast) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	stored := r.store.findPending(pending.Id)
+	if stored == nil {
+		return errors.New("pending broadcast not found")
+	}
+
+	stored.Status = types.PendingBroadcastStatusUnconfirmed
+	pending.Status = stored.Status
+	return nil
+}
+
+func (r *InMemoryPendingBroadcastRepository) GetPendingBroadcastByTrustmeshEntryId(entryId uuid.UUID) (*types.PendingBroadcast, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	for _, pending := range r.store.pending {
+		if pending.TrustmeshEntryId == entryId {
+			found := *pending
+			return &found, nil
+		}
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *InMemoryPendingBroadcastRepository) FinishPendingBroadcast(pending *types.PendingBroadcast, transactionHash string) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	for _, entry := range r.store.entries {
+		if entry.Id == pending.TrustmeshEntryId {
+			entry.CommitmentState = common.UncommittedCommitmentState
+			entry.TransactionHash = transactionHash
+			r.store.deletePending(pending.Id)
+			return nil
+		}
+	}
+
+	return errors.New("trustmesh entry not found")
+}
+
+func (r *InMemoryPendingBroadcastRepository) CompensatePendingBroadcast(pending *types.PendingBroadcast) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	trustmeshId := uuid.Nil
+	entries := []*types.TrustmeshEntry{}
+	for _, entry := range r.store.entries {
+		if entry.Id == pending.TrustmeshEntryId {
+			trustmeshId = entry.TrustmeshId
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	r.store.entries = entries
+	delete(r.store.offchainMessages, pending.OffchainProcessMessageId)
+
+	if r.store.latestEntryInTrustmesh(trustmeshId) == nil {
+		delete(r.store.trustmeshes, trustmeshId)
+	} else {
+		r.store.refreshTrustmeshSummary(trustmeshId)
+	}
+
+	r.store.deletePending(pending.Id)
+	return nil
+}
+
+func (r *InMemoryPendingBroadcastRepository) RecordTransactionHash(pending *types.PendingBroadcast, transactionHash string) error {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	stored := r.store.findPending(pending.Id)
+	if stored == nil {
+		return errors.New("pending broadcast not found")
+	}
+
+	stored.TransactionHash = transactionHash
+	pending.TransactionHash = transactionHash
+	return nil
+}
+
+func (r *InMemoryPendingBroadcastRepository) RecordLookupMiss(pending *types.PendingBroadcast) (int, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	stored := r.store.findPending(pending.Id)
+	if stored == nil {
+		return 0, errors.New("pending broadcast not found")
+	}
+
+	stored.LookupMisses++
+	pending.LookupMisses = stored.LookupMisses
+	return stored.LookupMisses, nil
+}
+
+func (r *InMemoryPendingBroadcastRepository) ClaimInterruptedPendingBroadcasts(now time.Time, pendingBefore time.Time, broadcastingBefore time.Time, lease time.Duration) ([]*types.PendingBroadcast, error) {
+	r.store.mutex.Lock()
+	defer r.store.mutex.Unlock()
+
+	claimed := []*types.PendingBroadcast{}
+	for _, pending := range r.store.pending {
+		interrupted := (pending.Status == types.PendingBroadcastStatusPending && pending.CreatedAt.Before(pendingBefore)) ||
+			(pending.Status == types.PendingBroadcastStatusBroadcasting && pending.BroadcastAttemptedAt.Time.Before(broadcastingBefore))
+		if !interrupted || (pending.RecoveryClaimedUntil.Valid && pending.RecoveryClaimedUntil.Time.After(now)) {
+			continue
+		}
+
+		pending.RecoveryClaimedUntil = sql.NullTime{Time: now.Add(lease), Valid: true}
+		found := *pending
+		claimed = append(claimed, &found)
+	}
+
+	return claimed, nil
+}
+
+func (s *memoryStore) findPending(id uuid.UUID) *types.PendingBroadcast {
+	for _, pending := range s.pending {
+		if pending.Id == id {
+			return pending
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) deletePending(id uuid.UUID) {
+	remaining := []*types.PendingBroadcast{}
+	for _, pending := range s.pending {
+		if pending.Id != id {
+			remaining = append(remaining, pending)
+		}
+	}
+	s.pending = remaining
+}
@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+func TestGivenEntryReferencingTransactionWhenCreateTrustmeshEntryThenEntryJoinsTrustmeshOfReferencedEntry(t *testing.T) {
+	repositories := NewInMemory()
+	initial := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), BaseledgerBusinessObjectId: "bboid"}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(initial)
+	feedback := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), ReferencedBaseledgerTransactionId: initial.BaseledgerTransactionId, ReferencedBaseledgerBusinessObjectId: "bboid"}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(feedback)
+	other := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4()}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(other)
+
+	if initial.TrustmeshId == uuid.Nil || feedback.TrustmeshId != initial.TrustmeshId {
+		t.Fatalf("feedback trustmesh = %v, want %v", feedback.TrustmeshId, initial.TrustmeshId)
+	}
+	if other.TrustmeshId == initial.TrustmeshId {
+		t.Fatalf("entry without reference must start new trustmesh")
+	}
+	if initial.CommitmentState != common.UncommittedCommitmentState {
+		t.Fatalf("commitment state = %v, want %v", initial.CommitmentState, common.UncommittedCommitmentState)
+	}
+
+	trustmesh, err := repositories.Trustmeshes.GetTrustmeshById(initial.TrustmeshId)
+	if err != nil || len(trustmesh.Entries) != 2 {
+		t.Fatalf("trustmesh should contain 2 entries, got %v %v", trustmesh, err)
+	}
+}
+
+func TestGivenTrustmeshWithEntriesWhenGetLatestTrustmeshEntryBasedOnBboidThenLastCreatedEntryReturned(t *testing.T) {
+	repositories := NewInMemory()
+	initial := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), BaseledgerBusinessObjectId: "bboid"}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(initial)
+	feedback := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), ReferencedBaseledgerTransactionId: initial.BaseledgerTransactionId}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(feedback)
+
+	latest, err := repositories.TrustmeshEntries.GetLatestTrustmeshEntryBasedOnBboid("bboid")
+	if err != nil || latest == nil || latest.Id != feedback.Id {
+		t.Fatalf("latest entry = %v, want %v", latest, feedback.Id)
+	}
+
+	missing, err := repositories.TrustmeshEntries.GetLatestTrustmeshEntryBasedOnBboid("unknown")
+	if err != nil || missing != nil {
+		t.Fatalf("unknown bboid should return nil, got %v %v", missing, err)
+	}
+}
+
+func TestGivenClaimedEntryWhenClaimTrustmeshEntriesToProcessThenItAndLaterEntriesOfItsTrustmeshSkipped(t *testing.T) {
+	repositories := NewInMemory()
+	now := time.Now()
+	initial := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4()}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(initial)
+	first, _ := repositories.TrustmeshEntries.ClaimTrustmeshEntriesToProcess(now, 10, time.Minute)
+	feedback := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), ReferencedBaseledgerTransactionId: initial.BaseledgerTransactionId}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(feedback)
+	other := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4()}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(other)
+
+	second, _ := repositories.TrustmeshEntries.ClaimTrustmeshEntriesToProcess(now, 10, time.Minute)
+
+	if len(first) != 1 || first[0].Id != initial.Id {
+		t.Fatalf("expected initial entry claimed, got %+v", first)
+	}
+	if len(second) != 1 || second[0].Id != other.Id {
+		t.Fatalf("expected only entry of other trustmesh claimed, got %+v", second)
+	}
+
+	repositories.TrustmeshEntries.ReleaseTrustmeshEntryClaims([]uuid.UUID{initial.Id, other.Id})
+	released, _ := repositories.TrustmeshEntries.ClaimTrustmeshEntriesToProcess(now, 1, time.Minute)
+
+	if len(released) != 1 || released[0].Id != initial.Id {
+		t.Fatalf("expected trustmesh entries claimed in order up to limit, got %+v", released)
+	}
+	expired, _ := repositories.TrustmeshEntries.ClaimTrustmeshEntriesToProcess(now.Add(2*time.Minute), 10, time.Minute)
+	if len(expired) != 2 || expired[0].Id != initial.Id || expired[1].Id != other.Id {
+		t.Fatalf("expired claims must be claimed again, got %+v", expired)
+	}
+}
+
+func TestGivenEarlierEntryInBackoffWhenClaimTrustmeshEntriesToProcessThenLaterEntriesOfItsTrustmeshWait(t *testing.T) {
+	repositories := NewInMemory()
+	now := time.Now()
+	initial := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4()}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(initial)
+	feedback := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), ReferencedBaseledgerTransactionId: initial.BaseledgerTransactionId}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(feedback)
+
+	// failed entry is not claimed anymore, but waits for its retry
+	initial.FailProcessing("failed", now, types.RetryPolicy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour})
+	repositories.TrustmeshEntries.UpdateTrustmeshEntryProcessing(initial)
+
+	if claimed, _ := repositories.TrustmeshEntries.ClaimTrustmeshEntriesToProcess(now, 10, time.Minute); len(claimed) != 0 {
+		t.Fatalf("expected feedback to wait for retry of initial entry, got %+v", claimed)
+	}
+
+	initial.FinishProcessing(common.CommittedCommitmentState)
+	repositories.TrustmeshEntries.UpdateTrustmeshEntryProcessing(initial)
+	claimed, _ := repositories.TrustmeshEntries.ClaimTrustmeshEntriesToProcess(now, 10, time.Minute)
+	if len(claimed) != 1 || claimed[0].Id != feedback.Id {
+		t.Fatalf("expected feedback claimed once initial entry is final, got %+v", claimed)
+	}
+}
+
+func TestGivenInvalidReferenceWhenCreateTrustmeshEntryThenEntryRejected(t *testing.T) {
+	repositories := NewInMemory()
+	workgroupId := uuid.NewV4()
+	initial := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), WorkgroupId: workgroupId}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(initial)
+	other := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), WorkgroupId: workgroupId}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(other)
+
+	invalid := map[string]*types.TrustmeshEntry{
+		"unknown transaction": {BaseledgerTransactionId: uuid.NewV4(), ReferencedBaseledgerTransactionId: uuid.NewV4()},
+		"other trustmesh":     {BaseledgerTransactionId: uuid.NewV4(), ReferencedBaseledgerTransactionId: initial.BaseledgerTransactionId, TrustmeshId: other.TrustmeshId},
+		"other workgroup":     {BaseledgerTransactionId: uuid.NewV4(), ReferencedBaseledgerTransactionId: initial.BaseledgerTransactionId, WorkgroupId: uuid.NewV4()},
+	}
+	for name, entry := range invalid {
+		err := repositories.TrustmeshEntries.CreateTrustmeshEntry(entry)
+
+		if !errors.Is(err, types.ErrInvalidTrustmeshReference) {
+			t.Fatalf("%v: expected invalid trustmesh reference, got %v", name, err)
+		}
+		if stored, _ := repositories.TrustmeshEntries.GetTrustmeshEntryById(entry.Id); stored != nil {
+			t.Fatalf("%v: entry must not be stored", name)
+		}
+	}
+
+	feedback := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), ReferencedBaseledgerTransactionId: initial.BaseledgerTransactionId, TrustmeshId: initial.TrustmeshId, WorkgroupId: workgroupId}
+	if err := repositories.TrustmeshEntries.CreateTrustmeshEntry(feedback); err != nil || feedback.ParentTrustmeshEntryId != initial.Id {
+		t.Fatalf("expected feedback linked to parent %v, got %v %v", initial.Id, feedback.ParentTrustmeshEntryId, err)
+	}
+}
+
+func TestGivenTrustmeshEntriesWhenCreatedCommittedAndCompensatedThenTrustmeshSummaryMaintained(t *testing.T) {
+	repositories := NewInMemory()
+	sender := &types.Organization{OrganizationName: "Org1"}
+	receiver := &types.Organization{OrganizationName: "Org2"}
+	repositories.Organizations.CreateOrganization(sender)
+	repositories.Organizations.CreateOrganization(receiver)
+
+	initial := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), TendermintTransactionId: uuid.NewV4(), SenderOrgId: sender.Id, ReceiverOrgId: receiver.Id, BusinessObjectType: "Order"}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(initial)
+	committedAt := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	repositories.TrustmeshEntries.SetTrustmeshEntryCommitmentState(initial.TendermintTransactionId, common.CommittedCommitmentState, "block", committedAt.Format(time.RFC3339Nano))
+
+	rejection := &types.TrustmeshEntry{
+		BaseledgerTransactionId:           uuid.NewV4(),
+		ReferencedBaseledgerTransactionId: initial.BaseledgerTransactionId,
+		SenderOrgId:                       receiver.Id,
+		ReceiverOrgId:                     sender.Id,
+		BusinessObjectType:                "Order",
+		BaseledgerTransactionType:         common.BaseledgerTransactionTypeReject,
+		WorkstepType:                      common.WorkstepTypeFinal,
+	}
+	pending := &types.PendingBroadcast{}
+	repositories.PendingBroadcasts.CreatePendingBroadcast(&types.OffchainProcessMessage{}, rejection, pending, func(*types.OffchainProcessMessage) string { return "" })
+
+	trustmesh, _ := repositories.Trustmeshes.GetTrustmeshById(initial.TrustmeshId)
+	if trustmesh.Participants != "Org1, Org2" || trustmesh.BusinessObjectTypes != "Order" {
+		t.Fatalf("participants %q and business object types %q not distinct in order of appearance", trustmesh.Participants, trustmesh.BusinessObjectTypes)
+	}
+	if !trustmesh.StartTime.Equal(committedAt) || !trustmesh.EndTime.Equal(committedAt) {
+		t.Fatalf("start %v and end %v should be commit time %v", trustmesh.StartTime, trustmesh.EndTime, committedAt)
+	}
+	if !trustmesh.Finalized || !trustmesh.ContainsRejections {
+		t.Fatalf("trustmesh with final rejection should be finalized and contain rejections")
+	}
+
+	repositories.PendingBroadcasts.CompensatePendingBroadcast(pending)
+
+	trustmesh, _ = repositories.Trustmeshes.GetTrustmeshById(initial.TrustmeshId)
+	if trustmesh.Finalized || trustmesh.ContainsRejections || !trustmesh.StartTime.Equal(committedAt) {
+		t.Fatalf("summary should be recomputed without compensated entry, got %+v", trustmesh)
+	}
+}
+
+func TestGivenSuggestionsAndFeedbackOfBusinessObjectWhenGetBusinessObjectVersionsThenSuggestionsReturnedOldestFirst(t *testing.T) {
+	repositories := NewInMemory()
+	initial := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), BaseledgerBusinessObjectId: "bboid", BaseledgerTransactionType: common.BaseledgerTransactionTypeSuggest}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(initial)
+	feedback := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), BaseledgerBusinessObjectId: "bboid", BaseledgerTransactionType: common.BaseledgerTransactionTypeReject, ReferencedBaseledgerTransactionId: initial.BaseledgerTransactionId}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(feedback)
+	newVersion := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), BaseledgerBusinessObjectId: "bboid", BaseledgerTransactionType: common.BaseledgerTransactionTypeSuggest, ReferencedBaseledgerTransactionId: feedback.BaseledgerTransactionId}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(newVersion)
+	other := &types.TrustmeshEntry{BaseledgerTransactionId: uuid.NewV4(), BaseledgerBusinessObjectId: "other", BaseledgerTransactionType: common.BaseledgerTransactionTypeSuggest}
+	repositories.TrustmeshEntries.CreateTrustmeshEntry(other)
+
+	versions, err := repositories.TrustmeshEntries.GetBusinessObjectVersions("bboid")
+	if err != nil || len(versions) != 2 || versions[0].Id != initial.Id || versions[1].Id != newVersion.Id {
+		t.Fatalf("versions = %v %v, want initial and new version", versions, err)
+	}
+}
@@ -0,0 +1,336 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/dbutil"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/types"
+	"github.com/unibrightio/proxy-api/workgroups"
+)
+
+// Postgres returns repositories backed by app db connection
+func Postgres() *Repositories {
+	return &Repositories{
+		Trustmeshes:       &PostgresTrustmeshRepository{},
+		TrustmeshEntries:  &PostgresTrustmeshEntryRepository{},
+		OffchainMessages:  &PostgresOffchainMessageRepository{},
+		Workgroups:        &PostgresWorkgroupRepository{},
+		Organizations:     &PostgresOrganizationRepository{},
+		Webhooks:          &PostgresWebhookRepository{},
+		PendingBroadcasts: &PostgresPendingBroadcastRepository{},
+		Schemas:           &PostgresBusinessObjectSchemaRepository{},
+	}
+}
+
+type PostgresTrustmeshRepository struct {
+}
+
+func (r *PostgresTrustmeshRepository) GetTrustmeshById(id uuid.UUID) (*types.Trustmesh, error) {
+	return types.GetTrustmeshById(id)
+}
+
+func (r *PostgresTrustmeshRepository) UpdateTrustmeshEthTxHash(id uuid.UUID, ethTxHash string) error {
+	return types.UpdateTrustmeshEthTxHash(id, ethTxHash)
+}
+
+type PostgresTrustmeshEntryRepository struct {
+}
+
+func (r *PostgresTrustmeshEntryRepository) CreateTrustmeshEntry(entry *types.TrustmeshEntry) error {
+	// new trustmesh is created together with its first entry
+	return dbutil.UnitOfWork(func(tx *gorm.DB) error {
+		return entry.CreateWith(tx)
+	})
+}
+
+func (r *PostgresTrustmeshEntryRepository) GetTrustmeshEntryById(id uuid.UUID) (*types.TrustmeshEntry, error) {
+	return types.GetTrustmeshEntryById(id)
+}
+
+func (r *PostgresTrustmeshEntryRepository) GetLatestTrustmeshEntryBasedOnTrustmeshId(trustmeshId string) (*types.TrustmeshEntry, error) {
+	return types.GetLatestTrustmeshEntryBasedOnTrustmeshId(trustmeshId)
+}
+
+func (r *PostgresTrustmeshEntryRepository) GetLatestTrustmeshEntryBasedOnBboid(bboid string) (*types.TrustmeshEntry, error) {
+	return types.GetLatestTrustmeshEntryBasedOnBboid(bboid)
+}
+
+func (r *PostgresTrustmeshEntryRepository) GetBusinessObjectVersions(bboid string) ([]types.TrustmeshEntry, error) {
+	var entries []types.TrustmeshEntry
+	res := dbutil.Db.GetConn().Preload("OffchainProcessMessage").
+		Where("baseledger_business_object_id = ? AND baseledger_transaction_type = ?", bboid, common.BaseledgerTransactionTypeSuggest).
+		Order("created_at asc").
+		Find(&entries)
+	if res.Error != nil {
+		logger.Errorf("error when getting versions of business object %v %v\n", bboid, res.Error)
+		return nil, res.Error
+	}
+
+	return entries, nil
+}
+
+func (r *PostgresTrustmeshEntryRepository) GetTrustmeshEntriesByCommitmentState(commitmentState string) ([]types.TrustmeshEntry, error) {
+	var entries []types.TrustmeshEntry
+	res := dbutil.Db.GetConn().Where("commitment_state=?", commitmentState).Find(&entries)
+	if res.Error != nil {
+		logger.Errorf("error when getting %v trustmesh entries %v\n", commitmentState, res.Error)
+		return nil, res.Error
+	}
+
+	return entries, nil
+}
+
+// claim is a single statement, skip locked lets concurrent claims of other replicas pass by each other
+// instead of waiting and then claiming the same entries. Entry waits until all earlier entries of its
+// trustmesh are final, whether they are claimed, waiting for retry or not committed yet
+const claimTrustmeshEntriesSql = `UPDATE trustmesh_entries SET processing_claimed_until = ?
+WHERE id IN (
+	SELECT e.id FROM trustmesh_entries e
+	WHERE e.commitment_state = ?
+	AND (e.processing_state = ? OR (e.processing_state IN (?) AND e.processing_next_retry_at <= ?))
+	AND (e.processing_claimed_until IS NULL OR e.processing_claimed_until <= ?)
+	AND NOT EXISTS (
+		SELECT 1 FROM trustmesh_entries earlier
+		WHERE earlier.trustmesh_id = e.trustmesh_id
+		AND earlier.created_at < e.created_at
+		AND earlier.processing_state NOT IN (?)
+	)
+	ORDER BY e.created_at ASC
+	LIMIT ?
+	FOR UPDATE OF e SKIP LOCKED
+)
+RETURNING *`
+
+func (r *PostgresTrustmeshEntryRepository) ClaimTrustmeshEntriesToProcess(now time.Time, limit int, lease time.Duration) ([]types.TrustmeshEntry, error) {
+	var entries []types.TrustmeshEntry
+	res := dbutil.Db.GetConn().Raw(claimTrustmeshEntriesSql,
+		now.Add(lease),
+		common.UncommittedCommitmentState,
+		common.PendingProcessingState,
+		[]string{common.FailedProcessingState, common.ProcessingProcessingState},
+		now,
+		now,
+		[]string{common.CommittedProcessingState, common.DeadProcessingState},
+		limit).
+		Scan(&entries)
+	if res.Error != nil {
+		logger.Errorf("error when claiming trustmesh entries to process %v\n", res.Error)
+		return nil, res.Error
+	}
+
+	// returning does not keep order of the select
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+func (r *PostgresTrustmeshEntryRepository) ReleaseTrustmeshEntryClaims(ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return dbutil.Db.GetConn().Exec("UPDATE trustmesh_entries SET processing_claimed_until = NULL WHERE id IN (?)", ids).Error
+}
+
+func (r *PostgresTrustmeshEntryRepository) GetTrustmeshEntriesByProcessingState(processingState string) ([]types.TrustmeshEntry, error) {
+	var entries []types.TrustmeshEntry
+	res := dbutil.Db.GetConn().Where("processing_state = ?", processingState).Order("created_at asc").Find(&entries)
+	if res.Error != nil {
+		logger.Errorf("error when getting %v trustmesh entries %v\n", processingState, res.Error)
+		return nil, res.Error
+	}
+
+	return entries, nil
+}
+
+func (r *PostgresTrustmeshEntryRepository) UpdateTrustmeshEntryProcessing(entry *types.TrustmeshEntry) error {
+	res := dbutil.Db.GetConn().Exec("UPDATE trustmesh_entries SET commitment_state = ?, processing_state = ?, processing_attempts = ?, processing_last_error = ?, processing_next_retry_at = ?, processing_resolution = ? WHERE id = ?",
+		entry.CommitmentState,
+		entry.ProcessingState,
+		entry.ProcessingAttempts,
+		entry.ProcessingLastError,
+		entry.ProcessingNextRetryAt,
+		entry.ProcessingResolution,
+		entry.Id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("trustmesh entry not found")
+	}
+
+	return nil
+}
+
+func (r *PostgresTrustmeshEntryRepository) SetTrustmeshEntryCommitmentState(tendermintTransactionId uuid.UUID, commitmentState string, blockId string, timestamp string) error {
+	return dbutil.UnitOfWork(func(tx *gorm.DB) error {
+		res := tx.Exec("UPDATE trustmesh_entries SET commitment_state = ?, tendermint_block_id = ?, tendermint_transaction_timestamp = ? WHERE tendermint_transaction_id = ?",
+			commitmentState,
+			blockId,
+			timestamp,
+			tendermintTransactionId)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("trustmesh entry not found")
+		}
+
+		return types.AddTrustmeshTransactionTimestampWith(tx, tendermintTransactionId, timestamp)
+	})
+}
+
+type PostgresOffchainMessageRepository struct {
+}
+
+func (r *PostgresOffchainMessageRepository) CreateOffchainMessage(msg *types.OffchainProcessMessage) error {
+	return msg.CreateWith(dbutil.Db.GetConn())
+}
+
+func (r *PostgresOffchainMessageRepository) GetOffchainMsgById(id uuid.UUID) (*types.OffchainProcessMessage, error) {
+	return types.GetOffchainMsgById(id)
+}
+
+type PostgresWorkgroupRepository struct {
+	workgroups.PostgresWorkgroupClient
+}
+
+func (r *PostgresWorkgroupRepository) CreateWorkgroup(workgroup *types.Workgroup) error {
+	if !workgroup.Create() {
+		return errors.New("workgroup not created")
+	}
+
+	return nil
+}
+
+func (r *PostgresWorkgroupRepository) CreateWorkgroupMember(member *types.WorkgroupMember) error {
+	if !member.Create() {
+		return errors.New("workgroup member not created")
+	}
+
+	return nil
+}
+
+type PostgresOrganizationRepository struct {
+}
+
+func (r *PostgresOrganizationRepository) CreateOrganization(organization *types.Organization) error {
+	if !organization.Create() {
+		return errors.New("organization not created")
+	}
+
+	return nil
+}
+
+func (r *PostgresOrganizationRepository) GetOrganizationById(id uuid.UUID) (*types.Organization, error) {
+	var organization types.Organization
+	res := dbutil.Db.GetConn().First(&organization, "id = ?", id.String())
+	if res.Error != nil {
+		logger.Errorf("error when getting organization from db %v\n", res.Error)
+		return nil, res.Error
+	}
+
+	return &organization, nil
+}
+
+type PostgresWebhookRepository struct {
+}
+
+func (r *PostgresWebhookRepository) CreateWebhook(webhook *types.SorWebhook) error {
+	if !webhook.Create() {
+		return errors.New("webhook not created")
+	}
+
+	return nil
+}
+
+func (r *PostgresWebhookRepository) FetchWebhookByType(webhookType types.WebhookType) *types.SorWebhook {
+	return types.FetchWebhookByType(webhookType)
+}
+
+type PostgresBusinessObjectSchemaRepository struct {
+}
+
+func (r *PostgresBusinessObjectSchemaRepository) SaveBusinessObjectSchema(schema *types.BusinessObjectSchema) error {
+	return schema.SaveWith(dbutil.Db.GetConn())
+}
+
+func (r *PostgresBusinessObjectSchemaRepository) GetBusinessObjectSchema(workgroupId uuid.UUID, businessObjectType string) (*types.BusinessObjectSchema, error) {
+	return types.GetBusinessObjectSchemaWith(dbutil.Db.GetConn(), workgroupId, businessObjectType)
+}
+
+func (r *PostgresBusinessObjectSchemaRepository) GetBusinessObjectSchemas(workgroupId uuid.UUID) ([]types.BusinessObjectSchema, error) {
+	return types.GetBusinessObjectSchemasWith(dbutil.Db.GetConn(), workgroupId)
+}
+
+func (r *PostgresBusinessObjectSchemaRepository) DeleteBusinessObjectSchema(workgroupId uuid.UUID, businessObjectType string) (bool, error) {
+	return types.DeleteBusinessObjectSchemaWith(dbutil.Db.GetConn(), workgroupId, businessObjectType)
+}
+
+type PostgresPendingBroadcastRepository struct {
+}
+
+func (r *PostgresPendingBroadcastRepository) CreatePendingBroadcast(offchainMsg *types.OffchainProcessMessage, entry *types.TrustmeshEntry, pending *types.PendingBroadcast, createPayload func(*types.OffchainProcessMessage) string) error {
+	return dbutil.UnitOfWork(func(tx *gorm.DB) error {
+		if err := offchainMsg.CreateWith(tx); err != nil {
+			return err
+		}
+
+		entry.OffchainProcessMessageId = offchainMsg.Id
+		if err := entry.CreateWith(tx); err != nil {
+			return err
+		}
+
+		pending.TrustmeshEntryId = entry.Id
+		pending.OffchainProcessMessageId = offchainMsg.Id
+		pending.Payload = createPayload(offchainMsg)
+		return pending.CreateWith(tx)
+	})
+}
+
+func (r *PostgresPendingBroadcastRepository) MarkBroadcasting(pending *types.PendingBroadcast) error {
+	return pending.MarkBroadcasting()
+}
+
+func (r *PostgresPendingBroadcastRepository) MarkUnconfirmed(pending *types.PendingBroadcast) error {
+	return pending.MarkUnconfirmed()
+}
+
+func (r *PostgresPendingBroadcastRepository) GetPendingBroadcastByTrustmeshEntryId(entryId uuid.UUID) (*types.PendingBroadcast, error) {
+	return types.GetPendingBroadcastByTrustmeshEntryId(entryId)
+}
+
+func (r *PostgresPendingBroadcastRepository) FinishPendingBroadcast(pending *types.PendingBroadcast, transactionHash string) error {
+	return dbutil.UnitOfWork(func(tx *gorm.DB) error {
+		err := types.SetTrustmeshEntryBroadcastedWith(tx, pending.TrustmeshEntryId, common.UncommittedCommitmentState, transactionHash)
+		if err != nil {
+			return err
+		}
+
+		return pending.DeleteWith(tx)
+	})
+}
+
+// pending broadcast row goes with the entry (on delete cascade)
+func (r *PostgresPendingBroadcastRepository) CompensatePendingBroadcast(pending *types.PendingBroadcast) error {
+	return dbutil.UnitOfWork(func(tx *gorm.DB) error {
+		return types.DeleteTrustmeshEntryWith(tx, pending.TrustmeshEntryId, pending.OffchainProcessMessageId)
+	})
+}
+
+func (r *PostgresPendingBroadcastRepository) RecordTransactionHash(pending *types.PendingBroadcast, transactionHash string) error {
+	return pending.RecordTransactionHash(transactionHash)
+}
+
+func (r *PostgresPendingBroadcastRepository) RecordLookupMiss(pending *types.PendingBroadcast) (int, error) {
+	return pending.RecordLookupMiss()
+}
+
+func (r *PostgresPendingBroadcastRepository) ClaimInterruptedPendingBroadcasts(now time.Time, pendingBefore time.Time, broadcastingBefore time.Time, lease time.Duration) ([]*types.PendingBroadcast, error) {
+	return types.ClaimInterruptedPendingBroadcasts(now, pendingBefore, broadcastingBefore, lease)
+}
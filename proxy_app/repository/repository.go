@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/types"
+	"github.com/unibrightio/proxy-api/workgroups"
+)
+
+type ITrustmeshRepository interface {
+	// trustmesh with all of its entries
+	GetTrustmeshById(id uuid.UUID) (*types.Trustmesh, error)
+	UpdateTrustmeshEthTxHash(id uuid.UUID, ethTxHash string) error
+}
+
+type ITrustmeshEntryRepository interface {
+	// creates entry and assigns it to trustmesh of referenced transaction or to a new trustmesh,
+	// commitment state is uncommitted unless set before
+	CreateTrustmeshEntry(entry *types.TrustmeshEntry) error
+	GetTrustmeshEntryById(id uuid.UUID) (*types.TrustmeshEntry, error)
+	// nil if trustmesh has no entries
+	GetLatestTrustmeshEntryBasedOnTrustmeshId(trustmeshId string) (*types.TrustmeshEntry, error)
+	// nil if no trustmesh contains bboid
+	GetLatestTrustmeshEntryBasedOnBboid(bboid string) (*types.TrustmeshEntry, error)
+	// suggestion entries of business object with offchain messages, oldest first, every new version reuses the bboid
+	GetBusinessObjectVersions(bboid string) ([]types.TrustmeshEntry, error)
+	GetTrustmeshEntriesByCommitmentState(commitmentState string) ([]types.TrustmeshEntry, error)
+	// claims up to limit uncommitted entries which are pending, or failed or processing with next retry time
+	// before now, and which are not claimed by another worker until now+lease,
+	// entry is not claimed while an earlier entry of its trustmesh is claimed so trustmesh order is kept
+	ClaimTrustmeshEntriesToProcess(now time.Time, limit int, lease time.Duration) ([]types.TrustmeshEntry, error)
+	ReleaseTrustmeshEntryClaims(ids []uuid.UUID) error
+	GetTrustmeshEntriesByProcessingState(processingState string) ([]types.TrustmeshEntry, error)
+	// stores commitment state and processing state, attempts, last error, next retry time and resolution of entry
+	UpdateTrustmeshEntryProcessing(entry *types.TrustmeshEntry) error
+	// sets commitment state and block info of entries with given tendermint transaction id
+	SetTrustmeshEntryCommitmentState(tendermintTransactionId uuid.UUID, commitmentState string, blockId string, timestamp string) error
+}
+
+type IOffchainMessageRepository interface {
+	CreateOffchainMessage(msg *types.OffchainProcessMessage) error
+	GetOffchainMsgById(id uuid.UUID) (*types.OffchainProcessMessage, error)
+}
+
+type IWorkgroupRepository interface {
+	workgroups.IWorkgroupClient
+	CreateWorkgroup(workgroup *types.Workgroup) error
+	CreateWorkgroupMember(member *types.WorkgroupMember) error
+}
+
+type IOrganizationRepository interface {
+	CreateOrganization(organization *types.Organization) error
+	GetOrganizationById(id uuid.UUID) (*types.Organization, error)
+}
+
+type IWebhookRepository interface {
+	CreateWebhook(webhook *types.SorWebhook) error
+	// nil if webhook of given type is not configured
+	FetchWebhookByType(webhookType types.WebhookType) *types.SorWebhook
+}
+
+type IBusinessObjectSchemaRepository interface {
+	// creates schema or replaces schema registered for its workgroup and business object type
+	SaveBusinessObjectSchema(schema *types.BusinessObjectSchema) error
+	// nil if no schema is registered, business objects of the type are then only checked to be json objects
+	GetBusinessObjectSchema(workgroupId uuid.UUID, businessObjectType string) (*types.BusinessObjectSchema, error)
+	GetBusinessObjectSchemas(workgroupId uuid.UUID) ([]types.BusinessObjectSchema, error)
+	// false if no schema was registered
+	DeleteBusinessObjectSchema(workgroupId uuid.UUID, businessObjectType string) (bool, error)
+}
+
+type IPendingBroadcastRepository interface {
+	// creates offchain message, trustmesh entry and pending broadcast in one transaction,
+	// createPayload is called once offchain message id is known and its result stored as pending payload
+	CreatePendingBroadcast(offchainMsg *types.OffchainProcessMessage, entry *types.TrustmeshEntry, pending *types.PendingBroadcast, createPayload func(*types.OffchainProcessMessage) string) error
+	// types.ErrPendingBroadcastTaken if row is not pending anymore
+	MarkBroadcasting(pending *types.PendingBroadcast) error
+	MarkUnconfirmed(pending *types.PendingBroadcast) error
+	// gorm.ErrRecordNotFound if entry has no pending broadcast
+	GetPendingBroadcastByTrustmeshEntryId(entryId uuid.UUID) (*types.PendingBroadcast, error)
+	// moves entry to uncommitted with transaction hash and removes pending broadcast in one transaction
+	FinishPendingBroadcast(pending *types.PendingBroadcast, transactionHash string) error
+	// keeps transaction hash on pending broadcast when finishing failed, so recovery can finish it later
+	RecordTransactionHash(pending *types.PendingBroadcast, transactionHash string) error
+	// returns how many times transaction was not found on chain, including this time
+	RecordLookupMiss(pending *types.PendingBroadcast) (int, error)
+	// removes entry, its offchain message and trustmesh if it was its only entry in one transaction
+	CompensatePendingBroadcast(pending *types.PendingBroadcast) error
+	// claims pending rows created before pendingBefore and broadcasting rows attempted before broadcastingBefore
+	// for the lease, rows claimed by other runs are skipped
+	ClaimInterruptedPendingBroadcasts(now time.Time, pendingBefore time.Time, broadcastingBefore time.Time, lease time.Duration) ([]*types.PendingBroadcast, error)
+}
+
+// Repositories groups persistence used by business logic, Postgres is used by the app and in-memory in tests
+type Repositories struct {
+	Trustmeshes       ITrustmeshRepository
+	TrustmeshEntries  ITrustmeshEntryRepository
+	OffchainMessages  IOffchainMessageRepository
+	Workgroups        IWorkgroupRepository
+	Organizations     IOrganizationRepository
+	Webhooks          IWebhookRepository
+	PendingBroadcasts IPendingBroadcastRepository
+	Schemas           IBusinessObjectSchemaRepository
+}
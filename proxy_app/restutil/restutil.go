@@ -2,110 +2,199 @@ package restutil
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	uuid "github.com/kthomas/go.uuid"
-	"github.com/spf13/viper"
-	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/config"
 	"github.com/unibrightio/proxy-api/logger"
-	"github.com/unibrightio/proxy-api/proxyutil"
+	"github.com/unibrightio/proxy-api/metrics"
+	"github.com/unibrightio/proxy-api/tracing"
 	"github.com/unibrightio/proxy-api/types"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const defaultResponseContentType = "application/json; charset=UTF-8"
 
+var restutilLog = logger.For("restutil")
+
+// BroadcastBudget is consumed before every sign and broadcast, see ratelimit.NewBroadcastBudget.
+// Set on startup, when nil broadcasts are not limited
+var BroadcastBudget func(ctx context.Context) error
+
 type SignAndBroadcastPayload struct {
 	TransactionId string `json:"transaction_id"`
 	Payload       string `json:"payload"`
 	OpCode        uint32 `json:"op_code"`
 }
 
-func SignAndBroadcast(payload SignAndBroadcastPayload) *string {
+type IBlockchainClient interface {
+	// returns transaction hash, nil if transaction was not broadcasted
+	SignAndBroadcast(ctx context.Context, payload SignAndBroadcastPayload) *string
+	// returns transaction stored on chain, nil if it could not be fetched
+	GetCommittedBaseledgerTransaction(ctx context.Context, id uuid.UUID) *types.BaseledgerTransactionDto
+}
+
+// RestBlockchainClient talks to blockchain app over its rest api
+type RestBlockchainClient struct {
+}
+
+func (client *RestBlockchainClient) SignAndBroadcast(ctx context.Context, payload SignAndBroadcastPayload) *string {
+	return SignAndBroadcast(ctx, payload)
+}
+
+func (client *RestBlockchainClient) GetCommittedBaseledgerTransaction(ctx context.Context, id uuid.UUID) *types.BaseledgerTransactionDto {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+config.Get().Blockchain.AppUrl+"/unibrightio/baseledger/baseledger/BaseledgerTransaction/"+id.String(), nil)
+	if err != nil {
+		logger.Errorf("error while creating committed baseledger transaction request %v\n", err.Error())
+		return nil
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		logger.Errorf("error while fetching committed baseledger transaction %v\n", err.Error())
+		return nil
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logger.Errorf("error while reading committed baseledger transaction response %v\n", err.Error())
+		return nil
+	}
+
+	restutilLog.Ctx(ctx).Debug("committed baseledger transaction fetched", logger.F("baseledger_transaction_id", id.String()), logger.Payload("body", string(body)))
+
+	var transactionResponse types.CommittedBaseledgerTransactionResponse
+	err = json.Unmarshal(body, &transactionResponse)
+
+	if err != nil {
+		logger.Errorf("error while unmarshalling fetched committed baseledger transaction %v\n", err.Error())
+		return nil
+	}
+
+	return &transactionResponse.BaseledgerTransaction
+}
+
+func SignAndBroadcast(ctx context.Context, payload SignAndBroadcastPayload) *string {
+	ctx, span := tracing.StartWithKind(ctx, "SignAndBroadcast", trace.SpanKindClient, tracing.TransactionIdKey.String(payload.TransactionId))
+	start := time.Now()
+	defer func() {
+		metrics.SignAndBroadcastDuration.Observe(time.Since(start).Seconds())
+		span.End()
+	}()
+
 	if !HasEnoughBalance() {
 		logger.Error("Not enough token balance to broadcast transaction")
+		metrics.SignAndBroadcastFailures.WithLabelValues("insufficient_balance").Inc()
+		tracing.Fail(span, "not enough token balance")
 		return nil
 	}
 
+	if BroadcastBudget != nil {
+		if err := BroadcastBudget(ctx); err != nil {
+			restutilLog.Ctx(ctx).Error("broadcast budget not available", logger.F("error", err.Error()))
+			metrics.SignAndBroadcastFailures.WithLabelValues("rate_limited").Inc()
+			tracing.Fail(span, "rate limited")
+			return nil
+		}
+	}
+
 	jsonValue, err := json.Marshal(payload)
 
 	if err != nil {
 		logger.Error("Error marshaling sign and broadcast json")
+		metrics.SignAndBroadcastFailures.WithLabelValues("marshal").Inc()
+		tracing.Fail(span, "marshal error")
 		return nil
 	}
 
-	resp, err := http.Post("http://"+viper.Get("BLOCKCHAIN_APP_URL").(string)+"/signAndBroadcast", "application/json", bytes.NewBuffer(jsonValue))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+config.Get().Blockchain.AppUrl+"/signAndBroadcast", bytes.NewBuffer(jsonValue))
+	if err != nil {
+		logger.Errorf("error while creating sign and broadcast request %v\n", err.Error())
+		metrics.SignAndBroadcastFailures.WithLabelValues("request").Inc()
+		tracing.Fail(span, "request error")
+		return nil
+	}
+	request.Header.Set("Content-Type", "application/json")
+	tracing.InjectHttp(ctx, request)
+
+	resp, err := http.DefaultClient.Do(request)
 
 	if err != nil {
 		logger.Errorf("error while sending feedback request %v\n", err.Error())
+		metrics.SignAndBroadcastFailures.WithLabelValues("request").Inc()
+		tracing.Fail(span, "request error")
 		return nil
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		logger.Errorf("error while reading sign and broadcast transaction response %v\n", err.Error())
+		metrics.SignAndBroadcastFailures.WithLabelValues("response").Inc()
+		tracing.Fail(span, "response error")
 		return nil
 	}
 
 	txHash := string(body)
+	span.SetAttributes(tracing.TransactionHashKey.String(txHash))
 	return &txHash
 }
 
-func HasEnoughBalance() bool {
-	resp, err := http.Get("http://" + viper.Get("BLOCKCHAIN_APP_URL").(string) + "/balanceCheck")
+// BroadcastTransaction adapts SignAndBroadcast to saga.Broadcaster
+func BroadcastTransaction(ctx context.Context, transactionId uuid.UUID, payload string, opCode uint32) *string {
+	return SignAndBroadcast(ctx, SignAndBroadcastPayload{
+		TransactionId: transactionId.String(),
+		Payload:       payload,
+		OpCode:        opCode,
+	})
+}
 
+// BaseledgerTransactionExists checks if transaction with given id is stored on chain, implements saga.TransactionLookup
+func BaseledgerTransactionExists(ctx context.Context, id uuid.UUID) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+config.Get().Blockchain.AppUrl+"/unibrightio/baseledger/baseledger/BaseledgerTransaction/"+id.String(), nil)
 	if err != nil {
-		logger.Errorf("error while sending feedback request %v\n", err.Error())
-		return false
+		return false, err
 	}
 
-	return resp.StatusCode == 200
-}
-
-func SendRejectFeedback(offchainProcessMessage *types.OffchainProcessMessage, workgroupId string) {
-	var feedback = &types.NewFeedbackRequest{
-		WorkgroupId:        uuid.FromStringOrNil(workgroupId),
-		BusinessObjectType: offchainProcessMessage.BusinessObjectType,
-		Recipient:          offchainProcessMessage.ReceiverId.String(),
-		Approved:           false,
-		BaseledgerBusinessObjectIdOfApprovedObject: offchainProcessMessage.BaseledgerBusinessObjectId,
-		HashOfObjectToApprove:                      offchainProcessMessage.BusinessObjectProof,
-		OriginalBaseledgerTransactionId:            offchainProcessMessage.BaseledgerTransactionIdOfStoredProof.String(),
-		OriginalOffchainProcessMessageId:           offchainProcessMessage.Id.String(),
-		FeedbackMessage:                            "Rejected because Hashes do not match",
-		BaseledgerProvenBusinessObjectJson:         offchainProcessMessage.BaseledgerSyncTreeJson,
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return false, err
 	}
+	defer resp.Body.Close()
 
-	transactionId := uuid.NewV4()
-
-	offchainMsg := createFeedbackOffchainMessage(*feedback, transactionId, common.BaseledgerTransactionTypeReject)
-
-	if !offchainMsg.Create() {
-		logger.Errorf("error when creating new offchain msg entry")
-		return
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
 	}
 
-	payload := proxyutil.CreateNewFeedbackBaseledgerTransactionPayload(feedback, &offchainMsg)
-
-	signAndBroadcastPayload := SignAndBroadcastPayload{
-		TransactionId: transactionId.String(),
-		Payload:       payload,
+	if resp.StatusCode == http.StatusOK {
+		return true, nil
 	}
 
-	transactionHash := SignAndBroadcast(signAndBroadcastPayload)
-
-	if transactionHash == nil {
-		return
+	// cosmos rest returns 500 with not found message for missing store keys
+	if resp.StatusCode == http.StatusNotFound || strings.Contains(strings.ToLower(string(body)), "not found") {
+		return false, nil
 	}
 
-	trustmeshEntry := createFeedbackSentTrustmeshEntry(*feedback, transactionId, offchainMsg, common.BaseledgerTransactionTypeReject, *transactionHash)
+	return false, fmt.Errorf("unexpected status %v when looking up transaction %v", resp.StatusCode, id.String())
+}
+
+func HasEnoughBalance() bool {
+	resp, err := http.Get("http://" + config.Get().Blockchain.AppUrl + "/balanceCheck")
 
-	if !trustmeshEntry.Create() {
-		logger.Errorf("error when creating new trustmesh entry")
-		return
+	if err != nil {
+		logger.Errorf("error while sending feedback request %v\n", err.Error())
+		return false
 	}
+
+	return resp.StatusCode == 200
 }
 
 // Render an object and status using the given gin context
@@ -113,7 +202,7 @@ func Render(obj interface{}, status int, c *gin.Context) {
 	c.Header("content-type", defaultResponseContentType)
 	c.Writer.WriteHeader(status)
 	if &obj != nil && status != http.StatusNoContent {
-		logger.Infof("response object %v", &obj)
+		restutilLog.Ctx(c.Request.Context()).Debug("rendering response", logger.F("status", status), logger.Payload("response", obj))
 		encoder := json.NewEncoder(c.Writer)
 		encoder.SetIndent("", "    ")
 		if err := encoder.Encode(obj); err != nil {
@@ -130,46 +219,3 @@ func RenderError(message string, status int, c *gin.Context) {
 	logger.Errorf("request error %v", err)
 	Render(err, status, c)
 }
-
-func createFeedbackOffchainMessage(req types.NewFeedbackRequest, transactionId uuid.UUID, baseledgerTransactionType string) types.OffchainProcessMessage {
-	offchainMessage := types.OffchainProcessMessage{
-		SenderId:                             uuid.FromStringOrNil(viper.Get("ORGANIZATION_ID").(string)),
-		ReceiverId:                           uuid.FromStringOrNil(req.Recipient),
-		Topic:                                req.WorkgroupId.String(),
-		WorkstepType:                         "Feedback",
-		BaseledgerSyncTreeJson:               req.BaseledgerProvenBusinessObjectJson,
-		BusinessObjectProof:                  req.HashOfObjectToApprove,
-		BaseledgerBusinessObjectId:           "",
-		ReferencedBaseledgerBusinessObjectId: req.BaseledgerBusinessObjectIdOfApprovedObject,
-		StatusTextMessage:                    req.FeedbackMessage,
-		BaseledgerTransactionIdOfStoredProof: transactionId,
-		TendermintTransactionIdOfStoredProof: transactionId,
-		BusinessObjectType:                   req.BusinessObjectType,
-		BaseledgerTransactionType:            baseledgerTransactionType,
-		ReferencedBaseledgerTransactionId:    uuid.FromStringOrNil(req.OriginalBaseledgerTransactionId),
-		EntryType:                            common.FeedbackSentTrustmeshEntryType,
-	}
-
-	return offchainMessage
-}
-
-func createFeedbackSentTrustmeshEntry(req types.NewFeedbackRequest, transactionId uuid.UUID, offchainMsg types.OffchainProcessMessage, feedbackMsg string, txHash string) *types.TrustmeshEntry {
-	trustmeshEntry := &types.TrustmeshEntry{
-		TendermintTransactionId:              transactionId,
-		OffchainProcessMessageId:             offchainMsg.Id,
-		SenderOrgId:                          uuid.FromStringOrNil(viper.Get("ORGANIZATION_ID").(string)),
-		ReceiverOrgId:                        uuid.FromStringOrNil(req.Recipient),
-		WorkgroupId:                          req.WorkgroupId,
-		WorkstepType:                         offchainMsg.WorkstepType,
-		BaseledgerTransactionType:            feedbackMsg,
-		BaseledgerTransactionId:              transactionId,
-		ReferencedBaseledgerTransactionId:    uuid.FromStringOrNil(req.OriginalBaseledgerTransactionId),
-		BusinessObjectType:                   req.BusinessObjectType,
-		BaseledgerBusinessObjectId:           offchainMsg.BaseledgerBusinessObjectId,
-		ReferencedBaseledgerBusinessObjectId: offchainMsg.ReferencedBaseledgerBusinessObjectId,
-		TransactionHash:                      txHash,
-		EntryType:                            common.FeedbackSentTrustmeshEntryType,
-	}
-
-	return trustmeshEntry
-}
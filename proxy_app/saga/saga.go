@@ -0,0 +1,193 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/tracing"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+var sagaLog = logger.For("saga")
+
+var ErrBroadcastFailed = errors.New("sign and broadcast transaction error")
+
+// Broadcaster signs and broadcasts transaction, returns transaction hash or nil if broadcast failed
+type Broadcaster func(ctx context.Context, transactionId uuid.UUID, payload string, opCode uint32) *string
+
+// TransactionLookup checks if transaction with given id ended up on chain
+type TransactionLookup func(ctx context.Context, transactionId uuid.UUID) (bool, error)
+
+// BroadcastSaga creates offchain message and trustmesh entry for outgoing suggestion or feedback.
+// Rows are written in one transaction with entry in PENDING_BROADCAST state, transaction is broadcasted
+// afterwards and entry is either moved to UNCOMMITTED with transaction hash or compensated (deleted).
+// If process dies in between, pending broadcast row is picked up by RecoverInterrupted.
+type BroadcastSaga struct {
+	OffchainMessage *types.OffchainProcessMessage
+	TrustmeshEntry  *types.TrustmeshEntry
+	TransactionId   uuid.UUID
+	OpCode          uint32
+	// CreatePayload is called inside transaction once offchain message id is known
+	CreatePayload func(offchainMsg *types.OffchainProcessMessage) string
+}
+
+func (s *BroadcastSaga) Run(ctx context.Context, pendingBroadcasts repository.IPendingBroadcastRepository, broadcast Broadcaster) error {
+	ctx, span := tracing.Start(ctx, "BroadcastSaga", tracing.TransactionIdKey.String(s.TransactionId.String()))
+	defer span.End()
+
+	s.TrustmeshEntry.CommitmentState = common.PendingBroadcastCommitmentState
+	s.TrustmeshEntry.TransactionHash = ""
+	pending := &types.PendingBroadcast{
+		TransactionId: s.TransactionId,
+		OpCode:        s.OpCode,
+	}
+
+	err := pendingBroadcasts.CreatePendingBroadcast(s.OffchainMessage, s.TrustmeshEntry, pending, s.CreatePayload)
+	if err != nil {
+		sagaLog.Ctx(ctx).Error("failed to create pending trustmesh entry", logger.F("error", err))
+		tracing.Fail(span, "create error")
+		return err
+	}
+
+	// recovery already took the row over and broadcasts it, entry stays pending broadcast until then
+	err = pendingBroadcasts.MarkBroadcasting(pending)
+	if err == types.ErrPendingBroadcastTaken {
+		sagaLog.Ctx(ctx).Warn("pending broadcast taken over by recovery", logger.F("pending_broadcast_id", pending.Id.String()))
+		return nil
+	}
+
+	// nothing was broadcasted yet so it is safe to compensate
+	if err != nil {
+		compensate(ctx, pendingBroadcasts, pending)
+		tracing.Fail(span, "mark broadcasting error")
+		return err
+	}
+
+	transactionHash := broadcast(ctx, s.TransactionId, pending.Payload, pending.OpCode)
+	if transactionHash == nil {
+		compensate(ctx, pendingBroadcasts, pending)
+		tracing.Fail(span, "broadcast error")
+		return ErrBroadcastFailed
+	}
+
+	// transaction is on its way to the chain, failing here would make client retry and broadcast twice.
+	// row stays in BROADCASTING state and recovery sorts it out
+	s.TrustmeshEntry.CommitmentState = common.UncommittedCommitmentState
+	s.TrustmeshEntry.TransactionHash = *transactionHash
+	finish(ctx, pendingBroadcasts, pending, *transactionHash)
+
+	return nil
+}
+
+// RecoveryPolicy defines when interrupted sagas are recovered
+type RecoveryPolicy struct {
+	// pending rows older than this were never broadcasted by the live saga
+	After time.Duration
+	// broadcasting rows are looked up on chain this long after broadcast, longer than block commit time.
+	// Claims of recovered rows last as long, so lookups of the same row are at least this far apart
+	BroadcastGrace time.Duration
+	// broadcasting row is compensated once its transaction was not found in this many lookups
+	CompensateAfterMisses int
+}
+
+// RecoverInterrupted completes interrupted sagas. Rows never broadcasted are broadcasted now,
+// rows with unknown broadcast outcome are compensated if transaction repeatedly is not found on chain.
+// Rows are claimed, so recovery running on several replicas or next to live saga never handles the same row twice
+func RecoverInterrupted(ctx context.Context, pendingBroadcasts repository.IPendingBroadcastRepository, broadcast Broadcaster, lookup TransactionLookup, policy RecoveryPolicy) {
+	now := time.Now()
+	interrupted, err := pendingBroadcasts.ClaimInterruptedPendingBroadcasts(now, now.Add(-policy.After), now.Add(-policy.BroadcastGrace), policy.BroadcastGrace)
+	if err != nil {
+		return
+	}
+
+	for _, pending := range interrupted {
+		if ctx.Err() != nil {
+			return
+		}
+
+		recoverOne(ctx, pendingBroadcasts, pending, broadcast, lookup, policy)
+	}
+}
+
+func recoverOne(ctx context.Context, pendingBroadcasts repository.IPendingBroadcastRepository, pending *types.PendingBroadcast, broadcast Broadcaster, lookup TransactionLookup, policy RecoveryPolicy) {
+	log := sagaLog.Ctx(ctx).With(logger.F("pending_broadcast_id", pending.Id.String()), logger.F("transaction_id", pending.TransactionId.String()))
+
+	switch pending.Status {
+	case types.PendingBroadcastStatusPending:
+		// fails with types.ErrPendingBroadcastTaken when live saga got to it first
+		if err := pendingBroadcasts.MarkBroadcasting(pending); err != nil {
+			return
+		}
+
+		transactionHash := broadcast(ctx, pending.TransactionId, pending.Payload, pending.OpCode)
+		if transactionHash == nil {
+			log.Warn("broadcast of recovered transaction failed, compensating")
+			compensate(ctx, pendingBroadcasts, pending)
+			return
+		}
+
+		if finish(ctx, pendingBroadcasts, pending, *transactionHash) {
+			log.Info("recovered pending broadcast")
+		}
+	case types.PendingBroadcastStatusBroadcasting:
+		// broadcast succeeded but entry could not be updated at the time
+		if pending.TransactionHash != "" {
+			if finish(ctx, pendingBroadcasts, pending, pending.TransactionHash) {
+				log.Info("recovered broadcasted transaction")
+			}
+			return
+		}
+
+		exists, err := lookup(ctx, pending.TransactionId)
+		if err != nil {
+			log.Warn("failed to look up transaction, will retry", logger.F("error", err))
+			return
+		}
+
+		if !exists {
+			// transaction can still be in mempool, compensating too early would drop a committed entry
+			misses, err := pendingBroadcasts.RecordLookupMiss(pending)
+			if err != nil || misses < policy.CompensateAfterMisses {
+				log.Warn("interrupted transaction not found on chain, will look up again", logger.F("lookup_misses", misses))
+				return
+			}
+
+			log.Warn("interrupted transaction repeatedly not found on chain, compensating", logger.F("lookup_misses", misses))
+			compensate(ctx, pendingBroadcasts, pending)
+			return
+		}
+
+		// transaction hash is returned only by broadcast, without it commitment cannot be checked
+		// operator finishes it with the hash looked up on chain or abandons it (proxyctl entry finish-broadcast, abandon-broadcast)
+		log.Error("interrupted transaction found on chain but its hash is unknown, needs manual resolution")
+		pendingBroadcasts.MarkUnconfirmed(pending)
+	}
+}
+
+// finish moves entry to uncommitted, when that fails transaction hash is kept on pending broadcast
+// so recovery can finish it instead of looking up a transaction it can not resolve without hash
+func finish(ctx context.Context, pendingBroadcasts repository.IPendingBroadcastRepository, pending *types.PendingBroadcast, transactionHash string) bool {
+	err := pendingBroadcasts.FinishPendingBroadcast(pending, transactionHash)
+	if err == nil {
+		return true
+	}
+
+	log := sagaLog.Ctx(ctx).With(logger.F("pending_broadcast_id", pending.Id.String()), logger.F("transaction_hash", transactionHash))
+	log.Error("failed to record broadcasted transaction", logger.F("error", err))
+	if err = pendingBroadcasts.RecordTransactionHash(pending, transactionHash); err != nil {
+		log.Error("failed to keep transaction hash for recovery", logger.F("error", err))
+	}
+	return false
+}
+
+// compensate removes everything saga created
+func compensate(ctx context.Context, pendingBroadcasts repository.IPendingBroadcastRepository, pending *types.PendingBroadcast) {
+	if err := pendingBroadcasts.CompensatePendingBroadcast(pending); err != nil {
+		sagaLog.Ctx(ctx).Error("failed to compensate pending trustmesh entry", logger.F("pending_broadcast_id", pending.Id.String()), logger.F("error", err))
+	}
+}
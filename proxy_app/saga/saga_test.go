@@ -0,0 +1,254 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+// fakeChain counts broadcasts per transaction and reports broadcasted transactions as found
+type fakeChain struct {
+	mutex      sync.Mutex
+	broadcasts map[uuid.UUID]int
+	fail       bool
+	delay      time.Duration
+}
+
+func newFakeChain() *fakeChain {
+	return &fakeChain{broadcasts: map[uuid.UUID]int{}}
+}
+
+func (c *fakeChain) broadcast(ctx context.Context, transactionId uuid.UUID, payload string, opCode uint32) *string {
+	time.Sleep(c.delay)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.fail {
+		return nil
+	}
+	c.broadcasts[transactionId]++
+	hash := "hash-" + transactionId.String()
+	return &hash
+}
+
+func (c *fakeChain) broadcastCount(transactionId uuid.UUID) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.broadcasts[transactionId]
+}
+
+func notOnChain(ctx context.Context, transactionId uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func onChain(ctx context.Context, transactionId uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+// failingFinishRepository fails to finish broadcasts as long as finishFails is set
+type failingFinishRepository struct {
+	repository.IPendingBroadcastRepository
+	finishFails bool
+}
+
+func (r *failingFinishRepository) FinishPendingBroadcast(pending *types.PendingBroadcast, transactionHash string) error {
+	if r.finishFails {
+		return errors.New("db unavailable")
+	}
+	return r.IPendingBroadcastRepository.FinishPendingBroadcast(pending, transactionHash)
+}
+
+func newSaga() *BroadcastSaga {
+	transactionId := uuid.NewV4()
+	return &BroadcastSaga{
+		OffchainMessage: &types.OffchainProcessMessage{},
+		TrustmeshEntry:  &types.TrustmeshEntry{BaseledgerTransactionId: transactionId},
+		TransactionId:   transactionId,
+		CreatePayload:   func(offchainMsg *types.OffchainProcessMessage) string { return "payload" },
+	}
+}
+
+// interruptedSaga creates rows of saga as if process died before or right after broadcast
+func interruptedSaga(t *testing.T, repositories *repository.Repositories, status string) (*BroadcastSaga, *types.PendingBroadcast) {
+	saga := newSaga()
+	pending := &types.PendingBroadcast{TransactionId: saga.TransactionId}
+	saga.TrustmeshEntry.CommitmentState = common.PendingBroadcastCommitmentState
+	if err := repositories.PendingBroadcasts.CreatePendingBroadcast(saga.OffchainMessage, saga.TrustmeshEntry, pending, saga.CreatePayload); err != nil {
+		t.Fatalf("creating pending broadcast failed %v", err)
+	}
+	if status == types.PendingBroadcastStatusBroadcasting {
+		repositories.PendingBroadcasts.MarkBroadcasting(pending)
+	}
+
+	return saga, pending
+}
+
+func entryState(t *testing.T, repositories *repository.Repositories, transactionId uuid.UUID) *types.TrustmeshEntry {
+	for _, state := range []string{common.PendingBroadcastCommitmentState, common.UncommittedCommitmentState} {
+		entries, _ := repositories.TrustmeshEntries.GetTrustmeshEntriesByCommitmentState(state)
+		for _, entry := range entries {
+			if entry.BaseledgerTransactionId == transactionId {
+				return &entry
+			}
+		}
+	}
+
+	return nil
+}
+
+var immediateRecovery = RecoveryPolicy{After: 0, BroadcastGrace: 0, CompensateAfterMisses: 2}
+
+func TestGivenPendingBroadcastWhenSagaRunsThenEntryIsUncommittedWithTransactionHash(t *testing.T) {
+	repositories := repository.NewInMemory()
+	chain := newFakeChain()
+	saga := newSaga()
+
+	if err := saga.Run(context.Background(), repositories.PendingBroadcasts, chain.broadcast); err != nil {
+		t.Fatalf("saga failed %v", err)
+	}
+
+	entry := entryState(t, repositories, saga.TransactionId)
+	if entry == nil || entry.CommitmentState != common.UncommittedCommitmentState || entry.TransactionHash != "hash-"+saga.TransactionId.String() {
+		t.Fatalf("expected uncommitted entry with hash, got %+v", entry)
+	}
+	if left, _ := repositories.PendingBroadcasts.ClaimInterruptedPendingBroadcasts(time.Now(), time.Now(), time.Now(), 0); len(left) != 0 {
+		t.Fatalf("expected pending broadcast to be removed, got %v", len(left))
+	}
+}
+
+func TestGivenFailingBroadcastWhenSagaRunsThenEntryIsCompensated(t *testing.T) {
+	repositories := repository.NewInMemory()
+	chain := newFakeChain()
+	chain.fail = true
+	saga := newSaga()
+
+	if err := saga.Run(context.Background(), repositories.PendingBroadcasts, chain.broadcast); err != ErrBroadcastFailed {
+		t.Fatalf("expected broadcast error, got %v", err)
+	}
+	if entry := entryState(t, repositories, saga.TransactionId); entry != nil {
+		t.Fatalf("expected entry to be compensated, got %+v", entry)
+	}
+}
+
+func TestGivenInterruptedPendingBroadcastWhenRecoveredThenItIsBroadcasted(t *testing.T) {
+	repositories := repository.NewInMemory()
+	chain := newFakeChain()
+	saga, _ := interruptedSaga(t, repositories, types.PendingBroadcastStatusPending)
+
+	RecoverInterrupted(context.Background(), repositories.PendingBroadcasts, chain.broadcast, notOnChain, immediateRecovery)
+
+	entry := entryState(t, repositories, saga.TransactionId)
+	if chain.broadcastCount(saga.TransactionId) != 1 || entry == nil || entry.CommitmentState != common.UncommittedCommitmentState {
+		t.Fatalf("expected recovered entry to be broadcasted once, got %+v", entry)
+	}
+}
+
+func TestGivenBroadcastingTransactionFoundOnChainWhenRecoveredThenItIsLeftForOperator(t *testing.T) {
+	repositories := repository.NewInMemory()
+	chain := newFakeChain()
+	saga, _ := interruptedSaga(t, repositories, types.PendingBroadcastStatusBroadcasting)
+
+	RecoverInterrupted(context.Background(), repositories.PendingBroadcasts, chain.broadcast, onChain, immediateRecovery)
+
+	if entry := entryState(t, repositories, saga.TransactionId); entry == nil || chain.broadcastCount(saga.TransactionId) != 0 {
+		t.Fatalf("expected entry to be kept without broadcast, got %+v", entry)
+	}
+	if left, _ := repositories.PendingBroadcasts.ClaimInterruptedPendingBroadcasts(time.Now(), time.Now(), time.Now(), 0); len(left) != 0 {
+		t.Fatalf("expected unconfirmed pending broadcast not to be recovered again")
+	}
+}
+
+func TestGivenBroadcastingTransactionNotFoundOnChainWhenRecoveredThenItIsCompensatedOnlyAfterRepeatedMisses(t *testing.T) {
+	repositories := repository.NewInMemory()
+	chain := newFakeChain()
+	saga, _ := interruptedSaga(t, repositories, types.PendingBroadcastStatusBroadcasting)
+
+	RecoverInterrupted(context.Background(), repositories.PendingBroadcasts, chain.broadcast, notOnChain, immediateRecovery)
+	if entry := entryState(t, repositories, saga.TransactionId); entry == nil {
+		t.Fatalf("expected entry to be kept after first miss")
+	}
+
+	RecoverInterrupted(context.Background(), repositories.PendingBroadcasts, chain.broadcast, notOnChain, immediateRecovery)
+	if entry := entryState(t, repositories, saga.TransactionId); entry != nil {
+		t.Fatalf("expected entry to be compensated after second miss, got %+v", entry)
+	}
+}
+
+func TestGivenBroadcastingTransactionWithinGraceWhenRecoveredThenItIsNotLookedUp(t *testing.T) {
+	repositories := repository.NewInMemory()
+	chain := newFakeChain()
+	saga, _ := interruptedSaga(t, repositories, types.PendingBroadcastStatusBroadcasting)
+
+	lookedUp := false
+	lookup := func(ctx context.Context, transactionId uuid.UUID) (bool, error) {
+		lookedUp = true
+		return false, nil
+	}
+	RecoverInterrupted(context.Background(), repositories.PendingBroadcasts, chain.broadcast, lookup, RecoveryPolicy{BroadcastGrace: time.Hour, CompensateAfterMisses: 1})
+
+	if lookedUp || entryState(t, repositories, saga.TransactionId) == nil {
+		t.Fatalf("expected transaction in grace period not to be looked up")
+	}
+}
+
+func TestGivenFinishFailingAfterBroadcastWhenRecoveredThenRecordedTransactionHashIsUsed(t *testing.T) {
+	repositories := repository.NewInMemory()
+	pendingBroadcasts := &failingFinishRepository{IPendingBroadcastRepository: repositories.PendingBroadcasts, finishFails: true}
+	chain := newFakeChain()
+	saga := newSaga()
+
+	if err := saga.Run(context.Background(), pendingBroadcasts, chain.broadcast); err != nil {
+		t.Fatalf("saga must not fail once transaction is broadcasted, got %v", err)
+	}
+
+	// lookup is not needed, hash recorded by live saga is enough
+	pendingBroadcasts.finishFails = false
+	RecoverInterrupted(context.Background(), pendingBroadcasts, chain.broadcast, notOnChain, RecoveryPolicy{CompensateAfterMisses: 1})
+
+	entry := entryState(t, repositories, saga.TransactionId)
+	if entry == nil || entry.CommitmentState != common.UncommittedCommitmentState || entry.TransactionHash != "hash-"+saga.TransactionId.String() {
+		t.Fatalf("expected entry to be finished with recorded hash, got %+v", entry)
+	}
+	if chain.broadcastCount(saga.TransactionId) != 1 {
+		t.Fatalf("expected single broadcast, got %v", chain.broadcastCount(saga.TransactionId))
+	}
+}
+
+func TestGivenRecoveryRunningNextToLiveSagaWhenBothSeePendingBroadcastThenItIsBroadcastedOnce(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		repositories := repository.NewInMemory()
+		chain := newFakeChain()
+		chain.delay = time.Millisecond
+		saga := newSaga()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			saga.Run(context.Background(), repositories.PendingBroadcasts, chain.broadcast)
+		}()
+
+		recovering := true
+		for recovering {
+			select {
+			case <-done:
+				recovering = false
+			default:
+				RecoverInterrupted(context.Background(), repositories.PendingBroadcasts, chain.broadcast, onChain, RecoveryPolicy{BroadcastGrace: time.Hour, CompensateAfterMisses: 1})
+			}
+		}
+		RecoverInterrupted(context.Background(), repositories.PendingBroadcasts, chain.broadcast, onChain, RecoveryPolicy{BroadcastGrace: time.Hour, CompensateAfterMisses: 1})
+
+		entry := entryState(t, repositories, saga.TransactionId)
+		if chain.broadcastCount(saga.TransactionId) != 1 || entry == nil || entry.CommitmentState != common.UncommittedCommitmentState {
+			t.Fatalf("expected single broadcast, got %v broadcasts and entry %+v", chain.broadcastCount(saga.TransactionId), entry)
+		}
+	}
+}
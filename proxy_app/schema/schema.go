@@ -0,0 +1,276 @@
+// Package schema validates business objects against JSON Schemas agreed in a workgroup. Schemas are
+// JSON Schema draft-07, validated with gojsonschema. $schema of another draft and $ref to anything but
+// the schema itself are rejected when schema is compiled, so validation never loads remote documents
+// and members do not silently validate something else than agreed
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// SupportedDraft is the JSON Schema draft schemas are written in, $schema may be omitted
+const SupportedDraft = "http://json-schema.org/draft-07/schema#"
+
+// ErrInvalidBusinessObject is matched (errors.Is) when business object is not json or does not match schema
+var ErrInvalidBusinessObject = errors.New("invalid business object")
+
+// ValidationError is one violation of schema, path is json pointer to the violating value
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) String() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors is returned by Validate, message lists all violations
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := []string{}
+	for _, err := range e {
+		messages = append(messages, err.String())
+	}
+	return "business object does not match schema: " + strings.Join(messages, "; ")
+}
+
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrInvalidBusinessObject
+}
+
+// Schema is compiled JSON Schema, raw keeps the decoded schema to read sync tree leaf strings by it
+type Schema struct {
+	compiled *gojsonschema.Schema
+	raw      interface{}
+}
+
+// Compile parses schema json and checks it against the draft-07 meta schema
+func Compile(schemaJson string) (*Schema, error) {
+	var raw interface{}
+	if err := decode(schemaJson, &raw); err != nil {
+		return nil, fmt.Errorf("schema is not valid json %w", err)
+	}
+	if keywords, ok := raw.(map[string]interface{}); ok {
+		if draft, ok := keywords["$schema"]; ok && strings.TrimSuffix(fmt.Sprint(draft), "#") != strings.TrimSuffix(SupportedDraft, "#") {
+			return nil, fmt.Errorf("schema draft %v is not supported, expected %v", draft, SupportedDraft)
+		}
+	}
+	if ref := externalRef(raw); ref != "" {
+		return nil, fmt.Errorf("schema references %v, only references within the schema are supported", ref)
+	}
+
+	loader := gojsonschema.NewSchemaLoader()
+	loader.Draft = gojsonschema.Draft7
+	loader.AutoDetect = false
+	loader.Validate = true
+	compiled, err := loader.Compile(gojsonschema.NewGoLoader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("schema is invalid %w", err)
+	}
+
+	return &Schema{compiled: compiled, raw: raw}, nil
+}
+
+// externalRef returns first $ref that does not point into the schema itself
+func externalRef(raw interface{}) string {
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		for keyword, value := range v {
+			if ref, ok := value.(string); ok && keyword == "$ref" && !strings.HasPrefix(ref, "#") {
+				return ref
+			}
+			if ref := externalRef(value); ref != "" {
+				return ref
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if ref := externalRef(value); ref != "" {
+				return ref
+			}
+		}
+	}
+	return ""
+}
+
+// Validate checks that business object json is an object matching schema, all violations are returned
+// sorted by path. Nil schema only checks that business object is a json object
+func (s *Schema) Validate(businessObjectJson string) error {
+	var value interface{}
+	if err := decode(businessObjectJson, &value); err != nil {
+		return ValidationErrors{{Path: "/", Message: "business object is not valid json"}}
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		return ValidationErrors{{Path: "/", Message: "business object has to be a json object"}}
+	}
+	if s == nil {
+		return nil
+	}
+
+	return s.validateValue(value)
+}
+
+// ValidateSyncTreeObject validates business object read from sync tree leaves whose values are strings
+// (trees without typed leaves, business objects decoded from xml, edifact or csv).
+// A string is accepted where schema expects number, integer, boolean or null if it reads as one
+func (s *Schema) ValidateSyncTreeObject(businessObjectJson string) error {
+	if err := (*Schema)(nil).Validate(businessObjectJson); err != nil || s == nil {
+		return err
+	}
+
+	var value interface{}
+	decode(businessObjectJson, &value)
+	return s.validateValue(readLeafStrings(s.raw, value))
+}
+
+func (s *Schema) validateValue(value interface{}) error {
+	result, err := s.compiled.Validate(gojsonschema.NewGoLoader(value))
+	if err != nil {
+		return ValidationErrors{{Path: "/", Message: err.Error()}}
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	errs := ValidationErrors{}
+	for _, resultError := range result.Errors() {
+		path := pointer(resultError.Context())
+		// violations of object keywords are reported for the object, they are moved to the property
+		if property, ok := resultError.Details()["property"].(string); ok {
+			switch resultError.Type() {
+			case "required", "additional_property_not_allowed":
+				path = strings.TrimSuffix(path, "/") + "/" + escape(property)
+			}
+		}
+		errs = append(errs, ValidationError{Path: path, Message: resultError.Description()})
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return errs
+}
+
+// ValidateBusinessObject validates business object against schema json, empty schema only checks
+// that business object is a json object
+func ValidateBusinessObject(schemaJson string, businessObjectJson string) error {
+	var s *Schema
+	if schemaJson != "" {
+		var err error
+		if s, err = Compile(schemaJson); err != nil {
+			return err
+		}
+	}
+
+	return s.Validate(businessObjectJson)
+}
+
+// readLeafStrings converts strings to the type schema expects, strings written by fmt.Sprint for
+// nil, booleans and numbers are read back. Values that can not be read are left for validation to report.
+// Only type, properties, additionalProperties and items are followed
+func readLeafStrings(raw interface{}, value interface{}) interface{} {
+	keywords, _ := raw.(map[string]interface{})
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := keywords["properties"].(map[string]interface{})
+		for name, property := range v {
+			if propertySchema, ok := properties[name]; ok {
+				v[name] = readLeafStrings(propertySchema, property)
+			} else if additional, ok := keywords["additionalProperties"]; ok {
+				v[name] = readLeafStrings(additional, property)
+			}
+		}
+	case []interface{}:
+		if items, ok := keywords["items"]; ok {
+			for i, item := range v {
+				v[i] = readLeafStrings(items, item)
+			}
+		}
+	case string:
+		types := schemaTypes(keywords)
+		if len(types) == 0 || contains(types, "string") {
+			return v
+		}
+		for _, t := range types {
+			switch {
+			case t == "null" && v == "<nil>":
+				return nil
+			case t == "boolean" && (v == "true" || v == "false"):
+				return v == "true"
+			case t == "number" || t == "integer":
+				var n json.Number
+				if err := decode(v, &n); err == nil {
+					return n
+				}
+			}
+		}
+	}
+	return value
+}
+
+func schemaTypes(keywords map[string]interface{}) []string {
+	switch t := keywords["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := []string{}
+		for _, name := range t {
+			types = append(types, fmt.Sprint(name))
+		}
+		return types
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// pointer turns context of gojsonschema, (root).lines.0.quantity, into json pointer /lines/0/quantity.
+// Context does not expose its segments, so property names are not escaped
+func pointer(context *gojsonschema.JsonContext) string {
+	path := strings.TrimPrefix(context.String("/"), gojsonschema.STRING_CONTEXT_ROOT)
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// Canonical is json of schema with object keys sorted and without whitespace, members registering the
+// same schema get the same text and hash however they formatted it. Numbers are kept as written
+func (s *Schema) Canonical() (string, error) {
+	canonical := &bytes.Buffer{}
+	encoder := json.NewEncoder(canonical)
+	encoder.SetEscapeHTML(false)
+	// maps are encoded with sorted keys
+	if err := encoder.Encode(s.raw); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(canonical.String(), "\n"), nil
+}
+
+func decode(data string, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(value); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after json value")
+	}
+	return nil
+}
+
+func escape(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,142 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+const orderSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"required": ["orderId", "lines"],
+	"additionalProperties": false,
+	"properties": {
+		"orderId": {"type": "string", "pattern": "^PO-[0-9]+$"},
+		"currency": {"enum": ["EUR", "USD"]},
+		"amount": {"type": "number", "exclusiveMinimum": 0},
+		"lines": {"type": "array", "minItems": 1, "items": {
+			"type": "object",
+			"required": ["sku"],
+			"properties": {"sku": {"type": "string", "minLength": 1}, "quantity": {"type": "integer"}}
+		}}
+	}
+}`
+
+func TestGivenValidBusinessObjectWhenValidateThenNoError(t *testing.T) {
+	s, err := Compile(orderSchema)
+	if err != nil {
+		t.Fatalf("compile failed %v", err)
+	}
+
+	err = s.Validate(`{"orderId":"PO-1","currency":"EUR","amount":10.5,"lines":[{"sku":"a","quantity":2.0}]}`)
+	if err != nil {
+		t.Fatalf("valid business object rejected %v", err)
+	}
+}
+
+func TestGivenInvalidBusinessObjectWhenValidateThenAllViolationsReturnedSortedByPath(t *testing.T) {
+	s, _ := Compile(orderSchema)
+
+	err := s.Validate(`{"orderId":"4711","currency":"CHF","amount":0,"lines":[{"quantity":1.5}],"note":"x"}`)
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || !errors.Is(err, ErrInvalidBusinessObject) {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	want := []string{"/amount", "/currency", "/lines/0/quantity", "/lines/0/sku", "/note", "/orderId"}
+	if len(errs) != len(want) {
+		t.Fatalf("errors = %v, want paths %v", errs, want)
+	}
+	for i, path := range want {
+		if errs[i].Path != path {
+			t.Fatalf("error %v = %v, want path %v", i, errs[i], path)
+		}
+	}
+}
+
+func TestGivenNoJsonObjectWhenValidateThenRejectedEvenWithoutSchema(t *testing.T) {
+	var s *Schema
+	for _, businessObject := range []string{``, `{"orderId":`, `[1,2]`, `"order"`, `{} {}`} {
+		if err := s.Validate(businessObject); !errors.Is(err, ErrInvalidBusinessObject) {
+			t.Fatalf("business object %q accepted, got %v", businessObject, err)
+		}
+	}
+	if err := s.Validate(`{"orderId":"PO-1"}`); err != nil {
+		t.Fatalf("json object rejected without schema %v", err)
+	}
+}
+
+func TestGivenUnsupportedOrMalformedSchemaWhenCompileThenError(t *testing.T) {
+	schemas := []string{
+		`{"type":"object"`,
+		`{"$ref":"#/definitions/order"}`,
+		`{"properties":{"order":{"$ref":"https://example.com/order.json"}}}`,
+		`{"$schema":"http://json-schema.org/draft-04/schema#","type":"object"}`,
+		`{"type":"decimal"}`,
+		`{"properties":{"amount":{"minimum":"1"}}}`,
+		`{"pattern":"("}`,
+	}
+	for _, schemaJson := range schemas {
+		if _, err := Compile(schemaJson); err == nil {
+			t.Fatalf("schema %v compiled", schemaJson)
+		}
+	}
+}
+
+func TestGivenSameSchemaWithOtherKeyOrderAndWhitespaceWhenCanonicalThenSameJson(t *testing.T) {
+	first, _ := Compile(`{"type":"object","required":["orderId"],"properties":{"orderId":{"type":"string","pattern":"<PO-\\d+>"},"amount":{"minimum":1.50}}}`)
+	second, _ := Compile(`{
+		"properties": {
+			"amount": {"minimum": 1.50},
+			"orderId": {"pattern": "<PO-\\d+>", "type": "string"}
+		},
+		"required": ["orderId"],
+		"type": "object"
+	}`)
+
+	canonical, err := first.Canonical()
+	if err != nil {
+		t.Fatalf("canonical json failed %v", err)
+	}
+	other, _ := second.Canonical()
+	expected := `{"properties":{"amount":{"minimum":1.50},"orderId":{"pattern":"<PO-\\d+>","type":"string"}},"required":["orderId"],"type":"object"}`
+	if canonical != expected || other != expected {
+		t.Fatalf("expected %v, got %v and %v", expected, canonical, other)
+	}
+}
+
+func TestGivenSchemaWithLocalReferencesAndCombinatorsWhenValidateThenTheyAreApplied(t *testing.T) {
+	s, err := Compile(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"definitions": {"sku": {"type": "string", "minLength": 1}},
+		"properties": {
+			"sku": {"$ref": "#/definitions/sku"},
+			"amount": {"anyOf": [{"type": "integer"}, {"type": "string", "pattern": "^[0-9]+$"}]}
+		}
+	}`)
+	if err != nil {
+		t.Fatalf("compile failed %v", err)
+	}
+
+	if err := s.Validate(`{"sku":"a","amount":"12"}`); err != nil {
+		t.Fatalf("valid business object rejected %v", err)
+	}
+	var errs ValidationErrors
+	if err := s.Validate(`{"sku":"","amount":"x"}`); !errors.As(err, &errs) || errs[0].Path != "/amount" || errs[len(errs)-1].Path != "/sku" {
+		t.Fatalf("expected amount and sku errors, got %v", err)
+	}
+}
+
+func TestGivenSyncTreeLeafStringsWhenValidateSyncTreeObjectThenStringsReadAsExpectedTypes(t *testing.T) {
+	s, _ := Compile(`{"properties":{"amount":{"type":"number"},"paid":{"type":"boolean"},"note":{"type":["string","null"]},"lines":{"items":{"properties":{"quantity":{"type":"integer"}}}}}}`)
+
+	if err := s.ValidateSyncTreeObject(`{"amount":"10.5","paid":"true","note":"<nil>","lines":[{"quantity":"2"}]}`); err != nil {
+		t.Fatalf("leaf strings rejected %v", err)
+	}
+
+	err := s.ValidateSyncTreeObject(`{"amount":"ten","lines":[{"quantity":"2.5"}]}`)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 || errs[0].Path != "/amount" || errs[1].Path != "/lines/0/quantity" {
+		t.Fatalf("expected amount and quantity errors, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package simulation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+const baseledgerTransactionPath = "/unibrightio/baseledger/baseledger/BaseledgerTransaction/"
+
+// ChainTransaction is transaction broadcasted to fake chain, every transaction is committed in its own block
+type ChainTransaction struct {
+	Hash          string
+	TransactionId string
+	Payload       string
+	OpCode        uint32
+	Height        int
+	Time          time.Time
+}
+
+// FakeChain serves blockchain app (signAndBroadcast, balanceCheck, BaseledgerTransaction query)
+// and tendermint rpc (tx, block) used by proxy
+type FakeChain struct {
+	server       *httptest.Server
+	mutex        sync.Mutex
+	transactions []*ChainTransaction
+	balance      bool
+}
+
+func NewFakeChain() *FakeChain {
+	chain := &FakeChain{balance: true}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/signAndBroadcast", chain.signAndBroadcast)
+	mux.HandleFunc("/balanceCheck", chain.balanceCheck)
+	mux.HandleFunc(baseledgerTransactionPath, chain.baseledgerTransaction)
+	mux.HandleFunc("/tx", chain.tx)
+	mux.HandleFunc("/block", chain.block)
+	chain.server = httptest.NewServer(mux)
+
+	return chain
+}
+
+// Host is used as both blockchain app and tendermint url, proxy prepends scheme itself
+func (c *FakeChain) Host() string {
+	return strings.TrimPrefix(c.server.URL, "http://")
+}
+
+func (c *FakeChain) Close() {
+	c.server.Close()
+}
+
+// SetBalance controls balance check, without balance proxy does not broadcast
+func (c *FakeChain) SetBalance(enough bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.balance = enough
+}
+
+// Transactions returns broadcasted transactions in order of commitment
+func (c *FakeChain) Transactions() []ChainTransaction {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	transactions := make([]ChainTransaction, 0, len(c.transactions))
+	for _, transaction := range c.transactions {
+		transactions = append(transactions, *transaction)
+	}
+
+	return transactions
+}
+
+func (c *FakeChain) signAndBroadcast(w http.ResponseWriter, r *http.Request) {
+	var payload restutil.SignAndBroadcastPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	hash := sha256.Sum256([]byte(payload.TransactionId + payload.Payload))
+	transaction := &ChainTransaction{
+		Hash:          strings.ToUpper(hex.EncodeToString(hash[:])),
+		TransactionId: payload.TransactionId,
+		Payload:       payload.Payload,
+		OpCode:        payload.OpCode,
+		Height:        len(c.transactions) + 1,
+		Time:          time.Now().UTC(),
+	}
+	c.transactions = append(c.transactions, transaction)
+
+	w.Write([]byte(transaction.Hash))
+}
+
+func (c *FakeChain) balanceCheck(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.balance {
+		w.WriteHeader(http.StatusPaymentRequired)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *FakeChain) baseledgerTransaction(w http.ResponseWriter, r *http.Request) {
+	transactionId := strings.TrimPrefix(r.URL.Path, baseledgerTransactionPath)
+	transaction := c.find(func(t *ChainTransaction) bool { return t.TransactionId == transactionId })
+	if transaction == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	writeJson(w, types.CommittedBaseledgerTransactionResponse{
+		BaseledgerTransaction: types.BaseledgerTransactionDto{
+			Id:                      strconv.Itoa(transaction.Height),
+			BaseledgerTransactionId: transaction.TransactionId,
+			Payload:                 transaction.Payload,
+		},
+	})
+}
+
+func (c *FakeChain) tx(w http.ResponseWriter, r *http.Request) {
+	hash := strings.ToUpper(strings.TrimPrefix(r.URL.Query().Get("hash"), "0x"))
+	transaction := c.find(func(t *ChainTransaction) bool { return t.Hash == hash })
+	if transaction == nil {
+		http.Error(w, "tx not found", http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(w, types.TxResp{
+		TxResult: types.TxResult{
+			Hash:   transaction.Hash,
+			Height: strconv.Itoa(transaction.Height),
+		},
+	})
+}
+
+func (c *FakeChain) block(w http.ResponseWriter, r *http.Request) {
+	height, _ := strconv.Atoi(r.URL.Query().Get("height"))
+	transaction := c.find(func(t *ChainTransaction) bool { return t.Height == height })
+	if transaction == nil {
+		http.Error(w, "block not found", http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(w, types.BlockResp{
+		BlockResult: types.BlockResult{
+			Block: types.Block{Header: types.Header{Time: transaction.Time.Format(time.RFC3339Nano)}},
+		},
+	})
+}
+
+func (c *FakeChain) find(match func(*ChainTransaction) bool) *ChainTransaction {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, transaction := range c.transactions {
+		if match(transaction) {
+			return transaction
+		}
+	}
+
+	return nil
+}
+
+func writeJson(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,39 @@
+package simulation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// EthExit is exit proof stored on ethereum
+type EthExit struct {
+	TransactionId string
+	Proof         string
+	EthTxHash     string
+}
+
+// FakeEth records exit proofs instead of calling the contract
+type FakeEth struct {
+	mutex sync.Mutex
+	exits []EthExit
+}
+
+func (e *FakeEth) StoreExitProof(ctx context.Context, txId string, proof string) (string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	hash := sha256.Sum256([]byte(txId + proof))
+	exit := EthExit{TransactionId: txId, Proof: proof, EthTxHash: "0x" + hex.EncodeToString(hash[:])}
+	e.exits = append(e.exits, exit)
+
+	return exit.EthTxHash, nil
+}
+
+func (e *FakeEth) Exits() []EthExit {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return append([]EthExit(nil), e.exits...)
+}
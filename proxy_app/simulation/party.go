@@ -0,0 +1,202 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/nats-io/nats-server/v2/server"
+	businesslogic "github.com/unibrightio/proxy-api/business_logic"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/cron"
+	"github.com/unibrightio/proxy-api/messaging"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/systemofrecord"
+	"github.com/unibrightio/proxy-api/types"
+	"github.com/unibrightio/proxy-api/workflow"
+)
+
+// Party is one proxy instance with its own in-memory repositories and NATS server,
+// it shares chain, SOR and network counters with other parties
+type Party struct {
+	Name           string
+	OrganizationId uuid.UUID
+	Repositories   *repository.Repositories
+	Workflow       *workflow.Service
+	Processor      *businesslogic.Processor
+	Eth            *FakeEth
+	// Outgoing can change offchain messages before they are sent to counterparty, used to simulate tampering
+	Outgoing func(subject string, message []byte) []byte
+
+	network     *Network
+	natsServer  *server.Server
+	natsToken   string
+	subscriber  *messaging.MessagingClient
+	natsAddress string
+}
+
+func newParty(network *Network, name string) (*Party, error) {
+	party := &Party{
+		Name:           name,
+		OrganizationId: uuid.NewV4(),
+		Repositories:   repository.NewInMemory(),
+		Eth:            &FakeEth{},
+		network:        network,
+		natsToken:      uuid.NewV4().String(),
+	}
+	party.subscriber = party.natsMessagingClient()
+
+	natsServer, err := server.NewServer(&server.Options{
+		Host:          "127.0.0.1",
+		Port:          server.RANDOM_PORT,
+		Authorization: party.natsToken,
+		NoLog:         true,
+		NoSigs:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	go natsServer.Start()
+	if !natsServer.ReadyForConnections(5 * time.Second) {
+		natsServer.Shutdown()
+		return nil, errNatsNotReady
+	}
+	party.natsServer = natsServer
+	party.natsAddress = natsServer.Addr().String()
+
+	party.Workflow = &workflow.Service{
+		OrganizationId: party.OrganizationId.String(),
+		Repositories:   party.Repositories,
+		Broadcast:      restutil.BroadcastTransaction,
+	}
+	party.Processor = &businesslogic.Processor{
+		Repositories:   party.Repositories,
+		Blockchain:     &restutil.RestBlockchainClient{},
+		Messaging:      &countingMessagingClient{party: party, IMessagingClient: party.natsMessagingClient()},
+		Sor:            &systemofrecord.WebhookSorClient{Webhooks: party.Repositories.Webhooks},
+		Eth:            party.Eth,
+		RejectFeedback: party.Workflow.SendRejectFeedback,
+	}
+
+	for _, webhook := range network.Sor.Webhooks(name) {
+		if err := party.Repositories.Webhooks.CreateWebhook(webhook); err != nil {
+			party.close()
+			return nil, err
+		}
+	}
+
+	for subject, onEnvelope := range map[string]func(messaging.Envelope){
+		common.BaseledgerNatsSubject: party.receiveOffchainProcessMessage,
+		common.EthTxHashNatsSubject:  party.receiveTrustmeshUpdate,
+	} {
+		if err := party.subscriber.Subscribe(party.natsAddress, party.natsToken, subject, onEnvelope); err != nil {
+			party.close()
+			return nil, err
+		}
+	}
+
+	return party, nil
+}
+
+// Poll runs one query trustmeshes round, the way cron does it
+func (p *Party) Poll() {
+	entries, err := p.Repositories.TrustmeshEntries.ClaimTrustmeshEntriesToProcess(time.Now(), 500, time.Minute)
+	if err != nil {
+		p.network.t.Errorf("%v failed to claim uncommitted entries %v", p.Name, err)
+		return
+	}
+
+	cron.ProcessEntries(context.Background(), entries, p.Processor.Execute)
+
+	ids := make([]uuid.UUID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.Id
+	}
+	p.Repositories.TrustmeshEntries.ReleaseTrustmeshEntryClaims(ids)
+}
+
+// Trustmesh returns trustmesh containing bboid, nil if there is none
+func (p *Party) Trustmesh(bboid string) *types.Trustmesh {
+	latest, err := p.Repositories.TrustmeshEntries.GetLatestTrustmeshEntryBasedOnBboid(bboid)
+	if err != nil || latest == nil {
+		return nil
+	}
+
+	trustmesh, err := p.Repositories.Trustmeshes.GetTrustmeshById(latest.TrustmeshId)
+	if err != nil {
+		return nil
+	}
+
+	return trustmesh
+}
+
+func (p *Party) pendingEntries() int {
+	pending := 0
+	for _, state := range []string{common.PendingBroadcastCommitmentState, common.UncommittedCommitmentState} {
+		entries, _ := p.Repositories.TrustmeshEntries.GetTrustmeshEntriesByCommitmentState(state)
+		pending += len(entries)
+	}
+
+	return pending
+}
+
+// natsMessagingClient is messaging client of party, parties exchange envelopes over their nats servers only
+func (p *Party) natsMessagingClient() *messaging.MessagingClient {
+	return &messaging.MessagingClient{
+		OrganizationId: p.OrganizationId.String(),
+		Transports:     map[string]messaging.ITransport{messaging.SchemeNats: &messaging.NatsTransport{}},
+	}
+}
+
+func (p *Party) receiveOffchainProcessMessage(envelope messaging.Envelope) {
+	defer p.network.received()
+
+	var natsMessage types.NatsMessage
+	if err := json.Unmarshal(envelope.Payload, &natsMessage); err != nil {
+		p.network.t.Errorf("%v failed to parse offchain process message %v", p.Name, err)
+		return
+	}
+
+	if err := p.Workflow.ReceiveOffchainProcessMessage(context.Background(), envelope, natsMessage); err != nil {
+		p.network.t.Errorf("%v failed to receive offchain process message %v", p.Name, err)
+	}
+}
+
+func (p *Party) receiveTrustmeshUpdate(envelope messaging.Envelope) {
+	defer p.network.received()
+
+	var updateMessage types.NatsTrustmeshUpdateMessage
+	if err := json.Unmarshal(envelope.Payload, &updateMessage); err != nil {
+		p.network.t.Errorf("%v failed to parse trustmesh update message %v", p.Name, err)
+		return
+	}
+
+	if err := p.Workflow.ReceiveTrustmeshUpdate(context.Background(), envelope, updateMessage); err != nil {
+		p.network.t.Errorf("%v failed to receive trustmesh update message %v", p.Name, err)
+	}
+}
+
+func (p *Party) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p.subscriber.Drain(ctx)
+	p.natsServer.Shutdown()
+}
+
+// countingMessagingClient counts sent messages so that network knows when all of them are received
+type countingMessagingClient struct {
+	messaging.IMessagingClient
+	party *Party
+}
+
+func (c *countingMessagingClient) SendMessage(envelope messaging.Envelope, recipient string, token string) error {
+	if c.party.Outgoing != nil {
+		envelope.Payload = c.party.Outgoing(envelope.Subject, envelope.Payload)
+	}
+
+	c.party.network.sent()
+	return c.IMessagingClient.SendMessage(envelope, recipient, token)
+}
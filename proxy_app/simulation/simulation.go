@@ -0,0 +1,173 @@
+// Package simulation runs several proxy instances in one process against fake blockchain, ethereum
+// and system of record, so that workflows between organizations can be tested with go test
+package simulation
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/config"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+// same key as in local development workgroups
+const workgroupPrivatizeKey = "6368616e676520746869732070617373776f726420746f206120736563726574"
+
+const settleTimeout = 10 * time.Second
+
+var errNatsNotReady = errors.New("embedded nats server not ready")
+
+// Network is set of parties sharing one workgroup, chain and system of record
+type Network struct {
+	Chain     *FakeChain
+	Sor       *SorRecorder
+	Workgroup types.Workgroup
+
+	t       testing.TB
+	parties []*Party
+	mutex   sync.Mutex
+	// offchain messages sent and received by all parties, equal when none is in flight
+	sentMessages     int
+	receivedMessages int
+}
+
+// NewNetwork starts parties with given names and makes them members of one workgroup,
+// everything is stopped and configuration restored when test finishes
+func NewNetwork(t testing.TB, names ...string) *Network {
+	network := &Network{
+		Chain:     NewFakeChain(),
+		Sor:       NewSorRecorder(),
+		Workgroup: types.Workgroup{Id: uuid.NewV4(), WorkgroupName: "simulation", PrivatizeKey: workgroupPrivatizeKey},
+		t:         t,
+	}
+
+	// blockchain urls are read from configuration, all parties share the chain
+	previousConfig := config.Get()
+	simulationConfig := *previousConfig
+	simulationConfig.Blockchain.AppUrl = network.Chain.Host()
+	simulationConfig.Blockchain.TendermintUrl = network.Chain.Host()
+	config.Set(&simulationConfig)
+
+	t.Cleanup(func() {
+		for _, party := range network.parties {
+			party.close()
+		}
+		network.Sor.Close()
+		network.Chain.Close()
+		config.Set(previousConfig)
+	})
+
+	for _, name := range names {
+		party, err := newParty(network, name)
+		if err != nil {
+			t.Fatalf("starting party %v failed %v", name, err)
+		}
+		network.parties = append(network.parties, party)
+	}
+
+	for _, party := range network.parties {
+		network.join(party)
+	}
+
+	return network
+}
+
+// Party returns party with given name
+func (n *Network) Party(name string) *Party {
+	for _, party := range n.parties {
+		if party.Name == name {
+			return party
+		}
+	}
+
+	n.t.Fatalf("party %v does not exist", name)
+	return nil
+}
+
+// Settle polls all parties until every entry is processed and every offchain message received
+func (n *Network) Settle() {
+	deadline := time.Now().Add(settleTimeout)
+
+	for {
+		for _, party := range n.parties {
+			party.Poll()
+		}
+
+		pending := n.pending()
+		if pending == "" {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			n.t.Fatalf("network did not settle in %v, %v", settleTimeout, pending)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// join stores workgroup, organizations and memberships of all other parties in repositories of party
+func (n *Network) join(party *Party) {
+	workgroup := n.Workgroup
+	if err := party.Repositories.Workgroups.CreateWorkgroup(&workgroup); err != nil {
+		n.t.Fatalf("creating workgroup of %v failed %v", party.Name, err)
+	}
+
+	for _, member := range n.parties {
+		err := party.Repositories.Organizations.CreateOrganization(&types.Organization{Id: member.OrganizationId, OrganizationName: member.Name})
+		if err != nil {
+			n.t.Fatalf("creating organization %v of %v failed %v", member.Name, party.Name, err)
+		}
+
+		if member == party {
+			continue
+		}
+
+		err = party.Repositories.Workgroups.CreateWorkgroupMember(&types.WorkgroupMember{
+			WorkgroupId:          n.Workgroup.Id.String(),
+			OrganizationId:       member.OrganizationId.String(),
+			OrganizationEndpoint: member.natsAddress,
+			OrganizationToken:    member.natsToken,
+		})
+		if err != nil {
+			n.t.Fatalf("creating workgroup member %v of %v failed %v", member.Name, party.Name, err)
+		}
+	}
+}
+
+// pending describes work which is not yet done, empty if there is none
+func (n *Network) pending() string {
+	n.mutex.Lock()
+	inFlight := n.sentMessages - n.receivedMessages
+	n.mutex.Unlock()
+
+	if inFlight != 0 {
+		return fmt.Sprintf("%v offchain messages in flight", inFlight)
+	}
+
+	for _, party := range n.parties {
+		if entries := party.pendingEntries(); entries != 0 {
+			return fmt.Sprintf("%v has %v entries to process", party.Name, entries)
+		}
+	}
+
+	return ""
+}
+
+func (n *Network) sent() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.sentMessages++
+}
+
+func (n *Network) received() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.receivedMessages++
+}
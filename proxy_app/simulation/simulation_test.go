@@ -0,0 +1,398 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/saga"
+	"github.com/unibrightio/proxy-api/synctree"
+	"github.com/unibrightio/proxy-api/types"
+	"github.com/unibrightio/proxy-api/workflow"
+)
+
+const orderJson = `{"orderId":"4711","amount":"10"}`
+const finalOrderJson = `{"orderId":"4711","amount":"12"}`
+
+func suggestOrder(t *testing.T, network *Network, from *Party, to *Party) *workflow.WorkstepResult {
+	result, err := from.Workflow.CreateSuggestion(context.Background(), workflow.SuggestionRequest{
+		WorkgroupId:        network.Workgroup.Id.String(),
+		Recipient:          to.OrganizationId.String(),
+		BusinessObjectType: "order",
+		BusinessObjectId:   "4711",
+		BusinessObjectJson: orderJson,
+	})
+	if err != nil {
+		t.Fatalf("suggestion of %v failed %v", from.Name, err)
+	}
+
+	return result
+}
+
+func giveFeedback(t *testing.T, party *Party, bboid string, approved bool, message string) *workflow.WorkstepResult {
+	result, err := party.Workflow.CreateFeedback(context.Background(), workflow.FeedbackRequest{
+		BaseledgerBusinessObjectId: bboid,
+		Approved:                   approved,
+		FeedbackMessage:            message,
+	})
+	if err != nil {
+		t.Fatalf("feedback of %v failed %v", party.Name, err)
+	}
+
+	return result
+}
+
+func entryTypes(trustmesh *types.Trustmesh) []string {
+	var entryTypes []string
+	for _, entry := range trustmesh.Entries {
+		entryTypes = append(entryTypes, entry.EntryType)
+	}
+
+	return entryTypes
+}
+
+func assertEntryTypes(t *testing.T, party *Party, bboid string, expected ...string) *types.Trustmesh {
+	trustmesh := party.Trustmesh(bboid)
+	if trustmesh == nil {
+		t.Fatalf("%v has no trustmesh with %v", party.Name, bboid)
+	}
+
+	actual := entryTypes(trustmesh)
+	if len(actual) != len(expected) {
+		t.Fatalf("%v has entries %v, expected %v", party.Name, actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("%v has entries %v, expected %v", party.Name, actual, expected)
+		}
+	}
+
+	for _, entry := range trustmesh.Entries {
+		if entry.CommitmentState != common.CommittedCommitmentState {
+			t.Fatalf("%v entry %v is %v, expected committed", party.Name, entry.EntryType, entry.CommitmentState)
+		}
+	}
+
+	return trustmesh
+}
+
+func findCall(calls []SorCall, webhook string, entryType string) *SorCall {
+	for i := range calls {
+		if calls[i].Webhook == webhook && calls[i].EntryType == entryType {
+			return &calls[i]
+		}
+	}
+
+	return nil
+}
+
+// sync tree does not keep order of object keys
+func sameJson(actual string, expected string) bool {
+	var actualValue, expectedValue interface{}
+	if json.Unmarshal([]byte(actual), &actualValue) != nil || json.Unmarshal([]byte(expected), &expectedValue) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(actualValue, expectedValue)
+}
+
+func assertNoSorErrors(t *testing.T, network *Network) {
+	if errors := network.Sor.Errors(); len(errors) > 0 {
+		t.Fatalf("system of record received malformed webhooks %v", errors)
+	}
+}
+
+func TestGivenAliceAndBobWhenAliceSuggestsThenBobsSorReceivesBusinessObject(t *testing.T) {
+	network := NewNetwork(t, "alice", "bob")
+	alice, bob := network.Party("alice"), network.Party("bob")
+
+	suggestion := suggestOrder(t, network, alice, bob)
+	network.Settle()
+
+	aliceTrustmesh := assertEntryTypes(t, alice, suggestion.BaseledgerBusinessObjectId, common.SuggestionSentTrustmeshEntryType)
+	assertEntryTypes(t, bob, suggestion.BaseledgerBusinessObjectId, common.SuggestionReceivedTrustmeshEntryType)
+
+	if aliceTrustmesh.Id.String() != suggestion.WorkflowId {
+		t.Fatalf("expected workflow id %v, got trustmesh %v", suggestion.WorkflowId, aliceTrustmesh.Id)
+	}
+
+	created := findCall(network.Sor.Calls("bob"), "create", common.SuggestionReceivedTrustmeshEntryType)
+	if created == nil {
+		t.Fatalf("bob's sor did not receive business object, calls %v", network.Sor.Calls("bob"))
+	}
+	if !sameJson(created.BusinessObject, orderJson) {
+		t.Fatalf("expected business object %v, got %v", orderJson, created.BusinessObject)
+	}
+	if created.Origin != alice.OrganizationId.String() {
+		t.Fatalf("expected origin alice %v, got %v", alice.OrganizationId, created.Origin)
+	}
+
+	updated := findCall(network.Sor.Calls("alice"), "update", common.SuggestionSentTrustmeshEntryType)
+	if updated == nil || !updated.Approved {
+		t.Fatalf("alice's sor was not notified about successful suggestion, calls %v", network.Sor.Calls("alice"))
+	}
+
+	if len(network.Chain.Transactions()) != 1 {
+		t.Fatalf("expected 1 transaction on chain, got %v", len(network.Chain.Transactions()))
+	}
+	assertNoSorErrors(t, network)
+}
+
+func TestGivenApprovedFinalWorkstepWhenAliceReceivesApprovalThenTrustmeshExitsToEthOnBothSides(t *testing.T) {
+	network := NewNetwork(t, "alice", "bob")
+	alice, bob := network.Party("alice"), network.Party("bob")
+
+	initial := suggestOrder(t, network, alice, bob)
+	network.Settle()
+
+	giveFeedback(t, bob, initial.BaseledgerBusinessObjectId, true, "approved")
+	network.Settle()
+
+	final, err := alice.Workflow.CreateSuggestion(context.Background(), workflow.SuggestionRequest{
+		WorkgroupId:        network.Workgroup.Id.String(),
+		WorkstepType:       common.WorkstepTypeFinal,
+		WorkflowId:         initial.WorkflowId,
+		BusinessObjectType: "order",
+		BusinessObjectId:   "4711",
+		BusinessObjectJson: finalOrderJson,
+	})
+	if err != nil {
+		t.Fatalf("final suggestion failed %v", err)
+	}
+	if final.WorkflowId != initial.WorkflowId {
+		t.Fatalf("expected final suggestion in workflow %v, got %v", initial.WorkflowId, final.WorkflowId)
+	}
+	network.Settle()
+
+	giveFeedback(t, bob, final.BaseledgerBusinessObjectId, true, "final approved")
+	network.Settle()
+
+	aliceTrustmesh := assertEntryTypes(t, alice, final.BaseledgerBusinessObjectId,
+		common.SuggestionSentTrustmeshEntryType,
+		common.FeedbackReceivedTrustmeshEntryType,
+		common.SuggestionSentTrustmeshEntryType,
+		common.FeedbackReceivedTrustmeshEntryType)
+	bobTrustmesh := assertEntryTypes(t, bob, final.BaseledgerBusinessObjectId,
+		common.SuggestionReceivedTrustmeshEntryType,
+		common.FeedbackSentTrustmeshEntryType,
+		common.SuggestionReceivedTrustmeshEntryType,
+		common.FeedbackSentTrustmeshEntryType)
+
+	exits := alice.Eth.Exits()
+	if len(exits) != 1 {
+		t.Fatalf("expected alice to exit once, got %v", len(exits))
+	}
+	if len(bob.Eth.Exits()) != 0 {
+		t.Fatalf("expected bob not to exit himself, got %v", len(bob.Eth.Exits()))
+	}
+
+	expectedRootProof := synctree.CreateFromTrustmesh(*aliceTrustmesh).RootProof
+	if exits[0].Proof != expectedRootProof {
+		t.Fatalf("expected exit proof %v, got %v", expectedRootProof, exits[0].Proof)
+	}
+	if aliceTrustmesh.EthExitTxHash != exits[0].EthTxHash || bobTrustmesh.EthExitTxHash != exits[0].EthTxHash {
+		t.Fatalf("expected eth exit tx hash %v on both sides, alice %v bob %v", exits[0].EthTxHash, aliceTrustmesh.EthExitTxHash, bobTrustmesh.EthExitTxHash)
+	}
+
+	// 2 suggestions, 2 feedbacks and exit
+	if len(network.Chain.Transactions()) != 5 {
+		t.Fatalf("expected 5 transactions on chain, got %v", len(network.Chain.Transactions()))
+	}
+	assertNoSorErrors(t, network)
+}
+
+func TestGivenSuggestionWhenBobRejectsThenAlicesSorIsNotifiedAndNothingExits(t *testing.T) {
+	network := NewNetwork(t, "alice", "bob")
+	alice, bob := network.Party("alice"), network.Party("bob")
+
+	suggestion := suggestOrder(t, network, alice, bob)
+	network.Settle()
+
+	giveFeedback(t, bob, suggestion.BaseledgerBusinessObjectId, false, "wrong amount")
+	network.Settle()
+
+	trustmesh := assertEntryTypes(t, alice, suggestion.BaseledgerBusinessObjectId,
+		common.SuggestionSentTrustmeshEntryType,
+		common.FeedbackReceivedTrustmeshEntryType)
+	if trustmesh.Entries[1].BaseledgerTransactionType != common.BaseledgerTransactionTypeReject {
+		t.Fatalf("expected received feedback to be reject, got %v", trustmesh.Entries[1].BaseledgerTransactionType)
+	}
+
+	rejected := findCall(network.Sor.Calls("alice"), "update", common.FeedbackReceivedTrustmeshEntryType)
+	if rejected == nil || rejected.Approved || rejected.Message != "wrong amount" {
+		t.Fatalf("alice's sor was not notified about rejection, calls %v", network.Sor.Calls("alice"))
+	}
+
+	if len(alice.Eth.Exits()) != 0 || len(bob.Eth.Exits()) != 0 {
+		t.Fatalf("expected no exits after rejection")
+	}
+	assertNoSorErrors(t, network)
+}
+
+func TestGivenTamperedOffchainMessageWhenBobVerifiesProofThenSuggestionIsRejectedAutomatically(t *testing.T) {
+	network := NewNetwork(t, "alice", "bob")
+	alice, bob := network.Party("alice"), network.Party("bob")
+
+	// offchain message carries different object than the one whose proof is on chain
+	alice.Outgoing = func(subject string, message []byte) []byte {
+		var natsMessage types.NatsMessage
+		if err := json.Unmarshal(message, &natsMessage); err != nil {
+			t.Errorf("failed to parse outgoing message %v", err)
+			return message
+		}
+
+		tamperedTree, err := synctree.CreateFromBusinessObjectJson(`{"orderId":"4711","amount":"1000"}`, nil)
+		if err != nil {
+			t.Errorf("failed to create tampered sync tree %v", err)
+			return message
+		}
+		tamperedTreeJson, _ := json.Marshal(tamperedTree)
+		natsMessage.ProcessMessage.BaseledgerSyncTreeJson = string(tamperedTreeJson)
+		natsMessage.ProcessMessage.BusinessObjectProof = tamperedTree.RootProof
+
+		tampered, _ := json.Marshal(natsMessage)
+		return tampered
+	}
+
+	suggestion := suggestOrder(t, network, alice, bob)
+	network.Settle()
+
+	assertEntryTypes(t, bob, suggestion.BaseledgerBusinessObjectId,
+		common.SuggestionReceivedTrustmeshEntryType,
+		common.FeedbackSentTrustmeshEntryType)
+	assertEntryTypes(t, alice, suggestion.BaseledgerBusinessObjectId,
+		common.SuggestionSentTrustmeshEntryType,
+		common.FeedbackReceivedTrustmeshEntryType)
+
+	if created := findCall(network.Sor.Calls("bob"), "create", common.SuggestionReceivedTrustmeshEntryType); created != nil {
+		t.Fatalf("tampered business object must not reach bob's sor, got %v", created.BusinessObject)
+	}
+
+	rejected := findCall(network.Sor.Calls("alice"), "update", common.FeedbackReceivedTrustmeshEntryType)
+	if rejected == nil || rejected.Approved || rejected.Message != "Rejected because Hashes do not match" {
+		t.Fatalf("alice's sor was not notified about automatic rejection, calls %v", network.Sor.Calls("alice"))
+	}
+	assertNoSorErrors(t, network)
+}
+
+func TestGivenChainWithoutBalanceWhenAliceSuggestsThenNothingIsStoredOrSent(t *testing.T) {
+	network := NewNetwork(t, "alice", "bob")
+	alice, bob := network.Party("alice"), network.Party("bob")
+	network.Chain.SetBalance(false)
+
+	_, err := alice.Workflow.CreateSuggestion(context.Background(), workflow.SuggestionRequest{
+		WorkgroupId:        network.Workgroup.Id.String(),
+		Recipient:          bob.OrganizationId.String(),
+		BusinessObjectType: "order",
+		BusinessObjectId:   "4711",
+		BusinessObjectJson: orderJson,
+	})
+	if err != saga.ErrBroadcastFailed {
+		t.Fatalf("expected broadcast error, got %v", err)
+	}
+	network.Settle()
+
+	for _, state := range []string{common.PendingBroadcastCommitmentState, common.UncommittedCommitmentState, common.CommittedCommitmentState} {
+		entries, _ := alice.Repositories.TrustmeshEntries.GetTrustmeshEntriesByCommitmentState(state)
+		if len(entries) != 0 {
+			t.Fatalf("expected failed suggestion to be compensated, alice has %v %v entries", len(entries), state)
+		}
+	}
+
+	if len(network.Sor.Calls("bob")) != 0 || len(network.Chain.Transactions()) != 0 {
+		t.Fatalf("expected nothing to reach chain or bob")
+	}
+}
+
+func TestGivenRejectedSuggestionWhenAliceSuggestsNewVersionThenOnlyDeltaIsSentAndBobsSorReceivesNewVersion(t *testing.T) {
+	network := NewNetwork(t, "alice", "bob")
+	alice, bob := network.Party("alice"), network.Party("bob")
+
+	suggestion := suggestOrder(t, network, alice, bob)
+	network.Settle()
+	giveFeedback(t, bob, suggestion.BaseledgerBusinessObjectId, false, "wrong amount")
+	network.Settle()
+
+	var sentSyncTrees []string
+	alice.Outgoing = func(subject string, message []byte) []byte {
+		var natsMessage types.NatsMessage
+		if err := json.Unmarshal(message, &natsMessage); err == nil && subject == common.BaseledgerNatsSubject {
+			sentSyncTrees = append(sentSyncTrees, natsMessage.ProcessMessage.BaseledgerSyncTreeJson)
+		}
+		return message
+	}
+
+	_, err := alice.Workflow.CreateSuggestion(context.Background(), workflow.SuggestionRequest{
+		WorkgroupId:                network.Workgroup.Id.String(),
+		WorkstepType:               common.WorkstepTypeNewVersion,
+		BaseledgerBusinessObjectId: suggestion.BaseledgerBusinessObjectId,
+		BusinessObjectJson:         finalOrderJson,
+	})
+	if err != nil {
+		t.Fatalf("new version of alice failed %v", err)
+	}
+	network.Settle()
+
+	if len(sentSyncTrees) != 1 {
+		t.Fatalf("expected one offchain message, got %v", len(sentSyncTrees))
+	}
+	delta, err := synctree.ParseDelta(sentSyncTrees[0])
+	if err != nil || delta == nil || len(delta.Changes) != 1 {
+		t.Fatalf("expected delta with the changed amount, got %v", sentSyncTrees[0])
+	}
+
+	var received *SorCall
+	calls := network.Sor.Calls("bob")
+	for i := range calls {
+		if calls[i].EntryType == common.SuggestionReceivedTrustmeshEntryType && sameJson(calls[i].BusinessObject, finalOrderJson) {
+			received = &calls[i]
+		}
+	}
+	if received == nil {
+		t.Fatalf("bob's sor did not receive new version, calls %v", calls)
+	}
+	assertNoSorErrors(t, network)
+}
+
+func TestGivenSyncTreeLargerThanNatsMaxPayloadWhenAliceSuggestsThenBobsSorReceivesBusinessObject(t *testing.T) {
+	network := NewNetwork(t, "alice", "bob")
+	alice, bob := network.Party("alice"), network.Party("bob")
+
+	lines := []string{}
+	for i := 0; i < 20000; i++ {
+		lines = append(lines, fmt.Sprintf(`{"sku":"sku-%v","quantity":%v}`, i, i%7))
+	}
+	largeOrderJson := `{"orderId":"4711","lines":[` + strings.Join(lines, ",") + `]}`
+
+	var sentSize int
+	alice.Outgoing = func(subject string, message []byte) []byte {
+		sentSize = len(message)
+		return message
+	}
+
+	suggestion, err := alice.Workflow.CreateSuggestion(context.Background(), workflow.SuggestionRequest{
+		WorkgroupId:        network.Workgroup.Id.String(),
+		Recipient:          bob.OrganizationId.String(),
+		BusinessObjectType: "order",
+		BusinessObjectId:   "4711",
+		BusinessObjectJson: largeOrderJson,
+	})
+	if err != nil {
+		t.Fatalf("suggestion of alice failed %v", err)
+	}
+	network.Settle()
+
+	if sentSize <= 1024*1024 {
+		t.Fatalf("expected offchain message above nats max payload, got %v bytes", sentSize)
+	}
+	assertEntryTypes(t, bob, suggestion.BaseledgerBusinessObjectId, common.SuggestionReceivedTrustmeshEntryType)
+	created := findCall(network.Sor.Calls("bob"), "create", common.SuggestionReceivedTrustmeshEntryType)
+	if created == nil || !sameJson(created.BusinessObject, largeOrderJson) {
+		t.Fatalf("bob's sor did not receive large business object")
+	}
+	assertNoSorErrors(t, network)
+}
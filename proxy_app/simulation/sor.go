@@ -0,0 +1,112 @@
+package simulation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/unibrightio/proxy-api/types"
+)
+
+// webhook bodies are templated by proxy, message is not escaped so scenarios use plain messages
+const createObjectWebhookBody = `{"party":"{{party}}","webhook":"create","origin":"{{origin}}","entry_type":"{{entry_type}}","workstep_type":"{{workstep_type}}","bboid":"{{bboid}}","business_object":"{{business_object_json_payload}}"}`
+const updateObjectWebhookBody = `{"party":"{{party}}","webhook":"update","origin":"{{origin}}","entry_type":"{{entry_type}}","workstep_type":"{{workstep_type}}","bboid":"{{bboid}}","approved":{{approved}},"message":"{{message}}"}`
+const webhookBodyParams = "entry_type:EntryType;workstep_type:WorkstepType;bboid:BaseledgerBusinessObjectId"
+
+// SorCall is webhook request received by system of record of a party
+type SorCall struct {
+	Party          string `json:"party"`
+	Webhook        string `json:"webhook"`
+	Origin         string `json:"origin"`
+	EntryType      string `json:"entry_type"`
+	WorkstepType   string `json:"workstep_type"`
+	Bboid          string `json:"bboid"`
+	BusinessObject string `json:"business_object"`
+	Approved       bool   `json:"approved"`
+	Message        string `json:"message"`
+}
+
+// SorRecorder is system of record of all parties, it records webhook calls
+type SorRecorder struct {
+	server *httptest.Server
+	mutex  sync.Mutex
+	calls  []SorCall
+	errors []string
+}
+
+func NewSorRecorder() *SorRecorder {
+	recorder := &SorRecorder{}
+	recorder.server = httptest.NewServer(http.HandlerFunc(recorder.record))
+	return recorder
+}
+
+func (r *SorRecorder) Close() {
+	r.server.Close()
+}
+
+// Webhooks returns create and update object webhooks of a party
+func (r *SorRecorder) Webhooks(party string) []*types.SorWebhook {
+	webhook := func(webhookType types.WebhookType, name string, body string) *types.SorWebhook {
+		return &types.SorWebhook{
+			Url:             r.server.URL + "/" + party + "/" + name,
+			HttpMethod:      http.MethodPost,
+			WebhookType:     webhookType,
+			AuthType:        types.None,
+			BodyContentType: "application/json",
+			Body:            strings.Replace(body, "{{party}}", party, 1),
+			BodyParams:      webhookBodyParams,
+		}
+	}
+
+	return []*types.SorWebhook{
+		webhook(types.CreateObject, "create", createObjectWebhookBody),
+		webhook(types.UpdateObject, "update", updateObjectWebhookBody),
+	}
+}
+
+// Calls returns webhook calls received by party in order of arrival
+func (r *SorRecorder) Calls(party string) []SorCall {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var calls []SorCall
+	for _, call := range r.calls {
+		if call.Party == party {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Errors returns webhook requests which could not be decoded
+func (r *SorRecorder) Errors() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string(nil), r.errors...)
+}
+
+func (r *SorRecorder) record(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var call SorCall
+	if err := json.Unmarshal(body, &call); err != nil {
+		r.errors = append(r.errors, req.URL.Path+": "+err.Error()+": "+string(body))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.calls = append(r.calls, call)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,381 @@
+package synctree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// compactSyncTree is how sync trees are written to json: leaf values in leaf order without node ids and
+// hashes, which are computed again when tree is read. Covered leaves are empty, their hash is in Covered
+type compactSyncTree struct {
+	RootProof    string
+	LeafEncoding string `json:",omitempty"`
+	BaseProof    string `json:",omitempty"`
+	Leaves       []string
+	Covered      map[int]string `json:",omitempty"` // leaf index -> hash of covered leaf value
+}
+
+// fullSyncTree is json of sync tree with all nodes, written by proxies before compact trees
+type fullSyncTree BaseledgerSyncTree
+
+func (t BaseledgerSyncTree) MarshalJSON() ([]byte, error) {
+	levels, ok := nodeLevels(t)
+	if !ok || hasLeafIds(levels[0]) {
+		// i.e. empty tree or trustmesh tree with transaction ids as leaf ids
+		return json.Marshal(fullSyncTree(t))
+	}
+
+	compact := compactSyncTree{RootProof: t.RootProof, LeafEncoding: t.LeafEncoding, BaseProof: t.BaseProof}
+	for i, leaf := range levels[0] {
+		if !leaf.IsCovered {
+			compact.Leaves = append(compact.Leaves, leaf.Value)
+			continue
+		}
+		compact.Leaves = append(compact.Leaves, "")
+		if compact.Covered == nil {
+			compact.Covered = map[int]string{}
+		}
+		compact.Covered[i] = leaf.Value
+	}
+
+	return json.Marshal(compact)
+}
+
+// UnmarshalJSON reads compact and full sync trees, nodes of compact trees are computed from leaves
+func (t *BaseledgerSyncTree) UnmarshalJSON(data []byte) error {
+	var probe struct {
+		Leaves json.RawMessage
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+	if probe.Leaves == nil {
+		return json.Unmarshal(data, (*fullSyncTree)(t))
+	}
+
+	var compact compactSyncTree
+	if err := json.Unmarshal(data, &compact); err != nil {
+		return err
+	}
+	if !isLeafCount(len(compact.Leaves)) {
+		return fmt.Errorf("sync tree has %v leaves, expected power of two", len(compact.Leaves))
+	}
+
+	LeafNodeSlice := make([]SyncTreeNode, len(compact.Leaves))
+	for i, value := range compact.Leaves {
+		LeafNodeSlice[i] = SyncTreeNode{IsLeaf: true, Index: i, Value: value}
+		if hash, ok := compact.Covered[i]; ok {
+			LeafNodeSlice[i].IsCovered = true
+			LeafNodeSlice[i].Value = hash
+		}
+	}
+
+	*t = treeFromLevels(LeafNodeSlice, hashLevels(leafValues(LeafNodeSlice)))
+	t.RootProof = compact.RootProof
+	t.LeafEncoding = compact.LeafEncoding
+	t.BaseProof = compact.BaseProof
+	return nil
+}
+
+func hasLeafIds(leaves []SyncTreeNode) bool {
+	for i, leaf := range leaves {
+		if leaf.SyncTreeNodeID != nodeId(0, i) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLeafCount(count int) bool {
+	return count >= 2 && count&(count-1) == 0
+}
+
+// hashLevels hashes leaf values pairwise up to the root, levels[0] are the leaf values
+func hashLevels(leaves []string) [][]string {
+	levels := [][]string{leaves}
+	for level := leaves; len(level) > 1; level = levels[len(levels)-1] {
+		parents := make([]string, len(level)/2)
+		for i := range parents {
+			parents[i] = createHash(level[2*i] + "|" + level[2*i+1])
+		}
+		levels = append(levels, parents)
+	}
+
+	return levels
+}
+
+// updateHashLevels hashes leaves like hashLevels, hashes of base whose leaves did not change are kept.
+// It returns the levels and the number of hashes computed
+func updateHashLevels(base [][]string, leaves []string) ([][]string, int) {
+	if len(base) == 0 || len(base[0]) != len(leaves) {
+		return hashLevels(leaves), len(leaves) - 1
+	}
+
+	changed := []int{}
+	for i := range leaves {
+		if leaves[i] != base[0][i] {
+			changed = append(changed, i)
+		}
+	}
+
+	levels := [][]string{leaves}
+	computed := 0
+	for level := 1; level < len(base); level++ {
+		hashes := append([]string{}, base[level]...)
+		parents := []int{}
+		for _, i := range changed {
+			parent := i / 2
+			if len(parents) > 0 && parents[len(parents)-1] == parent {
+				continue
+			}
+			parents = append(parents, parent)
+			hashes[parent] = createHash(levels[level-1][2*parent] + "|" + levels[level-1][2*parent+1])
+			computed++
+		}
+		levels = append(levels, hashes)
+		changed = parents
+	}
+
+	return levels, computed
+}
+
+func nodeId(level int, index int) string {
+	return strconv.Itoa(level) + "-" + strconv.Itoa(index)
+}
+
+// nodesFromLevels creates nodes of all levels, leaves first and root last. Node ids are level-index
+// unless leaf has an id already
+func nodesFromLevels(LeafNodeSlice []SyncTreeNode, levels [][]string) []SyncTreeNode {
+	count := 0
+	for _, level := range levels {
+		count += len(level)
+	}
+	nodes := make([]SyncTreeNode, 0, count)
+
+	for level, hashes := range levels {
+		for index, value := range hashes {
+			node := SyncTreeNode{IsHash: level > 0, IsRoot: level > 0 && len(hashes) == 1, Level: level, Index: index, Value: value}
+			if level == 0 {
+				node = LeafNodeSlice[index]
+				node.IsLeaf = true
+				node.Level = 0
+				node.Index = index
+			}
+			if node.SyncTreeNodeID == "" {
+				node.SyncTreeNodeID = nodeId(level, index)
+			}
+			if level+1 < len(levels) {
+				node.ParentNodeID = nodeId(level+1, index/2)
+			}
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes
+}
+
+// nodeLevels orders nodes by level and index, false unless nodes are a complete binary tree
+func nodeLevels(tree BaseledgerSyncTree) ([][]SyncTreeNode, bool) {
+	sizes := []int{}
+	for _, node := range tree.Nodes {
+		if node.Level < 0 || node.Level > len(tree.Nodes) {
+			return nil, false
+		}
+		for len(sizes) <= node.Level {
+			sizes = append(sizes, 0)
+		}
+		sizes[node.Level]++
+	}
+	if len(sizes) < 2 || !isLeafCount(sizes[0]) {
+		return nil, false
+	}
+	for level := 1; level < len(sizes); level++ {
+		if sizes[level] != sizes[level-1]/2 {
+			return nil, false
+		}
+	}
+	if sizes[len(sizes)-1] != 1 {
+		return nil, false
+	}
+
+	levels := make([][]SyncTreeNode, len(sizes))
+	placed := make([][]bool, len(sizes))
+	for level, size := range sizes {
+		levels[level] = make([]SyncTreeNode, size)
+		placed[level] = make([]bool, size)
+	}
+	for _, node := range tree.Nodes {
+		if node.Index < 0 || node.Index >= sizes[node.Level] || placed[node.Level][node.Index] {
+			return nil, false
+		}
+		levels[node.Level][node.Index] = node
+		placed[node.Level][node.Index] = true
+	}
+
+	return levels, true
+}
+
+// verifyNodes checks every hash against the nodes below it and the root against root proof in one pass
+// over the nodes. Covered leaves hold the hash of their value, so pairs with covered leaf are checked too.
+// Covered leaves of trees from proxies before covered leaf hashes are empty and fail
+func verifyNodes(tree BaseledgerSyncTree) bool {
+	levels, ok := nodeLevels(tree)
+	if !ok {
+		return false
+	}
+
+	for level := 0; level+1 < len(levels); level++ {
+		for i, parent := range levels[level+1] {
+			left, right := levels[level][2*i], levels[level][2*i+1]
+			if parent.Value != createHash(left.Value+"|"+right.Value) {
+				return false
+			}
+		}
+	}
+
+	root := levels[len(levels)-1][0]
+	return root.Value == tree.RootProof
+}
+
+// levelValues are node values of a tree by level, nil if tree can not be updated incrementally
+func levelValues(tree BaseledgerSyncTree) [][]string {
+	levels, ok := nodeLevels(tree)
+	if !ok {
+		return nil
+	}
+
+	values := make([][]string, len(levels))
+	for level, nodes := range levels {
+		values[level] = make([]string, len(nodes))
+		for i, node := range nodes {
+			if node.IsCovered {
+				return nil
+			}
+			values[level][i] = node.Value
+		}
+	}
+	return values
+}
+
+// UpdateFromBusinessObject builds sync tree of new version of business object from sync tree of the
+// version before, only hashes above changed leaves are computed. The tree is the one CreateFromBusinessObject
+// builds, its BaseProof is root proof of base so offchain message can carry the delta to base only
+func UpdateFromBusinessObject(base BaseledgerSyncTree, businessObject string, format string, knowledgeLimiters []string) (BaseledgerSyncTree, error) {
+	leaves, err := businessObjectLeaves(businessObject, format)
+	if err != nil {
+		return BaseledgerSyncTree{}, err
+	}
+
+	LeafNodeSlice, err := leafNodes(leaves)
+	if err != nil {
+		return BaseledgerSyncTree{}, err
+	}
+	LeafNodeSlice = padLeaves(coverLeaves(LeafNodeSlice, knowledgeLimiters), len(LeafNodeSlice))
+
+	var baseLevels [][]string
+	if base.LeafEncoding == LeafEncodingJson && verifyNodes(base) {
+		baseLevels = levelValues(base)
+	}
+	levels, _ := updateHashLevels(baseLevels, leafValues(LeafNodeSlice))
+
+	syncTree := treeFromLevels(LeafNodeSlice, levels)
+	syncTree.LeafEncoding = LeafEncodingJson
+	if baseLevels != nil {
+		syncTree.BaseProof = base.RootProof
+	}
+	return syncTree, nil
+}
+
+// SyncTreeDelta is sync tree of new version of business object as changes to sync tree of the version
+// before, offchain messages of new versions carry it instead of the whole tree
+type SyncTreeDelta struct {
+	BaseProof    string
+	RootProof    string
+	LeafEncoding string `json:",omitempty"`
+	LeafCount    int
+	Changes      map[int]string // leaf values that differ from base by leaf index
+}
+
+// CreateDelta returns changes of tree to base, false if base is not the version tree was updated from
+func CreateDelta(base BaseledgerSyncTree, tree BaseledgerSyncTree) (*SyncTreeDelta, bool) {
+	if tree.BaseProof == "" || tree.BaseProof != base.RootProof || tree.LeafEncoding != base.LeafEncoding {
+		return nil, false
+	}
+	baseLevels, treeLevels := levelValues(base), levelValues(tree)
+	if baseLevels == nil || treeLevels == nil {
+		return nil, false
+	}
+
+	delta := &SyncTreeDelta{
+		BaseProof:    base.RootProof,
+		RootProof:    tree.RootProof,
+		LeafEncoding: tree.LeafEncoding,
+		LeafCount:    len(treeLevels[0]),
+		Changes:      map[int]string{},
+	}
+	for i, value := range treeLevels[0] {
+		if i >= len(baseLevels[0]) || baseLevels[0][i] != value {
+			delta.Changes[i] = value
+		}
+	}
+	return delta, true
+}
+
+// ApplyDelta rebuilds sync tree from base and delta, it fails unless the root is the root proof of delta
+func ApplyDelta(base BaseledgerSyncTree, delta SyncTreeDelta) (BaseledgerSyncTree, error) {
+	if base.RootProof != delta.BaseProof || !verifyNodes(base) {
+		return BaseledgerSyncTree{}, errors.New("base of sync tree delta does not match its proof")
+	}
+	baseLevels := levelValues(base)
+	if baseLevels == nil {
+		return BaseledgerSyncTree{}, errors.New("base of sync tree delta has covered leaves")
+	}
+	if !isLeafCount(delta.LeafCount) {
+		return BaseledgerSyncTree{}, fmt.Errorf("sync tree delta has %v leaves, expected power of two", delta.LeafCount)
+	}
+	// leaves beyond base are all in changes, so a delta never has more leaves than base and changes together
+	if delta.LeafCount > len(baseLevels[0])+len(delta.Changes) {
+		return BaseledgerSyncTree{}, fmt.Errorf("sync tree delta has %v leaves, base and changes only %v", delta.LeafCount, len(baseLevels[0])+len(delta.Changes))
+	}
+
+	leaves := make([]string, delta.LeafCount)
+	copy(leaves, baseLevels[0])
+	for i, value := range delta.Changes {
+		if i < 0 || i >= delta.LeafCount {
+			return BaseledgerSyncTree{}, fmt.Errorf("sync tree delta changes leaf %v of %v", i, delta.LeafCount)
+		}
+		leaves[i] = value
+	}
+
+	LeafNodeSlice := make([]SyncTreeNode, len(leaves))
+	for i, value := range leaves {
+		LeafNodeSlice[i] = SyncTreeNode{IsLeaf: true, Index: i, Value: value}
+	}
+	levels, _ := updateHashLevels(baseLevels, leaves)
+
+	syncTree := treeFromLevels(LeafNodeSlice, levels)
+	if syncTree.RootProof != delta.RootProof {
+		return BaseledgerSyncTree{}, errors.New("sync tree rebuilt from delta does not match its root proof")
+	}
+	syncTree.LeafEncoding = delta.LeafEncoding
+	syncTree.BaseProof = delta.BaseProof
+	return syncTree, nil
+}
+
+// ParseDelta reads sync tree json of offchain message, nil if it holds a whole tree
+func ParseDelta(syncTreeJson string) (*SyncTreeDelta, error) {
+	var probe struct {
+		Changes json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(syncTreeJson), &probe); err != nil || probe.Changes == nil {
+		return nil, nil
+	}
+
+	delta := &SyncTreeDelta{}
+	if err := json.Unmarshal([]byte(syncTreeJson), delta); err != nil {
+		return nil, fmt.Errorf("sync tree delta can not be read %w", err)
+	}
+	return delta, nil
+}
@@ -0,0 +1,153 @@
+package synctree
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func largeOrderJson(lines int, changedLine int) string {
+	items := []string{}
+	for i := 0; i < lines; i++ {
+		quantity := 1
+		if i == changedLine {
+			quantity = 2
+		}
+		items = append(items, fmt.Sprintf(`{"sku":"sku-%v","quantity":%v}`, i, quantity))
+	}
+	return `{"orderId":"4711","lines":[` + strings.Join(items, ",") + `]}`
+}
+
+func TestGivenSyncTreeWhenMarshaledThenCompactJsonRebuildsSameTree(t *testing.T) {
+	syncTree := createFromJson(t, largeOrderJson(20, -1), nil)
+
+	syncTreeJson, _ := json.Marshal(syncTree)
+	if strings.Contains(string(syncTreeJson), "Nodes") {
+		t.Fatalf("expected compact json, got %s", syncTreeJson)
+	}
+
+	var read BaseledgerSyncTree
+	if err := json.Unmarshal(syncTreeJson, &read); err != nil {
+		t.Fatalf("compact json can not be read %v", err)
+	}
+	if len(read.Nodes) != len(syncTree.Nodes) || read.RootProof != syncTree.RootProof || !verifyNodes(read) {
+		t.Fatalf("compact json did not rebuild tree")
+	}
+	if readBusinessObjectJson(t, read) != readBusinessObjectJson(t, syncTree) {
+		t.Fatalf("business object = %v, want %v", readBusinessObjectJson(t, read), readBusinessObjectJson(t, syncTree))
+	}
+}
+
+func TestGivenSyncTreeWithAllNodesWhenUnmarshaledThenItIsVerified(t *testing.T) {
+	syncTree := createFromJson(t, largeOrderJson(2, -1), nil)
+	fullJson, _ := json.Marshal(fullSyncTree(syncTree))
+
+	if !VerifyHashMatch(syncTree.RootProof, syncTree.RootProof, string(fullJson)) {
+		t.Fatalf("sync tree json with all nodes was not verified")
+	}
+}
+
+func TestGivenTamperedNeighbourOfCoveredLeafWhenVerifiedThenHashMatchFails(t *testing.T) {
+	syncTree := createFromJson(t, `{"id":"po-1","price":10}`, []string{"price"})
+	syncTreeJson, _ := json.Marshal(syncTree)
+	if !VerifyHashMatch(syncTree.RootProof, syncTree.RootProof, string(syncTreeJson)) {
+		t.Fatalf("sync tree with covered leaf was not verified")
+	}
+
+	var compact compactSyncTree
+	json.Unmarshal(syncTreeJson, &compact)
+	compact.Leaves[0] = `id:"po-2"`
+	tamperedJson, _ := json.Marshal(compact)
+
+	if VerifyHashMatch(syncTree.RootProof, syncTree.RootProof, string(tamperedJson)) {
+		t.Fatalf("sync tree with tampered neighbour of covered leaf was verified")
+	}
+}
+
+func TestGivenTamperedLeafWhenVerifiedThenHashMatchFails(t *testing.T) {
+	syncTree := createFromJson(t, largeOrderJson(20, -1), nil)
+	syncTree.Nodes[3].Value = strings.Replace(syncTree.Nodes[3].Value, "1", "9", 1)
+	syncTreeJson, _ := json.Marshal(fullSyncTree(syncTree))
+
+	if VerifyHashMatch(syncTree.RootProof, syncTree.RootProof, string(syncTreeJson)) {
+		t.Fatalf("tampered sync tree was verified")
+	}
+}
+
+func TestGivenOneChangedFieldWhenHashesUpdatedThenOnlyItsPathIsComputed(t *testing.T) {
+	base := createFromJson(t, largeOrderJson(100, -1), nil)
+	changed := createFromJson(t, largeOrderJson(100, 42), nil)
+
+	levels, computed := updateHashLevels(levelValues(base), levelValues(changed)[0])
+	if computed != len(levels)-1 {
+		t.Fatalf("computed %v hashes, want %v", computed, len(levels)-1)
+	}
+	if levels[len(levels)-1][0] != changed.RootProof {
+		t.Fatalf("root = %v, want %v", levels[len(levels)-1][0], changed.RootProof)
+	}
+}
+
+func TestGivenNewVersionWhenUpdatedFromBaseThenTreeMatchesFullBuild(t *testing.T) {
+	base := createFromJson(t, largeOrderJson(100, -1), nil)
+
+	updated, err := UpdateFromBusinessObject(base, largeOrderJson(100, 42), "", nil)
+	if err != nil {
+		t.Fatalf("update failed %v", err)
+	}
+
+	full := createFromJson(t, largeOrderJson(100, 42), nil)
+	if updated.RootProof != full.RootProof || updated.BaseProof != base.RootProof || !verifyNodes(updated) {
+		t.Fatalf("updated tree %v does not match full build %v", updated.RootProof, full.RootProof)
+	}
+}
+
+func TestGivenDeltaWhenAppliedToBaseThenNewVersionIsRebuilt(t *testing.T) {
+	base := createFromJson(t, largeOrderJson(100, -1), nil)
+	updated, _ := UpdateFromBusinessObject(base, largeOrderJson(100, 42), "", nil)
+
+	delta, ok := CreateDelta(base, updated)
+	if !ok || len(delta.Changes) != 1 {
+		t.Fatalf("expected delta with one change, got %v", delta)
+	}
+	deltaJson, _ := json.Marshal(delta)
+	parsed, err := ParseDelta(string(deltaJson))
+	if err != nil || parsed == nil {
+		t.Fatalf("delta can not be parsed %v", err)
+	}
+
+	applied, err := ApplyDelta(base, *parsed)
+	if err != nil {
+		t.Fatalf("delta can not be applied %v", err)
+	}
+	if readBusinessObjectJson(t, applied) != readBusinessObjectJson(t, updated) {
+		t.Fatalf("business object = %v, want %v", readBusinessObjectJson(t, applied), readBusinessObjectJson(t, updated))
+	}
+
+	parsed.RootProof = base.RootProof
+	if _, err := ApplyDelta(base, *parsed); err == nil {
+		t.Fatalf("expected delta with wrong root proof to fail")
+	}
+
+	parsed.RootProof = updated.RootProof
+	parsed.LeafCount = 1 << 62
+	if _, err := ApplyDelta(base, *parsed); err == nil {
+		t.Fatalf("expected delta with more leaves than base and changes to fail")
+	}
+
+	// new version with many more leaves than base
+	grown, _ := UpdateFromBusinessObject(base, largeOrderJson(1000, -1), "", nil)
+	grownDelta, _ := CreateDelta(base, grown)
+	if applied, err := ApplyDelta(base, *grownDelta); err != nil || applied.RootProof != grown.RootProof {
+		t.Fatalf("expected grown tree to be rebuilt, got %v", err)
+	}
+}
+
+func TestGivenWholeSyncTreeWhenParsedAsDeltaThenNoDelta(t *testing.T) {
+	syncTreeJson, _ := json.Marshal(createFromJson(t, largeOrderJson(2, -1), nil))
+
+	delta, err := ParseDelta(string(syncTreeJson))
+	if err != nil || delta != nil {
+		t.Fatalf("expected no delta, got %v %v", delta, err)
+	}
+}
@@ -0,0 +1,149 @@
+package synctree
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/unibrightio/proxy-api/codec"
+)
+
+// JSON patch operations of a diff, test marks covered field whose hash did not change
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+	PatchOpTest    = "test"
+)
+
+// PatchOperation is a JSON patch (RFC 6902) operation with the replaced value added. Covered (knowledge
+// limited) fields have neither path nor value in the tree, they are identified by leaf index and compared
+// by the hash of their leaf
+type PatchOperation struct {
+	Op       string      `json:"op"`
+	Path     string      `json:"path"`
+	Value    interface{} `json:"value,omitempty"`
+	OldValue interface{} `json:"old_value,omitempty"`
+	Covered  bool        `json:"covered,omitempty"`
+	Leaf     *int        `json:"leaf,omitempty"`
+	Hash     string      `json:"hash,omitempty"`
+	OldHash  string      `json:"old_hash,omitempty"`
+}
+
+type leafField struct {
+	value   interface{}
+	literal string // value as written in leaf, fields are compared by it
+}
+
+var arrayIndexPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// Diff compares flattened business object leaves of two sync trees, operations are sorted by path
+// and turn business object of from into business object of to
+func Diff(from BaseledgerSyncTree, to BaseledgerSyncTree) []PatchOperation {
+	fromFields, fromCovered := leafFields(from)
+	toFields, toCovered := leafFields(to)
+
+	operations := []PatchOperation{}
+	for path, field := range toFields {
+		old, ok := fromFields[path]
+		switch {
+		case !ok:
+			operations = append(operations, fieldOperation(PatchOpAdd, path, field, leafField{}))
+		case old.literal != field.literal:
+			operations = append(operations, fieldOperation(PatchOpReplace, path, field, old))
+		}
+	}
+	for path, old := range fromFields {
+		if _, ok := toFields[path]; !ok {
+			operations = append(operations, fieldOperation(PatchOpRemove, path, leafField{}, old))
+		}
+	}
+
+	for leaf, hash := range toCovered {
+		oldHash, ok := fromCovered[leaf]
+		switch {
+		case !ok:
+			operations = append(operations, coveredOperation(PatchOpAdd, leaf, hash, ""))
+		case oldHash == hash:
+			operations = append(operations, coveredOperation(PatchOpTest, leaf, hash, oldHash))
+		default:
+			operations = append(operations, coveredOperation(PatchOpReplace, leaf, hash, oldHash))
+		}
+	}
+	for leaf, oldHash := range fromCovered {
+		if _, ok := toCovered[leaf]; !ok {
+			operations = append(operations, coveredOperation(PatchOpRemove, leaf, "", oldHash))
+		}
+	}
+
+	// covered leaves come first by leaf index, then fields by path
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i].Covered != operations[j].Covered {
+			return operations[i].Covered
+		}
+		if operations[i].Covered {
+			return *operations[i].Leaf < *operations[j].Leaf
+		}
+		return operations[i].Path < operations[j].Path
+	})
+	return operations
+}
+
+func coveredOperation(op string, leaf int, hash string, oldHash string) PatchOperation {
+	return PatchOperation{Op: op, Covered: true, Leaf: &leaf, Hash: hash, OldHash: oldHash}
+}
+
+func fieldOperation(op string, path string, field leafField, old leafField) PatchOperation {
+	operation := PatchOperation{Op: op, Path: jsonPointer(path)}
+	if op != PatchOpRemove {
+		operation.Value = field.value
+	}
+	if op == PatchOpReplace || op == PatchOpRemove {
+		operation.OldValue = old.value
+	}
+	return operation
+}
+
+// leafFields maps field paths of business object leaves (path:value) to their values and indexes of
+// covered leaves to the hash of their value, the only thing known about them. Padding leaves have no field
+func leafFields(tree BaseledgerSyncTree) (map[string]leafField, map[int]string) {
+	fields := map[string]leafField{}
+	covered := map[int]string{}
+	for _, node := range tree.Nodes {
+		if !node.IsLeaf || node.Level != 0 {
+			continue
+		}
+
+		if node.IsCovered {
+			covered[node.Index] = node.Value
+			continue
+		}
+
+		parts := strings.SplitN(node.Value, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		field := leafField{literal: parts[1], value: parts[1]}
+		if tree.LeafEncoding == LeafEncodingJson {
+			if value, err := decodeLeafValue(parts[1]); err == nil {
+				field.value = value
+			}
+		}
+		fields[parts[0]] = field
+	}
+
+	return fields, covered
+}
+
+// jsonPointer turns flattened path a.b[0].c into /a/b/0/c
+func jsonPointer(path string) string {
+	path = arrayIndexPattern.ReplaceAllString(path, ".$1")
+
+	segments := strings.Split(path, ".")
+	for i, segment := range segments {
+		segment = codec.UnescapeName(segment)
+		segments[i] = strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1")
+	}
+	return "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,100 @@
+package synctree
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGivenChangedBusinessObjectWhenDiffThenAddRemoveAndReplaceOperationsSortedByPath(t *testing.T) {
+	from := createFromJson(t, `{"id":"po-1","amount":10,"lines":[{"sku":"a"}],"note":"old"}`, []string{})
+	to := createFromJson(t, `{"id":"po-1","amount":12,"lines":[{"sku":"a"},{"sku":"b/c"}]}`, []string{})
+
+	operations := Diff(from, to)
+
+	want := []PatchOperation{
+		{Op: PatchOpReplace, Path: "/amount", Value: json.Number("12"), OldValue: json.Number("10")},
+		{Op: PatchOpAdd, Path: "/lines/1/sku", Value: "b/c"},
+		{Op: PatchOpRemove, Path: "/note", OldValue: "old"},
+	}
+	if len(operations) != len(want) {
+		t.Fatalf("operations = %+v, want %+v", operations, want)
+	}
+	for i := range want {
+		if operations[i] != want[i] {
+			t.Fatalf("operation %v = %+v, want %+v", i, operations[i], want[i])
+		}
+	}
+}
+
+func TestGivenSameBusinessObjectWhenDiffThenNoOperations(t *testing.T) {
+	from := createFromJson(t, `{"id":"po-1","amount":10}`, []string{})
+	to := createFromJson(t, `{"amount":10,"id":"po-1"}`, []string{})
+
+	if operations := Diff(from, to); len(operations) != 0 {
+		t.Fatalf("operations = %+v, want none", operations)
+	}
+}
+
+// compactRoundTrip returns tree the way receiving proxy reads it, covered leaves keep only their stored hash
+func compactRoundTrip(t *testing.T, tree BaseledgerSyncTree) BaseledgerSyncTree {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("marshal failed %v", err)
+	}
+	var read BaseledgerSyncTree
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatalf("unmarshal failed %v", err)
+	}
+	return read
+}
+
+func TestGivenCoveredLeafWhenDiffThenOnlyLeafHashesCompared(t *testing.T) {
+	from := createFromJson(t, `{"id":"po-1","price":10}`, []string{"price"})
+	to := compactRoundTrip(t, createFromJson(t, `{"id":"po-1","price":11}`, []string{"price"}))
+	unchanged := compactRoundTrip(t, createFromJson(t, `{"id":"po-1","price":10}`, []string{"price"}))
+
+	operations := Diff(from, to)
+	if len(operations) != 1 || operations[0].Op != PatchOpReplace || !operations[0].Covered || operations[0].Value != nil || operations[0].OldValue != nil {
+		t.Fatalf("operations = %+v, want covered replace without values", operations)
+	}
+	if operations[0].Leaf == nil || *operations[0].Leaf != 1 || operations[0].Path != "" {
+		t.Fatalf("operation = %+v, want covered leaf 1 without path", operations[0])
+	}
+	if operations[0].Hash != createHash(`price:11`) || operations[0].OldHash != createHash(`price:10`) {
+		t.Fatalf("hashes = %v %v, want hashes of covered leaves", operations[0].Hash, operations[0].OldHash)
+	}
+
+	operations = Diff(from, unchanged)
+	if len(operations) != 1 || operations[0].Op != PatchOpTest || operations[0].Hash != operations[0].OldHash {
+		t.Fatalf("operations = %+v, want covered test", operations)
+	}
+}
+
+func TestGivenFieldCoveredOnlyInNewVersionWhenDiffThenFieldIsRemovedAndCoveredLeafAdded(t *testing.T) {
+	from := createFromJson(t, `{"id":"po-1","price":10}`, []string{})
+	to := createFromJson(t, `{"id":"po-1","price":10}`, []string{"price"})
+
+	operations := Diff(from, to)
+	if len(operations) != 2 || operations[0].Op != PatchOpAdd || !operations[0].Covered || operations[1].Op != PatchOpRemove || operations[1].Path != "/price" {
+		t.Fatalf("operations = %+v, want covered add and removed price", operations)
+	}
+}
+
+func TestGivenPathWithArrayIndexesAndEscapedCharactersWhenJsonPointerThenRfc6901Pointer(t *testing.T) {
+	if pointer := jsonPointer("a.b[0].c~d[12]"); pointer != "/a/b/0/c~0d/12" {
+		t.Fatalf("pointer = %v", pointer)
+	}
+}
+
+func TestGivenCoveredLeavesAndFieldsWhenDiffThenCoveredLeavesSortedByIndexBeforeFields(t *testing.T) {
+	from := createFromJson(t, `{"id":"po-1","amount":10,"price":10,"tax":1}`, []string{"price", "tax"})
+	to := createFromJson(t, `{"id":"po-1","amount":12,"price":11,"tax":2}`, []string{"price", "tax"})
+
+	operations := Diff(from, to)
+	if len(operations) != 3 || !operations[0].Covered || !operations[1].Covered || operations[2].Covered || operations[2].Path != "/amount" {
+		t.Fatalf("operations = %+v, want two covered leaves before amount", operations)
+	}
+	if *operations[0].Leaf >= *operations[1].Leaf {
+		t.Fatalf("leaves = %v %v, want ascending leaf index", *operations[0].Leaf, *operations[1].Leaf)
+	}
+}
@@ -0,0 +1,104 @@
+package synctree
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/unibrightio/proxy-api/codec"
+)
+
+// FormatLeaf is path of the leaf that keeps format of business objects that are not json, so that
+// receiver can write business object back in the format it was sent in. It is hashed like any other leaf,
+// field names can not collide with it as codec.EscapeName escapes #
+const FormatLeaf = "#format"
+
+// CreateFromBusinessObject builds sync tree from business object in given format, empty format is json
+func CreateFromBusinessObject(businessObject string, format string, knowledgeLimiters []string) (BaseledgerSyncTree, error) {
+	leaves, err := businessObjectLeaves(businessObject, format)
+	if err != nil {
+		return BaseledgerSyncTree{}, err
+	}
+
+	return createFromLeaves(leaves, knowledgeLimiters)
+}
+
+// businessObjectLeaves maps field paths of business object in given format to field values
+func businessObjectLeaves(businessObject string, format string) (map[string]interface{}, error) {
+	if format == "" || format == codec.FormatJson {
+		return jsonLeaves(businessObject)
+	}
+
+	businessObjectCodec, err := codec.Get(format)
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := businessObjectCodec.Decode(businessObject)
+	if err != nil {
+		return nil, err
+	}
+
+	leafValues := map[string]interface{}{FormatLeaf: format}
+	for path, value := range leaves {
+		leafValues[path] = value
+	}
+	return leafValues, nil
+}
+
+// GetBusinessObject writes business object of sync tree back in the format it was created from
+func GetBusinessObject(syncTree BaseledgerSyncTree) (businessObject string, format string, err error) {
+	values, err := readLeaves(syncTree)
+	if err != nil {
+		return "", "", err
+	}
+	formatValue, ok := values[FormatLeaf]
+	if !ok {
+		businessObject, err = GetBusinessObjectJson(syncTree)
+		return businessObject, codec.FormatJson, err
+	}
+	delete(values, FormatLeaf)
+
+	// codecs decode to strings, other values would come from leaves changed after decoding
+	format = fmt.Sprint(formatValue)
+	leaves := map[string]string{}
+	for path, value := range values {
+		leaves[path] = fmt.Sprint(value)
+	}
+
+	businessObjectCodec, err := codec.Get(format)
+	if err != nil {
+		return "", format, err
+	}
+	if len(leaves) == 0 {
+		return "", format, errors.New("sync tree has no business object leaves")
+	}
+	businessObject, err = businessObjectCodec.Encode(leaves, leafCount(syncTree))
+	return businessObject, format, err
+}
+
+// GetBusinessObjectFieldsJson is json of business object fields without format leaf, schemas of business
+// object types are checked against it whatever format business object was sent in
+func GetBusinessObjectFieldsJson(syncTree BaseledgerSyncTree) (string, error) {
+	fields := BaseledgerSyncTree{RootProof: syncTree.RootProof, LeafEncoding: syncTree.LeafEncoding}
+	for _, node := range syncTree.Nodes {
+		if node.IsLeaf && strings.HasPrefix(node.Value, FormatLeaf+":") {
+			continue
+		}
+		fields.Nodes = append(fields.Nodes, node)
+	}
+	return GetBusinessObjectJson(fields)
+}
+
+// HasTypedFields is true if business object fields keep their json types, fields of other formats
+// and of trees without leaf encoding are strings
+func HasTypedFields(syncTree BaseledgerSyncTree) bool {
+	if syncTree.LeafEncoding != LeafEncodingJson {
+		return false
+	}
+	for _, node := range syncTree.Nodes {
+		if node.IsLeaf && strings.HasPrefix(node.Value, FormatLeaf+":") {
+			return false
+		}
+	}
+	return true
+}
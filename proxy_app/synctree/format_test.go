@@ -0,0 +1,70 @@
+package synctree
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/unibrightio/proxy-api/codec"
+)
+
+func TestGivenCsvBusinessObjectWhenSyncTreeCreatedThenBusinessObjectWrittenBackInCsv(t *testing.T) {
+	csv := "sku,quantity\na-1,2\nb-2,1\n"
+
+	syncTree, err := CreateFromBusinessObject(csv, codec.FormatCsv, []string{})
+	if err != nil {
+		t.Fatalf("create failed %v", err)
+	}
+	businessObject, format, err := GetBusinessObject(syncTree)
+
+	if err != nil || format != codec.FormatCsv || businessObject != csv {
+		t.Fatalf("business object = %q, format %v, %v, want %q", businessObject, format, err, csv)
+	}
+	var fields map[string]interface{}
+	fieldsJson, err := GetBusinessObjectFieldsJson(syncTree)
+	if err != nil {
+		t.Fatalf("reading fields failed %v", err)
+	}
+	if err := json.Unmarshal([]byte(fieldsJson), &fields); err != nil {
+		t.Fatalf("fields json invalid %v", err)
+	}
+	if _, ok := fields[FormatLeaf]; ok || len(fields["rows"].([]interface{})) != 2 {
+		t.Fatalf("fields = %v, want rows without format leaf", fields)
+	}
+}
+
+func TestGivenJsonBusinessObjectWhenGetBusinessObjectThenJson(t *testing.T) {
+	syncTree, err := CreateFromBusinessObject(`{"id":"po-1"}`, "", []string{})
+	if err != nil {
+		t.Fatalf("create failed %v", err)
+	}
+
+	businessObject, format, err := GetBusinessObject(syncTree)
+
+	if err != nil || format != codec.FormatJson || businessObject != `{"id":"po-1"}` {
+		t.Fatalf("business object = %q, format %v, %v", businessObject, format, err)
+	}
+}
+
+func TestGivenJsonKeyNamedLikeFormatLeafWhenGetBusinessObjectThenJsonWithTheKey(t *testing.T) {
+	businessObjectJson := `{"#format":"csv","id":"po-1"}`
+	syncTree, err := CreateFromBusinessObject(businessObjectJson, "", []string{})
+	if err != nil {
+		t.Fatalf("create failed %v", err)
+	}
+
+	businessObject, format, err := GetBusinessObject(syncTree)
+
+	if err != nil || format != codec.FormatJson || businessObject != businessObjectJson {
+		t.Fatalf("business object = %q, format %v, %v, want %q", businessObject, format, err, businessObjectJson)
+	}
+	fieldsJson, err := GetBusinessObjectFieldsJson(syncTree)
+	if err != nil || !HasTypedFields(syncTree) || fieldsJson != businessObjectJson {
+		t.Fatalf("fields json = %v, %v, want %v", fieldsJson, err, businessObjectJson)
+	}
+}
+
+func TestGivenUnsupportedFormatWhenCreateFromBusinessObjectThenError(t *testing.T) {
+	if _, err := CreateFromBusinessObject("ISA*00*", "x12", []string{}); err == nil {
+		t.Fatalf("create succeeded, want error")
+	}
+}
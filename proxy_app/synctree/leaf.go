@@ -0,0 +1,243 @@
+package synctree
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unibrightio/proxy-api/codec"
+)
+
+// LeafEncodingJson marks sync trees whose leaves are path:value with escaped path segments (see
+// codec.EscapeName) and value as json literal, so numbers, booleans, nulls and empty objects and arrays
+// keep their type. Trees without leaf encoding have fmt.Sprint values and are read as strings
+const LeafEncodingJson = "json"
+
+// flattenLeaves adds a leaf for every scalar, empty object and empty array of nested json value
+func flattenLeaves(prefix string, nested interface{}, leaves map[string]interface{}) {
+	switch nested := nested.(type) {
+	case map[string]interface{}:
+		if len(nested) == 0 {
+			leaves[prefix] = nested
+			return
+		}
+		for k, v := range nested {
+			key := codec.EscapeName(k)
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenLeaves(key, v, leaves)
+		}
+	case []interface{}:
+		if len(nested) == 0 {
+			leaves[prefix] = nested
+			return
+		}
+		for i, v := range nested {
+			flattenLeaves(prefix+"["+strconv.Itoa(i)+"]", v, leaves)
+		}
+	default:
+		leaves[prefix] = nested
+	}
+}
+
+// encodeLeafValue writes leaf value as json literal, html characters are not escaped so that
+// leaves stay readable
+func encodeLeafValue(value interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func decodeLeafValue(literal string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(literal))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// readLeaves maps field paths of uncovered business object leaves to their values, values of trees
+// without leaf encoding are strings
+func readLeaves(syncTree BaseledgerSyncTree) (map[string]interface{}, error) {
+	leaves := map[string]interface{}{}
+	for _, node := range syncTree.Nodes {
+		if !node.IsLeaf || node.IsCovered || node.Value == "" {
+			continue
+		}
+		parts := strings.SplitN(node.Value, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if syncTree.LeafEncoding != LeafEncodingJson {
+			leaves[parts[0]] = parts[1]
+			continue
+		}
+
+		value, err := decodeLeafValue(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("leaf %v has invalid value %w", parts[0], err)
+		}
+		leaves[parts[0]] = value
+	}
+
+	return leaves, nil
+}
+
+// leafCount is number of leaves of sync tree, covered and padding leaves included. Arrays of its
+// business object have fewer elements, every element has at least one leaf
+func leafCount(syncTree BaseledgerSyncTree) int {
+	count := 0
+	for _, node := range syncTree.Nodes {
+		if node.IsLeaf && node.Level == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+type pathStep struct {
+	key   string
+	index int // -1 if step is object key
+}
+
+// parseLeafPath splits escaped path a.b[0][1].c into steps, empty path is the business object itself.
+// Indexes have to be below maxIndex, the number of leaves of the tree
+func parseLeafPath(path string, maxIndex int) ([]pathStep, error) {
+	steps := []pathStep{}
+	if path == "" {
+		return steps, nil
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		name := part
+		indexes := ""
+		if open := strings.Index(part, "["); open > -1 {
+			name, indexes = part[:open], part[open:]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("path %v has empty segment", path)
+		}
+		steps = append(steps, pathStep{key: codec.UnescapeName(name), index: -1})
+
+		for indexes != "" {
+			end := strings.Index(indexes, "]")
+			if indexes[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("path %v has invalid index", path)
+			}
+			index, err := strconv.Atoi(indexes[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %v has invalid index", path)
+			}
+			if index >= maxIndex {
+				return nil, fmt.Errorf("path %v has index above %v leaves of sync tree", path, maxIndex)
+			}
+			steps = append(steps, pathStep{index: index})
+			indexes = indexes[end+1:]
+		}
+	}
+
+	return steps, nil
+}
+
+// fieldNode is object, array or value of business object while it is rebuilt from leaves
+type fieldNode struct {
+	object map[string]*fieldNode
+	array  map[int]*fieldNode
+	value  interface{}
+	isLeaf bool
+}
+
+func (n *fieldNode) step(step pathStep, path string) (*fieldNode, error) {
+	if n.isLeaf {
+		return nil, fmt.Errorf("path %v continues below value", path)
+	}
+	if step.index < 0 {
+		if n.array != nil {
+			return nil, fmt.Errorf("path %v addresses array by key", path)
+		}
+		if n.object == nil {
+			n.object = map[string]*fieldNode{}
+		}
+		if _, ok := n.object[step.key]; !ok {
+			n.object[step.key] = &fieldNode{}
+		}
+		return n.object[step.key], nil
+	}
+
+	if n.object != nil {
+		return nil, fmt.Errorf("path %v addresses object by index", path)
+	}
+	if n.array == nil {
+		n.array = map[int]*fieldNode{}
+	}
+	if _, ok := n.array[step.index]; !ok {
+		n.array[step.index] = &fieldNode{}
+	}
+	return n.array[step.index], nil
+}
+
+func (n *fieldNode) build() interface{} {
+	switch {
+	case n.isLeaf:
+		return n.value
+	case n.array != nil:
+		indexes := []int{}
+		for index := range n.array {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		// indexes missing in leaves (i.e. covered) are null
+		array := make([]interface{}, indexes[len(indexes)-1]+1)
+		for _, index := range indexes {
+			array[index] = n.array[index].build()
+		}
+		return array
+	default:
+		object := map[string]interface{}{}
+		for key, child := range n.object {
+			object[key] = child.build()
+		}
+		return object
+	}
+}
+
+// unflattenLeaves rebuilds business object from leaves with escaped paths, array indexes have to be
+// below maxIndex
+func unflattenLeaves(leaves map[string]interface{}, maxIndex int) (map[string]interface{}, error) {
+	root := &fieldNode{}
+	for path, value := range leaves {
+		steps, err := parseLeafPath(path, maxIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		node := root
+		for _, step := range steps {
+			if node, err = node.step(step, path); err != nil {
+				return nil, err
+			}
+		}
+		if node.isLeaf || node.object != nil || node.array != nil {
+			return nil, fmt.Errorf("path %v has more than one value", path)
+		}
+		node.isLeaf = true
+		node.value = value
+	}
+
+	object, ok := root.build().(map[string]interface{})
+	if !ok {
+		return nil, errors.New("business object is not an object")
+	}
+	return object, nil
+}
@@ -0,0 +1,176 @@
+package synctree
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// keys with characters that have a meaning in leaf paths and leaf values
+var propertyKeys = []string{"id", "a.b", "c:d", "e[0]", "]", "%2E", "%", "", "~/", "Größe", "line items", "0"}
+
+var propertyNumbers = []string{"0", "-1", "12", "3.25", "1e21", "-0.5E-3", "12345678901234567890123"}
+
+var propertyStrings = []string{"", "po-1", "a:b", "<nil>", "true", "12", "map[]", `"quoted"`, "line\nbreak", "<tag> & ü"}
+
+func randomJsonValue(r *rand.Rand, depth int) interface{} {
+	kind := r.Intn(8)
+	if depth > 3 && kind >= 6 {
+		kind = r.Intn(6)
+	}
+
+	switch kind {
+	case 0:
+		return nil
+	case 1:
+		return r.Intn(2) == 0
+	case 2, 3:
+		return json.Number(propertyNumbers[r.Intn(len(propertyNumbers))])
+	case 4, 5:
+		return propertyStrings[r.Intn(len(propertyStrings))]
+	case 6:
+		return randomJsonObject(r, depth+1)
+	default:
+		// arrays longer than 10 elements have multi digit indexes
+		array := make([]interface{}, r.Intn(14))
+		for i := range array {
+			array[i] = randomJsonValue(r, depth+1)
+		}
+		return array
+	}
+}
+
+func randomJsonObject(r *rand.Rand, depth int) map[string]interface{} {
+	object := map[string]interface{}{}
+	for i := r.Intn(5); i > 0; i-- {
+		object[propertyKeys[r.Intn(len(propertyKeys))]] = randomJsonValue(r, depth)
+	}
+	return object
+}
+
+func createFromJson(t *testing.T, businessObjectJson string, knowledgeLimiters []string) BaseledgerSyncTree {
+	syncTree, err := CreateFromBusinessObjectJson(businessObjectJson, knowledgeLimiters)
+	if err != nil {
+		t.Fatalf("create failed %v", err)
+	}
+	return syncTree
+}
+
+func readBusinessObjectJson(t *testing.T, syncTree BaseledgerSyncTree) string {
+	businessObjectJson, err := GetBusinessObjectJson(syncTree)
+	if err != nil {
+		t.Fatalf("reading business object failed %v", err)
+	}
+	return businessObjectJson
+}
+
+func decodeWithNumbers(t *testing.T, businessObjectJson string) interface{} {
+	decoder := json.NewDecoder(strings.NewReader(businessObjectJson))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		t.Fatalf("invalid json %v %v", businessObjectJson, err)
+	}
+	return value
+}
+
+func TestGivenRandomBusinessObjectWhenSyncTreeCreatedThenBusinessObjectJsonRoundTripsLosslessly(t *testing.T) {
+	property := func(seed int64) bool {
+		object := randomJsonObject(rand.New(rand.NewSource(seed)), 0)
+		businessObjectJson, _ := json.Marshal(object)
+
+		syncTree := createFromJson(t, string(businessObjectJson), []string{})
+		roundTripped := readBusinessObjectJson(t, syncTree)
+
+		if !reflect.DeepEqual(decodeWithNumbers(t, string(businessObjectJson)), decodeWithNumbers(t, roundTripped)) {
+			t.Logf("business object %s came back as %s", businessObjectJson, roundTripped)
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGivenRandomBusinessObjectWhenSyncTreeCreatedThenLeafPathsHaveNoValueSeparator(t *testing.T) {
+	property := func(seed int64) bool {
+		object := randomJsonObject(rand.New(rand.NewSource(seed)), 0)
+		businessObjectJson, _ := json.Marshal(object)
+
+		syncTree := createFromJson(t, string(businessObjectJson), []string{})
+		for _, node := range syncTree.Nodes {
+			if node.Level != 0 || node.Value == "" {
+				continue
+			}
+			path := strings.SplitN(node.Value, ":", 2)[0]
+			if _, err := parseLeafPath(path, leafCount(syncTree)); err != nil {
+				t.Logf("leaf %v of %s has invalid path %v", node.Value, businessObjectJson, err)
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGivenTreeWithoutLeafEncodingWhenGetBusinessObjectJsonThenLeavesReadAsStringsWithMultiDigitIndexes(t *testing.T) {
+	leaves := []SyncTreeNode{}
+	for i := 0; i < 12; i++ {
+		leaves = append(leaves, SyncTreeNode{IsLeaf: true, Index: i, Value: "lines[" + strconv.Itoa(i) + "].sku:sku-" + strconv.Itoa(i)})
+	}
+	legacy := buildSyncTreeFromLeaves(leaves, len(leaves), []string{})
+
+	var businessObject map[string][]map[string]string
+	if err := json.Unmarshal([]byte(readBusinessObjectJson(t, legacy)), &businessObject); err != nil {
+		t.Fatalf("invalid business object json %v", err)
+	}
+	if len(businessObject["lines"]) != 12 || businessObject["lines"][11]["sku"] != "sku-11" {
+		t.Fatalf("lines = %v, want 12 lines", businessObject["lines"])
+	}
+}
+
+func TestGivenInvalidJsonWhenCreateFromBusinessObjectJsonThenError(t *testing.T) {
+	for _, businessObjectJson := range []string{`{"id":`, `["po-1"]`, ``} {
+		if _, err := CreateFromBusinessObjectJson(businessObjectJson, []string{}); err == nil {
+			t.Fatalf("create of %q succeeded, want error", businessObjectJson)
+		}
+	}
+}
+
+func TestGivenLeafWithIndexAboveLeafCountWhenGetBusinessObjectJsonThenError(t *testing.T) {
+	for _, index := range []string{"9223372036854775807", "100000000", "4"} {
+		syncTree := createFromJson(t, `{"id":"po-1","items":[{"sku":1},{"sku":2}]}`, []string{})
+		for i, node := range syncTree.Nodes {
+			if node.Level == 0 && strings.HasPrefix(node.Value, "items[1].sku:") {
+				syncTree.Nodes[i].Value = "items[" + index + "].sku:2"
+			}
+		}
+
+		if businessObjectJson, err := GetBusinessObjectJson(syncTree); err == nil {
+			t.Fatalf("business object with index %v = %v, want error", index, businessObjectJson)
+		}
+
+		syncTree.LeafEncoding = ""
+		if businessObjectJson, err := GetBusinessObjectJson(syncTree); err == nil {
+			t.Fatalf("business object without leaf encoding with index %v = %v, want error", index, businessObjectJson)
+		}
+	}
+}
+
+func TestGivenLeafWithInvalidValueWhenGetBusinessObjectJsonThenError(t *testing.T) {
+	syncTree := createFromJson(t, `{"id":"po-1","amount":10}`, []string{})
+	syncTree.Nodes[0].Value = `amount:{"not json`
+
+	if businessObjectJson, err := GetBusinessObjectJson(syncTree); err == nil {
+		t.Fatalf("business object = %v, want error", businessObjectJson)
+	}
+}
@@ -7,15 +7,18 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/ahmetb/go-linq/v3"
 	"github.com/imdario/mergo"
-	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/metrics"
 	"github.com/unibrightio/proxy-api/types"
 )
 
+var synctreeLog = logger.For("synctree")
+
 type SyncTreeNode struct {
 	SyncTreeNodeID string
 	ParentNodeID   string
@@ -29,8 +32,10 @@ type SyncTreeNode struct {
 }
 
 type BaseledgerSyncTree struct {
-	RootProof string
-	Nodes     []SyncTreeNode
+	RootProof    string
+	Nodes        []SyncTreeNode
+	LeafEncoding string `json:",omitempty"` // LeafEncodingJson, empty for trees of proxies before it
+	BaseProof    string `json:",omitempty"` // root proof of version tree was updated from, see UpdateFromBusinessObject
 }
 
 func CreateFromTrustmesh(trustmesh types.Trustmesh) BaseledgerSyncTree {
@@ -56,85 +61,145 @@ func CreateFromTrustmesh(trustmesh types.Trustmesh) BaseledgerSyncTree {
 	return buildSyncTreeFromLeaves(LeafNodeSlice, leafIndex, []string{})
 }
 
-func CreateFromBusinessObjectJson(businessObjectJson string, knowledgeLimiters []string) BaseledgerSyncTree {
+func CreateFromBusinessObjectJson(businessObjectJson string, knowledgeLimiters []string) (BaseledgerSyncTree, error) {
+	leaves, err := jsonLeaves(businessObjectJson)
+	if err != nil {
+		return BaseledgerSyncTree{}, err
+	}
+
+	return createFromLeaves(leaves, knowledgeLimiters)
+}
+
+func jsonLeaves(businessObjectJson string) (map[string]interface{}, error) {
 	var result map[string]interface{}
-	var leafIndex = 0
-	json.Unmarshal([]byte(businessObjectJson), &result)
+	// numbers are kept as written, float64 would round big integers
+	decoder := json.NewDecoder(strings.NewReader(businessObjectJson))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("business object is not a json object %w", err)
+	}
 	//Flatten hierarchical structure into non-hierarchical leaf node structure
-	FlattenOut, err := Flatten(result, nil)
+	FlattenOut := map[string]interface{}{}
+	if result != nil {
+		flattenLeaves("", result, FlattenOut)
+	}
+
+	return FlattenOut, nil
+}
+
+func createFromLeaves(leaves map[string]interface{}, knowledgeLimiters []string) (BaseledgerSyncTree, error) {
+	LeafNodeSlice, err := leafNodes(leaves)
 	if err != nil {
-		fmt.Println(err)
+		return BaseledgerSyncTree{}, err
 	}
+	syncTree := buildSyncTreeFromLeaves(LeafNodeSlice, len(LeafNodeSlice), knowledgeLimiters)
+	syncTree.LeafEncoding = LeafEncodingJson
+	return syncTree, nil
+}
+
+// leafNodes creates a leaf for every field, leaves are sorted by path so that a field keeps its
+// position in new versions of business object as long as no field before it is added or removed
+func leafNodes(leaves map[string]interface{}) ([]SyncTreeNode, error) {
+	paths := make([]string, 0, len(leaves))
+	for k := range leaves {
+		paths = append(paths, k)
+	}
+	sort.Strings(paths)
 
 	var LeafNodeSlice []SyncTreeNode
 	//Create a leaf data strcuture for every leaf node
-	for k, v := range FlattenOut {
+	for leafIndex, k := range paths {
 		leaf := SyncTreeNode{}
-		leaf.SyncTreeNodeID = uuid.NewV4().String()
 		leaf.IsCovered = false
 		leaf.IsHash = false
 		leaf.IsLeaf = true
 		leaf.IsRoot = false
-		leaf.Value = k + ":" + fmt.Sprint(v) // this is the value
+		value, err := encodeLeafValue(leaves[k])
+		if err != nil {
+			return nil, fmt.Errorf("value of %v can not be written to leaf %w", k, err)
+		}
+		leaf.Value = k + ":" + value // this is the value
 		leaf.Index = leafIndex
 		leaf.Level = 0
 		LeafNodeSlice = append(LeafNodeSlice, leaf)
-		leafIndex++
 	}
 
-	return buildSyncTreeFromLeaves(LeafNodeSlice, leafIndex, knowledgeLimiters)
+	return LeafNodeSlice, nil
 }
 
 func buildSyncTreeFromLeaves(LeafNodeSlice []SyncTreeNode, leafIndex int, knowledgeLimiters []string) BaseledgerSyncTree {
+	LeafNodeSlice = padLeaves(coverLeaves(LeafNodeSlice, knowledgeLimiters), leafIndex)
+
+	//Now we build the tree out of the nodes. This means taking always two leafs and combining them by hashing their joint values, level by level until we reached/built the root
+	return treeFromLevels(LeafNodeSlice, hashLevels(leafValues(LeafNodeSlice)))
+}
+
+// coverLeaves replaces values of knowledge limited leaves with the hash of the value before the tree is
+// hashed, so every pair hash can be recomputed from the leaves and uncovered neighbours are verified too
+func coverLeaves(LeafNodeSlice []SyncTreeNode, knowledgeLimiters []string) []SyncTreeNode {
+	for i, leaf := range LeafNodeSlice {
+		if leaf.IsLeaf && isNodeKnowledgeLimited(leaf.Value, knowledgeLimiters) {
+			LeafNodeSlice[i].IsCovered = true
+			LeafNodeSlice[i].Value = createHash(leaf.Value)
+		}
+	}
+	return LeafNodeSlice
+}
+
+// padLeaves adds empty leaves up to the next power of two
+func padLeaves(LeafNodeSlice []SyncTreeNode, leafIndex int) []SyncTreeNode {
 	//Each entry will be a leaf. We need 2^x leafs. Determine x
 	var x = math.Max(1, math.Ceil(math.Log2(float64(len(LeafNodeSlice)))))
 	//Now "fill" the dictionary up to 2^x entries
 	for l := len(LeafNodeSlice); l < int(math.Pow(float64(2), x)); l++ {
-		LeafNodeSlice = append(LeafNodeSlice, SyncTreeNode{SyncTreeNodeID: uuid.NewV4().String(), IsLeaf: true, Index: leafIndex})
+		LeafNodeSlice = append(LeafNodeSlice, SyncTreeNode{IsLeaf: true, Index: leafIndex})
 		leafIndex++
 	}
 
-	syncTree := BaseledgerSyncTree{}
-	//Now we build the tree out of the nodes. This means taking always two leafs and combining them by hashing their joint values. We do this recursively until we reached/built the root
-	syncTree.Nodes = buildBONodesRecursive(LeafNodeSlice)
+	return LeafNodeSlice
+}
 
-	//Set Root proof
-	for _, rootnode := range syncTree.Nodes {
-		if rootnode.IsRoot {
-			syncTree.RootProof = rootnode.Value
-			break
-		}
+func leafValues(LeafNodeSlice []SyncTreeNode) []string {
+	values := make([]string, len(LeafNodeSlice))
+	for i, leaf := range LeafNodeSlice {
+		values[i] = leaf.Value
 	}
+	return values
+}
 
-	if len(knowledgeLimiters) > 0 {
-		for _, v := range syncTree.Nodes {
-			if v.IsLeaf && isNodeKnowledgeLimited(v.Value, knowledgeLimiters) {
-				v.IsCovered = true
-				v.Value = ""
-			}
-		}
-	}
+func treeFromLevels(LeafNodeSlice []SyncTreeNode, levels [][]string) BaseledgerSyncTree {
+	syncTree := BaseledgerSyncTree{}
+	syncTree.Nodes = nodesFromLevels(LeafNodeSlice, levels)
+
+	//Set Root proof
+	root := levels[len(levels)-1]
+	syncTree.RootProof = root[0]
 
 	return syncTree
 }
 
-func GetBusinessObjectJson(syncTree BaseledgerSyncTree) string {
-	jsonelements := make(map[string]interface{})
-	for _, v := range syncTree.Nodes {
-		if v.IsLeaf && v.Value != "" {
-			var substrings []string = strings.SplitN(v.Value, ":", 2)
-			if len(substrings) > 1 {
-				jsonelements[substrings[0]] = substrings[1]
-			}
-		}
+// GetBusinessObjectJson is business object of uncovered leaves as json, error if leaves can not be read
+// or do not form an object
+func GetBusinessObjectJson(syncTree BaseledgerSyncTree) (string, error) {
+	jsonelements, err := readLeaves(syncTree)
+	if err != nil {
+		return "", err
+	}
+	var unflattenedOut map[string]interface{}
+	if syncTree.LeafEncoding == LeafEncodingJson {
+		unflattenedOut, err = unflattenLeaves(jsonelements, leafCount(syncTree))
+	} else {
+		unflattenedOut, err = unflatten3(jsonelements, leafCount(syncTree))
 	}
-	unflattenedOut, err := unflatten3(jsonelements)
 	if err != nil {
-		fmt.Println(err)
+		return "", err
 	}
 	//Convert data structure into JSON string
-	jsonstring, _ := json.Marshal(unflattenedOut)
-	return string(jsonstring)
+	jsonstring, err := json.Marshal(unflattenedOut)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonstring), nil
 }
 
 func VerifyHashMatch(blockchainProof string, existingBusinessObjectProof string, baseledgerSyncTreeJson string) bool {
@@ -143,60 +208,32 @@ func VerifyHashMatch(blockchainProof string, existingBusinessObjectProof string,
 	ret = blockchainProof == existingBusinessObjectProof
 	if ret {
 		bpbo := BaseledgerSyncTree{}
-		json.Unmarshal([]byte(baseledgerSyncTreeJson), &bpbo)
+		if err := json.Unmarshal([]byte(baseledgerSyncTreeJson), &bpbo); err != nil {
+			synctreeLog.Warn("sync tree is not valid json", logger.F("error", err.Error()))
+		}
 
 		//Level A check (Proofs match?)
 		ret = existingBusinessObjectProof == bpbo.RootProof
 
-		if ret {
-			//Level B check (All intermediate proof calculcations match?)
-			ret = verifyIntermediateHashes(bpbo)
-		}
 		if ret {
 			var limitedKnowledgeNodes []int
-			linq.From(bpbo.Nodes).Where(func(c interface{}) bool {
-				return c.(SyncTreeNode).IsLeaf && c.(SyncTreeNode).IsCovered
-			}).Select(func(c interface{}) interface{} {
-				return c.(SyncTreeNode).Index
-			}).ToSlice(&limitedKnowledgeNodes)
+			for _, node := range bpbo.Nodes {
+				if node.IsLeaf && node.IsCovered {
+					limitedKnowledgeNodes = append(limitedKnowledgeNodes, node.Index)
+				}
+			}
 
 			if len(limitedKnowledgeNodes) > 0 {
-				fmt.Println("Limited Knowledge in SyncTree! Indices:" + fmt.Sprint(limitedKnowledgeNodes))
+				synctreeLog.Debug("sync tree has covered leaves", logger.F("indices", limitedKnowledgeNodes))
 			}
 
-			//Level C check (Check existing (not masked) leaf nodes)
-			ret = verifyLeafNodes(bpbo)
+			//Level B and C check (All leaf and intermediate hashes match, root is the proof?)
+			ret = verifyNodes(bpbo)
 		}
 	}
-	return ret
-}
 
-func buildBONodesRecursive(nodes []SyncTreeNode) []SyncTreeNode {
-	var ret []SyncTreeNode
-	//Only one leaf left? We determined the root
-	if len(nodes) <= 1 {
-		return append(ret, nodes...)
-	} else { //build leafs of higher level and dive into recursion
-		var parentNodes []SyncTreeNode
-		for i := 0; i < len(nodes); i += 2 {
-			var stohash string = nodes[i].Value + "|" + nodes[i+1].Value
-			//Create parent node
-			parent := SyncTreeNode{}
-			parent.SyncTreeNodeID = uuid.NewV4().String()
-			parent.IsCovered = false
-			parent.IsHash = true
-			parent.IsLeaf = false
-			parent.IsRoot = len(nodes) == 2
-			parent.Value = createHash(stohash)
-			parent.Index = i / 2
-			parent.Level = nodes[i].Level + 1
-			parentNodes = append(parentNodes, parent)
-
-			nodes[i].ParentNodeID = parent.SyncTreeNodeID
-			nodes[i+1].ParentNodeID = parent.SyncTreeNodeID
-		}
-		ret = append(ret, nodes...)
-		ret = append(ret, buildBONodesRecursive(parentNodes)...)
+	if !ret {
+		metrics.HashVerificationFailures.Inc()
 	}
 	return ret
 }
@@ -206,103 +243,12 @@ func createHash(bo string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-func verifyLeafNodes(bpbo BaseledgerSyncTree) bool {
-	var leafnodes []SyncTreeNode
-	var levelplusnodes []SyncTreeNode
-
-	//using linq for go
-	linq.From(bpbo.Nodes).Where(func(c interface{}) bool {
-		return c.(SyncTreeNode).Level == 0
-	}).OrderBy( // sort
-		func(node interface{}) interface{} {
-			return (node.(SyncTreeNode).Index)
-		}).Select(func(c interface{}) interface{} {
-		return c.(SyncTreeNode)
-	}).ToSlice(&leafnodes)
-
-	//using linq for go
-	linq.From(bpbo.Nodes).Where(func(c interface{}) bool {
-		return c.(SyncTreeNode).Level == 1
-	}).OrderBy( // sort
-		func(node interface{}) interface{} {
-			return (node.(SyncTreeNode).Index)
-		}).Select(func(c interface{}) interface{} {
-		return c.(SyncTreeNode)
-	}).ToSlice(&levelplusnodes)
-
-	for n := 0; n < len(leafnodes); n += 2 {
-		if !compareNodeHashes(leafnodes[n], leafnodes[n+1], levelplusnodes[n/2]) {
-			return false
-		}
-	}
-	return true
-}
-
-func verifyIntermediateHashes(bpbo BaseledgerSyncTree) bool {
-	//Calculate all intermediate hashes
-	maxlevel := 0
-	for _, v := range bpbo.Nodes {
-		if v.Level > maxlevel {
-			maxlevel = v.Level
-		}
-	}
-
-	for level := 1; level < maxlevel; level++ {
-		var levelnodes []SyncTreeNode
-		var levelplusnodes []SyncTreeNode
-
-		//using linq for go
-		linq.From(bpbo.Nodes).Where(func(c interface{}) bool {
-			return c.(SyncTreeNode).Level == level
-		}).OrderBy( // sort
-			func(node interface{}) interface{} {
-				return (node.(SyncTreeNode).Index)
-			}).Select(func(c interface{}) interface{} {
-			return c.(SyncTreeNode)
-		}).ToSlice(&levelnodes)
-
-		//using linq for go
-		linq.From(bpbo.Nodes).Where(func(c interface{}) bool {
-			return c.(SyncTreeNode).Level == level+1
-		}).OrderBy( // sort
-			func(node interface{}) interface{} {
-				return (node.(SyncTreeNode).Index)
-			}).Select(func(c interface{}) interface{} {
-			return c.(SyncTreeNode)
-		}).ToSlice(&levelplusnodes)
-
-		for n := 0; n < len(levelnodes); n += 2 {
-			if !compareNodeHashes(levelnodes[n], levelnodes[n+1], levelplusnodes[n/2]) {
-				return false
-			}
-		}
-
-	}
-	return true
-}
-
-func compareNodeHashes(node1 SyncTreeNode, node2 SyncTreeNode, fatherNode SyncTreeNode) bool {
-	ret := false
-
-	//Create Hash
-	var stohash string = node1.Value + "|" + node2.Value
-	if fatherNode.Value == createHash(stohash) {
-		ret = true
-	}
-
-	return ret
-}
-
+// isNodeKnowledgeLimited is true for leaves (path:value) of limited fields and of fields nested in them
 func isNodeKnowledgeLimited(nodeValue string, knowledgeLimiters []string) bool {
-	if len(nodeValue) > 0 && len(knowledgeLimiters) > 0 {
-		lastIndex := strings.LastIndex(nodeValue, ":")
-		if lastIndex > -1 {
-			nodeAttribute := nodeValue[lastIndex:]
-			for _, v := range knowledgeLimiters {
-				if v == nodeAttribute {
-					return true
-				}
-			}
+	path := strings.SplitN(nodeValue, ":", 2)[0]
+	for _, v := range knowledgeLimiters {
+		if v != "" && (path == v || strings.HasPrefix(path, v+".") || strings.HasPrefix(path, v+"[")) {
+			return true
 		}
 	}
 	return false
@@ -476,13 +422,20 @@ func isArrayKeyPart(keyPart string) (bool, string, int) {
 	if lastChar != "]" {
 		return false, "", -1
 	}
-	indexArray := keyPart[len(keyPart)-2 : len(keyPart)-1]
-	arrayNum, _ := strconv.Atoi(indexArray)
-	keyName := keyPart[:len(keyPart)-3]
+	open := strings.LastIndex(keyPart, "[")
+	if open < 0 {
+		return false, "", -1
+	}
+	arrayNum, err := strconv.Atoi(keyPart[open+1 : len(keyPart)-1])
+	if err != nil {
+		return false, "", -1
+	}
+	keyName := keyPart[:open]
 	return true, keyName, arrayNum
 }
 
-func unflatten3(flat map[string]interface{}) (map[string]interface{}, error) {
+// unflatten3 rebuilds business object of tree without leaf encoding, array indexes have to be below maxIndex
+func unflatten3(flat map[string]interface{}, maxIndex int) (map[string]interface{}, error) {
 	unflat := map[string]interface{}{}
 	for key, value := range flat {
 		keyParts := strings.Split(key, ".")
@@ -492,6 +445,9 @@ func unflatten3(flat map[string]interface{}) (map[string]interface{}, error) {
 			kName := k
 			isArr, keyName, index := isArrayKeyPart(k)
 			if isArr {
+				if index < 0 || index >= maxIndex {
+					return nil, fmt.Errorf("key=%v has index above %v leaves of sync tree", key, maxIndex)
+				}
 				kName = keyName
 			}
 			v, exists := m[kName]
@@ -2,22 +2,28 @@ package systemofrecord
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/cookiejar"
-	"net/http/httputil"
 	"reflect"
 	"strings"
 
 	"github.com/oleiade/reflections"
-	"github.com/spf13/viper"
+	"github.com/unibrightio/proxy-api/config"
 	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/metrics"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/tracing"
 	"github.com/unibrightio/proxy-api/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var client http.Client
+var sorLog = logger.For("systemofrecord")
 
 func InitClient() {
 	jar, err := cookiejar.New(nil)
@@ -29,7 +35,32 @@ func InitClient() {
 	}
 }
 
+type ISorClient interface {
+	// notifies system of record about trustmesh entry, returns false if webhook is not configured or could not be built
+	TriggerSorWebhook(ctx context.Context, webhookType types.WebhookType, trustmeshEntry *types.TrustmeshEntry, payload string, approved bool, message string, origin string) bool
+}
+
+// WebhookSorClient delivers notifications using webhooks configured in the given repository
+type WebhookSorClient struct {
+	Webhooks repository.IWebhookRepository
+}
+
+func (sorClient *WebhookSorClient) TriggerSorWebhook(
+	ctx context.Context,
+	webhookType types.WebhookType,
+	trustmeshEntry *types.TrustmeshEntry,
+	payload string,
+	approved bool,
+	message string,
+	origin string,
+) bool {
+	InitClient()
+	webhook := sorClient.Webhooks.FetchWebhookByType(webhookType)
+	return triggerSorWebhook(ctx, webhook, webhookType, trustmeshEntry, payload, approved, message, origin)
+}
+
 func TriggerSorWebhook(
+	ctx context.Context,
 	webhookType types.WebhookType,
 	trustmeshEntry *types.TrustmeshEntry,
 	payload string,
@@ -37,8 +68,26 @@ func TriggerSorWebhook(
 	message string,
 	origin string,
 ) bool {
+	return triggerSorWebhook(ctx, types.FetchWebhookByType(webhookType), webhookType, trustmeshEntry, payload, approved, message, origin)
+}
 
-	webhook := types.FetchWebhookByType(webhookType)
+func triggerSorWebhook(
+	ctx context.Context,
+	webhook *types.SorWebhook,
+	webhookType types.WebhookType,
+	trustmeshEntry *types.TrustmeshEntry,
+	payload string,
+	approved bool,
+	message string,
+	origin string,
+) bool {
+	ctx, span := tracing.StartWithKind(ctx, "TriggerSorWebhook", trace.SpanKindClient,
+		tracing.TrustmeshIdKey.String(trustmeshEntry.TrustmeshId.String()),
+		tracing.TrustmeshEntryIdKey.String(trustmeshEntry.Id.String()),
+		tracing.TransactionIdKey.String(trustmeshEntry.BaseledgerTransactionId.String()),
+		attribute.String("baseledger.webhook_type", fmt.Sprintf("%v", webhookType)),
+	)
+	defer span.End()
 
 	if webhook == nil {
 		return false
@@ -78,7 +127,10 @@ func TriggerSorWebhook(
 		addXcsrfTokenToRequest(webhook, request)
 	}
 
-	triggerWebhookRequest(request)
+	tracing.InjectHttp(ctx, request)
+	if !triggerWebhookRequest(ctx, request) {
+		tracing.Fail(span, "webhook delivery failed")
+	}
 	return true
 }
 
@@ -137,15 +189,15 @@ func buildWebhookRequestBody(
 	}
 
 	requestBody = strings.Replace(requestBody, "{{origin}}", origin, 1)
-	requestBody = strings.Replace(requestBody, "{{organization_id}}", viper.Get("ORGANIZATION_ID").(string), 1)
+	requestBody = strings.Replace(requestBody, "{{organization_id}}", config.Get().OrganizationId, 1)
 
-	logger.Infof("Body built %v\n", requestBody)
+	sorLog.Debug("webhook body built", logger.Payload("body", requestBody))
 
 	return requestBody
 }
 
 func prepareWebhookRequest(requestBody string, targetUrl string, httpMethod string) *http.Request {
-	logger.Infof("Preparing request with body.. %v", requestBody)
+	sorLog.Debug("preparing webhook request")
 
 	var jsonStr = []byte(requestBody)
 
@@ -217,34 +269,27 @@ func triggerXcsrfTokenRequest(request *http.Request) (string, []*http.Cookie) {
 	return resp.Header.Get("X-CSRF-Token"), resp.Cookies()
 }
 
-func triggerWebhookRequest(request *http.Request) {
-	logger.Infof("Firing away request..")
-
-	// Save a copy of this request for debugging.
-	requestDump, err := httputil.DumpRequest(request, true)
-	if err != nil {
-		logger.Errorf("DumpRequest error %s\n", err.Error())
-	}
-
-	logger.Infof("DumpRequest before result " + string(requestDump))
+func triggerWebhookRequest(ctx context.Context, request *http.Request) bool {
+	// url can contain basic auth credentials, it is redacted, headers and body are not logged
+	requestLog := sorLog.Ctx(ctx).With(logger.F("method", request.Method), logger.F("url", request.URL.String()))
+	requestLog.Info("firing webhook request")
 
 	resp, err := client.Do(request)
 	if err != nil {
-		logger.Errorf("Error firing away request %v\n", err.Error())
-		return
+		requestLog.Error("error firing webhook request", logger.F("error", err))
+		metrics.SorWebhookDeliveries.WithLabelValues(metrics.ResultFailure).Inc()
+		return false
 	}
 
-	// Save a copy of this request for debugging.
-	requestDump, err = httputil.DumpRequest(request, true)
-	if err != nil {
-		logger.Errorf("DumpRequest error %s\n", err.Error())
+	delivered := resp.StatusCode < 300
+	if delivered {
+		metrics.SorWebhookDeliveries.WithLabelValues(metrics.ResultSuccess).Inc()
+	} else {
+		metrics.SorWebhookDeliveries.WithLabelValues(metrics.ResultFailure).Inc()
 	}
 
-	logger.Infof("DumpRequest after result " + string(requestDump))
-
-	logger.Infof("Sor Webhook request succesfull")
-	logger.Infof("Sor Webhook request response %v\n", resp)
-	logger.Infof("Sor Webhook request response body %v\n", resp.Body)
+	requestLog.Info("webhook request finished", logger.F("status", resp.StatusCode), logger.F("delivered", delivered))
+	return delivered
 }
 
 func jsonEscape(i string) string {
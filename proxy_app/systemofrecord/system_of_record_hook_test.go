@@ -67,7 +67,7 @@ func TestGivenACreateWebhookWithSpecialParamPayloadAndOriginWhenBuildWebhookRequ
 		webhook.WebhookType,
 		trustmeshEntry,
 		payload,
-		"irelevant",
+		false,
 		"irelevant",
 		"proxy",
 	)
@@ -103,7 +103,7 @@ func TestGivenACreateWebhookWithBodyParamsWhenBuildWebhookRequestBodyCorrectRequ
 		webhook.WebhookType,
 		trustmeshEntry,
 		payload,
-		"irelevant",
+		false,
 		"irelevant",
 		"irelevant",
 	)
@@ -129,7 +129,7 @@ func TestGivenAUpdateWebhookWithSpecialParamsApprovedAndMessageWhenBuildWebhookR
 		WebhookType: types.UpdateObject,
 	}
 
-	want := "{ 'isApproved': 'APPROVED', 'feedbackMessage': 'this is a feedback message' }"
+	want := "{ 'isApproved': 'true', 'feedbackMessage': 'this is a feedback message' }"
 
 	result := buildWebhookRequestBody(
 		webhook.Body,
@@ -137,7 +137,7 @@ func TestGivenAUpdateWebhookWithSpecialParamsApprovedAndMessageWhenBuildWebhookR
 		webhook.WebhookType,
 		trustmeshEntry,
 		"",
-		"APPROVED",
+		true,
 		"this is a feedback message",
 		"irelevant",
 	)
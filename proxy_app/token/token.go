@@ -5,11 +5,11 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt"
-	"github.com/spf13/viper"
+	"github.com/unibrightio/proxy-api/config"
 )
 
 func GetToken(email string) (string, error) {
-	jwtSecret := []byte(viper.GetString("JWT_SECRET"))
+	jwtSecret := []byte(config.Get().Api.JwtSecret)
 
 	// Create the Claims
 	proxyClaims := jwt.MapClaims{}
@@ -26,7 +26,7 @@ func ValidateToken(encodedToken string) (*jwt.Token, error) {
 		if _, isvalid := token.Method.(*jwt.SigningMethodHMAC); !isvalid {
 			return nil, fmt.Errorf("Invalid token %v", token.Header["alg"])
 		}
-		jwtSecret := []byte(viper.GetString("JWT_SECRET"))
+		jwtSecret := []byte(config.Get().Api.JwtSecret)
 		return []byte(jwtSecret), nil
 	})
 }
@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/unibrightio/proxy-api/config"
+	"github.com/unibrightio/proxy-api/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/unibrightio/proxy-api"
+
+// span attribute keys, shared by all hops so that one trustmesh can be found across both proxies
+const (
+	TrustmeshIdKey                = attribute.Key("baseledger.trustmesh_id")
+	TrustmeshEntryIdKey           = attribute.Key("baseledger.trustmesh_entry_id")
+	EntryTypeKey                  = attribute.Key("baseledger.entry_type")
+	TransactionIdKey              = attribute.Key("baseledger.transaction_id")
+	TransactionHashKey            = attribute.Key("baseledger.transaction_hash")
+	BaseledgerBusinessObjectIdKey = attribute.Key("baseledger.business_object_id")
+	WorkgroupIdKey                = attribute.Key("baseledger.workgroup_id")
+	NatsSubjectKey                = attribute.Key("messaging.destination")
+)
+
+var propagator = propagation.TraceContext{}
+
+// Setup registers global tracer provider exporting over OTLP/HTTP when tracing is enabled.
+// When disabled, spans are not recorded but trace context is still propagated between hops.
+// Returned function flushes pending spans and should be called on shutdown
+func Setup() func(ctx context.Context) error {
+	otel.SetTextMapPropagator(propagator)
+
+	tracingConfig := config.Get().Tracing
+	if !tracingConfig.Enabled {
+		logger.Info("tracing disabled")
+		return func(ctx context.Context) error { return nil }
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpoint(tracingConfig.OtlpEndpoint),
+		otlptracehttp.WithInsecure(),
+	)
+	if err != nil {
+		logger.Errorf("error creating otlp exporter, tracing disabled %v", err.Error())
+		return func(ctx context.Context) error { return nil }
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(tracingConfig.ServiceName),
+			attribute.String("baseledger.organization_id", config.Get().OrganizationId),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	logger.Infof("tracing enabled, exporting to %v", tracingConfig.OtlpEndpoint)
+
+	return provider.Shutdown
+}
+
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+func StartWithKind(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
+
+// Fail marks span as failed, description should not contain secrets or payloads
+func Fail(span trace.Span, description string) {
+	span.SetStatus(codes.Error, description)
+}
+
+// Inject returns trace context of ctx as map, used in message envelopes
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract returns context continuing trace from map created with Inject
+func Extract(ctx context.Context, traceContext map[string]string) context.Context {
+	if len(traceContext) == 0 {
+		return ctx
+	}
+
+	return propagator.Extract(ctx, propagation.MapCarrier(traceContext))
+}
+
+// InjectHttp adds trace context headers to outgoing request
+func InjectHttp(ctx context.Context, request *http.Request) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(request.Header))
+}
+
+// ExtractHttp returns context continuing trace from incoming request headers
+func ExtractHttp(ctx context.Context, request *http.Request) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(request.Header))
+}
+
+// Serialize returns trace context of ctx as string, stored with trustmesh entry so that
+// asynchronous processing in cron continues trace of request that created the entry
+func Serialize(ctx context.Context) string {
+	traceContext := Inject(ctx)
+	if len(traceContext) == 0 {
+		return ""
+	}
+
+	serialized, err := json.Marshal(traceContext)
+	if err != nil {
+		return ""
+	}
+
+	return string(serialized)
+}
+
+// Deserialize returns context continuing trace stored with Serialize
+func Deserialize(ctx context.Context, serialized string) context.Context {
+	if serialized == "" {
+		return ctx
+	}
+
+	var traceContext map[string]string
+	err := json.Unmarshal([]byte(serialized), &traceContext)
+	if err != nil {
+		logger.Warnf("ignoring invalid stored trace context %v", err.Error())
+		return ctx
+	}
+
+	return Extract(ctx, traceContext)
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSerializedTraceContextContinuesTrace(t *testing.T) {
+	traceId, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanId, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceId,
+		SpanID:     spanId,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	serialized := Serialize(ctx)
+	restored := trace.SpanContextFromContext(Deserialize(context.Background(), serialized))
+
+	if restored.TraceID() != traceId || restored.SpanID() != spanId {
+		t.Errorf("expected trace %v span %v, got %v", traceId, spanId, serialized)
+	}
+	if !restored.IsRemote() {
+		t.Errorf("expected restored span context to be remote")
+	}
+}
+
+func TestDeserializeIgnoresMissingTraceContext(t *testing.T) {
+	ctx := Deserialize(context.Background(), "")
+
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Errorf("expected no span context")
+	}
+}
@@ -0,0 +1,59 @@
+package types
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/kthomas/go.uuid"
+)
+
+// BusinessObjectSchema is JSON Schema that business objects of one type have to match in workgroup.
+// Members agree on a schema by registering the same one, which they check by comparing hashes
+type BusinessObjectSchema struct {
+	Id                 uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	WorkgroupId        uuid.UUID
+	BusinessObjectType string
+	Schema             string
+	Hash               string // sha256 of compact schema json
+}
+
+// SaveWith creates schema of workgroup and business object type or replaces existing one
+func (s *BusinessObjectSchema) SaveWith(db *gorm.DB) error {
+	res := db.Exec(`INSERT INTO business_object_schemas (workgroup_id, business_object_type, schema, hash) VALUES (?, ?, ?, ?)
+		ON CONFLICT (workgroup_id, business_object_type) DO UPDATE SET schema = EXCLUDED.schema, hash = EXCLUDED.hash, updated_at = now()`,
+		s.WorkgroupId.String(), s.BusinessObjectType, s.Schema, s.Hash)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	return db.First(s, "workgroup_id = ? AND business_object_type = ?", s.WorkgroupId.String(), s.BusinessObjectType).Error
+}
+
+// GetBusinessObjectSchemaWith returns nil if no schema is registered for workgroup and business object type
+func GetBusinessObjectSchemaWith(db *gorm.DB, workgroupId uuid.UUID, businessObjectType string) (*BusinessObjectSchema, error) {
+	var schema BusinessObjectSchema
+	res := db.First(&schema, "workgroup_id = ? AND business_object_type = ?", workgroupId.String(), businessObjectType)
+	if gorm.IsRecordNotFoundError(res.Error) {
+		return nil, nil
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	return &schema, nil
+}
+
+// GetBusinessObjectSchemasWith returns schemas of workgroup ordered by business object type
+func GetBusinessObjectSchemasWith(db *gorm.DB, workgroupId uuid.UUID) ([]BusinessObjectSchema, error) {
+	schemas := []BusinessObjectSchema{}
+	res := db.Where("workgroup_id = ?", workgroupId.String()).Order("business_object_type asc").Find(&schemas)
+	return schemas, res.Error
+}
+
+// DeleteBusinessObjectSchemaWith returns false if no schema was registered
+func DeleteBusinessObjectSchemaWith(db *gorm.DB, workgroupId uuid.UUID, businessObjectType string) (bool, error) {
+	res := db.Where("workgroup_id = ? AND business_object_type = ?", workgroupId.String(), businessObjectType).Delete(&BusinessObjectSchema{})
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,197 @@
+package types
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/dbutil"
+	"github.com/unibrightio/proxy-api/logger"
+)
+
+const PendingBroadcastStatusPending = "PENDING"           // rows created, broadcast not attempted yet
+const PendingBroadcastStatusBroadcasting = "BROADCASTING" // broadcast attempted, result not recorded
+const PendingBroadcastStatusUnconfirmed = "UNCONFIRMED"   // transaction found on chain but hash unknown, needs operator
+
+// ErrPendingBroadcastTaken is returned when row was already marked as broadcasting by another run
+var ErrPendingBroadcastTaken = errors.New("pending broadcast already taken by another run")
+
+// PendingBroadcast is written together with trustmesh entry in PENDING_BROADCAST state
+// and removed once broadcast result is recorded or entry is compensated
+type PendingBroadcast struct {
+	Id                       uuid.UUID
+	CreatedAt                time.Time
+	TransactionId            uuid.UUID
+	TrustmeshEntryId         uuid.UUID
+	OffchainProcessMessageId uuid.UUID
+	Payload                  string
+	OpCode                   uint32
+	Status                   string
+	BroadcastAttemptedAt     sql.NullTime
+	RecoveryClaimedUntil     sql.NullTime
+	LookupMisses             int
+	// set only when broadcast succeeded but trustmesh entry could not be updated
+	TransactionHash string
+}
+
+func (p *PendingBroadcast) CreateWith(db *gorm.DB) error {
+	p.Status = PendingBroadcastStatusPending
+	result := db.Create(p)
+	if result.Error != nil {
+		logger.Errorf("errors while creating pending broadcast %v\n", result.GetErrors())
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("pending broadcast not created")
+	}
+
+	return nil
+}
+
+// MarkBroadcasting must be persisted before broadcast so recovery knows transaction may be on chain.
+// Only pending rows are marked, so live saga and recovery never broadcast the same row both
+func (p *PendingBroadcast) MarkBroadcasting() error {
+	now := time.Now()
+	res := dbutil.Db.GetConn().Exec("update pending_broadcasts set status = ?, broadcast_attempted_at = ? where id = ? and status = ?",
+		PendingBroadcastStatusBroadcasting, now, p.Id.String(), PendingBroadcastStatusPending)
+	if res.Error != nil {
+		logger.Errorf("error when marking pending broadcast %v as broadcasting %v\n", p.Id, res.Error)
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrPendingBroadcastTaken
+	}
+
+	p.Status = PendingBroadcastStatusBroadcasting
+	p.BroadcastAttemptedAt = sql.NullTime{Time: now, Valid: true}
+	return nil
+}
+
+func (p *PendingBroadcast) MarkUnconfirmed() error {
+	res := dbutil.Db.GetConn().Exec("update pending_broadcasts set status = ? where id = ?", PendingBroadcastStatusUnconfirmed, p.Id.String())
+	if res.Error != nil {
+		logger.Errorf("error when marking pending broadcast %v as unconfirmed %v\n", p.Id, res.Error)
+		return res.Error
+	}
+
+	p.Status = PendingBroadcastStatusUnconfirmed
+	return nil
+}
+
+func GetPendingBroadcastByTrustmeshEntryId(entryId uuid.UUID) (*PendingBroadcast, error) {
+	var pending PendingBroadcast
+	res := dbutil.Db.GetConn().First(&pending, "trustmesh_entry_id = ?", entryId.String())
+	if res.Error != nil {
+		logger.Errorf("error when getting pending broadcast of trustmesh entry %v %v\n", entryId, res.Error)
+		return nil, res.Error
+	}
+
+	return &pending, nil
+}
+
+// RecordTransactionHash keeps hash of broadcasted transaction until recovery moves it to trustmesh entry
+func (p *PendingBroadcast) RecordTransactionHash(transactionHash string) error {
+	res := dbutil.Db.GetConn().Exec("update pending_broadcasts set transaction_hash = ? where id = ?", transactionHash, p.Id.String())
+	if res.Error != nil {
+		logger.Errorf("error when recording transaction hash of pending broadcast %v %v\n", p.Id, res.Error)
+		return res.Error
+	}
+
+	p.TransactionHash = transactionHash
+	return nil
+}
+
+// RecordLookupMiss counts lookups that did not find the broadcasted transaction on chain, returns the new count
+func (p *PendingBroadcast) RecordLookupMiss() (int, error) {
+	row := dbutil.Db.GetConn().Raw("update pending_broadcasts set lookup_misses = lookup_misses + 1 where id = ? returning lookup_misses", p.Id.String()).Row()
+	if err := row.Scan(&p.LookupMisses); err != nil {
+		logger.Errorf("error when recording lookup miss of pending broadcast %v %v\n", p.Id, err)
+		return 0, err
+	}
+
+	return p.LookupMisses, nil
+}
+
+func (p *PendingBroadcast) DeleteWith(db *gorm.DB) error {
+	return db.Exec("delete from pending_broadcasts where id = ?", p.Id.String()).Error
+}
+
+// claim is a single statement like claim of trustmesh entries, skip locked lets recovery of other replicas
+// pass by rows claimed by this one, claimed rows are not picked up again until the lease is over
+const claimInterruptedPendingBroadcastsSql = `UPDATE pending_broadcasts SET recovery_claimed_until = ?
+WHERE id IN (
+	SELECT p.id FROM pending_broadcasts p
+	WHERE ((p.status = ? AND p.created_at < ?) OR (p.status = ? AND p.broadcast_attempted_at < ?))
+	AND (p.recovery_claimed_until IS NULL OR p.recovery_claimed_until <= ?)
+	ORDER BY p.created_at ASC
+	FOR UPDATE OF p SKIP LOCKED
+)
+RETURNING *`
+
+// ClaimInterruptedPendingBroadcasts claims pending rows created before pendingBefore and broadcasting rows
+// whose broadcast was attempted before broadcastingBefore, unconfirmed rows are left for operator
+func ClaimInterruptedPendingBroadcasts(now time.Time, pendingBefore time.Time, broadcastingBefore time.Time, lease time.Duration) ([]*PendingBroadcast, error) {
+	pending := []*PendingBroadcast{}
+	res := dbutil.Db.GetConn().Raw(claimInterruptedPendingBroadcastsSql,
+		now.Add(lease),
+		PendingBroadcastStatusPending,
+		pendingBefore,
+		PendingBroadcastStatusBroadcasting,
+		broadcastingBefore,
+		now).
+		Scan(&pending)
+
+	if res.Error != nil {
+		logger.Errorf("error when claiming interrupted pending broadcasts %v\n", res.Error)
+		return nil, res.Error
+	}
+
+	// returning does not keep order of the select
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+	return pending, nil
+}
+
+// SetTrustmeshEntryBroadcastedWith moves entry from PENDING_BROADCAST to given state and stores transaction hash
+func SetTrustmeshEntryBroadcastedWith(db *gorm.DB, entryId uuid.UUID, commitmentState string, transactionHash string) error {
+	res := db.Exec("update trustmesh_entries set commitment_state = ?, transaction_hash = ? where id = ?", commitmentState, transactionHash, entryId.String())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("trustmesh entry not found")
+	}
+
+	return nil
+}
+
+// DeleteTrustmeshEntryWith removes entry with its offchain message, and trustmesh if entry was the only one in it,
+// otherwise summary of trustmesh is recomputed without the entry
+func DeleteTrustmeshEntryWith(db *gorm.DB, entryId uuid.UUID, offchainMessageId uuid.UUID) error {
+	var trustmeshIds []uuid.UUID
+	if err := db.Table("trustmesh_entries").Where("id = ?", entryId.String()).Pluck("trustmesh_id", &trustmeshIds).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec("delete from trustmesh_entries where id = ?", entryId.String()).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec("delete from offchain_process_messages where id = ?", offchainMessageId.String()).Error; err != nil {
+		return err
+	}
+
+	for _, trustmeshId := range trustmeshIds {
+		err := db.Exec("delete from trustmeshes t where id = ? and not exists (select 1 from trustmesh_entries te where te.trustmesh_id = t.id)", trustmeshId.String()).Error
+		if err != nil {
+			return err
+		}
+		if err = RefreshTrustmeshSummaryWith(db, trustmeshId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
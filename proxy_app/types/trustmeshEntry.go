@@ -2,8 +2,11 @@ package types
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/jinzhu/gorm"
 	uuid "github.com/kthomas/go.uuid"
 	common "github.com/unibrightio/proxy-api/common"
 	"github.com/unibrightio/proxy-api/dbutil"
@@ -12,6 +15,7 @@ import (
 
 type TrustmeshEntry struct {
 	Id                                   uuid.UUID
+	CreatedAt                            time.Time
 	TendermintBlockId                    sql.NullString
 	TendermintTransactionId              uuid.UUID
 	TendermintTransactionTimestamp       sql.NullTime
@@ -34,7 +38,78 @@ type TrustmeshEntry struct {
 	CommitmentState                      string
 	TransactionHash                      string
 	TrustmeshId                          uuid.UUID
-	SorBusinessObjectId                  string // TODO: rename to remove SOR
+	ParentTrustmeshEntryId               uuid.UUID // entry of referenced transaction, nil for entry that started the trustmesh
+	SorBusinessObjectId                  string    // TODO: rename to remove SOR
+	TraceContext                         string    // trace of request or message that created the entry, continued when entry is processed
+	ProcessingState                      string    // state of business logic run for the entry, see common processing states
+	ProcessingAttempts                   int
+	ProcessingLastError                  string
+	ProcessingNextRetryAt                sql.NullTime // failed or processing entry is picked up again at this time
+	ProcessingResolution                 string       // reason given for manual retry, skip or resolve
+	ProcessingClaimedUntil               sql.NullTime // entry is claimed by a worker until this time, other replicas skip it
+}
+
+// RetryPolicy limits business logic runs of failed entries, delay doubles with every attempt
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	// processing entry is considered interrupted after this and picked up again
+	ProcessingTimeout time.Duration
+}
+
+// delay before retry after given number of failed attempts
+func (p RetryPolicy) delay(attempts int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	return delay
+}
+
+// StartProcessing marks entry as processing until the processing timeout passes
+func (t *TrustmeshEntry) StartProcessing(now time.Time, policy RetryPolicy) {
+	t.ProcessingState = common.ProcessingProcessingState
+	t.ProcessingNextRetryAt = sql.NullTime{Time: now.Add(policy.ProcessingTimeout), Valid: true}
+}
+
+// FinishProcessing marks entry as processed with given commitment state
+func (t *TrustmeshEntry) FinishProcessing(commitmentState string) {
+	t.CommitmentState = commitmentState
+	t.ProcessingState = common.CommittedProcessingState
+	t.ProcessingNextRetryAt = sql.NullTime{Valid: false}
+}
+
+// FailProcessing schedules retry of entry, or marks it dead once attempts are exhausted, returns true if dead
+func (t *TrustmeshEntry) FailProcessing(reason string, now time.Time, policy RetryPolicy) bool {
+	t.ProcessingAttempts++
+	t.ProcessingLastError = reason
+	if t.ProcessingAttempts >= policy.MaxAttempts {
+		t.AbandonProcessing(reason)
+		return true
+	}
+
+	t.ProcessingState = common.FailedProcessingState
+	t.ProcessingNextRetryAt = sql.NullTime{Time: now.Add(policy.delay(t.ProcessingAttempts)), Valid: true}
+	return false
+}
+
+// AbandonProcessing marks entry dead, it is not retried anymore
+func (t *TrustmeshEntry) AbandonProcessing(reason string) {
+	t.ProcessingState = common.DeadProcessingState
+	t.ProcessingLastError = reason
+	t.ProcessingNextRetryAt = sql.NullTime{Valid: false}
+}
+
+// ResetProcessing makes entry pending with no failed attempts, it is picked up on next poll
+func (t *TrustmeshEntry) ResetProcessing() {
+	t.ProcessingState = common.PendingProcessingState
+	t.ProcessingAttempts = 0
+	t.ProcessingNextRetryAt = sql.NullTime{Valid: false}
 }
 
 type Trustmesh struct {
@@ -50,22 +125,99 @@ type Trustmesh struct {
 	Entries             []TrustmeshEntry
 }
 
+// ErrInvalidTrustmeshReference is matched (errors.Is) when new entry can not be put into a trustmesh
+var ErrInvalidTrustmeshReference = errors.New("invalid trustmesh reference")
+
+// AssignTrustmesh puts new entry into a trustmesh. Entry without referenced transaction starts a new trustmesh,
+// which is returned to be created together with the entry. Other entries join trustmesh of parent, the first
+// entry of the referenced transaction, which has to exist and belong to the same workgroup and trustmesh if set
+func (t *TrustmeshEntry) AssignTrustmesh(parent *TrustmeshEntry, now time.Time) (*Trustmesh, error) {
+	if t.ReferencedBaseledgerTransactionId == uuid.Nil {
+		if t.TrustmeshId != uuid.Nil {
+			return nil, fmt.Errorf("%w: entry without referenced transaction can not join trustmesh %v", ErrInvalidTrustmeshReference, t.TrustmeshId)
+		}
+
+		trustmesh := &Trustmesh{Id: uuid.NewV4(), CreatedAt: now}
+		t.TrustmeshId = trustmesh.Id
+		t.ParentTrustmeshEntryId = uuid.Nil
+		return trustmesh, nil
+	}
+
+	if parent == nil || parent.TrustmeshId == uuid.Nil {
+		return nil, fmt.Errorf("%w: referenced transaction %v not found", ErrInvalidTrustmeshReference, t.ReferencedBaseledgerTransactionId)
+	}
+	if t.TrustmeshId != uuid.Nil && t.TrustmeshId != parent.TrustmeshId {
+		return nil, fmt.Errorf("%w: referenced transaction %v belongs to trustmesh %v, not %v", ErrInvalidTrustmeshReference, t.ReferencedBaseledgerTransactionId, parent.TrustmeshId, t.TrustmeshId)
+	}
+	if t.WorkgroupId != uuid.Nil && parent.WorkgroupId != uuid.Nil && t.WorkgroupId != parent.WorkgroupId {
+		return nil, fmt.Errorf("%w: referenced transaction %v belongs to workgroup %v, not %v", ErrInvalidTrustmeshReference, t.ReferencedBaseledgerTransactionId, parent.WorkgroupId, t.WorkgroupId)
+	}
+
+	t.TrustmeshId = parent.TrustmeshId
+	t.ParentTrustmeshEntryId = parent.Id
+	return nil, nil
+}
+
 func (t *TrustmeshEntry) Create() bool {
 	t.CommitmentState = common.UncommittedCommitmentState
+	return t.CreateWith(dbutil.Db.GetConn()) == nil
+}
+
+// CreateWith creates entry using given connection or transaction (see dbutil.UnitOfWork),
+// commitment state is uncommitted unless set before
+func (t *TrustmeshEntry) CreateWith(db *gorm.DB) error {
+	if t.CommitmentState == "" {
+		t.CommitmentState = common.UncommittedCommitmentState
+	}
+	if t.ProcessingState == "" {
+		t.ProcessingState = common.PendingProcessingState
+	}
 	t.TendermintBlockId = sql.NullString{Valid: false}
 	t.TendermintTransactionTimestamp = sql.NullTime{Valid: false}
-	if dbutil.Db.GetConn().NewRecord(t) {
-		result := dbutil.Db.GetConn().Create(&t)
-		rowsAffected := result.RowsAffected
-		errors := result.GetErrors()
-		if len(errors) > 0 {
-			logger.Errorf("errors while creating new entry %v\n", errors)
-			return false
+	if !db.NewRecord(t) {
+		return errors.New("trustmesh entry already exists")
+	}
+
+	if err := t.assignTrustmeshWith(db); err != nil {
+		return err
+	}
+
+	result := db.Create(t)
+	if result.Error != nil {
+		logger.Errorf("errors while creating new entry %v\n", result.GetErrors())
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("trustmesh entry not created")
+	}
+
+	return t.addToTrustmeshSummaryWith(db)
+}
+
+// assignTrustmeshWith looks up parent and creates new trustmesh, db should be a transaction
+// so that trustmesh is not left behind without entry
+func (t *TrustmeshEntry) assignTrustmeshWith(db *gorm.DB) error {
+	var parent *TrustmeshEntry
+	if t.ReferencedBaseledgerTransactionId != uuid.Nil {
+		var referenced TrustmeshEntry
+		res := db.Where("baseledger_transaction_id = ?", t.ReferencedBaseledgerTransactionId.String()).Order("created_at asc").First(&referenced)
+		if res.Error != nil && !gorm.IsRecordNotFoundError(res.Error) {
+			return res.Error
+		}
+		if res.Error == nil {
+			parent = &referenced
 		}
-		return rowsAffected > 0
 	}
 
-	return false
+	trustmesh, err := t.AssignTrustmesh(parent, time.Now())
+	if err != nil {
+		return err
+	}
+	if trustmesh == nil {
+		return nil
+	}
+
+	return db.Exec("INSERT INTO trustmeshes (id, created_at) VALUES (?, ?)", trustmesh.Id.String(), trustmesh.CreatedAt).Error
 }
 
 func GetTrustmeshById(id uuid.UUID) (*Trustmesh, error) {
@@ -172,3 +324,23 @@ func GetLatestTrustmeshEntryBasedOnBboid(bboid string) (*TrustmeshEntry, error)
 
 	return latestEntry, nil
 }
+
+// GetUncommittedBacklog returns number of entries waiting for commitment and creation time of the oldest one,
+// dead entries are not waiting anymore and not counted
+func GetUncommittedBacklog() (count int, oldestCreatedAt *time.Time, err error) {
+	db := dbutil.Db.GetConn()
+
+	var oldest sql.NullTime
+	row := db.Raw("select count(*), min(created_at) from trustmesh_entries where commitment_state = ? and processing_state <> ?", common.UncommittedCommitmentState, common.DeadProcessingState).Row()
+	err = row.Scan(&count, &oldest)
+	if err != nil {
+		logger.Errorf("error when getting uncommitted backlog from db %v\n", err)
+		return 0, nil, err
+	}
+
+	if oldest.Valid {
+		oldestCreatedAt = &oldest.Time
+	}
+
+	return count, oldestCreatedAt, nil
+}
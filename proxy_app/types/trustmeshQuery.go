@@ -0,0 +1,340 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/kthomas/go.uuid"
+)
+
+const defaultTrustmeshQueryLimit = 5
+const maxTrustmeshQueryLimit = 100
+
+// trustmesh sort fields with the sql expression they sort on, start and end time of a trustmesh
+// are the first and last transaction timestamps of its entries, creation time until one is committed
+var trustmeshSortExpressions = map[string]string{
+	"created_at": "trustmeshes.created_at",
+	"start_time": "COALESCE(trustmeshes.start_time, trustmeshes.created_at)",
+	"end_time":   "COALESCE(trustmeshes.end_time, trustmeshes.created_at)",
+}
+
+// TrustmeshQuery filters, sorts and paginates trustmeshes. Results are paginated with cursor
+// of the last returned trustmesh, or with page and limit for clients of the former offset pagination
+type TrustmeshQuery struct {
+	WorkgroupId                uuid.UUID
+	ParticipantOrgId           uuid.UUID // sender or receiver of any entry
+	BusinessObjectType         string
+	SorBusinessObjectId        string
+	BaseledgerBusinessObjectId string // bboid or referenced bboid of any entry
+	CommitmentState            string // commitment state of any entry
+	Finalized                  *bool
+	ContainsRejections         *bool
+	Exited                     *bool // exit proof stored on ethereum
+	CreatedAfter               *time.Time
+	CreatedBefore              *time.Time
+	TransactionAfter           *time.Time // any entry committed in range
+	TransactionBefore          *time.Time
+	// created_at, start_time or end_time, prefixed with - for descending order
+	Sort   string
+	Limit  int
+	Cursor string
+	Page   int
+	// json fields of trustmeshes to return, all if empty
+	Fields []string
+}
+
+// TrustmeshPage is one page of query results, next cursor is empty on last page
+// and total results are only counted for page based pagination
+type TrustmeshPage struct {
+	Trustmeshes  []Trustmesh
+	NextCursor   string
+	TotalResults *uint64
+}
+
+type trustmeshCursor struct {
+	Sort  string    `json:"s"`
+	Value time.Time `json:"v"`
+	Id    uuid.UUID `json:"id"`
+}
+
+// ParseTrustmeshQuery reads query from url query parameters, see api docs of GET /trustmeshes
+func ParseTrustmeshQuery(values url.Values) (*TrustmeshQuery, error) {
+	q := &TrustmeshQuery{
+		BusinessObjectType:         values.Get("business_object_type"),
+		SorBusinessObjectId:        values.Get("sor_business_object_id"),
+		BaseledgerBusinessObjectId: values.Get("bboid"),
+		CommitmentState:            values.Get("commitment_state"),
+		Sort:                       values.Get("sort"),
+		Cursor:                     values.Get("cursor"),
+		Limit:                      defaultTrustmeshQueryLimit,
+	}
+
+	var err error
+	if q.WorkgroupId, err = parseUuidParam(values, "workgroup_id"); err != nil {
+		return nil, err
+	}
+	if q.ParticipantOrgId, err = parseUuidParam(values, "participant"); err != nil {
+		return nil, err
+	}
+	if q.Finalized, err = parseBoolParam(values, "finalized"); err != nil {
+		return nil, err
+	}
+	if q.ContainsRejections, err = parseBoolParam(values, "contains_rejections"); err != nil {
+		return nil, err
+	}
+	if q.Exited, err = parseBoolParam(values, "exited"); err != nil {
+		return nil, err
+	}
+	for param, target := range map[string]**time.Time{
+		"created_after":      &q.CreatedAfter,
+		"created_before":     &q.CreatedBefore,
+		"transaction_after":  &q.TransactionAfter,
+		"transaction_before": &q.TransactionBefore,
+	} {
+		if *target, err = parseTimeParam(values, param); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.Sort == "" {
+		q.Sort = "created_at"
+	}
+	if _, ok := trustmeshSortExpressions[strings.TrimPrefix(q.Sort, "-")]; !ok {
+		return nil, fmt.Errorf("sort %v is not one of created_at, start_time, end_time", q.Sort)
+	}
+
+	// rpp is limit of former offset pagination
+	for _, param := range []string{"rpp", "limit"} {
+		if values.Get(param) == "" {
+			continue
+		}
+		if q.Limit, err = strconv.Atoi(values.Get(param)); err != nil || q.Limit < 1 || q.Limit > maxTrustmeshQueryLimit {
+			return nil, fmt.Errorf("%v has to be between 1 and %v", param, maxTrustmeshQueryLimit)
+		}
+	}
+	if values.Get("page") != "" {
+		if q.Page, err = strconv.Atoi(values.Get("page")); err != nil || q.Page < 1 {
+			return nil, fmt.Errorf("page has to be a positive number")
+		}
+		if q.Cursor != "" {
+			return nil, fmt.Errorf("page and cursor can not be combined")
+		}
+	}
+	if q.Cursor != "" {
+		if _, err = q.decodeCursor(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, field := range strings.Split(values.Get("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			q.Fields = append(q.Fields, field)
+		}
+	}
+
+	return q, nil
+}
+
+// Find runs query, entries with their organizations and workgroup are loaded only if preloadEntries is set
+func (q *TrustmeshQuery) Find(db *gorm.DB, preloadEntries bool) (*TrustmeshPage, error) {
+	db = q.filter(db.Model(&Trustmesh{}))
+	page := &TrustmeshPage{}
+
+	if q.Page > 0 {
+		var total uint64
+		if err := db.Count(&total).Error; err != nil {
+			return nil, err
+		}
+		page.TotalResults = &total
+		db = db.Offset((q.Page - 1) * q.Limit)
+	} else if q.Cursor != "" {
+		cursor, err := q.decodeCursor()
+		if err != nil {
+			return nil, err
+		}
+		comparison := ">"
+		if q.descending() {
+			comparison = "<"
+		}
+		db = db.Where(fmt.Sprintf("(%v, trustmeshes.id) %v (?, ?)", q.sortExpression(), comparison), cursor.Value, cursor.Id.String())
+	}
+
+	direction := "ASC"
+	if q.descending() {
+		direction = "DESC"
+	}
+	db = db.Order(fmt.Sprintf("%v %v, trustmeshes.id %v", q.sortExpression(), direction, direction)).
+		// one more to know if there is a next page
+		Limit(q.Limit + 1)
+	if preloadEntries {
+		db = db.Preload("Entries").
+			Preload("Entries.SenderOrg").
+			Preload("Entries.ReceiverOrg").
+			Preload("Entries.Workgroup")
+	}
+
+	var trustmeshes []Trustmesh
+	if err := db.Find(&trustmeshes).Error; err != nil {
+		return nil, err
+	}
+
+	page.Trustmeshes = trustmeshes
+	if len(trustmeshes) > q.Limit {
+		page.Trustmeshes = trustmeshes[:q.Limit]
+		if q.Page == 0 {
+			last := page.Trustmeshes[q.Limit-1]
+			page.NextCursor = encodeTrustmeshCursor(trustmeshCursor{Sort: q.Sort, Value: q.sortValue(last), Id: last.Id})
+		}
+	}
+
+	return page, nil
+}
+
+// filter narrows trustmeshes down, entry conditions match if any entry of the trustmesh matches
+func (q *TrustmeshQuery) filter(db *gorm.DB) *gorm.DB {
+	withEntry := func(db *gorm.DB, condition string, args ...interface{}) *gorm.DB {
+		return db.Where("EXISTS (SELECT 1 FROM trustmesh_entries fe WHERE fe.trustmesh_id = trustmeshes.id AND "+condition+")", args...)
+	}
+
+	if q.WorkgroupId != uuid.Nil {
+		db = withEntry(db, "fe.workgroup_id = ?", q.WorkgroupId.String())
+	}
+	if q.ParticipantOrgId != uuid.Nil {
+		db = withEntry(db, "(fe.sender_org_id = ? OR fe.receiver_org_id = ?)", q.ParticipantOrgId.String(), q.ParticipantOrgId.String())
+	}
+	if q.BusinessObjectType != "" {
+		db = withEntry(db, "fe.business_object_type = ?", q.BusinessObjectType)
+	}
+	if q.SorBusinessObjectId != "" {
+		db = withEntry(db, "fe.sor_business_object_id = ?", q.SorBusinessObjectId)
+	}
+	if q.BaseledgerBusinessObjectId != "" {
+		db = withEntry(db, "(fe.baseledger_business_object_id = ? OR fe.referenced_baseledger_business_object_id = ?)", q.BaseledgerBusinessObjectId, q.BaseledgerBusinessObjectId)
+	}
+	if q.CommitmentState != "" {
+		db = withEntry(db, "fe.commitment_state = ?", q.CommitmentState)
+	}
+	if q.TransactionAfter != nil {
+		db = withEntry(db, "fe.tendermint_transaction_timestamp >= ?", *q.TransactionAfter)
+	}
+	if q.TransactionBefore != nil {
+		db = withEntry(db, "fe.tendermint_transaction_timestamp < ?", *q.TransactionBefore)
+	}
+
+	if q.Finalized != nil {
+		db = db.Where("trustmeshes.finalized = ?", *q.Finalized)
+	}
+	if q.ContainsRejections != nil {
+		db = db.Where("trustmeshes.contains_rejections = ?", *q.ContainsRejections)
+	}
+	if q.Exited != nil {
+		if *q.Exited {
+			db = db.Where("COALESCE(trustmeshes.eth_exit_tx_hash, '') <> ''")
+		} else {
+			db = db.Where("COALESCE(trustmeshes.eth_exit_tx_hash, '') = ''")
+		}
+	}
+
+	if q.CreatedAfter != nil {
+		db = db.Where("trustmeshes.created_at >= ?", *q.CreatedAfter)
+	}
+	if q.CreatedBefore != nil {
+		db = db.Where("trustmeshes.created_at < ?", *q.CreatedBefore)
+	}
+
+	return db
+}
+
+func (q *TrustmeshQuery) descending() bool {
+	return strings.HasPrefix(q.Sort, "-")
+}
+
+func (q *TrustmeshQuery) sortField() string {
+	return strings.TrimPrefix(q.Sort, "-")
+}
+
+func (q *TrustmeshQuery) sortExpression() string {
+	return trustmeshSortExpressions[q.sortField()]
+}
+
+func (q *TrustmeshQuery) sortValue(trustmesh Trustmesh) time.Time {
+	value := trustmesh.CreatedAt
+	switch q.sortField() {
+	case "start_time":
+		if !trustmesh.StartTime.IsZero() {
+			value = trustmesh.StartTime
+		}
+	case "end_time":
+		if !trustmesh.EndTime.IsZero() {
+			value = trustmesh.EndTime
+		}
+	}
+	return value
+}
+
+// decodeCursor fails if cursor was created for another sort, its position would be meaningless
+func (q *TrustmeshQuery) decodeCursor() (*trustmeshCursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("cursor is invalid")
+	}
+
+	cursor := &trustmeshCursor{}
+	if err = json.Unmarshal(buf, cursor); err != nil || cursor.Id == uuid.Nil {
+		return nil, fmt.Errorf("cursor is invalid")
+	}
+	if cursor.Sort != q.Sort {
+		return nil, fmt.Errorf("cursor was created for sort %v, not %v", cursor.Sort, q.Sort)
+	}
+
+	return cursor, nil
+}
+
+func encodeTrustmeshCursor(cursor trustmeshCursor) string {
+	buf, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func parseUuidParam(values url.Values, param string) (uuid.UUID, error) {
+	if values.Get(param) == "" {
+		return uuid.Nil, nil
+	}
+
+	id, err := uuid.FromString(values.Get(param))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%v is not a valid uuid", param)
+	}
+	return id, nil
+}
+
+func parseBoolParam(values url.Values, param string) (*bool, error) {
+	if values.Get(param) == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseBool(values.Get(param))
+	if err != nil {
+		return nil, fmt.Errorf("%v has to be true or false", param)
+	}
+	return &value, nil
+}
+
+// time params are RFC3339 timestamps or dates, i.e. 2022-06-01
+func parseTimeParam(values url.Values, param string) (*time.Time, error) {
+	if values.Get(param) == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if value, err := time.Parse(layout, values.Get(param)); err == nil {
+			return &value, nil
+		}
+	}
+	return nil, fmt.Errorf("%v has to be RFC3339 timestamp or date", param)
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+)
+
+func TestGivenFilterParamsWhenParseTrustmeshQueryThenFiltersSet(t *testing.T) {
+	workgroupId := uuid.NewV4()
+	values := url.Values{
+		"workgroup_id":        {workgroupId.String()},
+		"bboid":               {"bboid"},
+		"finalized":           {"false"},
+		"exited":              {"true"},
+		"created_after":       {"2022-06-01"},
+		"transaction_before":  {"2022-06-02T10:00:00Z"},
+		"sort":                {"-end_time"},
+		"limit":               {"20"},
+		"fields":              {"Id, participants"},
+		"contains_rejections": {""},
+	}
+
+	q, err := ParseTrustmeshQuery(values)
+	if err != nil {
+		t.Fatalf("parsing query failed %v", err)
+	}
+
+	if q.WorkgroupId != workgroupId || q.BaseledgerBusinessObjectId != "bboid" || q.Limit != 20 || q.Sort != "-end_time" {
+		t.Fatalf("unexpected query %+v", q)
+	}
+	if q.Finalized == nil || *q.Finalized || q.Exited == nil || !*q.Exited || q.ContainsRejections != nil {
+		t.Fatalf("unexpected bool filters %+v", q)
+	}
+	if !q.CreatedAfter.Equal(time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)) || q.TransactionBefore.Hour() != 10 {
+		t.Fatalf("unexpected date range %v %v", q.CreatedAfter, q.TransactionBefore)
+	}
+	if len(q.Fields) != 2 || q.Fields[1] != "participants" {
+		t.Fatalf("fields = %v", q.Fields)
+	}
+}
+
+func TestGivenInvalidParamsWhenParseTrustmeshQueryThenError(t *testing.T) {
+	invalid := []url.Values{
+		{"workgroup_id": {"not-uuid"}},
+		{"finalized": {"maybe"}},
+		{"created_before": {"yesterday"}},
+		{"sort": {"participants"}},
+		{"limit": {"1000"}},
+		{"page": {"1"}, "cursor": {"abc"}},
+		{"cursor": {"not a cursor"}},
+	}
+
+	for _, values := range invalid {
+		if _, err := ParseTrustmeshQuery(values); err == nil {
+			t.Fatalf("expected error for %v", values)
+		}
+	}
+}
+
+func TestGivenCursorOfOtherSortWhenParseTrustmeshQueryThenError(t *testing.T) {
+	cursor := encodeTrustmeshCursor(trustmeshCursor{Sort: "created_at", Value: time.Now(), Id: uuid.NewV4()})
+
+	if _, err := ParseTrustmeshQuery(url.Values{"cursor": {cursor}}); err != nil {
+		t.Fatalf("cursor of same sort rejected %v", err)
+	}
+	if _, err := ParseTrustmeshQuery(url.Values{"cursor": {cursor}, "sort": {"-created_at"}}); err == nil {
+		t.Fatalf("expected error for cursor of other sort")
+	}
+}
@@ -0,0 +1,133 @@
+package types
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+)
+
+const trustmeshSummarySeparator = ", "
+
+// AddEntry updates summary of trustmesh with new entry, participants and business object types
+// are kept distinct in order of appearance and empty ones are left out
+func (t *Trustmesh) AddEntry(entry *TrustmeshEntry, senderOrgName string, receiverOrgName string) {
+	t.Participants = appendDistinct(t.Participants, senderOrgName)
+	t.Participants = appendDistinct(t.Participants, receiverOrgName)
+	t.BusinessObjectTypes = appendDistinct(t.BusinessObjectTypes, entry.BusinessObjectType)
+	t.Finalized = t.Finalized || entry.WorkstepType == common.WorkstepTypeFinal
+	t.ContainsRejections = t.ContainsRejections || entry.BaseledgerTransactionType == common.BaseledgerTransactionTypeReject
+
+	if entry.TendermintTransactionTimestamp.Valid {
+		t.AddTransactionTimestamp(entry.TendermintTransactionTimestamp.Time)
+	}
+}
+
+// AddTransactionTimestamp widens start and end time of trustmesh when one of its entries is committed,
+// they stay zero until the first entry is committed
+func (t *Trustmesh) AddTransactionTimestamp(timestamp time.Time) {
+	if t.StartTime.IsZero() || timestamp.Before(t.StartTime) {
+		t.StartTime = timestamp
+	}
+	if t.EndTime.IsZero() || timestamp.After(t.EndTime) {
+		t.EndTime = timestamp
+	}
+}
+
+// ResetSummary recomputes summary from entries, which need sender and receiver organizations loaded
+func (t *Trustmesh) ResetSummary(entries []TrustmeshEntry) {
+	t.StartTime = time.Time{}
+	t.EndTime = time.Time{}
+	t.Participants = ""
+	t.BusinessObjectTypes = ""
+	t.Finalized = false
+	t.ContainsRejections = false
+
+	for i := range entries {
+		t.AddEntry(&entries[i], entries[i].SenderOrg.OrganizationName, entries[i].ReceiverOrg.OrganizationName)
+	}
+}
+
+func appendDistinct(list string, item string) string {
+	if item == "" || list == "" {
+		return list + item
+	}
+	for _, existing := range strings.Split(list, trustmeshSummarySeparator) {
+		if existing == item {
+			return list
+		}
+	}
+	return list + trustmeshSummarySeparator + item
+}
+
+// addToTrustmeshSummaryWith updates summary of trustmesh with created entry, trustmesh row is locked
+// so that entries created concurrently in the same trustmesh do not overwrite each other
+func (t *TrustmeshEntry) addToTrustmeshSummaryWith(db *gorm.DB) error {
+	var trustmesh Trustmesh
+	res := db.Set("gorm:query_option", "FOR UPDATE").First(&trustmesh, "id = ?", t.TrustmeshId.String())
+	if res.Error != nil {
+		return res.Error
+	}
+
+	var organizations []Organization
+	res = db.Where("id IN (?)", []string{t.SenderOrgId.String(), t.ReceiverOrgId.String()}).Find(&organizations)
+	if res.Error != nil {
+		return res.Error
+	}
+	names := map[uuid.UUID]string{}
+	for _, organization := range organizations {
+		names[organization.Id] = organization.OrganizationName
+	}
+
+	trustmesh.AddEntry(t, names[t.SenderOrgId], names[t.ReceiverOrgId])
+	return updateTrustmeshSummaryWith(db, &trustmesh)
+}
+
+// AddTrustmeshTransactionTimestampWith widens start and end time of trustmesh of committed transaction
+func AddTrustmeshTransactionTimestampWith(db *gorm.DB, tendermintTransactionId uuid.UUID, timestamp string) error {
+	// postgres LEAST and GREATEST ignore nulls, so the first timestamp sets both
+	return db.Exec(`UPDATE trustmeshes SET start_time = LEAST(start_time, ?::timestamptz), end_time = GREATEST(end_time, ?::timestamptz)
+		WHERE id IN (SELECT trustmesh_id FROM trustmesh_entries WHERE tendermint_transaction_id = ?)`,
+		timestamp, timestamp, tendermintTransactionId.String()).Error
+}
+
+// RefreshTrustmeshSummaryWith recomputes summary of trustmesh from its entries, used when entries are removed
+func RefreshTrustmeshSummaryWith(db *gorm.DB, trustmeshId uuid.UUID) error {
+	var trustmesh Trustmesh
+	res := db.Set("gorm:query_option", "FOR UPDATE").First(&trustmesh, "id = ?", trustmeshId.String())
+	if gorm.IsRecordNotFoundError(res.Error) {
+		return nil
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+
+	var entries []TrustmeshEntry
+	res = db.Preload("SenderOrg").Preload("ReceiverOrg").Where("trustmesh_id = ?", trustmeshId.String()).Order("created_at asc").Find(&entries)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	trustmesh.ResetSummary(entries)
+	return updateTrustmeshSummaryWith(db, &trustmesh)
+}
+
+func updateTrustmeshSummaryWith(db *gorm.DB, trustmesh *Trustmesh) error {
+	return db.Exec("UPDATE trustmeshes SET start_time = ?, end_time = ?, participants = ?, business_object_types = ?, finalized = ?, contains_rejections = ? WHERE id = ?",
+		nullTime(trustmesh.StartTime),
+		nullTime(trustmesh.EndTime),
+		trustmesh.Participants,
+		trustmesh.BusinessObjectTypes,
+		trustmesh.Finalized,
+		trustmesh.ContainsRejections,
+		trustmesh.Id.String()).Error
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
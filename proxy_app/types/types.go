@@ -2,7 +2,9 @@ package types
 
 import (
 	// _ "github.com/jinzhu/gorm/dialects/postgres" // postgres
+	"errors"
 
+	"github.com/jinzhu/gorm"
 	uuid "github.com/kthomas/go.uuid"
 	"github.com/unibrightio/proxy-api/dbutil"
 	"github.com/unibrightio/proxy-api/logger"
@@ -21,6 +23,7 @@ type OffchainProcessMessage struct {
 	ReferencedWorkstepType               string
 	BusinessObjectProof                  string
 	BusinessObjectType                   string
+	BusinessObjectSchemaHash             string // hash of schema sender validated business object against, empty without schema
 	TendermintTransactionIdOfStoredProof uuid.UUID
 	BaseledgerTransactionIdOfStoredProof uuid.UUID
 	BaseledgerBusinessObjectId           string
@@ -35,11 +38,13 @@ type OffchainProcessMessage struct {
 type NatsMessage struct {
 	ProcessMessage OffchainProcessMessage
 	TxHash         string
+	TraceContext   map[string]string
 }
 
 type NatsTrustmeshUpdateMessage struct {
 	EthExitTxHash              string
 	BaseledgerBusinessObjectId string
+	TraceContext               map[string]string
 }
 
 type NewSuggestionRequest struct {
@@ -50,6 +55,7 @@ type NewSuggestionRequest struct {
 	BusinessObjectId                     string
 	BaseledgerBusinessObjectId           string
 	BusinessObjectJson                   string
+	BusinessObjectFormat                 string
 	ReferencedBaseledgerBusinessObjectId string
 	ReferencedBaseledgerTransactionId    string
 	KnowledgeLimiters                    []string
@@ -86,19 +92,25 @@ type BaseledgerTransactionExitPayload struct {
 }
 
 func (o *OffchainProcessMessage) Create() bool {
-	db := dbutil.Db.GetConn()
-	if db.NewRecord(o) {
-		result := db.Create(&o)
-		rowsAffected := result.RowsAffected
-		errors := result.GetErrors()
-		if len(errors) > 0 {
-			logger.Errorf("errors while creating new offchain process msg entry %v\n", errors)
-			return false
-		}
-		return rowsAffected > 0
+	return o.CreateWith(dbutil.Db.GetConn()) == nil
+}
+
+// CreateWith creates message using given connection or transaction (see dbutil.UnitOfWork)
+func (o *OffchainProcessMessage) CreateWith(db *gorm.DB) error {
+	if !db.NewRecord(o) {
+		return errors.New("offchain process msg already exists")
+	}
+
+	result := db.Create(o)
+	if result.Error != nil {
+		logger.Errorf("errors while creating new offchain process msg entry %v\n", result.GetErrors())
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("offchain process msg not created")
 	}
 
-	return false
+	return nil
 }
 
 func GetOffchainMsgById(id uuid.UUID) (msg *OffchainProcessMessage, err error) {
@@ -1,6 +1,9 @@
 package types
 
 import (
+	"crypto/ed25519"
+	"encoding/hex"
+
 	uuid "github.com/kthomas/go.uuid"
 	"github.com/unibrightio/proxy-api/dbutil"
 	"github.com/unibrightio/proxy-api/logger"
@@ -12,6 +15,18 @@ type WorkgroupMember struct {
 	OrganizationId       string
 	OrganizationEndpoint string
 	OrganizationToken    string
+	// hex encoded ed25519 key, envelopes the member sends over https and amqp are verified with it
+	OrganizationPublicKey string
+}
+
+// PublicKey returns public key of member, nil if it has none or it is invalid
+func (t *WorkgroupMember) PublicKey() ed25519.PublicKey {
+	key, err := hex.DecodeString(t.OrganizationPublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil
+	}
+
+	return ed25519.PublicKey(key)
 }
 
 func (t *WorkgroupMember) Create() bool {
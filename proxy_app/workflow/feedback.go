@@ -0,0 +1,264 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/metrics"
+	"github.com/unibrightio/proxy-api/proxyutil"
+	"github.com/unibrightio/proxy-api/saga"
+	"github.com/unibrightio/proxy-api/tracing"
+	"github.com/unibrightio/proxy-api/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type FeedbackRequest struct {
+	WorkflowId                 string
+	BaseledgerBusinessObjectId string
+	Approved                   bool
+	FeedbackMessage            string
+}
+
+// CreateFeedback broadcasts approval or rejection of latest received suggestion in workflow
+// and creates feedback sent entry
+func (s *Service) CreateFeedback(ctx context.Context, req FeedbackRequest) (*WorkstepResult, error) {
+	var latestTrustmeshEntry *types.TrustmeshEntry
+	var err error
+
+	if req.BaseledgerBusinessObjectId != "" {
+		latestTrustmeshEntry, err = s.Repositories.TrustmeshEntries.GetLatestTrustmeshEntryBasedOnBboid(req.BaseledgerBusinessObjectId)
+	} else if req.WorkflowId != "" {
+		latestTrustmeshEntry, err = s.Repositories.TrustmeshEntries.GetLatestTrustmeshEntryBasedOnTrustmeshId(req.WorkflowId)
+	} else {
+		return nil, invalidRequest("Both bboid and workflow id are missing. At least one must be provided")
+	}
+
+	if err != nil {
+		return nil, invalidRequest(err.Error())
+	}
+	if latestTrustmeshEntry == nil {
+		return nil, invalidRequest("Workflow not found")
+	}
+
+	if latestTrustmeshEntry.EntryType != common.SuggestionReceivedTrustmeshEntryType {
+		return nil, invalidRequest("Previous trustmesh entry is not of type Suggest")
+	}
+
+	suggestionReceivedOffchainMessage, err := s.Repositories.OffchainMessages.GetOffchainMsgById(latestTrustmeshEntry.OffchainProcessMessageId)
+	if err != nil {
+		return nil, invalidRequest(err.Error())
+	}
+
+	workgroup := s.Repositories.Workgroups.FindWorkgroup(latestTrustmeshEntry.WorkgroupId.String())
+	if workgroup == nil {
+		return nil, invalidRequest("Workgroup not found")
+	}
+
+	newFeedbackRequest := newFeedbackRequest(req, *latestTrustmeshEntry, suggestionReceivedOffchainMessage)
+
+	transactionId := uuid.NewV4()
+
+	feedbackOffchainMessage := createFeedbackOffchainMessage(*newFeedbackRequest, suggestionReceivedOffchainMessage, transactionId)
+	feedbackSentTrustmeshEntry := createFeedbackSentTrustmeshEntry(*newFeedbackRequest, feedbackOffchainMessage, "")
+	// feedback has to stay in workflow of the suggestion, creating entry fails otherwise
+	feedbackSentTrustmeshEntry.TrustmeshId = latestTrustmeshEntry.TrustmeshId
+
+	trace.SpanFromContext(ctx).SetAttributes(tracing.TransactionIdKey.String(transactionId.String()))
+	feedbackSentTrustmeshEntry.TraceContext = tracing.Serialize(ctx)
+
+	broadcastSaga := &saga.BroadcastSaga{
+		OffchainMessage: &feedbackOffchainMessage,
+		TrustmeshEntry:  feedbackSentTrustmeshEntry,
+		TransactionId:   transactionId,
+		OpCode:          uint32(getRandomFeedbackOpCode()),
+		CreatePayload: func(offchainMsg *types.OffchainProcessMessage) string {
+			return proxyutil.CreateNewFeedbackBaseledgerTransactionPayloadForWorkgroup(workgroup, s.OrganizationId, newFeedbackRequest, offchainMsg)
+		},
+	}
+
+	if err := broadcastSaga.Run(ctx, s.Repositories.PendingBroadcasts, s.Broadcast); err != nil {
+		logger.Errorf(err.Error())
+		if errors.Is(err, types.ErrInvalidTrustmeshReference) {
+			return nil, invalidRequest(err.Error())
+		}
+		return nil, err
+	}
+
+	metrics.FeedbacksCreated.WithLabelValues(strconv.FormatBool(newFeedbackRequest.Approved)).Inc()
+
+	return &WorkstepResult{
+		WorkflowId:                 feedbackSentTrustmeshEntry.TrustmeshId.String(),
+		WorkstepId:                 feedbackSentTrustmeshEntry.Id.String(),
+		BaseledgerBusinessObjectId: feedbackSentTrustmeshEntry.ReferencedBaseledgerBusinessObjectId,
+		TransactionHash:            feedbackSentTrustmeshEntry.TransactionHash,
+	}, nil
+}
+
+// SendRejectFeedback rejects received suggestion whose proof could not be verified or whose business object
+// does not match schema, feedback message tells the sender why
+func (s *Service) SendRejectFeedback(ctx context.Context, offchainProcessMessage *types.OffchainProcessMessage, workgroupId string, feedbackMessage string) {
+	var feedback = &types.NewFeedbackRequest{
+		WorkgroupId:        uuid.FromStringOrNil(workgroupId),
+		BusinessObjectType: offchainProcessMessage.BusinessObjectType,
+		Recipient:          offchainProcessMessage.SenderId.String(), // received suggestion is rejected back to its sender
+		Approved:           false,
+		BaseledgerBusinessObjectIdOfApprovedObject: offchainProcessMessage.BaseledgerBusinessObjectId,
+		HashOfObjectToApprove:                      offchainProcessMessage.BusinessObjectProof,
+		OriginalBaseledgerTransactionId:            offchainProcessMessage.BaseledgerTransactionIdOfStoredProof.String(),
+		OriginalOffchainProcessMessageId:           offchainProcessMessage.Id.String(),
+		FeedbackMessage:                            feedbackMessage,
+		BaseledgerProvenBusinessObjectJson:         offchainProcessMessage.BaseledgerSyncTreeJson,
+	}
+
+	workgroup := s.Repositories.Workgroups.FindWorkgroup(workgroupId)
+	if workgroup == nil {
+		logger.Errorf("error when sending reject feedback, workgroup %v not found", workgroupId)
+		return
+	}
+
+	transactionId := uuid.NewV4()
+
+	offchainMsg := s.createRejectFeedbackOffchainMessage(*feedback, transactionId)
+	trustmeshEntry := s.createRejectFeedbackSentTrustmeshEntry(*feedback, transactionId, offchainMsg)
+	trustmeshEntry.TraceContext = tracing.Serialize(ctx)
+
+	broadcastSaga := &saga.BroadcastSaga{
+		OffchainMessage: &offchainMsg,
+		TrustmeshEntry:  trustmeshEntry,
+		TransactionId:   transactionId,
+		CreatePayload: func(offchainMsg *types.OffchainProcessMessage) string {
+			return proxyutil.CreateNewFeedbackBaseledgerTransactionPayloadForWorkgroup(workgroup, s.OrganizationId, feedback, offchainMsg)
+		},
+	}
+
+	if err := broadcastSaga.Run(ctx, s.Repositories.PendingBroadcasts, s.Broadcast); err != nil {
+		logger.Errorf("error when sending reject feedback %v", err)
+	}
+}
+
+func getRandomFeedbackOpCode() int {
+	rand.Seed(time.Now().UnixNano())
+	min := 7
+	max := 8
+
+	return rand.Intn(max-min+1) + min
+}
+
+func createFeedbackOffchainMessage(
+	newFeedbackRequest types.NewFeedbackRequest,
+	suggestionReceivedOffchainMessage *types.OffchainProcessMessage,
+	transactionId uuid.UUID,
+) types.OffchainProcessMessage {
+	baseledgerTransactionType := common.BaseledgerTransactionTypeApprove
+
+	if !newFeedbackRequest.Approved {
+		baseledgerTransactionType = common.BaseledgerTransactionTypeReject
+	}
+
+	offchainMessage := types.OffchainProcessMessage{
+		SenderId:                             suggestionReceivedOffchainMessage.ReceiverId, // TODO: there was a problem here reading viper organization id, it was reading first org id for some reason
+		ReceiverId:                           suggestionReceivedOffchainMessage.SenderId,
+		Topic:                                suggestionReceivedOffchainMessage.Topic,
+		WorkstepType:                         common.WorkstepTypeFeedback,
+		BaseledgerSyncTreeJson:               suggestionReceivedOffchainMessage.BaseledgerSyncTreeJson,
+		BusinessObjectProof:                  suggestionReceivedOffchainMessage.BusinessObjectProof,
+		BaseledgerBusinessObjectId:           "", // empty because we are giving feedback
+		ReferencedBaseledgerBusinessObjectId: suggestionReceivedOffchainMessage.BaseledgerBusinessObjectId,
+		StatusTextMessage:                    newFeedbackRequest.FeedbackMessage,
+		BaseledgerTransactionIdOfStoredProof: transactionId,
+		TendermintTransactionIdOfStoredProof: transactionId,
+		BusinessObjectType:                   suggestionReceivedOffchainMessage.BusinessObjectType,
+		BaseledgerTransactionType:            baseledgerTransactionType,
+		ReferencedBaseledgerTransactionId:    suggestionReceivedOffchainMessage.BaseledgerTransactionIdOfStoredProof,
+		EntryType:                            common.FeedbackSentTrustmeshEntryType,
+		SorBusinessObjectId:                  suggestionReceivedOffchainMessage.SorBusinessObjectId,
+		ReferencedWorkstepType:               suggestionReceivedOffchainMessage.WorkstepType,
+	}
+
+	return offchainMessage
+}
+
+func createFeedbackSentTrustmeshEntry(newFeedbackRequest types.NewFeedbackRequest, offchainMsg types.OffchainProcessMessage, txHash string) *types.TrustmeshEntry {
+	trustmeshEntry := &types.TrustmeshEntry{
+		TendermintTransactionId:              offchainMsg.BaseledgerTransactionIdOfStoredProof,
+		OffchainProcessMessageId:             offchainMsg.Id,
+		SenderOrgId:                          uuid.FromStringOrNil(offchainMsg.SenderId.String()),
+		ReceiverOrgId:                        uuid.FromStringOrNil(offchainMsg.ReceiverId.String()),
+		WorkgroupId:                          uuid.FromStringOrNil(offchainMsg.Topic),
+		WorkstepType:                         offchainMsg.WorkstepType,
+		BaseledgerTransactionType:            offchainMsg.BaseledgerTransactionType,
+		BaseledgerTransactionId:              offchainMsg.BaseledgerTransactionIdOfStoredProof,
+		ReferencedBaseledgerTransactionId:    uuid.FromStringOrNil(newFeedbackRequest.OriginalBaseledgerTransactionId),
+		BusinessObjectType:                   offchainMsg.BusinessObjectType,
+		BaseledgerBusinessObjectId:           offchainMsg.BaseledgerBusinessObjectId,
+		ReferencedBaseledgerBusinessObjectId: offchainMsg.ReferencedBaseledgerBusinessObjectId,
+		TransactionHash:                      txHash,
+		EntryType:                            common.FeedbackSentTrustmeshEntryType,
+		SorBusinessObjectId:                  offchainMsg.SorBusinessObjectId,
+	}
+
+	return trustmeshEntry
+}
+
+func newFeedbackRequest(req FeedbackRequest, suggestionReceivedTrustmeshEntry types.TrustmeshEntry, suggestionReceivedOffchainMessage *types.OffchainProcessMessage) *types.NewFeedbackRequest {
+	return &types.NewFeedbackRequest{
+		WorkgroupId:        suggestionReceivedTrustmeshEntry.WorkgroupId,
+		Recipient:          suggestionReceivedTrustmeshEntry.SenderOrgId.String(),
+		BusinessObjectType: suggestionReceivedTrustmeshEntry.BusinessObjectType,
+		BaseledgerBusinessObjectIdOfApprovedObject: suggestionReceivedTrustmeshEntry.BaseledgerBusinessObjectId,
+		OriginalBaseledgerTransactionId:            suggestionReceivedTrustmeshEntry.BaseledgerTransactionId.String(), // TODO: BAS-79 is this correct?
+		Approved:                                   req.Approved,
+		FeedbackMessage:                            req.FeedbackMessage,
+		BaseledgerProvenBusinessObjectJson:         suggestionReceivedOffchainMessage.BaseledgerSyncTreeJson,
+		HashOfObjectToApprove:                      suggestionReceivedOffchainMessage.BusinessObjectProof,
+		OriginalOffchainProcessMessageId:           suggestionReceivedOffchainMessage.Id.String(), // TODO: BAS-79 is this correct?
+	}
+}
+
+func (s *Service) createRejectFeedbackOffchainMessage(req types.NewFeedbackRequest, transactionId uuid.UUID) types.OffchainProcessMessage {
+	offchainMessage := types.OffchainProcessMessage{
+		SenderId:                             uuid.FromStringOrNil(s.OrganizationId),
+		ReceiverId:                           uuid.FromStringOrNil(req.Recipient),
+		Topic:                                req.WorkgroupId.String(),
+		WorkstepType:                         "Feedback",
+		BaseledgerSyncTreeJson:               req.BaseledgerProvenBusinessObjectJson,
+		BusinessObjectProof:                  req.HashOfObjectToApprove,
+		BaseledgerBusinessObjectId:           "",
+		ReferencedBaseledgerBusinessObjectId: req.BaseledgerBusinessObjectIdOfApprovedObject,
+		StatusTextMessage:                    req.FeedbackMessage,
+		BaseledgerTransactionIdOfStoredProof: transactionId,
+		TendermintTransactionIdOfStoredProof: transactionId,
+		BusinessObjectType:                   req.BusinessObjectType,
+		BaseledgerTransactionType:            common.BaseledgerTransactionTypeReject,
+		ReferencedBaseledgerTransactionId:    uuid.FromStringOrNil(req.OriginalBaseledgerTransactionId),
+		EntryType:                            common.FeedbackSentTrustmeshEntryType,
+	}
+
+	return offchainMessage
+}
+
+func (s *Service) createRejectFeedbackSentTrustmeshEntry(req types.NewFeedbackRequest, transactionId uuid.UUID, offchainMsg types.OffchainProcessMessage) *types.TrustmeshEntry {
+	trustmeshEntry := &types.TrustmeshEntry{
+		TendermintTransactionId:              transactionId,
+		OffchainProcessMessageId:             offchainMsg.Id,
+		SenderOrgId:                          uuid.FromStringOrNil(s.OrganizationId),
+		ReceiverOrgId:                        uuid.FromStringOrNil(req.Recipient),
+		WorkgroupId:                          req.WorkgroupId,
+		WorkstepType:                         offchainMsg.WorkstepType,
+		BaseledgerTransactionType:            common.BaseledgerTransactionTypeReject,
+		BaseledgerTransactionId:              transactionId,
+		ReferencedBaseledgerTransactionId:    uuid.FromStringOrNil(req.OriginalBaseledgerTransactionId),
+		BusinessObjectType:                   req.BusinessObjectType,
+		BaseledgerBusinessObjectId:           offchainMsg.BaseledgerBusinessObjectId,
+		ReferencedBaseledgerBusinessObjectId: offchainMsg.ReferencedBaseledgerBusinessObjectId,
+		EntryType:                            common.FeedbackSentTrustmeshEntryType,
+	}
+
+	return trustmeshEntry
+}
@@ -0,0 +1,87 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/messaging"
+	"github.com/unibrightio/proxy-api/tracing"
+	"github.com/unibrightio/proxy-api/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ReceiveOffchainProcessMessage stores offchain message of counterparty and creates suggestion or feedback received entry,
+// message is rejected unless it was sent by its sender in its workgroup
+func (s *Service) ReceiveOffchainProcessMessage(ctx context.Context, envelope messaging.Envelope, natsMessage types.NatsMessage) error {
+	if err := envelope.CheckSender(natsMessage.ProcessMessage.SenderId.String(), natsMessage.ProcessMessage.Topic); err != nil {
+		return err
+	}
+
+	natsMessage.ProcessMessage.Id = uuid.Nil // set to nil so that it can be created in the DB
+	syncTreeJson, err := s.resolveSyncTreeDelta(natsMessage.ProcessMessage)
+	if err != nil {
+		return fmt.Errorf("error when resolving sync tree of offchain msg: %w", err)
+	}
+	natsMessage.ProcessMessage.BaseledgerSyncTreeJson = syncTreeJson
+	if err := s.Repositories.OffchainMessages.CreateOffchainMessage(&natsMessage.ProcessMessage); err != nil {
+		return errors.New("error when creating new offchain msg entry")
+	}
+
+	entryType := common.SuggestionReceivedTrustmeshEntryType
+	if natsMessage.ProcessMessage.EntryType == common.FeedbackSentTrustmeshEntryType {
+		entryType = common.FeedbackReceivedTrustmeshEntryType
+	}
+
+	trustmeshEntry := &types.TrustmeshEntry{
+		TendermintTransactionId:              natsMessage.ProcessMessage.BaseledgerTransactionIdOfStoredProof,
+		OffchainProcessMessageId:             natsMessage.ProcessMessage.Id,
+		SenderOrgId:                          natsMessage.ProcessMessage.SenderId,
+		ReceiverOrgId:                        natsMessage.ProcessMessage.ReceiverId,
+		WorkgroupId:                          uuid.FromStringOrNil(natsMessage.ProcessMessage.Topic),
+		WorkstepType:                         natsMessage.ProcessMessage.WorkstepType,
+		BaseledgerTransactionType:            natsMessage.ProcessMessage.BaseledgerTransactionType,
+		BaseledgerTransactionId:              natsMessage.ProcessMessage.BaseledgerTransactionIdOfStoredProof,
+		ReferencedBaseledgerTransactionId:    natsMessage.ProcessMessage.ReferencedBaseledgerTransactionId,
+		BusinessObjectType:                   natsMessage.ProcessMessage.BusinessObjectType,
+		BaseledgerBusinessObjectId:           natsMessage.ProcessMessage.BaseledgerBusinessObjectId,
+		ReferencedBaseledgerBusinessObjectId: natsMessage.ProcessMessage.ReferencedBaseledgerBusinessObjectId,
+		SorBusinessObjectId:                  natsMessage.ProcessMessage.SorBusinessObjectId,
+		TransactionHash:                      natsMessage.TxHash,
+		EntryType:                            entryType,
+		TraceContext:                         tracing.Serialize(ctx),
+	}
+
+	if err := s.Repositories.TrustmeshEntries.CreateTrustmeshEntry(trustmeshEntry); err != nil {
+		// i.e. referenced transaction is unknown, message is not linked to a wrong trustmesh
+		return fmt.Errorf("error when creating new trustmesh entry: %w", err)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(tracing.TrustmeshEntryIdKey.String(trustmeshEntry.Id.String()))
+
+	return nil
+}
+
+// ReceiveTrustmeshUpdate stores eth exit transaction hash sent by counterparty on trustmesh containing bboid,
+// only parties of the latest entry of the trustmesh may send it
+func (s *Service) ReceiveTrustmeshUpdate(ctx context.Context, envelope messaging.Envelope, msg types.NatsTrustmeshUpdateMessage) error {
+	trustmeshEntry, err := s.Repositories.TrustmeshEntries.GetLatestTrustmeshEntryBasedOnBboid(msg.BaseledgerBusinessObjectId)
+	if err != nil {
+		return err
+	}
+	if trustmeshEntry == nil {
+		return errors.New("no trustmesh contains baseledger business object " + msg.BaseledgerBusinessObjectId)
+	}
+
+	counterparty := trustmeshEntry.SenderOrgId
+	if strings.EqualFold(envelope.SenderId, trustmeshEntry.ReceiverOrgId.String()) {
+		counterparty = trustmeshEntry.ReceiverOrgId
+	}
+	if err := envelope.CheckSender(counterparty.String(), trustmeshEntry.WorkgroupId.String()); err != nil {
+		return err
+	}
+
+	return s.Repositories.Trustmeshes.UpdateTrustmeshEthTxHash(trustmeshEntry.TrustmeshId, msg.EthExitTxHash)
+}
@@ -0,0 +1,159 @@
+package workflow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/schema"
+	"github.com/unibrightio/proxy-api/synctree"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+// ErrSchemaNotAgreed is matched (errors.Is) when sender of suggestion validated business object against
+// another schema than the one registered here
+var ErrSchemaNotAgreed = errors.New("schema not agreed")
+
+// RegisterBusinessObjectSchema stores JSON Schema business objects of type have to match in workgroup,
+// schema registered before for the type is replaced
+func (s *Service) RegisterBusinessObjectSchema(workgroupId string, businessObjectType string, schemaJson string) (*types.BusinessObjectSchema, error) {
+	if businessObjectType == "" {
+		return nil, invalidRequest("Business object type is missing")
+	}
+	if s.Repositories.Workgroups.FindWorkgroup(workgroupId) == nil {
+		return nil, notFound("Workgroup not found")
+	}
+	compiled, err := schema.Compile(schemaJson)
+	if err != nil {
+		return nil, invalidRequest(err.Error())
+	}
+
+	canonical, err := compiled.Canonical()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(canonical))
+
+	businessObjectSchema := &types.BusinessObjectSchema{
+		WorkgroupId:        uuid.FromStringOrNil(workgroupId),
+		BusinessObjectType: businessObjectType,
+		Schema:             canonical,
+		Hash:               hex.EncodeToString(hash[:]),
+	}
+	if err := s.Repositories.Schemas.SaveBusinessObjectSchema(businessObjectSchema); err != nil {
+		return nil, err
+	}
+
+	return businessObjectSchema, nil
+}
+
+func (s *Service) GetBusinessObjectSchemas(workgroupId string) ([]types.BusinessObjectSchema, error) {
+	if s.Repositories.Workgroups.FindWorkgroup(workgroupId) == nil {
+		return nil, notFound("Workgroup not found")
+	}
+
+	return s.Repositories.Schemas.GetBusinessObjectSchemas(uuid.FromStringOrNil(workgroupId))
+}
+
+func (s *Service) GetBusinessObjectSchema(workgroupId string, businessObjectType string) (*types.BusinessObjectSchema, error) {
+	businessObjectSchema, err := s.Repositories.Schemas.GetBusinessObjectSchema(uuid.FromStringOrNil(workgroupId), businessObjectType)
+	if err != nil {
+		return nil, err
+	}
+	if businessObjectSchema == nil {
+		return nil, notFound("Schema not found")
+	}
+
+	return businessObjectSchema, nil
+}
+
+func (s *Service) DeleteBusinessObjectSchema(workgroupId string, businessObjectType string) error {
+	deleted, err := s.Repositories.Schemas.DeleteBusinessObjectSchema(uuid.FromStringOrNil(workgroupId), businessObjectType)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return notFound("Schema not found")
+	}
+
+	return nil
+}
+
+// ValidateBusinessObject checks business object of suggestion against schema registered in workgroup,
+// without schema it is only checked to be a json object. Error matches schema.ErrInvalidBusinessObject
+// if business object is invalid
+func ValidateBusinessObject(schemas repository.IBusinessObjectSchemaRepository, workgroupId uuid.UUID, businessObjectType string, businessObjectJson string) error {
+	compiled, err := compiledSchema(schemas, workgroupId, businessObjectType)
+	if err != nil {
+		return err
+	}
+
+	return compiled.Validate(businessObjectJson)
+}
+
+// ValidateReceivedBusinessObject is ValidateBusinessObject for business object read from sync tree,
+// string fields of trees without typed fields are read as the types schema expects
+func ValidateReceivedBusinessObject(schemas repository.IBusinessObjectSchemaRepository, workgroupId uuid.UUID, businessObjectType string, syncTree synctree.BaseledgerSyncTree) error {
+	compiled, err := compiledSchema(schemas, workgroupId, businessObjectType)
+	if err != nil {
+		return err
+	}
+
+	businessObjectJson, err := synctree.GetBusinessObjectFieldsJson(syncTree)
+	if err != nil {
+		return fmt.Errorf("%w, sync tree can not be read %v", schema.ErrInvalidBusinessObject, err)
+	}
+	if synctree.HasTypedFields(syncTree) {
+		return compiled.Validate(businessObjectJson)
+	}
+	return compiled.ValidateSyncTreeObject(businessObjectJson)
+}
+
+// BusinessObjectSchemaHash returns hash of schema registered for type in workgroup, sent with suggestions
+// so that receiver checks both validated against the same schema. Empty if no schema is registered
+func BusinessObjectSchemaHash(schemas repository.IBusinessObjectSchemaRepository, workgroupId uuid.UUID, businessObjectType string) (string, error) {
+	businessObjectSchema, err := schemas.GetBusinessObjectSchema(workgroupId, businessObjectType)
+	if err != nil || businessObjectSchema == nil {
+		return "", err
+	}
+
+	return businessObjectSchema.Hash, nil
+}
+
+// CheckSchemaAgreement checks that sender of suggestion validated business object against the schema
+// registered here, error matches ErrSchemaNotAgreed if schemas differ or only one side has a schema
+func CheckSchemaAgreement(schemas repository.IBusinessObjectSchemaRepository, workgroupId uuid.UUID, businessObjectType string, senderSchemaHash string) error {
+	hash, err := BusinessObjectSchemaHash(schemas, workgroupId, businessObjectType)
+	if err != nil {
+		return err
+	}
+	if hash != senderSchemaHash {
+		return fmt.Errorf("%w: schema of %v is %v here and %v at sender", ErrSchemaNotAgreed, businessObjectType, schemaHashOrNone(hash), schemaHashOrNone(senderSchemaHash))
+	}
+
+	return nil
+}
+
+func schemaHashOrNone(hash string) string {
+	if hash == "" {
+		return "none"
+	}
+	return hash
+}
+
+// nil if no schema is registered
+func compiledSchema(schemas repository.IBusinessObjectSchemaRepository, workgroupId uuid.UUID, businessObjectType string) (*schema.Schema, error) {
+	businessObjectSchema, err := schemas.GetBusinessObjectSchema(workgroupId, businessObjectType)
+	if err != nil || businessObjectSchema == nil {
+		return nil, err
+	}
+
+	compiled, err := schema.Compile(businessObjectSchema.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("schema of %v in workgroup %v can not be compiled %w", businessObjectType, workgroupId, err)
+	}
+	return compiled, nil
+}
@@ -0,0 +1,282 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/codec"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/metrics"
+	"github.com/unibrightio/proxy-api/proxyutil"
+	"github.com/unibrightio/proxy-api/saga"
+	"github.com/unibrightio/proxy-api/schema"
+	"github.com/unibrightio/proxy-api/synctree"
+	"github.com/unibrightio/proxy-api/tracing"
+	"github.com/unibrightio/proxy-api/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type SuggestionRequest struct {
+	WorkgroupId                string
+	Recipient                  string
+	WorkstepType               string
+	WorkflowId                 string
+	BaseledgerBusinessObjectId string
+	BusinessObjectType         string
+	BusinessObjectId           string
+	BusinessObjectJson         string
+	BusinessObjectFormat       string // json if empty, BusinessObjectJson then holds business object in this format
+	KnowledgeLimiters          []string
+}
+
+// CreateSuggestion broadcasts suggestion and creates suggestion sent entry. Without bboid and workflow id
+// the suggestion starts new workflow, otherwise it continues workflow whose latest step is feedback
+func (s *Service) CreateSuggestion(ctx context.Context, req SuggestionRequest) (*WorkstepResult, error) {
+	newSuggestionRequest := &types.NewSuggestionRequest{}
+
+	// there is no bboid and no trustmesh id that the suggestion references - we treat it as INITIAL
+	if req.BaseledgerBusinessObjectId == "" && req.WorkflowId == "" {
+		newSuggestionRequest = createNewInitialSuggestionRequest(req)
+	} else {
+		// either go with bboid or workflow id
+		var latestTrustmeshEntry *types.TrustmeshEntry
+		var err error
+		if req.BaseledgerBusinessObjectId != "" {
+			latestTrustmeshEntry, err = s.Repositories.TrustmeshEntries.GetLatestTrustmeshEntryBasedOnBboid(req.BaseledgerBusinessObjectId)
+		} else {
+			latestTrustmeshEntry, err = s.Repositories.TrustmeshEntries.GetLatestTrustmeshEntryBasedOnTrustmeshId(req.WorkflowId)
+		}
+
+		if err != nil {
+			return nil, invalidRequest(err.Error())
+		}
+		if latestTrustmeshEntry == nil {
+			return nil, invalidRequest("Workflow not found")
+		}
+
+		// consider opening up for other previous worksteps.
+		// currently we are rigid that feedback has to be the step that came before this one
+		// in the scenario where workflow id is provided
+		if latestTrustmeshEntry.EntryType != common.FeedbackReceivedTrustmeshEntryType && latestTrustmeshEntry.EntryType != common.FeedbackSentTrustmeshEntryType {
+			return nil, invalidRequest("Previous workstep is not feedback sent/received")
+		}
+
+		if req.WorkstepType == common.WorkstepTypeNewVersion {
+			newSuggestionRequest = createNewVersionSuggestionRequestFromLatestTrustmeshEntry(req, *latestTrustmeshEntry)
+		} else if req.WorkstepType == common.WorkstepTypeNextWorkstep {
+			newSuggestionRequest = createNextWorkstepOrFinalSuggestionRequestFromLatestTrustmeshEntry(req, *latestTrustmeshEntry, common.WorkstepTypeNextWorkstep)
+		} else if req.WorkstepType == common.WorkstepTypeFinal {
+			newSuggestionRequest = createNextWorkstepOrFinalSuggestionRequestFromLatestTrustmeshEntry(req, *latestTrustmeshEntry, common.WorkstepTypeFinal)
+		} else {
+			return nil, invalidRequest("Workstep type is invalid for suggestion")
+		}
+	}
+
+	workgroup := s.Repositories.Workgroups.FindWorkgroup(newSuggestionRequest.WorkgroupId.String())
+	if workgroup == nil {
+		return nil, invalidRequest("Workgroup not found")
+	}
+
+	syncTree, err := s.createSuggestionSyncTree(workgroup.Id, *newSuggestionRequest)
+	if err != nil {
+		return nil, err
+	}
+	schemaHash, err := BusinessObjectSchemaHash(s.Repositories.Schemas, workgroup.Id, newSuggestionRequest.BusinessObjectType)
+	if err != nil {
+		return nil, err
+	}
+	workflowLog.Ctx(ctx).Debug("sync tree created", logger.Payload("sync_tree", syncTree))
+
+	syncTreeJson, err := json.Marshal(syncTree)
+	if err != nil {
+		logger.Errorf("error marshaling sync tree %v", err.Error())
+		return nil, errors.New("error marshaling sync tree")
+	}
+
+	transactionId := uuid.NewV4()
+
+	offchainMsg := s.createNewSuggestionOffchainMessage(*newSuggestionRequest, transactionId, string(syncTreeJson), syncTree.RootProof)
+	offchainMsg.BusinessObjectSchemaHash = schemaHash
+	trustmeshEntry := createSuggestionSentTrustmeshEntry(*newSuggestionRequest, transactionId, offchainMsg, "")
+
+	trace.SpanFromContext(ctx).SetAttributes(tracing.TransactionIdKey.String(transactionId.String()))
+	trustmeshEntry.TraceContext = tracing.Serialize(ctx)
+
+	broadcastSaga := &saga.BroadcastSaga{
+		OffchainMessage: &offchainMsg,
+		TrustmeshEntry:  trustmeshEntry,
+		TransactionId:   transactionId,
+		OpCode:          uint32(getRandomSuggestionOpCode()),
+		CreatePayload: func(offchainMsg *types.OffchainProcessMessage) string {
+			return proxyutil.CreateNewSuggestionBaseledgerTransactionPayloadForWorkgroup(workgroup, newSuggestionRequest, offchainMsg)
+		},
+	}
+
+	if err := broadcastSaga.Run(ctx, s.Repositories.PendingBroadcasts, s.Broadcast); err != nil {
+		logger.Errorf(err.Error())
+		if errors.Is(err, types.ErrInvalidTrustmeshReference) {
+			return nil, invalidRequest(err.Error())
+		}
+		return nil, err
+	}
+
+	metrics.SuggestionsCreated.Inc()
+
+	return &WorkstepResult{
+		WorkflowId:                 trustmeshEntry.TrustmeshId.String(),
+		WorkstepId:                 trustmeshEntry.Id.String(),
+		BaseledgerBusinessObjectId: trustmeshEntry.BaseledgerBusinessObjectId,
+		TransactionHash:            trustmeshEntry.TransactionHash,
+	}, nil
+}
+
+// createSuggestionSyncTree validates business object against schema of its type and builds sync tree of it
+func (s *Service) createSuggestionSyncTree(workgroupId uuid.UUID, req types.NewSuggestionRequest) (synctree.BaseledgerSyncTree, error) {
+	if req.BusinessObjectFormat == "" || req.BusinessObjectFormat == codec.FormatJson {
+		// invalid json would silently become an empty sync tree with a valid proof
+		err := ValidateBusinessObject(s.Repositories.Schemas, workgroupId, req.BusinessObjectType, req.BusinessObjectJson)
+		if errors.Is(err, schema.ErrInvalidBusinessObject) {
+			return synctree.BaseledgerSyncTree{}, invalidRequest(err.Error())
+		}
+		if err != nil {
+			return synctree.BaseledgerSyncTree{}, err
+		}
+
+		return s.buildSuggestionSyncTree(req)
+	}
+
+	syncTree, err := s.buildSuggestionSyncTree(req)
+	if err != nil {
+		return synctree.BaseledgerSyncTree{}, invalidRequest(err.Error())
+	}
+
+	// decoded fields are checked, business object itself is not json
+	err = ValidateReceivedBusinessObject(s.Repositories.Schemas, workgroupId, req.BusinessObjectType, syncTree)
+	if errors.Is(err, schema.ErrInvalidBusinessObject) {
+		return synctree.BaseledgerSyncTree{}, invalidRequest(err.Error())
+	}
+	if err != nil {
+		return synctree.BaseledgerSyncTree{}, err
+	}
+
+	return syncTree, nil
+}
+
+// buildSuggestionSyncTree builds sync tree of new version from sync tree of the version before, so that
+// only hashes above changed fields are computed and offchain message can carry the delta only
+func (s *Service) buildSuggestionSyncTree(req types.NewSuggestionRequest) (synctree.BaseledgerSyncTree, error) {
+	if req.WorkstepType == common.WorkstepTypeNewVersion {
+		if base := latestVersionSyncTree(s.Repositories.TrustmeshEntries, req.BaseledgerBusinessObjectId); base != nil {
+			return synctree.UpdateFromBusinessObject(*base, req.BusinessObjectJson, req.BusinessObjectFormat, req.KnowledgeLimiters)
+		}
+	}
+
+	return synctree.CreateFromBusinessObject(req.BusinessObjectJson, req.BusinessObjectFormat, req.KnowledgeLimiters)
+}
+
+func getRandomSuggestionOpCode() int {
+	rand.Seed(time.Now().UnixNano())
+	min := 7
+	max := 8
+
+	return rand.Intn(max-min+1) + min
+}
+
+func createNewInitialSuggestionRequest(req SuggestionRequest) *types.NewSuggestionRequest {
+	return &types.NewSuggestionRequest{
+		WorkgroupId:                uuid.FromStringOrNil(req.WorkgroupId),
+		Recipient:                  req.Recipient,
+		WorkstepType:               common.WorkstepTypeInitial,
+		BusinessObjectType:         req.BusinessObjectType,
+		BusinessObjectId:           req.BusinessObjectId,
+		BaseledgerBusinessObjectId: uuid.NewV4().String(),
+		BusinessObjectJson:         req.BusinessObjectJson,
+		BusinessObjectFormat:       req.BusinessObjectFormat,
+		KnowledgeLimiters:          req.KnowledgeLimiters,
+	}
+}
+
+func createNewVersionSuggestionRequestFromLatestTrustmeshEntry(
+	req SuggestionRequest,
+	latestFeedbackTrustmeshEntry types.TrustmeshEntry) *types.NewSuggestionRequest {
+	return &types.NewSuggestionRequest{
+		WorkgroupId:                          uuid.FromStringOrNil(req.WorkgroupId),
+		Recipient:                            latestFeedbackTrustmeshEntry.SenderOrgId.String(),
+		WorkstepType:                         common.WorkstepTypeNewVersion,
+		BusinessObjectType:                   latestFeedbackTrustmeshEntry.BusinessObjectType,
+		BusinessObjectId:                     latestFeedbackTrustmeshEntry.SorBusinessObjectId,
+		BaseledgerBusinessObjectId:           latestFeedbackTrustmeshEntry.ReferencedBaseledgerBusinessObjectId,
+		ReferencedBaseledgerBusinessObjectId: latestFeedbackTrustmeshEntry.ReferencedBaseledgerBusinessObjectId,
+		ReferencedBaseledgerTransactionId:    latestFeedbackTrustmeshEntry.BaseledgerTransactionId.String(),
+		BusinessObjectJson:                   req.BusinessObjectJson,
+		BusinessObjectFormat:                 req.BusinessObjectFormat,
+		KnowledgeLimiters:                    req.KnowledgeLimiters,
+	}
+}
+
+func createNextWorkstepOrFinalSuggestionRequestFromLatestTrustmeshEntry(
+	req SuggestionRequest,
+	latestFeedbackTrustmeshEntry types.TrustmeshEntry,
+	workstepType string) *types.NewSuggestionRequest {
+	return &types.NewSuggestionRequest{
+		WorkgroupId:                          uuid.FromStringOrNil(req.WorkgroupId),
+		Recipient:                            latestFeedbackTrustmeshEntry.SenderOrgId.String(),
+		WorkstepType:                         workstepType,
+		BusinessObjectType:                   req.BusinessObjectType,
+		BusinessObjectId:                     req.BusinessObjectId,
+		BaseledgerBusinessObjectId:           uuid.NewV4().String(),
+		ReferencedBaseledgerBusinessObjectId: latestFeedbackTrustmeshEntry.ReferencedBaseledgerBusinessObjectId,
+		ReferencedBaseledgerTransactionId:    latestFeedbackTrustmeshEntry.BaseledgerTransactionId.String(),
+		BusinessObjectJson:                   req.BusinessObjectJson,
+		BusinessObjectFormat:                 req.BusinessObjectFormat,
+		KnowledgeLimiters:                    req.KnowledgeLimiters,
+	}
+}
+
+func (s *Service) createNewSuggestionOffchainMessage(
+	req types.NewSuggestionRequest, transactionId uuid.UUID, syncTreeJson string, rootProof string) types.OffchainProcessMessage {
+	offchainMessage := types.OffchainProcessMessage{
+		SenderId:                             uuid.FromStringOrNil(s.OrganizationId),
+		ReceiverId:                           uuid.FromStringOrNil(req.Recipient),
+		Topic:                                req.WorkgroupId.String(), // TODO: BAS-79 why is this called topic? rename to workgroup id
+		WorkstepType:                         req.WorkstepType,
+		BaseledgerSyncTreeJson:               syncTreeJson,
+		BusinessObjectProof:                  rootProof,
+		BusinessObjectType:                   req.BusinessObjectType,
+		SorBusinessObjectId:                  req.BusinessObjectId,
+		BaseledgerBusinessObjectId:           req.BaseledgerBusinessObjectId,
+		ReferencedBaseledgerBusinessObjectId: req.ReferencedBaseledgerBusinessObjectId,
+		BaseledgerTransactionType:            common.BaseledgerTransactionTypeSuggest,
+		EntryType:                            common.SuggestionSentTrustmeshEntryType, // can we ditch this as we have one above that says that this is a suggestion
+		StatusTextMessage:                    req.WorkstepType + " " + common.BaseledgerTransactionTypeSuggest,
+		BaseledgerTransactionIdOfStoredProof: transactionId,
+		ReferencedBaseledgerTransactionId:    uuid.FromStringOrNil(req.ReferencedBaseledgerTransactionId),
+		TendermintTransactionIdOfStoredProof: transactionId,
+	}
+
+	return offchainMessage
+}
+
+func createSuggestionSentTrustmeshEntry(req types.NewSuggestionRequest, transactionId uuid.UUID, offchainMsg types.OffchainProcessMessage, txHash string) *types.TrustmeshEntry {
+	return &types.TrustmeshEntry{
+		EntryType:                         common.SuggestionSentTrustmeshEntryType,
+		SenderOrgId:                       offchainMsg.SenderId,
+		ReceiverOrgId:                     uuid.FromStringOrNil(req.Recipient),
+		WorkgroupId:                       req.WorkgroupId,
+		WorkstepType:                      offchainMsg.WorkstepType,
+		BaseledgerTransactionType:         offchainMsg.BaseledgerTransactionType,
+		BusinessObjectType:                req.BusinessObjectType,
+		SorBusinessObjectId:               req.BusinessObjectId,
+		BaseledgerBusinessObjectId:        offchainMsg.BaseledgerBusinessObjectId,
+		OffchainProcessMessageId:          offchainMsg.Id,
+		TendermintTransactionId:           transactionId,
+		TransactionHash:                   txHash,
+		BaseledgerTransactionId:           transactionId,
+		ReferencedBaseledgerTransactionId: uuid.FromStringOrNil(req.ReferencedBaseledgerTransactionId),
+	}
+}
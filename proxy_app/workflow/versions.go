@@ -0,0 +1,204 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/unibrightio/proxy-api/common"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/synctree"
+	"github.com/unibrightio/proxy-api/types"
+)
+
+// BusinessObjectVersion is one suggestion of business object, version 1 is the initial suggestion
+// and every new version suggestion reuses its bboid
+type BusinessObjectVersion struct {
+	Version                        int
+	EntryId                        uuid.UUID
+	EntryType                      string
+	WorkstepType                   string
+	BaseledgerTransactionId        uuid.UUID
+	Proof                          string
+	CommitmentState                string
+	CreatedAt                      time.Time
+	TendermintTransactionTimestamp time.Time
+}
+
+// BusinessObjectDiff turns business object of version From into business object of version To
+type BusinessObjectDiff struct {
+	BaseledgerBusinessObjectId string
+	From                       int
+	To                         int
+	Operations                 []synctree.PatchOperation
+}
+
+func (s *Service) GetBusinessObjectVersions(bboid string) ([]BusinessObjectVersion, error) {
+	entries, err := s.getVersionEntries(bboid)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []BusinessObjectVersion{}
+	for i, entry := range entries {
+		versions = append(versions, BusinessObjectVersion{
+			Version:                        i + 1,
+			EntryId:                        entry.Id,
+			EntryType:                      entry.EntryType,
+			WorkstepType:                   entry.WorkstepType,
+			BaseledgerTransactionId:        entry.BaseledgerTransactionId,
+			Proof:                          entry.OffchainProcessMessage.BusinessObjectProof,
+			CommitmentState:                entry.CommitmentState,
+			CreatedAt:                      entry.CreatedAt,
+			TendermintTransactionTimestamp: entry.TendermintTransactionTimestamp.Time,
+		})
+	}
+
+	return versions, nil
+}
+
+// DiffBusinessObjectVersions compares sync tree leaves of two versions, from defaults to the version
+// before to and to defaults to the latest version
+func (s *Service) DiffBusinessObjectVersions(bboid string, from int, to int) (*BusinessObjectDiff, error) {
+	entries, err := s.getVersionEntries(bboid)
+	if err != nil {
+		return nil, err
+	}
+
+	if to == 0 {
+		to = len(entries)
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from < 1 || to < 1 || from > len(entries) || to > len(entries) {
+		return nil, invalidRequest(fmt.Sprintf("business object %v has versions 1 to %v", bboid, len(entries)))
+	}
+
+	fromTree, err := versionSyncTree(entries[from-1])
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := versionSyncTree(entries[to-1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &BusinessObjectDiff{
+		BaseledgerBusinessObjectId: bboid,
+		From:                       from,
+		To:                         to,
+		Operations:                 synctree.Diff(*fromTree, *toTree),
+	}, nil
+}
+
+func (s *Service) getVersionEntries(bboid string) ([]types.TrustmeshEntry, error) {
+	entries, err := s.Repositories.TrustmeshEntries.GetBusinessObjectVersions(bboid)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, notFound(fmt.Sprintf("business object %v not found", bboid))
+	}
+
+	return entries, nil
+}
+
+func versionSyncTree(entry types.TrustmeshEntry) (*synctree.BaseledgerSyncTree, error) {
+	syncTree := &synctree.BaseledgerSyncTree{}
+	if err := json.Unmarshal([]byte(entry.OffchainProcessMessage.BaseledgerSyncTreeJson), syncTree); err != nil {
+		return nil, fmt.Errorf("sync tree of entry %v can not be read %w", entry.Id, err)
+	}
+
+	return syncTree, nil
+}
+
+// VersionSyncTree is sync tree of the version of business object with given proof, nil if there is none
+func VersionSyncTree(entries repository.ITrustmeshEntryRepository, bboid string, proof string) *synctree.BaseledgerSyncTree {
+	versions, err := entries.GetBusinessObjectVersions(bboid)
+	if err != nil {
+		return nil
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].OffchainProcessMessage.BusinessObjectProof != proof {
+			continue
+		}
+		syncTree, err := versionSyncTree(versions[i])
+		if err != nil {
+			logger.Warnf(err.Error())
+			return nil
+		}
+		return syncTree
+	}
+
+	return nil
+}
+
+func latestVersionSyncTree(entries repository.ITrustmeshEntryRepository, bboid string) *synctree.BaseledgerSyncTree {
+	versions, err := entries.GetBusinessObjectVersions(bboid)
+	if err != nil || len(versions) == 0 {
+		return nil
+	}
+
+	syncTree, err := versionSyncTree(versions[len(versions)-1])
+	if err != nil {
+		logger.Warnf(err.Error())
+		return nil
+	}
+	return syncTree
+}
+
+// OffchainSyncTreeJson is sync tree json offchain message is sent with. New versions built from the
+// version before are sent as synctree.SyncTreeDelta, receiver has the version before already
+func OffchainSyncTreeJson(entries repository.ITrustmeshEntryRepository, offchainMessage types.OffchainProcessMessage) string {
+	syncTree := synctree.BaseledgerSyncTree{}
+	if offchainMessage.WorkstepType != common.WorkstepTypeNewVersion ||
+		json.Unmarshal([]byte(offchainMessage.BaseledgerSyncTreeJson), &syncTree) != nil ||
+		syncTree.BaseProof == "" {
+		return offchainMessage.BaseledgerSyncTreeJson
+	}
+
+	base := VersionSyncTree(entries, offchainMessage.BaseledgerBusinessObjectId, syncTree.BaseProof)
+	if base == nil {
+		return offchainMessage.BaseledgerSyncTreeJson
+	}
+	delta, ok := synctree.CreateDelta(*base, syncTree)
+	if !ok {
+		return offchainMessage.BaseledgerSyncTreeJson
+	}
+	deltaJson, err := json.Marshal(delta)
+	if err != nil {
+		return offchainMessage.BaseledgerSyncTreeJson
+	}
+
+	return string(deltaJson)
+}
+
+// resolveSyncTreeDelta turns sync tree delta of received offchain message into the whole sync tree
+func (s *Service) resolveSyncTreeDelta(offchainMessage types.OffchainProcessMessage) (string, error) {
+	delta, err := synctree.ParseDelta(offchainMessage.BaseledgerSyncTreeJson)
+	if err != nil {
+		return "", err
+	}
+	if delta == nil {
+		return offchainMessage.BaseledgerSyncTreeJson, nil
+	}
+
+	base := VersionSyncTree(s.Repositories.TrustmeshEntries, offchainMessage.BaseledgerBusinessObjectId, delta.BaseProof)
+	if base == nil {
+		return "", fmt.Errorf("base version %v of sync tree delta of business object %v not found", delta.BaseProof, offchainMessage.BaseledgerBusinessObjectId)
+	}
+	syncTree, err := synctree.ApplyDelta(*base, *delta)
+	if err != nil {
+		return "", err
+	}
+	syncTreeJson, err := json.Marshal(syncTree)
+	if err != nil {
+		return "", err
+	}
+
+	return string(syncTreeJson), nil
+}
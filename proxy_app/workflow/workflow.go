@@ -0,0 +1,76 @@
+package workflow
+
+import (
+	"errors"
+
+	"github.com/unibrightio/proxy-api/config"
+	"github.com/unibrightio/proxy-api/logger"
+	"github.com/unibrightio/proxy-api/repository"
+	"github.com/unibrightio/proxy-api/restutil"
+	"github.com/unibrightio/proxy-api/saga"
+)
+
+var workflowLog = logger.For("workflow")
+
+// ErrInvalidRequest is matched (errors.Is) by errors caused by the request, not by the proxy
+var ErrInvalidRequest = errors.New("invalid request")
+
+type invalidRequestError struct {
+	message string
+}
+
+func (e *invalidRequestError) Error() string {
+	return e.message
+}
+
+func (e *invalidRequestError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+func invalidRequest(message string) error {
+	return &invalidRequestError{message: message}
+}
+
+// ErrNotFound is matched (errors.Is) when requested object does not exist
+var ErrNotFound = errors.New("not found")
+
+type notFoundError struct {
+	message string
+}
+
+func (e *notFoundError) Error() string {
+	return e.message
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func notFound(message string) error {
+	return &notFoundError{message: message}
+}
+
+// Service runs workflow steps of one organization: sending suggestions and feedbacks
+// and receiving offchain messages of counterparties
+type Service struct {
+	OrganizationId string
+	Repositories   *repository.Repositories
+	Broadcast      saga.Broadcaster
+}
+
+// NewService returns service of configured organization using postgres and blockchain app
+func NewService() *Service {
+	return &Service{
+		OrganizationId: config.Get().OrganizationId,
+		Repositories:   repository.Postgres(),
+		Broadcast:      restutil.BroadcastTransaction,
+	}
+}
+
+// WorkstepResult identifies workstep created by suggestion or feedback
+type WorkstepResult struct {
+	WorkflowId                 string
+	WorkstepId                 string
+	BaseledgerBusinessObjectId string
+	TransactionHash            string
+}